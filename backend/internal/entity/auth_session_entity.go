@@ -0,0 +1,32 @@
+package entity
+
+import "time"
+
+// AuthSession はログインの1回分なのだ (端末ごとに1つできるのだ)
+type AuthSession struct {
+	SessionID  string     `json:"session_id" gorm:"primaryKey;column:session_id;type:text;default:gen_random_uuid()"`
+	UserID     int64      `json:"user_id" gorm:"column:user_id"`
+	UserAgent  string     `json:"user_agent" gorm:"column:user_agent"`
+	IPAddress  string     `json:"ip_address" gorm:"column:ip_address"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"column:created_at;autoCreateTime"`
+	LastUsedAt time.Time  `json:"last_used_at" gorm:"column:last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"column:expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" gorm:"column:revoked_at"`
+}
+
+func (AuthSession) TableName() string {
+	return "auth_sessions"
+}
+
+// RefreshToken はセッションのリフレッシュトークンなのだ (ハッシュだけ保存するのだ)
+type RefreshToken struct {
+	TokenHash string     `json:"-" gorm:"primaryKey;column:token_hash;type:text"`
+	SessionID string     `json:"session_id" gorm:"column:session_id;type:text"`
+	CreatedAt time.Time  `json:"created_at" gorm:"column:created_at;autoCreateTime"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"column:expires_at"`
+	UsedAt    *time.Time `json:"used_at" gorm:"column:used_at"`
+}
+
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
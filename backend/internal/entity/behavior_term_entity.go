@@ -0,0 +1,18 @@
+package entity
+
+import "time"
+
+// BehaviorTerm は観察で使う行動の語彙なのだ (ワークステーションごとに管理者が決めるのだ)
+type BehaviorTerm struct {
+	TermID        string    `json:"term_id" gorm:"primaryKey;column:term_id;type:text;default:gen_random_uuid()"`
+	WorkstationID int64     `json:"workstation_id" gorm:"column:workstation_id"`
+	Term          string    `json:"term" gorm:"column:term"`
+	Category      string    `json:"category" gorm:"column:category"`
+	Description   string    `json:"description" gorm:"column:description"`
+	CreatedAt     time.Time `json:"created_at" gorm:"column:created_at;autoCreateTime"`
+	UpdatedAt     time.Time `json:"updated_at" gorm:"column:updated_at;autoUpdateTime"`
+}
+
+func (BehaviorTerm) TableName() string {
+	return "behavior_terms"
+}
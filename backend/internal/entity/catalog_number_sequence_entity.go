@@ -0,0 +1,19 @@
+package entity
+
+import "time"
+
+// CatalogNumberSequence は登録番号の採番の設定なのだ
+// CollectionID が空文字ならワークステーション全体の既定として使うのだ
+type CatalogNumberSequence struct {
+	SequenceID    string    `json:"sequence_id" gorm:"primaryKey;column:sequence_id;type:text;default:gen_random_uuid()"`
+	WorkstationID int64     `json:"workstation_id" gorm:"column:workstation_id"`
+	CollectionID  string    `json:"collection_id" gorm:"column:collection_id"`
+	Prefix        string    `json:"prefix" gorm:"column:prefix"`
+	Padding       int       `json:"padding" gorm:"column:padding"`
+	NextValue     int64     `json:"next_value" gorm:"column:next_value"`
+	UpdatedAt     time.Time `json:"updated_at" gorm:"column:updated_at;autoUpdateTime"`
+}
+
+func (CatalogNumberSequence) TableName() string {
+	return "catalog_number_sequences"
+}
@@ -3,13 +3,33 @@ package entity
 import "time"
 
 type Identification struct {
-	IdentificationID string    `json:"identification_id" gorm:"primaryKey;column:identification_id;type:text"`
+	IdentificationID string    `json:"identification_id" gorm:"primaryKey;column:identification_id;type:text;default:gen_random_uuid()"`
 	OccurrenceID     string    `json:"occurrence_id" gorm:"column:occurrence_id;type:text"`
 	UserID           int64     `json:"user_id" gorm:"column:user_id"` // Text -> BigInt
 	SourceInfo       string    `json:"source_info" gorm:"column:source_info"`
 	IdentificatedAt  time.Time `json:"identificated_at" gorm:"column:identificated_at"`
+	// 同定した分類 (class_classification と同じ形) と、チェックリストの分類なのだ
+	WorkstationID       int64      `json:"workstation_id" gorm:"column:workstation_id"`
+	ClassClassification string     `json:"class_classification" gorm:"column:class_classification;type:jsonb"`
+	TaxonID             *string    `json:"taxon_id" gorm:"column:taxon_id;type:text"`
+	Note                string     `json:"note" gorm:"column:note"`
+	IsCurrent           bool       `json:"is_current" gorm:"column:is_current"`
+	WithdrawnAt         *time.Time `json:"withdrawn_at" gorm:"column:withdrawn_at"`
+	CreatedAt           time.Time  `json:"created_at" gorm:"column:created_at;autoCreateTime"`
 }
 
 func (Identification) TableName() string {
 	return "identifications"
 }
+
+// IdentificationVote は同定への賛成 (agree = true) / 反対の投票なのだ
+type IdentificationVote struct {
+	IdentificationID string    `json:"identification_id" gorm:"primaryKey;column:identification_id;type:text"`
+	UserID           int64     `json:"user_id" gorm:"primaryKey;column:user_id"`
+	Agree            bool      `json:"agree" gorm:"column:agree"`
+	VotedAt          time.Time `json:"voted_at" gorm:"column:voted_at;autoUpdateTime"`
+}
+
+func (IdentificationVote) TableName() string {
+	return "identification_votes"
+}
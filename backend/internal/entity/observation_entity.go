@@ -3,14 +3,26 @@ package entity
 import "time"
 
 type Observation struct {
-	ObservationID       string    `json:"observation_id" gorm:"primaryKey;column:observation_id;type:text"`
+	ObservationID       string    `json:"observation_id" gorm:"primaryKey;column:observation_id;type:text;default:gen_random_uuid()"`
 	OccurrenceID        string    `json:"occurrence_id" gorm:"column:occurrence_id;type:text"`
 	UserID              int64     `json:"user_id" gorm:"column:user_id"` // Text -> BigInt
-	ObservationMethodID string    `json:"observation_method_id" gorm:"column:observation_method_id;type:text"`
-	Behavior            string    `json:"behavior" gorm:"column:behavior"`
+	ObservationMethodID *string   `json:"observation_method_id" gorm:"column:observation_method_id;type:text"`
+	Behavior            string    `json:"behavior" gorm:"column:behavior"` // 語彙に無い行動の自由記述なのだ
 	ObservedAt          time.Time `json:"observed_at" gorm:"column:observed_at"`
+	WorkstationID       int64     `json:"workstation_id" gorm:"column:workstation_id"`
+	CreatedAt           time.Time `json:"created_at" gorm:"column:created_at;autoCreateTime"`
 }
 
 func (Observation) TableName() string {
 	return "observations"
 }
+
+// ObservationBehavior は観察に付けた行動の語彙なのだ
+type ObservationBehavior struct {
+	ObservationID string `json:"observation_id" gorm:"primaryKey;column:observation_id;type:text"`
+	TermID        string `json:"term_id" gorm:"primaryKey;column:term_id;type:text"`
+}
+
+func (ObservationBehavior) TableName() string {
+	return "observation_behaviors"
+}
@@ -1,11 +1,16 @@
 package entity
 
+import "time"
+
 type ObservationMethod struct {
-	ObservationMethodID string `json:"observation_method_id" gorm:"primaryKey;column:observation_method_id;type:text;default:gen_random_uuid()"`
-	MethodCommonName    string `json:"method_common_name" gorm:"column:method_common_name"`
-	PageID              string `json:"pageid" gorm:"column:pageid;type:text"` // カラム名ママ pageid
-	WorkstationID       int64  `json:"workstation_id" gorm:"column:workstation_id"`
-	UserID              int64  `json:"user_id" gorm:"column:user_id"`
+	ObservationMethodID string    `json:"observation_method_id" gorm:"primaryKey;column:observation_method_id;type:text;default:gen_random_uuid()"`
+	MethodCommonName    string    `json:"method_common_name" gorm:"column:method_common_name"`
+	PageID              *string   `json:"pageid" gorm:"column:pageid;type:text"` // カラム名ママ pageid
+	WorkstationID       int64     `json:"workstation_id" gorm:"column:workstation_id"`
+	UserID              int64     `json:"user_id" gorm:"column:user_id"`
+	Description         string    `json:"description" gorm:"column:description"`
+	CreatedAt           time.Time `json:"created_at" gorm:"column:created_at;autoCreateTime"`
+	UpdatedAt           time.Time `json:"updated_at" gorm:"column:updated_at;autoUpdateTime"`
 }
 
 func (ObservationMethod) TableName() string {
@@ -17,6 +17,15 @@ type Occurrence struct {
 	LanguageID       string    `json:"language_id" gorm:"column:language_id;type:text"` // Integer? 確認要だがschema.sqlではtextだった
 	CreatedAt        time.Time `json:"created_at" gorm:"column:created_at"`
 	Timezone         string    `json:"timezone" gorm:"column:timezone"`
+	// 産地の一般化 (mesh:2 など) と、元の精度で公開してよくなる日時なのだ
+	Sensitivity  *string    `json:"sensitivity" gorm:"column:sensitivity"`
+	EmbargoUntil *time.Time `json:"embargo_until" gorm:"column:embargo_until"`
+	// 同定の合意の結果 (unidentified / needs_id / research) なのだ
+	QualityGrade              string  `json:"quality_grade" gorm:"column:quality_grade;default:unidentified"`
+	ConsensusIdentificationID *string `json:"consensus_identification_id" gorm:"column:consensus_identification_id;type:text"`
+	// 分類名をチェックリストと照らし合わせた結果 (accepted / synonym / doubtful / unknown) と、見つかった分類なのだ
+	NameStatus *string `json:"name_status" gorm:"column:name_status"`
+	TaxonID    *string `json:"taxon_id" gorm:"column:taxon_id;type:text"`
 }
 
 func (Occurrence) TableName() string {
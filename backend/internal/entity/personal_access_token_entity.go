@@ -0,0 +1,31 @@
+package entity
+
+import "time"
+
+// PersonalAccessToken はスクリプトから API を使うための個人アクセストークンなのだ (ハッシュだけ保存するのだ)
+type PersonalAccessToken struct {
+	TokenID     string     `json:"token_id" gorm:"primaryKey;column:token_id;type:text;default:gen_random_uuid()"`
+	UserID      int64      `json:"user_id" gorm:"column:user_id"`
+	Name        string     `json:"name" gorm:"column:name"`
+	TokenHash   string     `json:"-" gorm:"column:token_hash"`
+	TokenPrefix string     `json:"token_prefix" gorm:"column:token_prefix"`
+	Scope       string     `json:"scope" gorm:"column:scope"`
+	CreatedAt   time.Time  `json:"created_at" gorm:"column:created_at;autoCreateTime"`
+	ExpiresAt   time.Time  `json:"expires_at" gorm:"column:expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at" gorm:"column:last_used_at"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty" gorm:"column:revoked_at"`
+}
+
+func (PersonalAccessToken) TableName() string {
+	return "personal_access_tokens"
+}
+
+// PersonalAccessTokenWorkstation はトークンで使えるワークステーションなのだ
+type PersonalAccessTokenWorkstation struct {
+	TokenID       string `json:"token_id" gorm:"primaryKey;column:token_id;type:text"`
+	WorkstationID int64  `json:"workstation_id" gorm:"primaryKey;column:workstation_id"`
+}
+
+func (PersonalAccessTokenWorkstation) TableName() string {
+	return "personal_access_token_workstations"
+}
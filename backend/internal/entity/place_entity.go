@@ -8,6 +8,13 @@ type Place struct {
 	PlaceNameID *string `json:"place_name_id" gorm:"column:place_name_id;type:text"` 
 	Coordinates string  `json:"coordinates" gorm:"column:coordinates;type:jsonb"` // JSONBは一旦stringで受ける
 	Accuracy    float64 `json:"accuracy" gorm:"column:accuracy"`
+	// coordinates から取り出して JGD2011 (≒WGS84) に変換した緯度経度なのだ。geom はDBのトリガーが作るのだ
+	Latitude  *float64 `json:"latitude" gorm:"column:latitude"`
+	Longitude *float64 `json:"longitude" gorm:"column:longitude"`
+	// MeshCode は JIS X 0410 の4分の1地域メッシュコード (10桁) なのだ
+	MeshCode *string `json:"mesh_code" gorm:"column:mesh_code"`
+	// Datum は元の coordinates の測地系 (EPSG コード) なのだ
+	Datum *string `json:"datum" gorm:"column:datum"`
 }
 
 func (Place) TableName() string {
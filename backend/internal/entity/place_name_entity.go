@@ -0,0 +1,22 @@
+package entity
+
+import "time"
+
+// PlaceName は地名辞書の1件なのだ (国 > 都道府県 > 市区町村 > 地点 の階層)
+// 境界ポリゴン (boundary) と代表点 (geom) はDB側の geometry 列なので、ここには持たないのだ
+type PlaceName struct {
+	PlaceNameID    string    `json:"place_name_id" gorm:"primaryKey;column:place_name_id;type:text;default:gen_random_uuid()"`
+	ClassPlaceName string    `json:"class_place_name" gorm:"column:class_place_name;type:jsonb"` // 多言語表記 {"ja": "...", "en": "..."}
+	WorkstationID  int64     `json:"workstation_id" gorm:"column:workstation_id"`
+	ParentID       *string   `json:"parent_id" gorm:"column:parent_id;type:text"`
+	Rank           string    `json:"rank" gorm:"column:rank"`
+	Name           string    `json:"name" gorm:"column:name"`
+	Latitude       *float64  `json:"latitude" gorm:"column:latitude"`
+	Longitude      *float64  `json:"longitude" gorm:"column:longitude"`
+	UserID         int64     `json:"user_id" gorm:"column:user_id"`
+	UpdatedAt      time.Time `json:"updated_at" gorm:"column:updated_at;autoUpdateTime"`
+}
+
+func (PlaceName) TableName() string {
+	return "place_names_json"
+}
@@ -0,0 +1,16 @@
+package entity
+
+import "time"
+
+// RecordCode は occurrence や標本に割り当てた短いコードなのだ
+type RecordCode struct {
+	Code          string    `json:"code" gorm:"primaryKey;column:code"`
+	WorkstationID int64     `json:"workstation_id" gorm:"column:workstation_id"`
+	TargetType    string    `json:"target_type" gorm:"column:target_type"` // occurrence / specimen
+	TargetID      string    `json:"target_id" gorm:"column:target_id"`
+	CreatedAt     time.Time `json:"created_at" gorm:"column:created_at;autoCreateTime"`
+}
+
+func (RecordCode) TableName() string {
+	return "record_codes"
+}
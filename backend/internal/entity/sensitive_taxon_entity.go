@@ -0,0 +1,20 @@
+package entity
+
+import "time"
+
+// SensitiveTaxon は産地を一般化して出す分類群の設定なのだ
+type SensitiveTaxon struct {
+	SensitiveTaxonID string     `json:"sensitive_taxon_id" gorm:"primaryKey;column:sensitive_taxon_id;type:text;default:gen_random_uuid()"`
+	WorkstationID    int64      `json:"workstation_id" gorm:"column:workstation_id"`
+	Rank             string     `json:"rank" gorm:"column:rank"`
+	Name             string     `json:"name" gorm:"column:name"`
+	Generalization   string     `json:"generalization" gorm:"column:generalization"` // mesh:1 / mesh:2 / mesh:3 / grid:<度> / hidden
+	EmbargoUntil     *time.Time `json:"embargo_until" gorm:"column:embargo_until"`
+	Note             string     `json:"note" gorm:"column:note"`
+	UserID           int64      `json:"user_id" gorm:"column:user_id"`
+	UpdatedAt        time.Time  `json:"updated_at" gorm:"column:updated_at;autoUpdateTime"`
+}
+
+func (SensitiveTaxon) TableName() string {
+	return "sensitive_taxa"
+}
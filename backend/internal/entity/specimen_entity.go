@@ -1,11 +1,22 @@
 package entity
 
+import "time"
+
 type Specimen struct {
-	SpecimenID       string `json:"specimen_id" gorm:"primaryKey;column:specimen_id;type:text"`
+	SpecimenID       string `json:"specimen_id" gorm:"primaryKey;column:specimen_id;type:text;default:gen_random_uuid()"`
 	OccurrenceID     string `json:"occurrence_id" gorm:"column:occurrence_id;type:text"`
 	InstitutionID    string `json:"institution_id" gorm:"column:institution_id;type:text"`
 	CollectionID     string `json:"collection_id" gorm:"column:collection_id;type:text"`
 	SpecimenMethodID string `json:"specimen_method_id" gorm:"column:specimen_method_id;type:text"`
+	// 登録番号 (例: "NSMT-I-000123") はワークステーションの中で重複しないのだ
+	WorkstationID int64     `json:"workstation_id" gorm:"column:workstation_id"`
+	CatalogNumber *string   `json:"catalog_number" gorm:"column:catalog_number"`
+	Note          string    `json:"note" gorm:"column:note"`
+	CreatedAt     time.Time `json:"created_at" gorm:"column:created_at;autoCreateTime"`
+	UpdatedAt     time.Time `json:"updated_at" gorm:"column:updated_at;autoUpdateTime"`
+
+	// 今の保管場所なのだ (貸し出し中も元の保管場所のままにするのだ)
+	StorageLocationID *string `json:"storage_location_id" gorm:"column:storage_location_id;type:text"`
 }
 
 func (Specimen) TableName() string {
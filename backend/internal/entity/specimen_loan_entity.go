@@ -0,0 +1,36 @@
+package entity
+
+import "time"
+
+// SpecimenLoan は他の機関への標本の貸し出しなのだ
+// ReturnedAt は含まれる標本がすべて返却されたときに入るのだ
+type SpecimenLoan struct {
+	LoanID              string     `json:"loan_id" gorm:"primaryKey;column:loan_id;type:text;default:gen_random_uuid()"`
+	WorkstationID       int64      `json:"workstation_id" gorm:"column:workstation_id"`
+	BorrowerName        string     `json:"borrower_name" gorm:"column:borrower_name"`
+	BorrowerInstitution string     `json:"borrower_institution" gorm:"column:borrower_institution"`
+	BorrowerEmail       string     `json:"borrower_email" gorm:"column:borrower_email"`
+	Purpose             string     `json:"purpose" gorm:"column:purpose"`
+	LoanedAt            time.Time  `json:"loaned_at" gorm:"column:loaned_at;type:date"`
+	DueDate             *time.Time `json:"due_date" gorm:"column:due_date;type:date"`
+	ReturnedAt          *time.Time `json:"returned_at" gorm:"column:returned_at"`
+	Note                string     `json:"note" gorm:"column:note"`
+	CreatedBy           int64      `json:"created_by" gorm:"column:created_by"`
+	CreatedAt           time.Time  `json:"created_at" gorm:"column:created_at;autoCreateTime"`
+	UpdatedAt           time.Time  `json:"updated_at" gorm:"column:updated_at;autoUpdateTime"`
+}
+
+func (SpecimenLoan) TableName() string {
+	return "specimen_loans"
+}
+
+// SpecimenLoanItem は貸し出しに含まれる標本なのだ (標本ごとに返却できるのだ)
+type SpecimenLoanItem struct {
+	LoanID     string     `json:"loan_id" gorm:"primaryKey;column:loan_id;type:text"`
+	SpecimenID string     `json:"specimen_id" gorm:"primaryKey;column:specimen_id;type:text"`
+	ReturnedAt *time.Time `json:"returned_at" gorm:"column:returned_at"`
+}
+
+func (SpecimenLoanItem) TableName() string {
+	return "specimen_loan_items"
+}
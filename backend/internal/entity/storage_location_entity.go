@@ -0,0 +1,38 @@
+package entity
+
+import "time"
+
+// StorageLocation は標本の保管場所なのだ
+// Kind は building > room > cabinet > drawer の階層で、親は必ず上の階層なのだ
+type StorageLocation struct {
+	LocationID    string    `json:"location_id" gorm:"primaryKey;column:location_id;type:text;default:gen_random_uuid()"`
+	WorkstationID int64     `json:"workstation_id" gorm:"column:workstation_id"`
+	ParentID      *string   `json:"parent_id" gorm:"column:parent_id;type:text"`
+	Kind          string    `json:"kind" gorm:"column:kind"`
+	Name          string    `json:"name" gorm:"column:name"`
+	Note          string    `json:"note" gorm:"column:note"`
+	CreatedAt     time.Time `json:"created_at" gorm:"column:created_at;autoCreateTime"`
+	UpdatedAt     time.Time `json:"updated_at" gorm:"column:updated_at;autoUpdateTime"`
+}
+
+func (StorageLocation) TableName() string {
+	return "storage_locations"
+}
+
+// SpecimenMovement は標本の移動の履歴なのだ (move / loan_out / loan_return)
+type SpecimenMovement struct {
+	MovementID     string    `json:"movement_id" gorm:"primaryKey;column:movement_id;type:text;default:gen_random_uuid()"`
+	SpecimenID     string    `json:"specimen_id" gorm:"column:specimen_id;type:text"`
+	WorkstationID  int64     `json:"workstation_id" gorm:"column:workstation_id"`
+	Kind           string    `json:"kind" gorm:"column:kind"`
+	FromLocationID *string   `json:"from_location_id" gorm:"column:from_location_id;type:text"`
+	ToLocationID   *string   `json:"to_location_id" gorm:"column:to_location_id;type:text"`
+	LoanID         *string   `json:"loan_id" gorm:"column:loan_id;type:text"`
+	Note           string    `json:"note" gorm:"column:note"`
+	MovedBy        int64     `json:"moved_by" gorm:"column:moved_by"`
+	MovedAt        time.Time `json:"moved_at" gorm:"column:moved_at"`
+}
+
+func (SpecimenMovement) TableName() string {
+	return "specimen_movements"
+}
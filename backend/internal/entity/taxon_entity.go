@@ -0,0 +1,27 @@
+package entity
+
+import "time"
+
+// Taxon は分類チェックリストの1件なのだ
+// 異名 (synonym) は AcceptedID に有効名の taxon_id を持つのだ
+type Taxon struct {
+	TaxonID          string    `json:"taxon_id" gorm:"primaryKey;column:taxon_id;type:text;default:gen_random_uuid()"`
+	WorkstationID    int64     `json:"workstation_id" gorm:"column:workstation_id"`
+	SourceID         string    `json:"source_id" gorm:"column:source_id"`
+	ParentSourceID   *string   `json:"-" gorm:"column:parent_source_id"`
+	AcceptedSourceID *string   `json:"-" gorm:"column:accepted_source_id"`
+	ParentID         *string   `json:"parent_id" gorm:"column:parent_id;type:text"`
+	AcceptedID       *string   `json:"accepted_id" gorm:"column:accepted_id;type:text"`
+	Rank             string    `json:"rank" gorm:"column:rank"`
+	ScientificName   string    `json:"scientific_name" gorm:"column:scientific_name"`
+	CanonicalName    string    `json:"canonical_name" gorm:"column:canonical_name"` // 著者名を除いた学名なのだ
+	Authorship       string    `json:"authorship" gorm:"column:authorship"`
+	TaxonomicStatus  string    `json:"taxonomic_status" gorm:"column:taxonomic_status"` // accepted / synonym / doubtful
+	VernacularName   string    `json:"vernacular_name" gorm:"column:vernacular_name"`
+	Classification   string    `json:"classification" gorm:"column:classification;type:jsonb"` // 上位分類 {"kingdom": ..., "family": ...}
+	UpdatedAt        time.Time `json:"updated_at" gorm:"column:updated_at;autoUpdateTime"`
+}
+
+func (Taxon) TableName() string {
+	return "taxa"
+}
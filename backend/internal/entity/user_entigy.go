@@ -10,6 +10,12 @@ type User struct {
 	Password    string    `json:"-" gorm:"column:password"`
 	CreatedAt   time.Time `json:"created_at" gorm:"column:created_at;autoCreateTime"`
 	Timezone    string    `json:"timezone" gorm:"column:timezone"`
+	// EmailVerifiedAt はメールアドレスを確かめた日時なのだ (まだなら null)
+	EmailVerifiedAt *time.Time `json:"email_verified_at" gorm:"column:email_verified_at"`
+	// PreferredLanguageID は languages マスターの言語なのだ (未設定なら null)
+	PreferredLanguageID *int64 `json:"preferred_language_id" gorm:"column:preferred_language_id"`
+	// DeletedAt はアカウントを削除した日時なのだ。削除したユーザーは名前だけ残るのだ
+	DeletedAt *time.Time `json:"deleted_at,omitempty" gorm:"column:deleted_at"`
 }
 
 func (User) TableName() string {
@@ -0,0 +1,42 @@
+package entity
+
+import "time"
+
+// UserIdentity は OpenID Connect の IdP のアカウント (issuer + sub) とユーザーの結び付けなのだ
+type UserIdentity struct {
+	Issuer      string     `json:"issuer" gorm:"primaryKey;column:issuer"`
+	Subject     string     `json:"subject" gorm:"primaryKey;column:subject"`
+	UserID      int64      `json:"user_id" gorm:"column:user_id"`
+	MailAddress string     `json:"mail_address" gorm:"column:mail_address"`
+	CreatedAt   time.Time  `json:"created_at" gorm:"column:created_at;autoCreateTime"`
+	LastLoginAt *time.Time `json:"last_login_at" gorm:"column:last_login_at"`
+}
+
+func (UserIdentity) TableName() string {
+	return "user_identities"
+}
+
+// OIDCLoginState は IdP へ送り出したログインの途中の状態なのだ (state はハッシュだけ保存するのだ)
+type OIDCLoginState struct {
+	StateHash    string    `gorm:"primaryKey;column:state_hash"`
+	Nonce        string    `gorm:"column:nonce"`
+	CodeVerifier string    `gorm:"column:code_verifier"`
+	CreatedAt    time.Time `gorm:"column:created_at;autoCreateTime"`
+	ExpiresAt    time.Time `gorm:"column:expires_at"`
+}
+
+func (OIDCLoginState) TableName() string {
+	return "oidc_login_states"
+}
+
+// OIDCLoginTicket はログイン後にトークンと引き換える使い捨ての券なのだ
+type OIDCLoginTicket struct {
+	TicketHash string    `gorm:"primaryKey;column:ticket_hash"`
+	UserID     int64     `gorm:"column:user_id"`
+	CreatedAt  time.Time `gorm:"column:created_at;autoCreateTime"`
+	ExpiresAt  time.Time `gorm:"column:expires_at"`
+}
+
+func (OIDCLoginTicket) TableName() string {
+	return "oidc_login_tickets"
+}
@@ -0,0 +1,24 @@
+package entity
+
+import "time"
+
+// メールで送るトークンの用途なのだ
+const (
+	MailTokenVerifyEmail   = "verify_email"
+	MailTokenResetPassword = "reset_password"
+)
+
+// UserMailToken はメールで送った1回きりのトークンなのだ (ハッシュだけ保存するのだ)
+type UserMailToken struct {
+	TokenHash   string     `json:"-" gorm:"primaryKey;column:token_hash;type:text"`
+	UserID      int64      `json:"user_id" gorm:"column:user_id"`
+	Purpose     string     `json:"purpose" gorm:"column:purpose"`
+	MailAddress string     `json:"mail_address" gorm:"column:mail_address"`
+	CreatedAt   time.Time  `json:"created_at" gorm:"column:created_at;autoCreateTime"`
+	ExpiresAt   time.Time  `json:"expires_at" gorm:"column:expires_at"`
+	UsedAt      *time.Time `json:"used_at" gorm:"column:used_at"`
+}
+
+func (UserMailToken) TableName() string {
+	return "user_mail_tokens"
+}
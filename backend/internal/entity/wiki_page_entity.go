@@ -10,8 +10,28 @@ type WikiPage struct {
 	UpdatedDate   time.Time `json:"updated_date" gorm:"column:updated_date"`
 	ContentPath   string    `json:"content_path" gorm:"column:content_path"`
 	WorkstationID int64     `json:"workstation_id" gorm:"column:workstation_id"`
+
+	Content  string `json:"content" gorm:"column:content"`   // Markdown の本文なのだ
+	Revision int    `json:"revision" gorm:"column:revision"` // 今の版の番号 (1 から)
 }
 
 func (WikiPage) TableName() string {
 	return "wiki_pages"
 }
+
+// WikiPageRevision は Wiki のページの1つの版なのだ (保存するたびに増えるのだ)
+type WikiPageRevision struct {
+	RevisionID  string    `json:"revision_id" gorm:"primaryKey;column:revision_id;type:text;default:gen_random_uuid()"`
+	PageID      string    `json:"page_id" gorm:"column:page_id;type:text"`
+	Revision    int       `json:"revision" gorm:"column:revision"`
+	Title       string    `json:"title" gorm:"column:title"`
+	Content     string    `json:"content,omitempty" gorm:"column:content"`
+	ContentHTML string    `json:"-" gorm:"column:content_html"`  // 本文を HTML にしたものなのだ (保存したときに作るのだ)
+	Summary     string    `json:"summary" gorm:"column:summary"` // 変更の要約なのだ
+	UserID      int64     `json:"user_id" gorm:"column:user_id"`
+	CreatedAt   time.Time `json:"created_at" gorm:"column:created_at;autoCreateTime"`
+}
+
+func (WikiPageRevision) TableName() string {
+	return "wiki_page_revisions"
+}
@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/service"
+)
+
+type AccountHandler struct {
+	accountService service.AccountService
+}
+
+func NewAccountHandler(accountService service.AccountService) *AccountHandler {
+	return &AccountHandler{accountService: accountService}
+}
+
+// VerifyEmail はメールのリンクのトークンでメールアドレスを確認するのだ (認証不要)
+func (h *AccountHandler) VerifyEmail(c *gin.Context) {
+	var req model.EmailVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.accountService.VerifyEmail(req.Token); err != nil {
+		c.JSON(accountErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ResendVerification は確認のメールを送り直すのだ
+func (h *AccountHandler) ResendVerification(c *gin.Context) {
+	if err := h.accountService.ResendVerification(c.GetString("user_id")); err != nil {
+		c.JSON(accountErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusAccepted)
+}
+
+// ForgotPassword は再設定のメールを送るのだ (認証不要)
+// 登録されているアドレスかどうかが分からないように、いつも 202 を返すのだ
+func (h *AccountHandler) ForgotPassword(c *gin.Context) {
+	var req model.PasswordForgotRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.accountService.RequestPasswordReset(req.MailAddress); err != nil {
+		c.JSON(accountErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusAccepted)
+}
+
+// ResetPassword はメールのリンクのトークンで新しいパスワードにするのだ (認証不要)
+func (h *AccountHandler) ResetPassword(c *gin.Context) {
+	var req model.PasswordResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.accountService.ResetPassword(req.Token, req.Password); err != nil {
+		c.JSON(accountErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ChangePassword は今のパスワードを確かめて新しいパスワードにするのだ (他の端末はログアウトするのだ)
+func (h *AccountHandler) ChangePassword(c *gin.Context) {
+	var req model.PasswordChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	err := h.accountService.ChangePassword(c.GetString("user_id"), c.GetString("session_id"), req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		c.JSON(accountErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// DeleteAccount はパスワード (無いユーザーはログインし直したばかりか) を確かめてアカウントを削除するのだ
+func (h *AccountHandler) DeleteAccount(c *gin.Context) {
+	var req model.AccountDeleteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.accountService.DeleteAccount(c.GetString("user_id"), c.GetString("session_id"), req.Password); err != nil {
+		c.JSON(accountErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func accountErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidMailToken):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrWrongPassword), errors.Is(err, service.ErrReauthenticationRequired):
+		// 401 だとフロントエンドがログアウト扱いにしてしまうので 403 なのだ
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrEmailAlreadyVerified), errors.Is(err, service.ErrLastAdministrator):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrMailTooSoon):
+		return http.StatusTooManyRequests
+	case errors.Is(err, service.ErrCouchDBPasswordUpdate):
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/service"
+)
+
+type APITokenHandler struct {
+	apiTokenService service.APITokenService
+}
+
+func NewAPITokenHandler(apiTokenService service.APITokenService) *APITokenHandler {
+	return &APITokenHandler{apiTokenService: apiTokenService}
+}
+
+// Create は個人アクセストークンを作るのだ。トークンそのものはこのレスポンスでしか返さないのだ
+func (h *APITokenHandler) Create(c *gin.Context) {
+	var req model.APITokenCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	res, err := h.apiTokenService.Create(c.GetString("user_id"), &req)
+	if err != nil {
+		c.JSON(apiTokenErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, res)
+}
+
+func (h *APITokenHandler) List(c *gin.Context) {
+	list, err := h.apiTokenService.List(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(apiTokenErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *APITokenHandler) Revoke(c *gin.Context) {
+	if err := h.apiTokenService.Revoke(c.GetString("user_id"), c.Param("token_id")); err != nil {
+		c.JSON(apiTokenErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func apiTokenErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidAPITokenRequest):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrWorkstationAccessDenied):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrAPITokenNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,211 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/saku-730/web-occurrence/backend/internal/service"
+)
+
+var errCouchDBEncodedResponse = errors.New("圧縮された CouchDB の応答は一般化できません")
+
+// couchDBDeniedSegments はドキュメントの中身を自由な形で返すので、一般化できない CouchDB の API なのだ
+var couchDBDeniedSegments = map[string]bool{
+	"_view":    true,
+	"_list":    true,
+	"_show":    true,
+	"_update":  true,
+	"_rewrite": true,
+}
+
+// couchDBSelectorEndpoints は selector で絞り込める CouchDB の API なのだ
+// place_data で絞り込むと一般化した座標の元の値を探れてしまうのだ
+var couchDBSelectorEndpoints = map[string]bool{
+	"_find":    true,
+	"_changes": true,
+	"_explain": true,
+}
+
+// filterCouchDBRequest はプロキシを通るリクエストを直すのだ
+// 管理者でないメンバーのリクエストは一般化できる形にするのだ。断るときは理由を返すのだ
+func filterCouchDBRequest(req *http.Request, segments []string, filter *service.CouchDocumentFilter) (string, error) {
+	if filter.Redacts() {
+		if reason := redactableCouchDBRequest(req, segments); reason != "" {
+			return reason, nil
+		}
+	}
+	return restoreCouchDBWrite(req, segments, filter)
+}
+
+// redactableCouchDBRequest は応答を一般化できないリクエストを断る理由を返すのだ
+func redactableCouchDBRequest(req *http.Request, segments []string) string {
+	for _, segment := range segments[1:] {
+		if couchDBDeniedSegments[segment] {
+			return "このCouchDBのAPIは管理者しか使えないのだ"
+		}
+	}
+	endpoint := segments[len(segments)-1]
+	query := req.URL.Query()
+	if endpoint == "_changes" && query.Get("include_docs") == "true" {
+		if feed := query.Get("feed"); feed == "continuous" || feed == "eventsource" {
+			return "include_docs 付きの continuous な _changes は管理者しか使えないのだ"
+		}
+	}
+
+	// 応答を書き換えられるように、圧縮しないでそのままの JSON で返してもらうのだ
+	req.Header.Del("Accept-Encoding")
+	if len(segments) == 2 || endpoint == "_bulk_get" {
+		req.Header.Set("Accept", "application/json")
+	}
+	return ""
+}
+
+// restoreCouchDBWrite はドキュメントを書き込むリクエストのボディを RestoreDocument で直すのだ
+func restoreCouchDBWrite(req *http.Request, segments []string, filter *service.CouchDocumentFilter) (string, error) {
+	if req.Method != http.MethodPost && req.Method != http.MethodPut {
+		return "", nil
+	}
+	if !strings.HasPrefix(req.Header.Get("Content-Type"), "application/json") {
+		return "", nil
+	}
+	if req.Header.Get("Content-Encoding") != "" {
+		return "圧縮したリクエストは使えないのだ", nil
+	}
+
+	endpoint := segments[len(segments)-1]
+	switch {
+	case req.Method == http.MethodPost && couchDBSelectorEndpoints[endpoint]:
+		if !filter.Redacts() {
+			return "", nil
+		}
+		return rewriteCouchDBBody(req, func(body map[string]interface{}) (string, error) {
+			for _, key := range []string{"selector", "sort"} {
+				raw, _ := json.Marshal(body[key])
+				if bytes.Contains(raw, []byte("place_data")) {
+					return "管理者でないと place_data では絞り込めないのだ", nil
+				}
+			}
+			// 取り出す項目を絞ると一般化に使う項目が抜けるので、ドキュメント全体を返してもらうのだ
+			delete(body, "fields")
+			return "", nil
+		})
+	case req.Method == http.MethodPost && endpoint == "_bulk_docs":
+		return rewriteCouchDBBody(req, func(body map[string]interface{}) (string, error) {
+			docs, _ := body["docs"].([]interface{})
+			for _, item := range docs {
+				if doc, ok := item.(map[string]interface{}); ok {
+					if err := filter.RestoreDocument(doc); err != nil {
+						return "", err
+					}
+				}
+			}
+			return "", nil
+		})
+	case (req.Method == http.MethodPost && len(segments) == 1) ||
+		(req.Method == http.MethodPut && len(segments) == 2 && !strings.HasPrefix(segments[1], "_")):
+		return rewriteCouchDBBody(req, func(doc map[string]interface{}) (string, error) {
+			return "", filter.RestoreDocument(doc)
+		})
+	}
+	return "", nil
+}
+
+// rewriteCouchDBBody は JSON のリクエストボディを fn で書き換えるのだ
+func rewriteCouchDBBody(req *http.Request, fn func(body map[string]interface{}) (string, error)) (string, error) {
+	raw, err := io.ReadAll(req.Body)
+	if err != nil {
+		return "", err
+	}
+	req.Body.Close()
+
+	var body map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&body); err != nil {
+		// 読めないボディはそのまま CouchDB に断ってもらうのだ
+		setCouchDBBody(req, raw)
+		return "", nil
+	}
+	reason, err := fn(body)
+	if reason != "" || err != nil {
+		return reason, err
+	}
+	rewritten, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+	setCouchDBBody(req, rewritten)
+	return "", nil
+}
+
+func setCouchDBBody(req *http.Request, body []byte) {
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.Header.Set("Content-Length", strconv.Itoa(len(body)))
+}
+
+// redactCouchDBResponse は CouchDB の応答に入っている occurrence の座標を一般化するのだ
+// ドキュメントの GET・_all_docs・_bulk_get・_find・_changes のどれでも、入れ子のドキュメントを探して直すのだ
+func redactCouchDBResponse(filter *service.CouchDocumentFilter) func(resp *http.Response) error {
+	return func(resp *http.Response) error {
+		if resp.Request.Method == http.MethodHead || !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+			return nil
+		}
+		// 流れ続ける _changes は include_docs 無しのときしか通さないので、ドキュメントは入っていないのだ
+		if feed := resp.Request.URL.Query().Get("feed"); feed == "continuous" || feed == "eventsource" {
+			return nil
+		}
+		if resp.Header.Get("Content-Encoding") != "" {
+			return errCouchDBEncodedResponse
+		}
+		raw, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		var body interface{}
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		if err := dec.Decode(&body); err != nil {
+			return fmt.Errorf("CouchDB の応答を読めませんでした: %w", err)
+		}
+		if redactCouchDBDocuments(body, filter) {
+			if raw, err = json.Marshal(body); err != nil {
+				return err
+			}
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(raw))
+		resp.ContentLength = int64(len(raw))
+		resp.Header.Set("Content-Length", strconv.Itoa(len(raw)))
+		return nil
+	}
+}
+
+func redactCouchDBDocuments(value interface{}, filter *service.CouchDocumentFilter) bool {
+	changed := false
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if filter.RedactDocument(v) {
+			return true
+		}
+		for _, child := range v {
+			if redactCouchDBDocuments(child, filter) {
+				changed = true
+			}
+		}
+	case []interface{}:
+		for _, child := range v {
+			if redactCouchDBDocuments(child, filter) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
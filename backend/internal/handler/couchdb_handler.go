@@ -1,13 +1,14 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
-	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/saku-730/web-occurrence/backend/internal/infrastructure"
 	"github.com/saku-730/web-occurrence/backend/internal/service"
 )
 
@@ -73,6 +74,39 @@ func (h *CouchDBHandler) ProxyRequest(c *gin.Context) {
 	// 4. リバースプロキシの作成
 	proxy := httputil.NewSingleHostReverseProxy(target)
 
+	// 権限の確認と転送で同じパスを使うのだ
+	couchPath, escapedPath, err := infrastructure.CouchDBProxyPath(c.Request.URL)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 同定の合意は書き換えさせず、管理者でないメンバーには配慮が必要なレコードの座標を一般化して渡すのだ
+	segments := infrastructure.CouchDBPathSegments(couchPath)
+	filter, err := h.couchDBService.DocumentFilter(userID, segments[0])
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "権限の確認に失敗しました"})
+		return
+	}
+	if filter != nil {
+		reason, err := filterCouchDBRequest(c.Request, segments, filter)
+		if err != nil {
+			if errors.Is(err, service.ErrGeneralizedDocument) {
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "リクエストの確認に失敗しました"})
+			return
+		}
+		if reason != "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": reason})
+			return
+		}
+		if filter.Redacts() {
+			proxy.ModifyResponse = redactCouchDBResponse(filter)
+		}
+	}
+
 	// Director: リクエスト内容を書き換える関数
 	originalDirector := proxy.Director
 	proxy.Director = func(req *http.Request) {
@@ -80,7 +114,7 @@ func (h *CouchDBHandler) ProxyRequest(c *gin.Context) {
 
 		// パスの調整: /api/couchdb プレフィックスを削除して、CouchDBへのパスにする
 		// 例: /api/couchdb/test_db/doc1 -> /test_db/doc1
-		req.URL.Path = strings.TrimPrefix(req.URL.Path, "/api/couchdb")
+		req.URL.Path, req.URL.RawPath = couchPath, escapedPath
 		
 		// 認証ヘッダーの注入 (Proxy Authentication)
 		req.Header.Set("X-Auth-CouchDB-UserName", username)
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/service"
+)
+
+type IdentificationHandler struct {
+	identService service.IdentificationService
+}
+
+func NewIdentificationHandler(identService service.IdentificationService) *IdentificationHandler {
+	return &IdentificationHandler{identService: identService}
+}
+
+func (h *IdentificationHandler) List(c *gin.Context) {
+	res, err := h.identService.List(c.GetString("user_id"), c.Param("occurrence_id"))
+	if err != nil {
+		c.JSON(identificationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *IdentificationHandler) Create(c *gin.Context) {
+	var req model.IdentificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	res, err := h.identService.Create(c.GetString("user_id"), c.Param("occurrence_id"), &req)
+	if err != nil {
+		c.JSON(identificationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, res)
+}
+
+func (h *IdentificationHandler) Withdraw(c *gin.Context) {
+	res, err := h.identService.Withdraw(c.GetString("user_id"), c.Param("occurrence_id"), c.Param("identification_id"))
+	if err != nil {
+		c.JSON(identificationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *IdentificationHandler) Vote(c *gin.Context) {
+	var req model.IdentificationVoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	res, err := h.identService.Vote(c.GetString("user_id"), c.Param("occurrence_id"), c.Param("identification_id"), *req.Agree)
+	if err != nil {
+		c.JSON(identificationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *IdentificationHandler) DeleteVote(c *gin.Context) {
+	res, err := h.identService.DeleteVote(c.GetString("user_id"), c.Param("occurrence_id"), c.Param("identification_id"))
+	if err != nil {
+		c.JSON(identificationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func identificationErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrWorkstationAccessDenied),
+		errors.Is(err, service.ErrWorkstationAdminRequired),
+		errors.Is(err, service.ErrWorkstationEditorRequired):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrOccurrenceNotFound),
+		errors.Is(err, service.ErrIdentificationNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrInvalidIdentification):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/service"
+)
+
+type LabelHandler struct {
+	labelService service.LabelService
+}
+
+func NewLabelHandler(labelService service.LabelService) *LabelHandler {
+	return &LabelHandler{labelService: labelService}
+}
+
+func (h *LabelHandler) Templates(c *gin.Context) {
+	c.JSON(http.StatusOK, h.labelService.Templates())
+}
+
+// Render は選んだ標本のラベルを PDF で返すのだ
+func (h *LabelHandler) Render(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	var req model.LabelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pdf, err := h.labelService.Render(c.GetString("user_id"), wsID, &req)
+	if err != nil {
+		c.JSON(labelErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="labels_%s.pdf"`, time.Now().Format("20060102_150405")))
+	c.Data(http.StatusOK, "application/pdf", pdf)
+}
+
+func labelErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrWorkstationAccessDenied):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrSpecimenNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrInvalidLabelRequest):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
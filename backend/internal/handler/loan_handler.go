@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/service"
+)
+
+type LoanHandler struct {
+	loanService service.LoanService
+}
+
+func NewLoanHandler(loanService service.LoanService) *LoanHandler {
+	return &LoanHandler{loanService: loanService}
+}
+
+// List は貸し出しの一覧なのだ (?status=open|returned|overdue で絞り込めるのだ)
+func (h *LoanHandler) List(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	var q model.LoanSearchQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	list, err := h.loanService.List(c.GetString("user_id"), wsID, &q)
+	if err != nil {
+		c.JSON(loanErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *LoanHandler) Overdue(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+
+	list, err := h.loanService.Overdue(c.GetString("user_id"), wsID)
+	if err != nil {
+		c.JSON(loanErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *LoanHandler) Get(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+
+	loan, err := h.loanService.Get(c.GetString("user_id"), wsID, c.Param("loan_id"))
+	if err != nil {
+		c.JSON(loanErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, loan)
+}
+
+func (h *LoanHandler) Create(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	var req model.LoanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	loan, err := h.loanService.Create(c.GetString("user_id"), wsID, &req)
+	if err != nil {
+		c.JSON(loanErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, loan)
+}
+
+func (h *LoanHandler) Update(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	var req model.LoanUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	loan, err := h.loanService.Update(c.GetString("user_id"), wsID, c.Param("loan_id"), &req)
+	if err != nil {
+		c.JSON(loanErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, loan)
+}
+
+// Return は標本を返却するのだ (一部だけの返却もできるのだ)
+func (h *LoanHandler) Return(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	var req model.LoanReturnRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	loan, err := h.loanService.Return(c.GetString("user_id"), wsID, c.Param("loan_id"), &req)
+	if err != nil {
+		c.JSON(loanErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, loan)
+}
+
+func loanErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrWorkstationAccessDenied):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrLoanNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrSpecimenAlreadyOnLoan):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrInvalidLoan):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
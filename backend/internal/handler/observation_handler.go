@@ -0,0 +1,236 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/service"
+)
+
+type ObservationHandler struct {
+	obsService service.ObservationService
+}
+
+func NewObservationHandler(obsService service.ObservationService) *ObservationHandler {
+	return &ObservationHandler{obsService: obsService}
+}
+
+func (h *ObservationHandler) ListMethods(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+
+	list, err := h.obsService.ListMethods(c.GetString("user_id"), wsID)
+	if err != nil {
+		c.JSON(observationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *ObservationHandler) CreateMethod(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	var req model.ObservationMethodRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	m, err := h.obsService.CreateMethod(c.GetString("user_id"), wsID, &req)
+	if err != nil {
+		c.JSON(observationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, m)
+}
+
+func (h *ObservationHandler) UpdateMethod(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	var req model.ObservationMethodRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	m, err := h.obsService.UpdateMethod(c.GetString("user_id"), wsID, c.Param("method_id"), &req)
+	if err != nil {
+		c.JSON(observationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, m)
+}
+
+func (h *ObservationHandler) DeleteMethod(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.obsService.DeleteMethod(c.GetString("user_id"), wsID, c.Param("method_id")); err != nil {
+		c.JSON(observationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *ObservationHandler) ListTerms(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+
+	list, err := h.obsService.ListTerms(c.GetString("user_id"), wsID)
+	if err != nil {
+		c.JSON(observationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *ObservationHandler) CreateTerm(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	var req model.BehaviorTermRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	t, err := h.obsService.CreateTerm(c.GetString("user_id"), wsID, &req)
+	if err != nil {
+		c.JSON(observationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, t)
+}
+
+func (h *ObservationHandler) UpdateTerm(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	var req model.BehaviorTermRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	t, err := h.obsService.UpdateTerm(c.GetString("user_id"), wsID, c.Param("term_id"), &req)
+	if err != nil {
+		c.JSON(observationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, t)
+}
+
+func (h *ObservationHandler) DeleteTerm(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.obsService.DeleteTerm(c.GetString("user_id"), wsID, c.Param("term_id")); err != nil {
+		c.JSON(observationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Search はワークステーションの観察記録を手法・行動・観察日時で絞り込むのだ
+func (h *ObservationHandler) Search(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	var q model.ObservationSearchQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	list, err := h.obsService.Search(c.GetString("user_id"), wsID, &q)
+	if err != nil {
+		c.JSON(observationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *ObservationHandler) List(c *gin.Context) {
+	list, err := h.obsService.List(c.GetString("user_id"), c.Param("occurrence_id"))
+	if err != nil {
+		c.JSON(observationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *ObservationHandler) Create(c *gin.Context) {
+	var req model.ObservationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	obs, err := h.obsService.Create(c.GetString("user_id"), c.Param("occurrence_id"), &req)
+	if err != nil {
+		c.JSON(observationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, obs)
+}
+
+func (h *ObservationHandler) Update(c *gin.Context) {
+	var req model.ObservationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	obs, err := h.obsService.Update(c.GetString("user_id"), c.Param("occurrence_id"), c.Param("observation_id"), &req)
+	if err != nil {
+		c.JSON(observationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, obs)
+}
+
+func (h *ObservationHandler) Delete(c *gin.Context) {
+	if err := h.obsService.Delete(c.GetString("user_id"), c.Param("occurrence_id"), c.Param("observation_id")); err != nil {
+		c.JSON(observationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func observationErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrWorkstationAccessDenied),
+		errors.Is(err, service.ErrWorkstationAdminRequired),
+		errors.Is(err, service.ErrObservationEditDenied):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrInvalidObservation):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrOccurrenceNotFound),
+		errors.Is(err, service.ErrObservationNotFound),
+		errors.Is(err, service.ErrObservationMethodNotFound),
+		errors.Is(err, service.ErrBehaviorTermNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrVocabularyConflict),
+		errors.Is(err, service.ErrVocabularyInUse):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/service"
+)
+
+type OccurrenceHandler struct {
+	occService    service.OccurrenceService
+	exportService service.ExportService
+}
+
+func NewOccurrenceHandler(occService service.OccurrenceService, exportService service.ExportService) *OccurrenceHandler {
+	return &OccurrenceHandler{
+		occService:    occService,
+		exportService: exportService,
+	}
+}
+
+// Search は occurrence の検索APIなのだ
+func (h *OccurrenceHandler) Search(c *gin.Context) {
+	var q model.OccurrenceSearchQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	res, err := h.occService.Search(c.GetString("user_id"), &q)
+	if err != nil {
+		c.JSON(occurrenceErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// MeshAggregate は地域メッシュごとの種別件数を返すのだ（分布図用）
+func (h *OccurrenceHandler) MeshAggregate(c *gin.Context) {
+	var req model.MeshAggregateRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	res, err := h.occService.AggregateByMesh(c.GetString("user_id"), &req)
+	if err != nil {
+		c.JSON(occurrenceErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// TaxonRollup は絞り込んだ分類の1つ下の階級ごとの件数を返すのだ
+func (h *OccurrenceHandler) TaxonRollup(c *gin.Context) {
+	var req model.TaxonRollupRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	res, err := h.occService.RollupByTaxon(c.GetString("user_id"), &req)
+	if err != nil {
+		c.JSON(occurrenceErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// Export は検索結果を CSV / xlsx でダウンロードさせるのだ
+// 1行ずつ書き出すので、件数が多くてもメモリに全部載せないのだ
+func (h *OccurrenceHandler) Export(c *gin.Context) {
+	var req model.OccurrenceExportRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	export, err := h.exportService.NewOccurrenceExport(c.GetString("user_id"), &req)
+	if err != nil {
+		c.JSON(occurrenceErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", export.ContentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, export.FileName))
+	c.Status(http.StatusOK)
+
+	if err := export.Write(c.Writer); err != nil {
+		// ヘッダーは送信済みなので、ログに残して接続を切るしかないのだ
+		fmt.Printf("[OccurrenceHandler] Export failed: %v\n", err)
+		c.Abort()
+	}
+}
+
+// occurrenceErrorStatus はサービスのエラーをHTTPステータスに変換するのだ
+func occurrenceErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrWorkstationAccessDenied):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrInvalidSearchQuery),
+		errors.Is(err, service.ErrInvalidExportFormat),
+		errors.Is(err, service.ErrInvalidExportColumn):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/service"
+)
+
+// OGCHandler は OGC API - Features のエンドポイントなのだ
+type OGCHandler struct {
+	ogcService service.OGCFeatureService
+	publicURL  string
+}
+
+// publicURL はリンクに書くこのサーバーの公開 URL (例: https://example.org) なのだ
+// 空ならリクエストの Host から組み立てるのだ (X-Forwarded-* は誰でも付けられるので見ないのだ)
+func NewOGCHandler(s service.OGCFeatureService, publicURL string) *OGCHandler {
+	return &OGCHandler{ogcService: s, publicURL: strings.TrimRight(publicURL, "/")}
+}
+
+func (h *OGCHandler) LandingPage(c *gin.Context) {
+	c.JSON(http.StatusOK, h.ogcService.LandingPage(h.baseURL(c)))
+}
+
+func (h *OGCHandler) Conformance(c *gin.Context) {
+	c.JSON(http.StatusOK, h.ogcService.Conformance())
+}
+
+func (h *OGCHandler) Collections(c *gin.Context) {
+	res, err := h.ogcService.Collections(c.GetString("user_id"), h.baseURL(c))
+	if err != nil {
+		ogcError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *OGCHandler) Collection(c *gin.Context) {
+	res, err := h.ogcService.Collection(c.GetString("user_id"), c.Param("collection_id"), h.baseURL(c))
+	if err != nil {
+		ogcError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *OGCHandler) Items(c *gin.Context) {
+	var req model.OGCItemsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "InvalidParameterValue", "description": err.Error()})
+		return
+	}
+
+	res, err := h.ogcService.Items(c.GetString("user_id"), c.Param("collection_id"), &req, h.baseURL(c), c.Request.URL.Query())
+	if err != nil {
+		ogcError(c, err)
+		return
+	}
+	c.Header("Content-Type", "application/geo+json")
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *OGCHandler) Item(c *gin.Context) {
+	res, err := h.ogcService.Item(c.GetString("user_id"), c.Param("collection_id"), c.Param("feature_id"), h.baseURL(c))
+	if err != nil {
+		ogcError(c, err)
+		return
+	}
+	c.Header("Content-Type", "application/geo+json")
+	c.JSON(http.StatusOK, res)
+}
+
+// baseURL はリンク生成用に、このAPIのベースURLを組み立てるのだ
+func (h *OGCHandler) baseURL(c *gin.Context) string {
+	if h.publicURL != "" {
+		return h.publicURL + "/api/ogc"
+	}
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host + "/api/ogc"
+}
+
+// ogcError は OGC API の例外形式 (code / description) でエラーを返すのだ
+func ogcError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrOGCNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"code": "NotFound", "description": err.Error()})
+	case errors.Is(err, service.ErrWorkstationAccessDenied):
+		c.JSON(http.StatusForbidden, gin.H{"code": "Forbidden", "description": err.Error()})
+	case errors.Is(err, service.ErrInvalidSearchQuery):
+		c.JSON(http.StatusBadRequest, gin.H{"code": "InvalidParameterValue", "description": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "ServerError", "description": err.Error()})
+	}
+}
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saku-730/web-occurrence/backend/internal/infrastructure"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/service"
+)
+
+const (
+	// oidcStateCookie はログインを始めたブラウザに持たせる state (のハッシュ) の Cookie なのだ
+	// 他人が始めたログインの戻り先 URL を踏まされても、Cookie が合わないので断れるのだ (ログイン CSRF 対策)
+	oidcStateCookie     = "oidc_state"
+	oidcStateCookiePath = "/api/oidc"
+	// oidcStateCookieMaxAge は IdP から戻ってくるまでの待ち時間 (秒) なのだ (oidcStateTTL と同じなのだ)
+	oidcStateCookieMaxAge = 10 * 60
+)
+
+type OIDCHandler struct {
+	oidcService service.OIDCService
+}
+
+func NewOIDCHandler(oidcService service.OIDCService) *OIDCHandler {
+	return &OIDCHandler{oidcService: oidcService}
+}
+
+// Config はログイン画面に IdP のボタンを出すかどうかを返すのだ (認証不要)
+func (h *OIDCHandler) Config(c *gin.Context) {
+	c.JSON(http.StatusOK, h.oidcService.Config())
+}
+
+// Login は IdP のログイン画面へリダイレクトするのだ (認証不要)
+func (h *OIDCHandler) Login(c *gin.Context) {
+	authURL, state, err := h.oidcService.BeginLogin()
+	if err != nil {
+		log.Printf("OIDC login error: %v", err)
+		c.Redirect(http.StatusFound, h.oidcService.FrontendCallbackURL(url.Values{"error": {oidcErrorCode(err)}}))
+		return
+	}
+	// IdP からのリダイレクト (トップレベルの GET) でも送られるように Lax にするのだ
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, infrastructure.HashSecretToken(state), oidcStateCookieMaxAge, oidcStateCookiePath, "", isSecureRequest(c), true)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback は IdP から戻ってきたところなのだ (認証不要)
+// トークンは URL に載せずに、使い捨ての券を付けてフロントエンドへ送るのだ
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	// state の Cookie は1回きりなので、ここで消すのだ
+	cookie, _ := c.Cookie(oidcStateCookie)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, "", -1, oidcStateCookiePath, "", isSecureRequest(c), true)
+
+	if idpErr := c.Query("error"); idpErr != "" {
+		// IdP の画面でキャンセルしたときなどなのだ
+		log.Printf("OIDC callback error from IdP: %s %s", idpErr, c.Query("error_description"))
+		c.Redirect(http.StatusFound, h.oidcService.FrontendCallbackURL(url.Values{"error": {"denied"}}))
+		return
+	}
+	// このブラウザで始めたログインでなければ、state を使わずに断るのだ
+	state := c.Query("state")
+	if cookie == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(infrastructure.HashSecretToken(state))) != 1 {
+		log.Printf("OIDC callback error: state cookie mismatch")
+		c.Redirect(http.StatusFound, h.oidcService.FrontendCallbackURL(url.Values{"error": {oidcErrorCode(service.ErrInvalidOIDCState)}}))
+		return
+	}
+	ticket, err := h.oidcService.CompleteLogin(c.Query("code"), state)
+	if err != nil {
+		log.Printf("OIDC callback error: %v", err)
+		c.Redirect(http.StatusFound, h.oidcService.FrontendCallbackURL(url.Values{"error": {oidcErrorCode(err)}}))
+		return
+	}
+	c.Redirect(http.StatusFound, h.oidcService.FrontendCallbackURL(url.Values{"ticket": {ticket}}))
+}
+
+// Exchange は券をアクセストークンとリフレッシュトークンに引き換えるのだ (認証不要)
+func (h *OIDCHandler) Exchange(c *gin.Context) {
+	var req model.OIDCExchangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	res, err := h.oidcService.ExchangeTicket(req.Ticket, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		c.JSON(oidcErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// isSecureRequest は HTTPS で来たリクエストかを調べるのだ (リバースプロキシの後ろでも分かるようにするのだ)
+func isSecureRequest(c *gin.Context) bool {
+	return c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+}
+
+func oidcErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidOIDCTicket):
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// oidcErrorCode はフロントエンドに渡すエラーの種類なのだ (メッセージはフロントエンドが出すのだ)
+func oidcErrorCode(err error) string {
+	switch {
+	case errors.Is(err, service.ErrOIDCDisabled):
+		return "disabled"
+	case errors.Is(err, service.ErrInvalidOIDCState):
+		return "expired"
+	case errors.Is(err, service.ErrOIDCEmailRequired):
+		return "email_required"
+	case errors.Is(err, service.ErrOIDCEmailInUse):
+		return "email_in_use"
+	case errors.Is(err, service.ErrOIDCProvider):
+		return "provider"
+	default:
+		return "server"
+	}
+}
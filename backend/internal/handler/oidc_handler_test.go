@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/service"
+)
+
+// fakeOIDCService は state を1つだけ発行するのだ
+type fakeOIDCService struct {
+	service.OIDCService
+	completed []string
+}
+
+func (s *fakeOIDCService) BeginLogin() (string, string, error) {
+	return "https://idp.example.ac.jp/authorize?state=state-1", "state-1", nil
+}
+
+func (s *fakeOIDCService) CompleteLogin(code, state string) (string, error) {
+	s.completed = append(s.completed, state)
+	return "ticket-1", nil
+}
+
+func (s *fakeOIDCService) FrontendCallbackURL(query url.Values) string {
+	return "http://localhost:3000/login/oidc?" + query.Encode()
+}
+
+func (s *fakeOIDCService) Config() *model.OIDCConfigResponse {
+	return &model.OIDCConfigResponse{Enabled: true}
+}
+
+func newOIDCTestRouter(s service.OIDCService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	h := NewOIDCHandler(s)
+	r.GET("/api/oidc/login", h.Login)
+	r.GET("/api/oidc/callback", h.Callback)
+	return r
+}
+
+func TestOIDCCallbackRequiresStateCookie(t *testing.T) {
+	s := &fakeOIDCService{}
+	r := newOIDCTestRouter(s)
+
+	login := httptest.NewRecorder()
+	r.ServeHTTP(login, httptest.NewRequest(http.MethodGet, "/api/oidc/login", nil))
+	if login.Code != http.StatusFound {
+		t.Fatalf("login status = %d", login.Code)
+	}
+	var stateCookie *http.Cookie
+	for _, c := range login.Result().Cookies() {
+		if c.Name == oidcStateCookie {
+			stateCookie = c
+		}
+	}
+	if stateCookie == nil || !stateCookie.HttpOnly || stateCookie.SameSite != http.SameSiteLaxMode || stateCookie.Value == "state-1" {
+		t.Fatalf("state cookie = %+v", stateCookie)
+	}
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+		want   string
+	}{
+		// 他人が始めたログインの戻り先 URL を踏まされたときなのだ
+		{"no cookie", nil, "error=expired"},
+		{"other login", &http.Cookie{Name: oidcStateCookie, Value: "other"}, "error=expired"},
+		{"same browser", stateCookie, "ticket=ticket-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.completed = nil
+			req := httptest.NewRequest(http.MethodGet, "/api/oidc/callback?code=code&state=state-1", nil)
+			if tt.cookie != nil {
+				req.AddCookie(&http.Cookie{Name: tt.cookie.Name, Value: tt.cookie.Value})
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			location := w.Header().Get("Location")
+			if w.Code != http.StatusFound || location != "http://localhost:3000/login/oidc?"+tt.want {
+				t.Fatalf("callback = %d %s, want redirect with %s", w.Code, location, tt.want)
+			}
+			if wantCompleted := tt.want == "ticket=ticket-1"; (len(s.completed) == 1) != wantCompleted {
+				t.Fatalf("CompleteLogin calls = %v", s.completed)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/service"
+)
+
+type PlaceNameHandler struct {
+	pnService service.PlaceNameService
+}
+
+func NewPlaceNameHandler(pnService service.PlaceNameService) *PlaceNameHandler {
+	return &PlaceNameHandler{pnService: pnService}
+}
+
+// List は地名の一覧を返すのだ。?q= を付けるとあいまい検索になるのだ
+func (h *PlaceNameHandler) List(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	var q model.PlaceNameSearchQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	list, err := h.pnService.List(c.GetString("user_id"), wsID, &q)
+	if err != nil {
+		c.JSON(placeNameErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// Suggest は座標 (?lat=&lon=) から地名の候補を返すのだ
+func (h *PlaceNameHandler) Suggest(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	var q model.PlaceNameSuggestQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	list, err := h.pnService.Suggest(c.GetString("user_id"), wsID, &q)
+	if err != nil {
+		c.JSON(placeNameErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *PlaceNameHandler) Get(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+
+	pn, err := h.pnService.Get(c.GetString("user_id"), wsID, c.Param("place_name_id"))
+	if err != nil {
+		c.JSON(placeNameErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, pn)
+}
+
+func (h *PlaceNameHandler) Create(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	var req model.PlaceNameRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pn, err := h.pnService.Create(c.GetString("user_id"), wsID, &req)
+	if err != nil {
+		c.JSON(placeNameErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, pn)
+}
+
+func (h *PlaceNameHandler) Update(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	var req model.PlaceNameRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pn, err := h.pnService.Update(c.GetString("user_id"), wsID, c.Param("place_name_id"), &req)
+	if err != nil {
+		c.JSON(placeNameErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, pn)
+}
+
+func (h *PlaceNameHandler) Delete(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.pnService.Delete(c.GetString("user_id"), wsID, c.Param("place_name_id")); err != nil {
+		c.JSON(placeNameErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// workstationIDParam はパスの :workstation_id を読むのだ。不正なら 400 を返して false なのだ
+func workstationIDParam(c *gin.Context) (int64, bool) {
+	wsID, err := strconv.ParseInt(c.Param("workstation_id"), 10, 64)
+	if err != nil || wsID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "workstation_id が正しくありません"})
+		return 0, false
+	}
+	return wsID, true
+}
+
+func placeNameErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrWorkstationAccessDenied):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrPlaceNameNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrPlaceNameInUse):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrInvalidPlaceName):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
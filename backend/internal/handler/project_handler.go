@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/service"
+)
+
+type ProjectHandler struct {
+	projectService service.ProjectService
+	occService     service.OccurrenceService
+}
+
+func NewProjectHandler(projectService service.ProjectService, occService service.OccurrenceService) *ProjectHandler {
+	return &ProjectHandler{
+		projectService: projectService,
+		occService:     occService,
+	}
+}
+
+func (h *ProjectHandler) List(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+
+	list, err := h.projectService.List(c.GetString("user_id"), wsID)
+	if err != nil {
+		c.JSON(projectErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *ProjectHandler) Get(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+
+	p, err := h.projectService.Get(c.GetString("user_id"), wsID, c.Param("project_id"))
+	if err != nil {
+		c.JSON(projectErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+func (h *ProjectHandler) Create(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	var req model.ProjectRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	p, err := h.projectService.Create(c.GetString("user_id"), wsID, &req)
+	if err != nil {
+		c.JSON(projectErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, p)
+}
+
+func (h *ProjectHandler) Update(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	var req model.ProjectRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	p, err := h.projectService.Update(c.GetString("user_id"), wsID, c.Param("project_id"), &req)
+	if err != nil {
+		c.JSON(projectErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+func (h *ProjectHandler) Delete(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.projectService.Delete(c.GetString("user_id"), wsID, c.Param("project_id")); err != nil {
+		c.JSON(projectErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// SaveMember はメンバーを追加するか、参加日・終了日を更新するのだ
+func (h *ProjectHandler) SaveMember(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	memberID, ok := memberUserIDParam(c)
+	if !ok {
+		return
+	}
+	var req model.ProjectMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	p, err := h.projectService.SaveMember(c.GetString("user_id"), wsID, c.Param("project_id"), memberID, &req)
+	if err != nil {
+		c.JSON(projectErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+func (h *ProjectHandler) RemoveMember(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	memberID, ok := memberUserIDParam(c)
+	if !ok {
+		return
+	}
+
+	p, err := h.projectService.RemoveMember(c.GetString("user_id"), wsID, c.Param("project_id"), memberID)
+	if err != nil {
+		c.JSON(projectErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+// Occurrences はプロジェクトの occurrence を /search と同じ条件で検索するのだ
+func (h *ProjectHandler) Occurrences(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	var q model.OccurrenceSearchQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetString("user_id")
+	p, err := h.projectService.Get(userID, wsID, c.Param("project_id"))
+	if err != nil {
+		c.JSON(projectErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	q.WorkstationID = wsID
+	q.ProjectID = p.ProjectID
+
+	res, err := h.occService.Search(userID, &q)
+	if err != nil {
+		c.JSON(occurrenceErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func memberUserIDParam(c *gin.Context) (int64, bool) {
+	userID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil || userID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id が正しくありません"})
+		return 0, false
+	}
+	return userID, true
+}
+
+func projectErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrWorkstationAccessDenied),
+		errors.Is(err, service.ErrProjectEditDenied):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrProjectNotFound),
+		errors.Is(err, service.ErrProjectMemberNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrProjectInUse):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrInvalidProject):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
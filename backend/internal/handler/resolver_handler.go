@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/service"
+)
+
+type ResolverHandler struct {
+	resolverService service.ResolverService
+}
+
+func NewResolverHandler(resolverService service.ResolverService) *ResolverHandler {
+	return &ResolverHandler{resolverService: resolverService}
+}
+
+// Resolve は読み取った文字列 (?payload=...) からレコードを探すのだ
+// redirect=true ならレコードの画面 (フロントエンド) に 303 でリダイレクトするのだ
+func (h *ResolverHandler) Resolve(c *gin.Context) {
+	var q model.ResolveQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rec, err := h.resolverService.Resolve(c.GetString("user_id"), q.Payload)
+	if err != nil {
+		c.JSON(resolverErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if q.Redirect {
+		c.Redirect(http.StatusSeeOther, rec.PageURL)
+		return
+	}
+	c.JSON(http.StatusOK, rec)
+}
+
+func (h *ResolverHandler) OccurrenceCode(c *gin.Context) {
+	rc, err := h.resolverService.OccurrenceCode(c.GetString("user_id"), c.Param("occurrence_id"))
+	if err != nil {
+		c.JSON(resolverErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rc)
+}
+
+func (h *ResolverHandler) SpecimenCode(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+
+	rc, err := h.resolverService.SpecimenCode(c.GetString("user_id"), wsID, c.Param("specimen_id"))
+	if err != nil {
+		c.JSON(resolverErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rc)
+}
+
+func resolverErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrWorkstationAccessDenied):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrRecordNotFound),
+		errors.Is(err, service.ErrOccurrenceNotFound),
+		errors.Is(err, service.ErrSpecimenNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrAmbiguousRecord):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/service"
+)
+
+type SensitiveTaxonHandler struct {
+	stService service.SensitiveTaxonService
+}
+
+func NewSensitiveTaxonHandler(stService service.SensitiveTaxonService) *SensitiveTaxonHandler {
+	return &SensitiveTaxonHandler{stService: stService}
+}
+
+func (h *SensitiveTaxonHandler) List(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+
+	list, err := h.stService.List(c.GetString("user_id"), wsID)
+	if err != nil {
+		c.JSON(sensitiveTaxonErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *SensitiveTaxonHandler) Create(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	var req model.SensitiveTaxonRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	st, err := h.stService.Create(c.GetString("user_id"), wsID, &req)
+	if err != nil {
+		c.JSON(sensitiveTaxonErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, st)
+}
+
+func (h *SensitiveTaxonHandler) Update(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	var req model.SensitiveTaxonRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	st, err := h.stService.Update(c.GetString("user_id"), wsID, c.Param("sensitive_taxon_id"), &req)
+	if err != nil {
+		c.JSON(sensitiveTaxonErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, st)
+}
+
+func (h *SensitiveTaxonHandler) Delete(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.stService.Delete(c.GetString("user_id"), wsID, c.Param("sensitive_taxon_id")); err != nil {
+		c.JSON(sensitiveTaxonErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func sensitiveTaxonErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrWorkstationAccessDenied),
+		errors.Is(err, service.ErrWorkstationAdminRequired):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrSensitiveTaxonNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrInvalidGeneralization):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/service"
+)
+
+type SessionHandler struct {
+	sessionService service.SessionService
+}
+
+func NewSessionHandler(sessionService service.SessionService) *SessionHandler {
+	return &SessionHandler{sessionService: sessionService}
+}
+
+// Refresh はリフレッシュトークンでアクセストークンを取り直すのだ (認証不要)
+func (h *SessionHandler) Refresh(c *gin.Context) {
+	var req model.TokenRefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	res, err := h.sessionService.Refresh(req.RefreshToken, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		c.JSON(sessionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// Logout はこのリクエストのセッションを取り消すのだ
+func (h *SessionHandler) Logout(c *gin.Context) {
+	if err := h.sessionService.Revoke(c.GetString("user_id"), c.GetString("session_id")); err != nil {
+		c.JSON(sessionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// LogoutAll はすべての端末のセッションを取り消すのだ (?keep_current=true ならこの端末は残すのだ)
+func (h *SessionHandler) LogoutAll(c *gin.Context) {
+	except := ""
+	if c.Query("keep_current") == "true" {
+		except = c.GetString("session_id")
+	}
+	if err := h.sessionService.RevokeAll(c.GetString("user_id"), except); err != nil {
+		c.JSON(sessionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *SessionHandler) List(c *gin.Context) {
+	list, err := h.sessionService.List(c.GetString("user_id"), c.GetString("session_id"))
+	if err != nil {
+		c.JSON(sessionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *SessionHandler) Revoke(c *gin.Context) {
+	if err := h.sessionService.Revoke(c.GetString("user_id"), c.Param("session_id")); err != nil {
+		c.JSON(sessionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func sessionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidRefreshToken):
+		return http.StatusUnauthorized
+	case errors.Is(err, service.ErrSessionNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
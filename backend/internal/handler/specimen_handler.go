@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/service"
+)
+
+type SpecimenHandler struct {
+	specimenService service.SpecimenService
+}
+
+func NewSpecimenHandler(specimenService service.SpecimenService) *SpecimenHandler {
+	return &SpecimenHandler{specimenService: specimenService}
+}
+
+func (h *SpecimenHandler) List(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	var q model.SpecimenSearchQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	list, err := h.specimenService.List(c.GetString("user_id"), wsID, &q)
+	if err != nil {
+		c.JSON(specimenErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// Lookup は登録番号 (?catalog_number=...) で標本を引くのだ
+func (h *SpecimenHandler) Lookup(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	var q model.SpecimenLookupQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sp, err := h.specimenService.FindByCatalogNumber(c.GetString("user_id"), wsID, q.CatalogNumber)
+	if err != nil {
+		c.JSON(specimenErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, sp)
+}
+
+func (h *SpecimenHandler) Get(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+
+	sp, err := h.specimenService.Get(c.GetString("user_id"), wsID, c.Param("specimen_id"))
+	if err != nil {
+		c.JSON(specimenErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, sp)
+}
+
+func (h *SpecimenHandler) Create(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	var req model.SpecimenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sp, err := h.specimenService.Create(c.GetString("user_id"), wsID, &req)
+	if err != nil {
+		c.JSON(specimenErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, sp)
+}
+
+func (h *SpecimenHandler) Update(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	var req model.SpecimenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sp, err := h.specimenService.Update(c.GetString("user_id"), wsID, c.Param("specimen_id"), &req)
+	if err != nil {
+		c.JSON(specimenErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, sp)
+}
+
+func (h *SpecimenHandler) Delete(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.specimenService.Delete(c.GetString("user_id"), wsID, c.Param("specimen_id")); err != nil {
+		c.JSON(specimenErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *SpecimenHandler) ListSequences(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+
+	list, err := h.specimenService.ListSequences(c.GetString("user_id"), wsID)
+	if err != nil {
+		c.JSON(specimenErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *SpecimenHandler) SaveSequence(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	var req model.CatalogNumberSequenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	seq, err := h.specimenService.SaveSequence(c.GetString("user_id"), wsID, &req)
+	if err != nil {
+		c.JSON(specimenErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, seq)
+}
+
+func specimenErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrWorkstationAccessDenied),
+		errors.Is(err, service.ErrWorkstationAdminRequired):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrSpecimenNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrCatalogNumberConflict):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrInvalidSpecimen):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/service"
+)
+
+type StorageHandler struct {
+	storageService service.StorageService
+}
+
+func NewStorageHandler(storageService service.StorageService) *StorageHandler {
+	return &StorageHandler{storageService: storageService}
+}
+
+func (h *StorageHandler) ListLocations(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+
+	list, err := h.storageService.ListLocations(c.GetString("user_id"), wsID)
+	if err != nil {
+		c.JSON(storageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *StorageHandler) CreateLocation(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	var req model.StorageLocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	loc, err := h.storageService.CreateLocation(c.GetString("user_id"), wsID, &req)
+	if err != nil {
+		c.JSON(storageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, loc)
+}
+
+func (h *StorageHandler) UpdateLocation(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	var req model.StorageLocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	loc, err := h.storageService.UpdateLocation(c.GetString("user_id"), wsID, c.Param("location_id"), &req)
+	if err != nil {
+		c.JSON(storageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, loc)
+}
+
+func (h *StorageHandler) DeleteLocation(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.storageService.DeleteLocation(c.GetString("user_id"), wsID, c.Param("location_id")); err != nil {
+		c.JSON(storageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// MoveSpecimen は標本を別の保管場所に移すのだ
+func (h *StorageHandler) MoveSpecimen(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	var req model.SpecimenMoveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	mv, err := h.storageService.MoveSpecimen(c.GetString("user_id"), wsID, c.Param("specimen_id"), &req)
+	if err != nil {
+		c.JSON(storageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, mv)
+}
+
+func (h *StorageHandler) ListMovements(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+
+	list, err := h.storageService.ListMovements(c.GetString("user_id"), wsID, c.Param("specimen_id"))
+	if err != nil {
+		c.JSON(storageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func storageErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrWorkstationAccessDenied),
+		errors.Is(err, service.ErrWorkstationAdminRequired):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrStorageLocationNotFound),
+		errors.Is(err, service.ErrSpecimenNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrStorageLocationConflict),
+		errors.Is(err, service.ErrStorageLocationInUse):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrInvalidStorageLocation):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/service"
+)
+
+type TaxonHandler struct {
+	taxonService service.TaxonService
+}
+
+func NewTaxonHandler(taxonService service.TaxonService) *TaxonHandler {
+	return &TaxonHandler{taxonService: taxonService}
+}
+
+// Search は学名・和名の補完候補を返すのだ (?q=&rank=)
+func (h *TaxonHandler) Search(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	var q model.TaxonSearchQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	list, err := h.taxonService.Search(c.GetString("user_id"), wsID, &q)
+	if err != nil {
+		c.JSON(taxonErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// Validate は名前がチェックリストにあるかを調べるのだ (?rank=&name=)
+func (h *TaxonHandler) Validate(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	var q model.TaxonValidationQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	res, err := h.taxonService.Validate(c.GetString("user_id"), wsID, &q)
+	if err != nil {
+		c.JSON(taxonErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *TaxonHandler) Get(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+
+	res, err := h.taxonService.Get(c.GetString("user_id"), wsID, c.Param("taxon_id"))
+	if err != nil {
+		c.JSON(taxonErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// Import は multipart の file で送られたチェックリスト (DwC-A の zip か taxon.txt) を取り込むのだ
+func (h *TaxonHandler) Import(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	fh, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file を指定してください"})
+		return
+	}
+	file, err := fh.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	res, err := h.taxonService.Import(c.GetString("user_id"), wsID, file, fh.Size)
+	if err != nil {
+		c.JSON(taxonErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func taxonErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrWorkstationAccessDenied),
+		errors.Is(err, service.ErrWorkstationAdminRequired):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrTaxonNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrInvalidChecklist):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/service"
+)
+
+// TileHandler は地図用のベクタータイルを返すのだ
+type TileHandler struct {
+	tileService service.TileService
+}
+
+func NewTileHandler(s service.TileService) *TileHandler {
+	return &TileHandler{tileService: s}
+}
+
+// Occurrences は /api/tiles/{z}/{x}/{y}.mvt なのだ
+// 検索APIと同じクエリパラメータで絞り込めるのだ
+func (h *TileHandler) Occurrences(c *gin.Context) {
+	z, errZ := strconv.Atoi(c.Param("z"))
+	x, errX := strconv.Atoi(c.Param("x"))
+	y, errY := strconv.Atoi(strings.TrimSuffix(c.Param("y"), ".mvt"))
+	if errZ != nil || errX != nil || errY != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "タイル番号が正しくありません"})
+		return
+	}
+
+	var q model.OccurrenceSearchQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tile, err := h.tileService.OccurrenceTile(c.GetString("user_id"), z, x, y, &q)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrWorkstationAccessDenied):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrInvalidSearchQuery):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	// データは同期で変わるので、キャッシュは短めにしておくのだ
+	c.Header("Cache-Control", "private, max-age=60")
+	c.Data(http.StatusOK, "application/vnd.mapbox-vector-tile", tile)
+}
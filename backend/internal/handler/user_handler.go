@@ -38,6 +38,12 @@ func (h *UserHandler) Register(c *gin.Context) {
 			return
 		}
 
+		// CouchDBユーザーが作れなかったときは登録ごと取り消しているので、やり直せるのだ
+		if errors.Is(err, service.ErrCouchDBUserCreation) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "同期用アカウントの作成に失敗しました。しばらくしてからもう一度登録してください"})
+			return
+		}
+
 		// その他のサーバー内部エラー
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "内部サーバーエラーが発生しました"})
 		return
@@ -62,15 +68,12 @@ func (h *UserHandler) Login(c *gin.Context) {
 		return
 	}
 
-	token, err := h.userService.LoginUser(&req)
+	res, err := h.userService.LoginUser(&req, c.Request.UserAgent(), c.ClientIP())
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
-	res := model.UserLoginResponse{
-		Token: token,
-	}
 	c.JSON(http.StatusOK, res)
 }
 
@@ -91,3 +94,23 @@ func (h *UserHandler) GetMe(c *gin.Context) {
 
 	c.JSON(http.StatusOK, user)
 }
+
+// UpdateMe はログイン中のユーザーの表示名・言語・タイムゾーンを変えるのだ
+func (h *UserHandler) UpdateMe(c *gin.Context) {
+	var req model.UserProfileUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.userService.UpdateProfile(c.GetString("user_id"), &req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidProfile) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "プロフィールの更新に失敗しました"})
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
@@ -0,0 +1,227 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/service"
+)
+
+type WikiHandler struct {
+	wikiService service.WikiService
+}
+
+func NewWikiHandler(wikiService service.WikiService) *WikiHandler {
+	return &WikiHandler{wikiService: wikiService}
+}
+
+func (h *WikiHandler) List(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	var q model.WikiSearchQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	list, err := h.wikiService.List(c.GetString("user_id"), wsID, &q)
+	if err != nil {
+		c.JSON(wikiErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *WikiHandler) Get(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+
+	page, err := h.wikiService.Get(c.GetString("user_id"), wsID, c.Param("page_id"))
+	if err != nil {
+		c.JSON(wikiErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+func (h *WikiHandler) Create(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	var req model.WikiPageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := h.wikiService.Create(c.GetString("user_id"), wsID, &req)
+	if err != nil {
+		c.JSON(wikiErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, page)
+}
+
+func (h *WikiHandler) Update(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	var req model.WikiPageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := h.wikiService.Update(c.GetString("user_id"), wsID, c.Param("page_id"), &req)
+	if err != nil {
+		c.JSON(wikiErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+func (h *WikiHandler) Delete(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.wikiService.Delete(c.GetString("user_id"), wsID, c.Param("page_id")); err != nil {
+		c.JSON(wikiErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Preview は保存前の Markdown を HTML にして返すのだ
+func (h *WikiHandler) Preview(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	var req model.WikiPreviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	html, err := h.wikiService.Preview(c.GetString("user_id"), wsID, &req)
+	if err != nil {
+		c.JSON(wikiErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"html": html})
+}
+
+func (h *WikiHandler) ListRevisions(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+
+	list, err := h.wikiService.ListRevisions(c.GetString("user_id"), wsID, c.Param("page_id"))
+	if err != nil {
+		c.JSON(wikiErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *WikiHandler) GetRevision(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	revision, ok := revisionParam(c)
+	if !ok {
+		return
+	}
+
+	rev, err := h.wikiService.GetRevision(c.GetString("user_id"), wsID, c.Param("page_id"), revision)
+	if err != nil {
+		c.JSON(wikiErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rev)
+}
+
+// Diff は2つの版 (?from=&to=) の差分を返すのだ
+func (h *WikiHandler) Diff(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	var q model.WikiDiffQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	diff, err := h.wikiService.Diff(c.GetString("user_id"), wsID, c.Param("page_id"), &q)
+	if err != nil {
+		c.JSON(wikiErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, diff)
+}
+
+func (h *WikiHandler) Restore(c *gin.Context) {
+	wsID, ok := workstationIDParam(c)
+	if !ok {
+		return
+	}
+	revision, ok := revisionParam(c)
+	if !ok {
+		return
+	}
+	var req model.WikiRestoreRequest
+	// 本文は省略できるのだ
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := h.wikiService.Restore(c.GetString("user_id"), wsID, c.Param("page_id"), revision, &req)
+	if err != nil {
+		c.JSON(wikiErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+func revisionParam(c *gin.Context) (int, bool) {
+	revision, err := strconv.Atoi(c.Param("revision"))
+	if err != nil || revision <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "revision が正しくありません"})
+		return 0, false
+	}
+	return revision, true
+}
+
+func wikiErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrWorkstationAccessDenied),
+		errors.Is(err, service.ErrWikiEditDenied):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrWikiPageNotFound),
+		errors.Is(err, service.ErrWikiRevisionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrWikiConflict),
+		errors.Is(err, service.ErrWikiPageInUse):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrInvalidWikiPage):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -4,6 +4,7 @@ package infrastructure
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -15,13 +16,21 @@ import (
 type CouchDBClient interface {
 	GetSessionCookie(username string) (string, error)
 	CreateCouchDBUser(username string, password string) error
+	// SetCouchDBUserPassword は CouchDB ユーザーのパスワードを変えるのだ。ユーザーが無ければ作るのだ
+	SetCouchDBUserPassword(username string, password string) error
 	UpsertDocument(docID string, data map[string]interface{}) error
 	FetchAllDocs(dbName string) ([]map[string]interface{}, error)
+	// GetDocument はドキュメントを1件取得するのだ。存在しなければ ErrCouchDocumentNotFound なのだ
+	GetDocument(dbName string, docID string) (map[string]interface{}, error)
+	// DeleteDocument はドキュメントを削除するのだ。もう無いときは何もしないのだ
+	DeleteDocument(dbName string, docID string) error
 	CreateDatabase(dbName string) error
 	// ▼ 追加: ワークステーションIDからDB名を生成するヘルパーなのだ
 	CreateWorkstationDBName(workstationID int64) string
 	// ▼ 追加: DBにアクセス権を設定するメソッドなのだ
 	SetDatabaseUserAccess(dbName string, userID string) error
+	// RemoveDatabaseUserAccess はDBのメンバーからユーザーを外すのだ
+	RemoveDatabaseUserAccess(dbName string, userID string) error
 }
 
 type couchDBClient struct {
@@ -130,6 +139,58 @@ func (c *couchDBClient) CreateCouchDBUser(username string, password string) erro
 	return nil
 }
 
+// CouchDBUserDocID は _users データベースでのユーザーのドキュメント ID なのだ
+func CouchDBUserDocID(username string) string {
+	return "org.couchdb.user:" + username
+}
+
+func (c *couchDBClient) SetCouchDBUserPassword(username string, password string) error {
+	docID := CouchDBUserDocID(username)
+	// 他の更新とぶつかったら (409) 取り直してもう一度だけやるのだ
+	for attempt := 0; ; attempt++ {
+		doc, err := c.GetDocument("_users", docID)
+		if err != nil {
+			if errors.Is(err, ErrCouchDocumentNotFound) {
+				return c.CreateCouchDBUser(username, password)
+			}
+			return err
+		}
+		// password を入れて保存すると、CouchDB 側でハッシュにし直してくれるのだ
+		doc["password"] = password
+		delete(doc, "derived_key")
+		delete(doc, "salt")
+
+		jsonData, err := json.Marshal(doc)
+		if err != nil {
+			return fmt.Errorf("CouchDBユーザー更新リクエストのJSON化に失敗: %v", err)
+		}
+		req, err := http.NewRequest(
+			"PUT",
+			fmt.Sprintf("%s/_users/%s", c.baseURL, docID),
+			bytes.NewBuffer(jsonData),
+		)
+		if err != nil {
+			return fmt.Errorf("CouchDBユーザー更新リクエストの作成に失敗: %v", err)
+		}
+		req.SetBasicAuth(c.adminUser, c.adminPass)
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return fmt.Errorf("CouchDBへのユーザー更新要求に失敗: %v", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode == http.StatusConflict && attempt == 0 {
+			continue
+		}
+		if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusAccepted {
+			return fmt.Errorf("CouchDBがユーザー更新に失敗 (ステータス: %d)", resp.StatusCode)
+		}
+		return nil
+	}
+}
+
 // CreateDatabase は、管理者権限を使って新しいDBを作成するのだ
 func (c *couchDBClient) CreateDatabase(dbName string) error {
 	url := fmt.Sprintf("%s/%s", c.baseURL, dbName)
@@ -201,6 +262,69 @@ func (c *couchDBClient) SetDatabaseUserAccess(dbName string, userID string) erro
 	return nil
 }
 
+func (c *couchDBClient) RemoveDatabaseUserAccess(dbName string, userID string) error {
+	url := fmt.Sprintf("%s/%s/_security", c.baseURL, dbName)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("セキュリティ取得リクエスト作成失敗: %w", err)
+	}
+	req.SetBasicAuth(c.adminUser, c.adminPass)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("CouchDBへのセキュリティ取得要求に失敗: %w", err)
+	}
+	defer resp.Body.Close()
+	// DB がもう無ければ外すものも無いのだ
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("セキュリティ取得失敗 (ステータス: %d)", resp.StatusCode)
+	}
+
+	var securityDoc map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&securityDoc); err != nil {
+		return fmt.Errorf("セキュリティドキュメントのデコード失敗: %w", err)
+	}
+	members, _ := securityDoc["members"].(map[string]interface{})
+	if members == nil {
+		return nil
+	}
+	names, _ := members["names"].([]interface{})
+	kept := make([]interface{}, 0, len(names))
+	for _, n := range names {
+		if n != userID {
+			kept = append(kept, n)
+		}
+	}
+	if len(kept) == len(names) {
+		return nil
+	}
+	members["names"] = kept
+
+	jsonData, err := json.Marshal(securityDoc)
+	if err != nil {
+		return fmt.Errorf("セキュリティドキュメントのJSON化に失敗: %w", err)
+	}
+	putReq, err := http.NewRequest("PUT", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("セキュリティ設定リクエスト作成失敗: %w", err)
+	}
+	putReq.SetBasicAuth(c.adminUser, c.adminPass)
+	putReq.Header.Set("Content-Type", "application/json")
+
+	putResp, err := c.client.Do(putReq)
+	if err != nil {
+		return fmt.Errorf("CouchDBへのセキュリティ設定要求に失敗: %w", err)
+	}
+	defer putResp.Body.Close()
+	if putResp.StatusCode != http.StatusOK && putResp.StatusCode != http.StatusCreated && putResp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("セキュリティ設定失敗 (ステータス: %d)", putResp.StatusCode)
+	}
+	return nil
+}
+
 // UpsertDocument はドキュメントを作成または更新するのだ
 func (c *couchDBClient) UpsertDocument(docID string, data map[string]interface{}) error {
 	// data から workstation_id (string) を取得してDB名を決定するのだ
@@ -313,3 +437,66 @@ func (c *couchDBClient) FetchAllDocs(dbName string) ([]map[string]interface{}, e
 
 	return docs, nil
 }
+
+var ErrCouchDocumentNotFound = errors.New("CouchDB のドキュメントが見つかりません")
+
+func (c *couchDBClient) GetDocument(dbName string, docID string) (map[string]interface{}, error) {
+	url := fmt.Sprintf("%s/%s/%s", c.baseURL, dbName, docID)
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(c.adminUser, c.adminPass)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ドキュメント取得失敗: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrCouchDocumentNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ドキュメント取得失敗 (ステータス: %d) %s", resp.StatusCode, url)
+	}
+
+	var doc map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("ドキュメントのデコード失敗: %v", err)
+	}
+	return doc, nil
+}
+
+func (c *couchDBClient) DeleteDocument(dbName string, docID string) error {
+	doc, err := c.GetDocument(dbName, docID)
+	if err != nil {
+		if errors.Is(err, ErrCouchDocumentNotFound) {
+			return nil
+		}
+		return err
+	}
+	rev, _ := doc["_rev"].(string)
+
+	url := fmt.Sprintf("%s/%s/%s?rev=%s", c.baseURL, dbName, docID, rev)
+	req, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return fmt.Errorf("DELETEリクエスト作成失敗: %v", err)
+	}
+	req.SetBasicAuth(c.adminUser, c.adminPass)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("ドキュメント削除リクエスト失敗: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("ドキュメント削除失敗 (ステータス: %d) %s", resp.StatusCode, url)
+	}
+	return nil
+}
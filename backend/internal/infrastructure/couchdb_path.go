@@ -0,0 +1,43 @@
+package infrastructure
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// CouchDBProxyPrefix はフロントエンドから CouchDB へ中継する API のパスなのだ
+const CouchDBProxyPrefix = "/api/couchdb"
+
+var ErrInvalidCouchDBPath = errors.New("CouchDB のパスが正しくありません")
+
+// CouchDBProxyPath は中継する CouchDB のパス (デコードしたものとエスケープしたもの) を返すのだ
+// 権限の確認と転送で同じパスを使うように、. や .. の区切りとエスケープした / は断るのだ
+// (CouchDB 側でパスが整理されて、確かめたのと別の DB に届かないようにするため)
+func CouchDBProxyPath(u *url.URL) (path string, escaped string, err error) {
+	escaped = strings.TrimPrefix(u.EscapedPath(), CouchDBProxyPrefix)
+	if !strings.HasPrefix(escaped, "/") {
+		return "", "", ErrInvalidCouchDBPath
+	}
+	segments := strings.Split(escaped[1:], "/")
+	for i, segment := range segments {
+		if strings.Contains(strings.ToLower(segment), "%2f") {
+			return "", "", ErrInvalidCouchDBPath
+		}
+		decoded, err := url.PathUnescape(segment)
+		if err != nil || decoded == "." || decoded == ".." {
+			return "", "", ErrInvalidCouchDBPath
+		}
+		// 最後の / だけは許すのだ (/db/ など)
+		if decoded == "" && i != len(segments)-1 {
+			return "", "", ErrInvalidCouchDBPath
+		}
+		segments[i] = decoded
+	}
+	return "/" + strings.Join(segments, "/"), escaped, nil
+}
+
+// CouchDBPathSegments は CouchDBProxyPath のパスを区切るのだ (最初が DB 名なのだ)
+func CouchDBPathSegments(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
@@ -0,0 +1,123 @@
+package infrastructure
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// 測地系の変換なのだ
+// 保存する緯度経度はすべて JGD2011 (実用上 WGS84 と同じ) にそろえるのだ
+
+const (
+	DatumWGS84   = "EPSG:4326"
+	DatumJGD2011 = "EPSG:6668"
+	DatumJGD2000 = "EPSG:4612"
+	DatumTokyo   = "EPSG:4301"
+)
+
+// datumAliases は入力で受け付ける表記と正規化した EPSG コードの対応なのだ
+var datumAliases = map[string]string{
+	"":                              DatumWGS84,
+	"wgs84":                         DatumWGS84,
+	"epsg:4326":                     DatumWGS84,
+	"4326":                          DatumWGS84,
+	"crs84":                         DatumWGS84,
+	"urn:ogc:def:crs:ogc:1.3:crs84": DatumWGS84,
+	"urn:ogc:def:crs:epsg::4326":    DatumWGS84,
+	"jgd2011":                       DatumJGD2011,
+	"epsg:6668":                     DatumJGD2011,
+	"6668":                          DatumJGD2011,
+	"urn:ogc:def:crs:epsg::6668":    DatumJGD2011,
+	"jgd2000":                       DatumJGD2000,
+	"epsg:4612":                     DatumJGD2000,
+	"4612":                          DatumJGD2000,
+	"urn:ogc:def:crs:epsg::4612":    DatumJGD2000,
+	"tokyo":                         DatumTokyo,
+	"tokyo datum":                   DatumTokyo,
+	"tokyo97":                       DatumTokyo,
+	"epsg:4301":                     DatumTokyo,
+	"4301":                          DatumTokyo,
+	"urn:ogc:def:crs:epsg::4301":    DatumTokyo,
+}
+
+// NormalizeDatum は測地系の表記ゆれを EPSG コードにそろえるのだ
+// 空文字は、GPS の既定である WGS84 とみなすのだ
+func NormalizeDatum(name string) (string, error) {
+	code, ok := datumAliases[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return "", fmt.Errorf("対応していない測地系です: %s", name)
+	}
+	return code, nil
+}
+
+// 楕円体のパラメータなのだ
+type ellipsoid struct {
+	a float64 // 長半径
+	f float64 // 扁平率
+}
+
+var (
+	bessel1841 = ellipsoid{a: 6377397.155, f: 1 / 299.152813}
+	grs80      = ellipsoid{a: 6378137.0, f: 1 / 298.257222101}
+)
+
+// tokyoToJGD2000Shift は日本測地系 → 世界測地系の3パラメータ (m) なのだ
+// 地域ごとの変換パラメータ (TKY2JGD) を使わない近似なので、誤差は数m程度あるのだ
+var tokyoToJGD2000Shift = [3]float64{-146.414, 507.337, 680.507}
+
+// ConvertToJGD2011 は指定した測地系の緯度経度を JGD2011 に変換するのだ
+// JGD2000 と JGD2011 の差 (東日本の地殻変動分) は PatchJGD のグリッドがないと補正できないので、同じものとして扱うのだ
+func ConvertToJGD2011(lat, lon float64, datum string) (float64, float64, error) {
+	code, err := NormalizeDatum(datum)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	switch code {
+	case DatumWGS84, DatumJGD2011, DatumJGD2000:
+		return lat, lon, nil
+	case DatumTokyo:
+		x, y, z := geodeticToECEF(lat, lon, 0, bessel1841)
+		x += tokyoToJGD2000Shift[0]
+		y += tokyoToJGD2000Shift[1]
+		z += tokyoToJGD2000Shift[2]
+		newLat, newLon := ecefToGeodetic(x, y, z, grs80)
+		return newLat, newLon, nil
+	default:
+		return 0, 0, fmt.Errorf("対応していない測地系です: %s", datum)
+	}
+}
+
+func geodeticToECEF(lat, lon, h float64, e ellipsoid) (x, y, z float64) {
+	phi := lat * math.Pi / 180
+	lambda := lon * math.Pi / 180
+	e2 := e.f * (2 - e.f)
+	n := e.a / math.Sqrt(1-e2*math.Sin(phi)*math.Sin(phi))
+
+	x = (n + h) * math.Cos(phi) * math.Cos(lambda)
+	y = (n + h) * math.Cos(phi) * math.Sin(lambda)
+	z = (n*(1-e2) + h) * math.Sin(phi)
+	return x, y, z
+}
+
+// ecefToGeodetic は地心直交座標から緯度経度に戻すのだ (反復計算、数回で mm 以下に収束するのだ)
+func ecefToGeodetic(x, y, z float64, e ellipsoid) (lat, lon float64) {
+	e2 := e.f * (2 - e.f)
+	p := math.Hypot(x, y)
+	lambda := math.Atan2(y, x)
+
+	phi := math.Atan2(z, p*(1-e2))
+	for i := 0; i < 10; i++ {
+		n := e.a / math.Sqrt(1-e2*math.Sin(phi)*math.Sin(phi))
+		h := p/math.Cos(phi) - n
+		next := math.Atan2(z, p*(1-e2*n/(n+h)))
+		if math.Abs(next-phi) < 1e-12 {
+			phi = next
+			break
+		}
+		phi = next
+	}
+
+	return phi * 180 / math.Pi, lambda * 180 / math.Pi
+}
@@ -0,0 +1,55 @@
+package infrastructure
+
+import (
+	"math"
+	"testing"
+)
+
+func dms(d, m, s float64) float64 {
+	return d + m/60 + s/3600
+}
+
+func TestNormalizeDatum(t *testing.T) {
+	tests := map[string]string{
+		"":                              DatumWGS84,
+		" WGS84 ":                       DatumWGS84,
+		"urn:ogc:def:crs:OGC:1.3:CRS84": DatumWGS84,
+		"JGD2011":                       DatumJGD2011,
+		"EPSG:4612":                     DatumJGD2000,
+		"Tokyo":                         DatumTokyo,
+	}
+	for in, want := range tests {
+		if got, err := NormalizeDatum(in); err != nil || got != want {
+			t.Errorf("NormalizeDatum(%q) = %q, %v, want %q", in, got, err, want)
+		}
+	}
+	if _, err := NormalizeDatum("NAD27"); err == nil {
+		t.Error("NormalizeDatum(NAD27): want error")
+	}
+}
+
+func TestConvertToJGD2011(t *testing.T) {
+	// 日本経緯度原点の国土地理院の公表値なのだ
+	// 日本測地系 35°39′17.5148″N 139°44′40.5020″E → 世界測地系 (JGD2000) 35°39′29.1572″N 139°44′28.8759″E
+	// 3パラメータの近似変換なので、数m (3e-5度は緯度で約3m) までの差は許すのだ
+	lat, lon, err := ConvertToJGD2011(dms(35, 39, 17.5148), dms(139, 44, 40.5020), "tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantLat, wantLon := dms(35, 39, 29.1572), dms(139, 44, 28.8759)
+	if math.Abs(lat-wantLat) > 3e-5 || math.Abs(lon-wantLon) > 3e-5 {
+		t.Fatalf("origin = (%.7f, %.7f), want (%.7f, %.7f)", lat, lon, wantLat, wantLon)
+	}
+
+	// 世界測地系どうしはそのままなのだ
+	for _, datum := range []string{"", "EPSG:6668", "jgd2000"} {
+		lat, lon, err := ConvertToJGD2011(35.681236, 139.767125, datum)
+		if err != nil || lat != 35.681236 || lon != 139.767125 {
+			t.Errorf("ConvertToJGD2011(%q) = %v, %v, %v", datum, lat, lon, err)
+		}
+	}
+
+	if _, _, err := ConvertToJGD2011(35, 139, "NAD27"); err == nil {
+		t.Error("ConvertToJGD2011(NAD27): want error")
+	}
+}
@@ -0,0 +1,212 @@
+package infrastructure
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// DwCReader は Darwin Core の Taxon ファイルを1行ずつ読むのだ
+// DwC-A (meta.xml 付きの zip) と、ヘッダー行付きのタブ / カンマ区切りテキストの両方に対応するのだ
+// 列名は term の URI の最後の部分 (taxonID, scientificName など) になるのだ
+type DwCReader struct {
+	r       *csv.Reader
+	closer  io.Closer
+	columns map[int]string
+}
+
+// dwcMeta は meta.xml のうち、コアファイルを読むのに必要な部分なのだ
+type dwcMeta struct {
+	Core struct {
+		RowType            string `xml:"rowType,attr"`
+		FieldsTerminatedBy string `xml:"fieldsTerminatedBy,attr"`
+		IgnoreHeaderLines  int    `xml:"ignoreHeaderLines,attr"`
+		Files              struct {
+			Location string `xml:"location"`
+		} `xml:"files"`
+		// ID はコアの行の識別子の列 (<id index="0"/>) なのだ
+		ID *struct {
+			Index int `xml:"index,attr"`
+		} `xml:"id"`
+		Fields []struct {
+			Index *int   `xml:"index,attr"`
+			Term  string `xml:"term,attr"`
+		} `xml:"field"`
+	} `xml:"core"`
+}
+
+// OpenDwCTaxa は r の中身を見て DwC-A か平文のファイルかを判断して開くのだ
+func OpenDwCTaxa(r io.ReaderAt, size int64) (*DwCReader, error) {
+	magic := make([]byte, 4)
+	if _, err := r.ReadAt(magic, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if bytes.Equal(magic, []byte("PK\x03\x04")) {
+		return openDwCArchive(r, size)
+	}
+	return newDwCTextReader(io.NewSectionReader(r, 0, size), nil)
+}
+
+func openDwCArchive(r io.ReaderAt, size int64) (*DwCReader, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("DwC-A を開けません: %w", err)
+	}
+
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[path.Base(f.Name)] = f
+	}
+
+	metaFile, ok := files["meta.xml"]
+	if !ok {
+		// meta.xml がなければ taxon.txt をヘッダー付きのテキストとして読むのだ
+		f, ok := files["taxon.txt"]
+		if !ok {
+			return nil, errors.New("DwC-A に meta.xml も taxon.txt もありません")
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		return newDwCTextReader(rc, rc)
+	}
+
+	var meta dwcMeta
+	mr, err := metaFile.Open()
+	if err != nil {
+		return nil, err
+	}
+	err = xml.NewDecoder(mr).Decode(&meta)
+	mr.Close()
+	if err != nil {
+		return nil, fmt.Errorf("meta.xml を読めません: %w", err)
+	}
+	if !strings.HasSuffix(meta.Core.RowType, "/Taxon") {
+		return nil, fmt.Errorf("コアが Taxon ではありません: %s", meta.Core.RowType)
+	}
+
+	f, ok := files[path.Base(meta.Core.Files.Location)]
+	if !ok {
+		return nil, fmt.Errorf("コアファイル %s がありません", meta.Core.Files.Location)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	cr := newDwCCSVReader(rc, unescapeDwCDelimiter(meta.Core.FieldsTerminatedBy))
+	for i := 0; i < meta.Core.IgnoreHeaderLines; i++ {
+		if _, err := cr.Read(); err != nil {
+			rc.Close()
+			return nil, err
+		}
+	}
+	columns := map[int]string{}
+	for _, field := range meta.Core.Fields {
+		if field.Index != nil {
+			columns[*field.Index] = dwcTermName(field.Term)
+		}
+	}
+	// id の列は taxonID の field が無いときの識別子なのだ (同じ列が field にもあればそちらの名前にするのだ)
+	if meta.Core.ID != nil {
+		if _, ok := columns[meta.Core.ID.Index]; !ok {
+			columns[meta.Core.ID.Index] = "id"
+		}
+	}
+	return &DwCReader{r: cr, closer: rc, columns: columns}, nil
+}
+
+// newDwCTextReader は1行目をヘッダーとして読むのだ。タブが含まれていればタブ区切りとみなすのだ
+func newDwCTextReader(r io.Reader, closer io.Closer) (*DwCReader, error) {
+	br := bufio.NewReader(r)
+	// Excel などで保存した UTF-8 の BOM は読み飛ばすのだ
+	if bom, err := br.Peek(3); err == nil && bytes.Equal(bom, []byte("\xef\xbb\xbf")) {
+		br.Discard(3)
+	}
+	header, err := br.Peek(4096)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+	delimiter := ","
+	if line, _, _ := bytes.Cut(header, []byte("\n")); bytes.Contains(line, []byte("\t")) {
+		delimiter = "\t"
+	}
+	cr := newDwCCSVReader(br, delimiter)
+	names, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("ヘッダー行を読めません: %w", err)
+	}
+	columns := map[int]string{}
+	for i, name := range names {
+		columns[i] = dwcTermName(name)
+	}
+	return &DwCReader{r: cr, closer: closer, columns: columns}, nil
+}
+
+// newDwCCSVReader は区切り文字を指定して csv.Reader を作るのだ
+// 引用符なしのタブ区切りでも値の途中の " で止まらないように LazyQuotes にしておくのだ
+func newDwCCSVReader(r io.Reader, delimiter string) *csv.Reader {
+	cr := csv.NewReader(r)
+	if delimiter != "" {
+		cr.Comma = []rune(delimiter)[0]
+	}
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	cr.ReuseRecord = true
+	return cr
+}
+
+// Next は次の1行を 列名 -> 値 のマップで返すのだ。終わりなら io.EOF なのだ
+func (d *DwCReader) Next() (map[string]string, error) {
+	record, err := d.r.Read()
+	if err != nil {
+		return nil, err
+	}
+	row := make(map[string]string, len(d.columns))
+	for i, value := range record {
+		if name, ok := d.columns[i]; ok {
+			row[name] = strings.TrimSpace(value)
+		}
+	}
+	return row, nil
+}
+
+// Line は直前に読んだ行の行番号なのだ (エラー表示用)
+func (d *DwCReader) Line() int {
+	line, _ := d.r.FieldPos(0)
+	return line
+}
+
+func (d *DwCReader) Close() error {
+	if d.closer != nil {
+		return d.closer.Close()
+	}
+	return nil
+}
+
+// dwcTermName は "http://rs.tdwg.org/dwc/terms/taxonID" や "dwc:taxonID" を "taxonID" にするのだ
+func dwcTermName(term string) string {
+	term = strings.TrimSpace(term)
+	if i := strings.LastIndexAny(term, "/:#"); i >= 0 {
+		term = term[i+1:]
+	}
+	return term
+}
+
+func unescapeDwCDelimiter(s string) string {
+	switch s {
+	case "", `\t`:
+		return "\t"
+	case `\,`:
+		return ","
+	}
+	return s
+}
@@ -0,0 +1,98 @@
+package infrastructure
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// JIS X 0410 地域メッシュの計算なのだ
+// 1次(4桁) → 2次(6桁) → 3次(8桁) → 2分の1(9桁) → 4分の1(10桁) と、細かいコードは粗いコードの先頭を含むのだ
+// なので4分の1地域メッシュのコードだけ保存しておけば、前方一致でどの階層でも絞り込めるのだ
+
+// JISMeshLevels は階層名とコードの桁数の対応なのだ
+var JISMeshLevels = map[string]int{
+	"1":       4,
+	"2":       6,
+	"3":       8,
+	"half":    9,
+	"quarter": 10,
+}
+
+// 4分の1地域メッシュ単位で、緯度は 1度 = 1.5 * 8 * 10 * 4 = 480 マス、経度は 1度 = 8 * 10 * 4 = 320 マスなのだ
+const (
+	meshLatUnits = 480
+	meshLonUnits = 320
+	// meshEpsilon は 36.2*480 = 17375.999... のような丸め誤差で境界がずれないようにする補正なのだ
+	meshEpsilon = 1e-9
+)
+
+// JISMeshCode は緯度経度 (JGD2011/WGS84) から4分の1地域メッシュコード (10桁) を計算するのだ
+// 1次メッシュが2桁+2桁で表せる範囲 (北緯0〜66.66度, 東経100〜200度) の外なら ok=false なのだ
+func JISMeshCode(lat, lon float64) (string, bool) {
+	if lat < 0 || lat >= 100/1.5 || lon < 100 || lon >= 200 {
+		return "", false
+	}
+
+	latIdx := int(math.Floor(lat*meshLatUnits + meshEpsilon))
+	lonIdx := int(math.Floor((lon-100)*meshLonUnits + meshEpsilon))
+
+	p, u := latIdx/320, lonIdx/320
+	q, v := latIdx%320/40, lonIdx%320/40
+	r, w := latIdx%40/4, lonIdx%40/4
+	half := latIdx%4/2*2 + lonIdx%4/2 + 1
+	quarter := latIdx%2*2 + lonIdx%2 + 1
+
+	return fmt.Sprintf("%02d%02d%d%d%d%d%d%d", p, u, q, v, r, w, half, quarter), true
+}
+
+// JISMeshBounds はメッシュコード (4/6/8/9/10桁) の範囲を [最小経度, 最小緯度, 最大経度, 最大緯度] で返すのだ
+func JISMeshBounds(code string) ([4]float64, error) {
+	var bounds [4]float64
+	switch len(code) {
+	case 4, 6, 8, 9, 10:
+	default:
+		return bounds, fmt.Errorf("メッシュコードの桁数が正しくありません: %s", code)
+	}
+	digits := make([]int, len(code))
+	for i, ch := range code {
+		if ch < '0' || ch > '9' {
+			return bounds, fmt.Errorf("メッシュコードに数字以外が含まれています: %s", code)
+		}
+		digits[i] = int(ch - '0')
+	}
+
+	p, _ := strconv.Atoi(code[0:2])
+	u, _ := strconv.Atoi(code[2:4])
+	lat := float64(p) / 1.5
+	lon := float64(u) + 100
+	latSize, lonSize := 1/1.5, 1.0
+
+	if len(code) >= 6 {
+		latSize, lonSize = latSize/8, lonSize/8
+		if digits[4] > 7 || digits[5] > 7 {
+			return bounds, fmt.Errorf("2次メッシュの番号が範囲外です: %s", code)
+		}
+		lat += float64(digits[4]) * latSize
+		lon += float64(digits[5]) * lonSize
+	}
+	if len(code) >= 8 {
+		latSize, lonSize = latSize/10, lonSize/10
+		lat += float64(digits[6]) * latSize
+		lon += float64(digits[7]) * lonSize
+	}
+	for _, i := range []int{8, 9} {
+		if len(code) <= i {
+			break
+		}
+		m := digits[i] - 1
+		if m < 0 || m > 3 {
+			return bounds, fmt.Errorf("分割メッシュの番号は1〜4です: %s", code)
+		}
+		latSize, lonSize = latSize/2, lonSize/2
+		lat += float64(m/2) * latSize
+		lon += float64(m%2) * lonSize
+	}
+
+	return [4]float64{lon, lat, lon + lonSize, lat + latSize}, nil
+}
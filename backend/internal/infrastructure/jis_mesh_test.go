@@ -0,0 +1,82 @@
+package infrastructure
+
+import (
+	"math"
+	"testing"
+)
+
+// メッシュコードは JIS X 0410 の定義と、国土地理院・統計局が公開しているコードに合わせて確かめるのだ
+
+func TestJISMeshCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lon float64
+		want     string
+	}{
+		// 東京駅 (3次メッシュ 53394611)
+		{"Tokyo Station", 35.681236, 139.767125, "5339461132"},
+		// 大阪駅 (3次メッシュ 52350349)
+		{"Osaka Station", 34.702485, 135.495951, "5235034923"},
+		// 那覇 (1次メッシュ 3927)
+		{"Naha", 26.2124, 127.6809, "3927255414"},
+		// 北緯36.2度は2次メッシュの境目なのだ。36.2*480 の丸め誤差で1つ南にずれないこと
+		{"secondary boundary", 36.2, 140.0, "5440204011"},
+		// 1次メッシュの南西の角はそのメッシュに入るのだ
+		{"primary corner", 36.0, 140.0, "5440000011"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := JISMeshCode(tt.lat, tt.lon)
+			if !ok || got != tt.want {
+				t.Fatalf("JISMeshCode(%v, %v) = %q, %v, want %q", tt.lat, tt.lon, got, ok, tt.want)
+			}
+			// 計算したメッシュの範囲に元の点が入っていること
+			for _, digits := range JISMeshLevels {
+				b, err := JISMeshBounds(got[:digits])
+				if err != nil {
+					t.Fatal(err)
+				}
+				if tt.lon < b[0]-1e-9 || tt.lon >= b[2] || tt.lat < b[1]-1e-9 || tt.lat >= b[3] {
+					t.Fatalf("%s: bounds %v do not contain (%v, %v)", got[:digits], b, tt.lat, tt.lon)
+				}
+			}
+		})
+	}
+}
+
+func TestJISMeshCodeOutOfRange(t *testing.T) {
+	for _, p := range [][2]float64{{-1, 139}, {35, 99.9}, {35, 200}, {70, 139}} {
+		if code, ok := JISMeshCode(p[0], p[1]); ok {
+			t.Errorf("JISMeshCode(%v, %v) = %q, want out of range", p[0], p[1], code)
+		}
+	}
+}
+
+func TestJISMeshBounds(t *testing.T) {
+	tests := []struct {
+		code string
+		want [4]float64
+	}{
+		{"5339", [4]float64{139, 35 + 1.0/3, 140, 36}},
+		{"533946", [4]float64{139.75, 35 + 2.0/3, 139.875, 35.75}},
+		{"53394611", [4]float64{139.7625, 35.675, 139.775, 35 + 41.0/60}},
+		{"533946113", [4]float64{139.7625, 35 + 40.5/60 + 1.0/240, 139.76875, 35 + 41.0/60}},
+	}
+	for _, tt := range tests {
+		got, err := JISMeshBounds(tt.code)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.code, err)
+		}
+		for i := range got {
+			if math.Abs(got[i]-tt.want[i]) > 1e-9 {
+				t.Fatalf("JISMeshBounds(%s) = %v, want %v", tt.code, got, tt.want)
+			}
+		}
+	}
+
+	for _, code := range []string{"533", "53394", "5339461", "5339x611", "53394811", "533946115"} {
+		if _, err := JISMeshBounds(code); err == nil {
+			t.Errorf("JISMeshBounds(%q): want error", code)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package infrastructure
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+)
+
+// メールの送信なのだ
+// ローカルのテスト用メールサーバー (MailHog や Mailpit など) にも、本番の SMTP サーバーにも送れるのだ
+
+const smtpTimeout = 10 * time.Second
+
+var ErrSMTPTLSRequired = errors.New("SMTPサーバーが STARTTLS に対応していません (ローカルのテスト用サーバーなら SMTP_ALLOW_PLAINTEXT=true にしてください)")
+
+// Mailer はテキストのメールを1通送るのだ
+type Mailer interface {
+	Send(to string, subject string, body string) error
+}
+
+// NewMailer は設定に合わせた Mailer を作るのだ。SMTP のホストが無ければログに出すだけなのだ
+func NewMailer(config *model.MailConfig) Mailer {
+	if config.Host == "" {
+		return &logMailer{}
+	}
+	if config.Port == "" {
+		config.Port = "25"
+	}
+	if config.From == "" {
+		config.From = "no-reply@localhost"
+	}
+	return &smtpMailer{config: *config}
+}
+
+type smtpMailer struct {
+	config model.MailConfig
+}
+
+func (m *smtpMailer) Send(to string, subject string, body string) error {
+	msg, err := buildMailMessage(m.config.From, to, subject, body)
+	if err != nil {
+		return err
+	}
+
+	host := m.config.Host
+	addr := net.JoinHostPort(host, m.config.Port)
+	tlsConfig := &tls.Config{ServerName: host}
+
+	// 465 番は最初から TLS (SMTPS) で、それ以外は STARTTLS を使うのだ
+	var conn net.Conn
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+	if m.config.Port == "465" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("SMTPサーバーへの接続に失敗: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTPの開始に失敗: %w", err)
+	}
+	defer client.Close()
+
+	if m.config.Port != "465" {
+		// STARTTLS が無いサーバーに平文で送ると、リセット用のリンクなどが盗み見られてしまうのだ
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				return fmt.Errorf("STARTTLSに失敗: %w", err)
+			}
+		} else if !m.config.AllowPlaintext {
+			return ErrSMTPTLSRequired
+		}
+	}
+	if m.config.Username != "" {
+		// PlainAuth は TLS でないと (localhost 以外では) パスワードを送らないのだ
+		auth := smtp.PlainAuth("", m.config.Username, m.config.Password, host)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("SMTP認証に失敗: %w", err)
+		}
+	}
+	if err := client.Mail(mailAddressOnly(m.config.From)); err != nil {
+		return fmt.Errorf("送信元の指定に失敗: %w", err)
+	}
+	if err := client.Rcpt(to); err != nil {
+		return fmt.Errorf("宛先の指定に失敗: %w", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("本文の送信開始に失敗: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		w.Close()
+		return fmt.Errorf("本文の送信に失敗: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("本文の送信に失敗: %w", err)
+	}
+	return client.Quit()
+}
+
+// logMailer は SMTP の設定が無いときに、送るはずだったメールの宛先と件名をログに出すのだ
+// 本文にはパスワードの再設定などのリンク (知っていれば使える秘密) が入るので出さないのだ
+// 中身を見たいときはローカルのテスト用メールサーバーを使ってほしいのだ
+type logMailer struct{}
+
+func (m *logMailer) Send(to string, subject string, body string) error {
+	log.Printf("[mail] SMTP_HOST が未設定なので送信しないのだ (To: %s, Subject: %s)", to, subject)
+	return nil
+}
+
+// buildMailMessage は UTF-8 のテキストメール (ヘッダーと Base64 の本文) を組み立てるのだ
+func buildMailMessage(from, to, subject, body string) ([]byte, error) {
+	// ヘッダーに改行を混ぜられると、別のヘッダーを足せてしまうのだ
+	for _, v := range []string{from, to, subject} {
+		if strings.ContainsAny(v, "\r\n") {
+			return nil, errors.New("メールのヘッダーに改行は使えません")
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: base64\r\n")
+	b.WriteString("\r\n")
+
+	encoded := base64.StdEncoding.EncodeToString([]byte(strings.ReplaceAll(body, "\n", "\r\n")))
+	for len(encoded) > 76 {
+		b.WriteString(encoded[:76])
+		b.WriteString("\r\n")
+		encoded = encoded[76:]
+	}
+	b.WriteString(encoded)
+	b.WriteString("\r\n")
+	return []byte(b.String()), nil
+}
+
+// mailAddressOnly は "名前 <addr>" の形から addr だけを取り出すのだ
+func mailAddressOnly(s string) string {
+	if i := strings.LastIndex(s, "<"); i >= 0 {
+		if j := strings.LastIndex(s, ">"); j > i {
+			return s[i+1 : j]
+		}
+	}
+	return strings.TrimSpace(s)
+}
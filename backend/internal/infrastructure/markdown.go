@@ -0,0 +1,440 @@
+package infrastructure
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Wiki 用の Markdown を HTML にするのだ (外部ライブラリなし)
+// 対応しているのは見出し・段落・強調・コード・引用・リスト・水平線・リンク・画像だけなのだ
+// 文字はすべてエスケープして、生の HTML は通さないのだ。リンク先も http / https / mailto / 相対パスに限るのだ
+// (タグを後から取り除くのではなく、許したタグしか作らないので、出力はそのまま埋め込めるのだ)
+
+var (
+	markdownHeadingPattern = regexp.MustCompile(`^(#{1,6})[ \t]+(.*?)[ \t#]*$`)
+	markdownRulePattern    = regexp.MustCompile(`^ {0,3}(?:(?:-[ \t]*){3,}|(?:\*[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	markdownBulletPattern  = regexp.MustCompile(`^ {0,3}[-*+][ \t]+(.*)$`)
+	markdownOrderedPattern = regexp.MustCompile(`^ {0,3}(\d{1,9})[.)][ \t]+(.*)$`)
+	markdownFencePattern   = regexp.MustCompile("^ {0,3}(```+|~~~+)[ \t]*([A-Za-z0-9_+-]*)")
+	markdownSchemePattern  = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9+.-]*):`)
+)
+
+// maxMarkdownInlineScan はリンクや強調の閉じを探すときに先を見るバイト数なのだ
+// 閉じていない [ や < がたくさんあっても、毎回行の最後まで探さないようにするのだ
+const maxMarkdownInlineScan = 2048
+
+// RenderMarkdown は Markdown を安全な HTML にするのだ
+func RenderMarkdown(src string) string {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	src = strings.ReplaceAll(src, "\r", "\n")
+	var b strings.Builder
+	renderMarkdownBlocks(&b, strings.Split(src, "\n"))
+	return b.String()
+}
+
+func renderMarkdownBlocks(b *strings.Builder, lines []string) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case strings.TrimSpace(line) == "":
+			i++
+
+		case markdownFencePattern.MatchString(line):
+			m := markdownFencePattern.FindStringSubmatch(line)
+			fence := m[1]
+			i++
+			var code []string
+			for i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence) {
+				code = append(code, lines[i])
+				i++
+			}
+			i++ // 閉じのフェンス
+			if m[2] != "" {
+				b.WriteString(`<pre><code class="language-` + html.EscapeString(m[2]) + `">`)
+			} else {
+				b.WriteString("<pre><code>")
+			}
+			for _, c := range code {
+				b.WriteString(html.EscapeString(c))
+				b.WriteString("\n")
+			}
+			b.WriteString("</code></pre>\n")
+
+		case markdownHeadingPattern.MatchString(line):
+			m := markdownHeadingPattern.FindStringSubmatch(line)
+			level := strconv.Itoa(len(m[1]))
+			b.WriteString("<h" + level + ">" + renderMarkdownInline(m[2]) + "</h" + level + ">\n")
+			i++
+
+		case markdownRulePattern.MatchString(line):
+			b.WriteString("<hr>\n")
+			i++
+
+		case isMarkdownQuote(line):
+			var inner []string
+			for i < len(lines) && isMarkdownQuote(lines[i]) {
+				l := strings.TrimLeft(lines[i], " ")[1:]
+				inner = append(inner, strings.TrimPrefix(l, " "))
+				i++
+			}
+			b.WriteString("<blockquote>\n")
+			renderMarkdownBlocks(b, inner)
+			b.WriteString("</blockquote>\n")
+
+		case markdownBulletPattern.MatchString(line), markdownOrderedPattern.MatchString(line):
+			i = renderMarkdownList(b, lines, i)
+
+		default:
+			var para []string
+			for i < len(lines) && isMarkdownParagraphLine(lines[i]) {
+				para = append(para, lines[i])
+				i++
+			}
+			b.WriteString("<p>" + renderMarkdownParagraph(para) + "</p>\n")
+		}
+	}
+}
+
+// renderMarkdownList は start 行目から続くリストを書き出して、次の行番号を返すのだ
+// 字下げした行はその項目の中身 (入れ子のリストなど) として扱うのだ
+func renderMarkdownList(b *strings.Builder, lines []string, start int) int {
+	ordered := !markdownBulletPattern.MatchString(lines[start])
+	if ordered {
+		m := markdownOrderedPattern.FindStringSubmatch(lines[start])
+		if n, _ := strconv.Atoi(m[1]); n != 1 {
+			b.WriteString(`<ol start="` + strconv.Itoa(n) + `">` + "\n")
+		} else {
+			b.WriteString("<ol>\n")
+		}
+	} else {
+		b.WriteString("<ul>\n")
+	}
+
+	i := start
+	for i < len(lines) {
+		var first string
+		if ordered {
+			m := markdownOrderedPattern.FindStringSubmatch(lines[i])
+			if m == nil {
+				break
+			}
+			first = m[2]
+		} else {
+			m := markdownBulletPattern.FindStringSubmatch(lines[i])
+			if m == nil {
+				break
+			}
+			first = m[1]
+		}
+		i++
+
+		item := []string{first}
+		for i < len(lines) {
+			l := lines[i]
+			if strings.TrimSpace(l) == "" {
+				// 空行の次も字下げが続くなら同じ項目なのだ
+				if i+1 < len(lines) && isMarkdownIndented(lines[i+1]) {
+					item = append(item, "")
+					i++
+					continue
+				}
+				break
+			}
+			if isMarkdownIndented(l) {
+				item = append(item, strings.TrimLeft(l, " \t"))
+				i++
+				continue
+			}
+			if markdownBulletPattern.MatchString(l) || markdownOrderedPattern.MatchString(l) || !isMarkdownParagraphLine(l) {
+				break
+			}
+			item = append(item, l) // 字下げなしで続く行 (段落の続き)
+			i++
+		}
+
+		b.WriteString("<li>")
+		if len(item) == 1 {
+			b.WriteString(renderMarkdownInline(strings.TrimSpace(item[0])))
+		} else {
+			b.WriteString("\n")
+			renderMarkdownBlocks(b, item)
+		}
+		b.WriteString("</li>\n")
+
+		// 項目の間の空行は読み飛ばすのだ
+		for i < len(lines) && strings.TrimSpace(lines[i]) == "" && i+1 < len(lines) &&
+			(markdownBulletPattern.MatchString(lines[i+1]) && !ordered || markdownOrderedPattern.MatchString(lines[i+1]) && ordered) {
+			i++
+		}
+	}
+
+	if ordered {
+		b.WriteString("</ol>\n")
+	} else {
+		b.WriteString("</ul>\n")
+	}
+	return i
+}
+
+func isMarkdownQuote(line string) bool {
+	return strings.HasPrefix(strings.TrimLeft(line, " "), ">")
+}
+
+func isMarkdownIndented(line string) bool {
+	return strings.HasPrefix(line, "  ") || strings.HasPrefix(line, "\t")
+}
+
+// isMarkdownParagraphLine は段落の続きになる行かを調べるのだ
+func isMarkdownParagraphLine(line string) bool {
+	return strings.TrimSpace(line) != "" &&
+		!markdownFencePattern.MatchString(line) &&
+		!markdownHeadingPattern.MatchString(line) &&
+		!markdownRulePattern.MatchString(line) &&
+		!isMarkdownQuote(line) &&
+		!markdownBulletPattern.MatchString(line) &&
+		!markdownOrderedPattern.MatchString(line)
+}
+
+// renderMarkdownParagraph は段落の行をつなげるのだ。行末の空白2つか \ は改行 (<br>) になるのだ
+func renderMarkdownParagraph(lines []string) string {
+	var b strings.Builder
+	for i, line := range lines {
+		hardBreak := strings.HasSuffix(line, "  ") || strings.HasSuffix(line, "\\")
+		text := strings.TrimSpace(strings.TrimSuffix(strings.TrimRight(line, " "), "\\"))
+		b.WriteString(renderMarkdownInline(text))
+		if i < len(lines)-1 {
+			if hardBreak {
+				b.WriteString("<br>")
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// renderMarkdownInline は行の中の強調・コード・リンク・画像を HTML にするのだ
+func renderMarkdownInline(s string) string {
+	var b strings.Builder
+	// 強調の閉じが見つからなかった範囲の終わりを marker ごとに覚えておいて、次はそこから探すのだ
+	closerScanned := map[string]int{}
+	// [ と ( の対になる閉じは最初に1回だけ探しておくのだ
+	var brackets, parens map[int]int
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte("\\`*_{}[]()#+-.!~<>|", s[i+1]) >= 0:
+			b.WriteString(html.EscapeString(s[i+1 : i+2]))
+			i += 2
+			continue
+
+		case c == '`':
+			n := countRun(s[i:], '`')
+			fence := s[i : i+n]
+			if end := strings.Index(s[i+n:], fence); end >= 0 {
+				code := strings.TrimSpace(s[i+n : i+n+end])
+				b.WriteString("<code>" + html.EscapeString(code) + "</code>")
+				i += n + end + n
+				continue
+			}
+			b.WriteString(html.EscapeString(fence))
+			i += n
+			continue
+
+		case c == '!' && strings.HasPrefix(s[i+1:], "["):
+			if brackets == nil {
+				brackets, parens = matchMarkdownPairs(s, '[', ']', true), matchMarkdownPairs(s, '(', ')', false)
+			}
+			if text, dest, n, ok := parseMarkdownLink(s[i+1:], i+1, brackets, parens); ok {
+				if u, ok := safeMarkdownURL(dest); ok {
+					b.WriteString(`<img src="` + html.EscapeString(u) + `" alt="` + html.EscapeString(text) + `">`)
+				} else {
+					b.WriteString(html.EscapeString(text))
+				}
+				i += 1 + n
+				continue
+			}
+
+		case c == '[':
+			if brackets == nil {
+				brackets, parens = matchMarkdownPairs(s, '[', ']', true), matchMarkdownPairs(s, '(', ')', false)
+			}
+			if text, dest, n, ok := parseMarkdownLink(s[i:], i, brackets, parens); ok {
+				if u, ok := safeMarkdownURL(dest); ok {
+					b.WriteString(`<a href="` + html.EscapeString(u) + `" rel="nofollow noopener">` + renderMarkdownInline(text) + "</a>")
+				} else {
+					b.WriteString(renderMarkdownInline(text))
+				}
+				i += n
+				continue
+			}
+
+		case c == '<':
+			// 自動リンク <https://...> なのだ。それ以外の < はタグにならないようエスケープするのだ
+			if end := strings.IndexByte(s[i:min(len(s), i+maxMarkdownInlineScan)], '>'); end > 0 {
+				dest := s[i+1 : i+end]
+				if strings.HasPrefix(dest, "http://") || strings.HasPrefix(dest, "https://") {
+					if u, ok := safeMarkdownURL(dest); ok && !strings.ContainsAny(dest, " \t") {
+						b.WriteString(`<a href="` + html.EscapeString(u) + `" rel="nofollow noopener">` + html.EscapeString(dest) + "</a>")
+						i += end + 1
+						continue
+					}
+				}
+			}
+
+		case c == '*' || c == '_' || c == '~':
+			n := countRun(s[i:], c)
+			if n >= 2 {
+				n = 2
+			}
+			if c == '~' && n < 2 {
+				break
+			}
+			// 単語の途中の _ (snake_case など) は強調にしないのだ
+			if c == '_' && i > 0 && isMarkdownWordByte(s[i-1]) {
+				break
+			}
+			marker := s[i : i+n]
+			if i+n < len(s) && s[i+n] == ' ' {
+				break
+			}
+			limit := min(len(s), i+n+maxMarkdownInlineScan)
+			end := findMarkdownCloser(s, max(i+n, closerScanned[marker]), limit, marker)
+			if end < 0 {
+				closerScanned[marker] = limit
+			}
+			if end > i+n {
+				inner := renderMarkdownInline(s[i+n : end])
+				switch {
+				case c == '~':
+					b.WriteString("<del>" + inner + "</del>")
+				case n == 2:
+					b.WriteString("<strong>" + inner + "</strong>")
+				default:
+					b.WriteString("<em>" + inner + "</em>")
+				}
+				i = end + n
+				continue
+			}
+		}
+
+		b.WriteString(html.EscapeString(s[i : i+1]))
+		i++
+	}
+	return b.String()
+}
+
+// matchMarkdownPairs は開き括弧の位置から、対になる閉じ括弧の位置を引けるようにするのだ
+// escapes なら \ の次の文字は括弧にしないのだ
+func matchMarkdownPairs(s string, open, close byte, escapes bool) map[int]int {
+	match := map[int]int{}
+	var stack []int
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if escapes {
+				i++
+			}
+		case open:
+			stack = append(stack, i)
+		case close:
+			if len(stack) > 0 {
+				match[stack[len(stack)-1]] = i
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+	return match
+}
+
+// parseMarkdownLink は [text](dest) を読んで、読んだバイト数を返すのだ
+// s は行の offset バイト目からなのだ。括弧の対は行全体で探した brackets・parens から引くのだ
+func parseMarkdownLink(s string, offset int, brackets, parens map[int]int) (text, dest string, n int, ok bool) {
+	closeBracket, found := brackets[offset]
+	closeBracket -= offset
+	if !found || closeBracket+1 >= len(s) || s[closeBracket+1] != '(' {
+		return "", "", 0, false
+	}
+	closeParen, found := parens[offset+closeBracket+1]
+	closeParen -= offset + closeBracket + 2
+	// 長すぎるリンクは (閉じ忘れのことが多いので) リンクにしないのだ
+	if !found || closeBracket+2+closeParen >= maxMarkdownInlineScan {
+		return "", "", 0, false
+	}
+	rest := s[closeBracket+2:]
+	dest = strings.TrimSpace(rest[:closeParen])
+	// タイトル ("...") は使わないので捨てるのだ
+	if sp := strings.IndexAny(dest, " \t"); sp >= 0 {
+		dest = dest[:sp]
+	}
+	dest = strings.TrimSuffix(strings.TrimPrefix(dest, "<"), ">")
+	return s[1:closeBracket], dest, closeBracket + 2 + closeParen + 1, true
+}
+
+// safeMarkdownURL はリンク先として使ってよい URL かを調べるのだ
+// javascript: や data: などは通さないのだ
+func safeMarkdownURL(u string) (string, bool) {
+	u = strings.TrimSpace(u)
+	if u == "" {
+		return "", false
+	}
+	for _, r := range u {
+		if r < 0x20 || r == 0x7f {
+			return "", false
+		}
+	}
+	if m := markdownSchemePattern.FindStringSubmatch(u); m != nil {
+		switch strings.ToLower(m[1]) {
+		case "http", "https", "mailto":
+			return u, true
+		default:
+			return "", false
+		}
+	}
+	// スキームが無ければ相対パスかページ内のリンクなのだ
+	return u, true
+}
+
+// findMarkdownCloser は from から limit までで強調を閉じる marker の位置を探すのだ (無ければ -1)
+func findMarkdownCloser(s string, from, limit int, marker string) int {
+	s = s[:limit]
+	for i := from; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case s[i] == '`':
+			// コードの中の記号では閉じないのだ
+			n := countRun(s[i:], '`')
+			if end := strings.Index(s[i+n:], s[i:i+n]); end >= 0 {
+				i += n + end + n - 1
+			}
+		case strings.HasPrefix(s[i:], marker):
+			if len(marker) == 1 && i+1 < len(s) && s[i+1] == marker[0] {
+				// ** の一部は * の閉じにしないのだ
+				i++
+				continue
+			}
+			if marker == "_" && i+1 < len(s) && isMarkdownWordByte(s[i+1]) {
+				continue
+			}
+			if s[i-1] == ' ' {
+				continue
+			}
+			return i
+		}
+	}
+	return -1
+}
+
+func countRun(s string, c byte) int {
+	n := 0
+	for n < len(s) && s[n] == c {
+		n++
+	}
+	return n
+}
+
+func isMarkdownWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z'
+}
@@ -0,0 +1,194 @@
+package infrastructure
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Mapbox Vector Tile (v2.1) のエンコーダーなのだ
+// 外部ライブラリなしで、点データだけのレイヤーを protobuf にするのだ
+// https://github.com/mapbox/vector-tile-spec/tree/master/2.1
+
+const (
+	mvtGeomPoint     = 1
+	mvtCommandMove   = 1
+	MVTDefaultExtent = 4096
+)
+
+// MVTLayer は1つのレイヤーなのだ。keys / values はタグ用に重複なく貯めるのだ
+type MVTLayer struct {
+	Name     string
+	Extent   uint32
+	keys     []string
+	keyIndex map[string]uint32
+	values   []interface{}
+	valIndex map[interface{}]uint32
+	features [][]byte
+}
+
+func NewMVTLayer(name string) *MVTLayer {
+	return &MVTLayer{
+		Name:     name,
+		Extent:   MVTDefaultExtent,
+		keyIndex: map[string]uint32{},
+		valIndex: map[interface{}]uint32{},
+	}
+}
+
+// AddPoint はタイル座標 (0..Extent) の点を1つ追加するのだ
+// props の値は string / int / int64 / float64 / bool に対応しているのだ
+func (l *MVTLayer) AddPoint(id uint64, x, y int32, props map[string]interface{}) error {
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var tags []uint32
+	for _, k := range keys {
+		v := props[k]
+		vi, err := l.valueIndex(v)
+		if err != nil {
+			return fmt.Errorf("属性 %s: %w", k, err)
+		}
+		tags = append(tags, l.keyIndexOf(k), vi)
+	}
+
+	var f []byte
+	if id != 0 {
+		f = appendVarintField(f, 1, id)
+	}
+	if len(tags) > 0 {
+		f = appendPacked(f, 2, tags)
+	}
+	f = appendVarintField(f, 3, mvtGeomPoint)
+	f = appendPacked(f, 4, []uint32{
+		mvtCommandMove&0x7 | 1<<3,
+		zigzag(x),
+		zigzag(y),
+	})
+
+	l.features = append(l.features, f)
+	return nil
+}
+
+// Len はレイヤーに入っている地物の数なのだ
+func (l *MVTLayer) Len() int {
+	return len(l.features)
+}
+
+func (l *MVTLayer) keyIndexOf(k string) uint32 {
+	if i, ok := l.keyIndex[k]; ok {
+		return i
+	}
+	i := uint32(len(l.keys))
+	l.keys = append(l.keys, k)
+	l.keyIndex[k] = i
+	return i
+}
+
+func (l *MVTLayer) valueIndex(v interface{}) (uint32, error) {
+	switch val := v.(type) {
+	case int:
+		v = int64(val)
+	case string, int64, float64, bool:
+	default:
+		return 0, fmt.Errorf("対応していない型です (%T)", v)
+	}
+	if i, ok := l.valIndex[v]; ok {
+		return i, nil
+	}
+	i := uint32(len(l.values))
+	l.values = append(l.values, v)
+	l.valIndex[v] = i
+	return i, nil
+}
+
+func (l *MVTLayer) marshal() []byte {
+	var b []byte
+	b = appendBytesField(b, 1, []byte(l.Name))
+	for _, f := range l.features {
+		b = appendBytesField(b, 2, f)
+	}
+	for _, k := range l.keys {
+		b = appendBytesField(b, 3, []byte(k))
+	}
+	for _, v := range l.values {
+		b = appendBytesField(b, 4, marshalMVTValue(v))
+	}
+	b = appendVarintField(b, 5, uint64(l.Extent))
+	b = appendVarintField(b, 15, 2)
+	return b
+}
+
+// MarshalMVT はレイヤーをまとめて1枚のタイルにするのだ
+// 地物のないレイヤーは省略するのだ
+func MarshalMVT(layers ...*MVTLayer) []byte {
+	var b []byte
+	for _, l := range layers {
+		if l.Len() == 0 {
+			continue
+		}
+		b = appendBytesField(b, 3, l.marshal())
+	}
+	return b
+}
+
+func marshalMVTValue(v interface{}) []byte {
+	var b []byte
+	switch val := v.(type) {
+	case string:
+		b = appendBytesField(b, 1, []byte(val))
+	case float64:
+		b = appendVarint(b, 3<<3|1)
+		bits := math.Float64bits(val)
+		for i := 0; i < 8; i++ {
+			b = append(b, byte(bits>>(8*i)))
+		}
+	case int64:
+		b = appendVarintField(b, 6, uint64(zigzag64(val)))
+	case bool:
+		n := uint64(0)
+		if val {
+			n = 1
+		}
+		b = appendVarintField(b, 7, n)
+	}
+	return b
+}
+
+func zigzag(n int32) uint32 {
+	return uint32((n << 1) ^ (n >> 31))
+}
+
+func zigzag64(n int64) uint64 {
+	return uint64((n << 1) ^ (n >> 63))
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendVarintField(b []byte, field int, v uint64) []byte {
+	b = appendVarint(b, uint64(field)<<3)
+	return appendVarint(b, v)
+}
+
+func appendBytesField(b []byte, field int, data []byte) []byte {
+	b = appendVarint(b, uint64(field)<<3|2)
+	b = appendVarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+func appendPacked(b []byte, field int, values []uint32) []byte {
+	var packed []byte
+	for _, v := range values {
+		packed = appendVarint(packed, uint64(v))
+	}
+	return appendBytesField(b, field, packed)
+}
@@ -0,0 +1,52 @@
+package infrastructure
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMarshalMVT(t *testing.T) {
+	layer := NewMVTLayer("p")
+	if err := layer.AddPoint(1, 10, 20, map[string]interface{}{"a": 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// vector_tile.proto に沿って手で組み立てた1点だけのタイルなのだ
+	feature := []byte{
+		0x08, 0x01, // id = 1
+		0x12, 0x02, 0x00, 0x00, // tags = [0, 0]
+		0x18, 0x01, // type = POINT
+		0x22, 0x03, 0x09, 0x14, 0x28, // geometry = MoveTo(1) zigzag(10) zigzag(20)
+	}
+	var want []byte
+	want = append(want, 0x1A, 0x1E) // layers
+	want = append(want, 0x0A, 0x01, 'p')
+	want = append(want, 0x12, byte(len(feature)))
+	want = append(want, feature...)
+	want = append(want, 0x1A, 0x01, 'a')              // keys
+	want = append(want, 0x22, 0x02, 0x30, 0x02)       // values = sint_value 1
+	want = append(want, 0x28, 0x80, 0x20, 0x78, 0x02) // extent = 4096, version = 2
+
+	if got := MarshalMVT(layer, NewMVTLayer("empty")); !bytes.Equal(got, want) {
+		t.Fatalf("MarshalMVT = % X\nwant          % X", got, want)
+	}
+}
+
+func TestMVTLayerSharesKeysAndValues(t *testing.T) {
+	layer := NewMVTLayer("p")
+	for i := 0; i < 3; i++ {
+		if err := layer.AddPoint(0, -1, 4096, map[string]interface{}{"grade": "research", "n": i % 2}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(layer.keys) != 2 || len(layer.values) != 3 {
+		t.Fatalf("keys = %v, values = %v", layer.keys, layer.values)
+	}
+	// id が0の地物は id を書かず、負の座標は zigzag で 1 になるのだ
+	if got := layer.features[0]; got[0] != 0x12 || !bytes.HasSuffix(got, []byte{0x22, 0x04, 0x09, 0x01, 0x80, 0x40}) {
+		t.Fatalf("feature = % X", got)
+	}
+	if err := layer.AddPoint(0, 0, 0, map[string]interface{}{"bad": []int{1}}); err == nil {
+		t.Fatal("unsupported value: want error")
+	}
+}
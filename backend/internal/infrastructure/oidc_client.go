@@ -0,0 +1,348 @@
+package infrastructure
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+)
+
+// OpenID Connect の認可コードフロー (PKCE 付き) の IdP 側とのやり取りなのだ
+// IdP の設定 (エンドポイントや署名の鍵) は issuer の .well-known/openid-configuration から読むのだ
+
+var ErrOIDCNotConfigured = errors.New("OpenID Connect のログインは設定されていません")
+var ErrOIDCTokenExchange = errors.New("IdP でのトークンの引き換えに失敗しました")
+var ErrOIDCInvalidIDToken = errors.New("IdP の ID トークンが正しくありません")
+
+const (
+	// jwksRefreshInterval は知らない kid が来たときに鍵を読み直す最短の間隔なのだ
+	// 鍵の入れ替えには付いていきつつ、でたらめな kid で IdP を叩かせないためなのだ
+	jwksRefreshInterval = time.Minute
+	// idTokenLeeway はサーバー同士の時計のずれを許す幅なのだ
+	idTokenLeeway = time.Minute
+)
+
+// idTokenAlgorithms は受け付ける ID トークンの署名方式なのだ (none や HS256 は受け付けないのだ)
+var idTokenAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+type OIDCClient interface {
+	Enabled() bool
+	// AuthCodeURL は IdP のログイン画面の URL を作るのだ
+	AuthCodeURL(state, nonce, codeChallenge string) (string, error)
+	// Exchange は認可コードを ID トークンと引き換えて、署名・発行者・宛先・期限・nonce を確かめるのだ
+	Exchange(code, codeVerifier, nonce string) (*model.OIDCClaims, error)
+}
+
+type oidcDiscovery struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	TokenAuthMethods      []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+type oidcClient struct {
+	client *http.Client
+	config *model.OIDCConfig
+
+	mu            sync.Mutex
+	discovery     *oidcDiscovery
+	keys          map[string]interface{}
+	keysFetchedAt time.Time
+}
+
+func NewOIDCClient(config *model.OIDCConfig) OIDCClient {
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+	if !slices.Contains(config.Scopes, "openid") {
+		config.Scopes = append([]string{"openid"}, config.Scopes...)
+	}
+	return &oidcClient{
+		client: &http.Client{Timeout: 10 * time.Second},
+		config: config,
+	}
+}
+
+func (c *oidcClient) Enabled() bool {
+	return c.config.Issuer != "" && c.config.ClientID != "" && c.config.RedirectURL != ""
+}
+
+// PKCEChallenge は code_verifier から S256 の code_challenge を作るのだ
+func PKCEChallenge(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (c *oidcClient) AuthCodeURL(state, nonce, codeChallenge string) (string, error) {
+	doc, err := c.getDiscovery()
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(doc.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("IdP の authorization_endpoint が読めません: %v", err)
+	}
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", c.config.ClientID)
+	q.Set("redirect_uri", c.config.RedirectURL)
+	q.Set("scope", strings.Join(c.config.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", codeChallenge)
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+func (c *oidcClient) Exchange(code, codeVerifier, nonce string) (*model.OIDCClaims, error) {
+	doc, err := c.getDiscovery()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", c.config.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+	form.Set("client_id", c.config.ClientID)
+	useBasic := false
+	if c.config.ClientSecret != "" {
+		// IdP が client_secret_post しか受け付けないときだけ、フォームに入れるのだ
+		if len(doc.TokenAuthMethods) == 0 || slices.Contains(doc.TokenAuthMethods, "client_secret_basic") {
+			useBasic = true
+		} else {
+			form.Set("client_secret", c.config.ClientSecret)
+		}
+	}
+
+	req, err := http.NewRequest("POST", doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if useBasic {
+		// RFC 6749 2.3.1 のとおり、Basic 認証に入れる前に URL エンコードするのだ
+		req.SetBasicAuth(url.QueryEscape(c.config.ClientID), url.QueryEscape(c.config.ClientSecret))
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCTokenExchange, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCTokenExchange, err)
+	}
+	var tokenRes struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &tokenRes); err != nil && resp.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("%w: レスポンスが読めません: %v", ErrOIDCTokenExchange, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: status %d %s %s", ErrOIDCTokenExchange, resp.StatusCode, tokenRes.Error, tokenRes.ErrorDescription)
+	}
+	if tokenRes.IDToken == "" {
+		return nil, fmt.Errorf("%w: id_token がありません", ErrOIDCTokenExchange)
+	}
+	return c.verifyIDToken(doc, tokenRes.IDToken, nonce)
+}
+
+func (c *oidcClient) verifyIDToken(doc *oidcDiscovery, rawIDToken, nonce string) (*model.OIDCClaims, error) {
+	parser := jwt.NewParser(
+		jwt.WithValidMethods(idTokenAlgorithms),
+		jwt.WithIssuer(doc.Issuer),
+		jwt.WithAudience(c.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(idTokenLeeway),
+	)
+	claims := jwt.MapClaims{}
+	if _, err := parser.ParseWithClaims(rawIDToken, claims, c.lookupKey); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCInvalidIDToken, err)
+	}
+
+	// nonce は IdP へ送り出したときのものと同じでないといけないのだ (ID トークンの使い回しを防ぐのだ)
+	if got, _ := claims["nonce"].(string); got == "" || got != nonce {
+		return nil, fmt.Errorf("%w: nonce が一致しません", ErrOIDCInvalidIDToken)
+	}
+	// 宛先が複数あるときは azp が自分でないといけないのだ
+	aud, _ := claims.GetAudience()
+	azp, _ := claims["azp"].(string)
+	if (len(aud) > 1 || azp != "") && azp != c.config.ClientID {
+		return nil, fmt.Errorf("%w: azp が一致しません", ErrOIDCInvalidIDToken)
+	}
+	sub, _ := claims.GetSubject()
+	if sub == "" {
+		return nil, fmt.Errorf("%w: sub がありません", ErrOIDCInvalidIDToken)
+	}
+
+	result := &model.OIDCClaims{Issuer: doc.Issuer, Subject: sub}
+	result.Email, _ = claims["email"].(string)
+	result.Name, _ = claims["name"].(string)
+	// email_verified を文字列で返す IdP もあるのだ
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		result.EmailVerified = v
+	case string:
+		result.EmailVerified = v == "true"
+	}
+	return result, nil
+}
+
+// lookupKey は ID トークンの kid に合う IdP の公開鍵を返すのだ (知らない kid なら鍵を読み直すのだ)
+func (c *oidcClient) lookupKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if key := c.findKey(kid); key != nil {
+		return key, nil
+	}
+	if !c.keysFetchedAt.IsZero() && time.Since(c.keysFetchedAt) < jwksRefreshInterval {
+		return nil, fmt.Errorf("kid %q の鍵がありません", kid)
+	}
+	keys, err := c.fetchKeys(c.discovery.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	c.keys = keys
+	c.keysFetchedAt = time.Now()
+	if key := c.findKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("kid %q の鍵がありません", kid)
+}
+
+// findKey は kid の鍵を探すのだ。kid が無いトークンは、鍵が1つだけのときに限ってそれを使うのだ
+func (c *oidcClient) findKey(kid string) interface{} {
+	if kid == "" {
+		if len(c.keys) == 1 {
+			for _, key := range c.keys {
+				return key
+			}
+		}
+		return nil
+	}
+	return c.keys[kid]
+}
+
+func (c *oidcClient) getDiscovery() (*oidcDiscovery, error) {
+	if !c.Enabled() {
+		return nil, ErrOIDCNotConfigured
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.discovery != nil {
+		return c.discovery, nil
+	}
+
+	var doc oidcDiscovery
+	wellKnown := strings.TrimRight(c.config.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := c.getJSON(wellKnown, &doc); err != nil {
+		return nil, fmt.Errorf("IdP の設定が読めません: %v", err)
+	}
+	// 設定した issuer と IdP が名乗る issuer が違うときは、別の IdP なので使わないのだ
+	if strings.TrimRight(doc.Issuer, "/") != strings.TrimRight(c.config.Issuer, "/") {
+		return nil, fmt.Errorf("IdP の issuer が設定と違います: %s", doc.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, fmt.Errorf("IdP の設定にエンドポイントが足りません")
+	}
+	c.discovery = &doc
+	return c.discovery, nil
+}
+
+// fetchKeys は jwks_uri から署名の確認に使う公開鍵を読むのだ (kid -> 鍵)
+func (c *oidcClient) fetchKeys(jwksURI string) (map[string]interface{}, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := c.getJSON(jwksURI, &set); err != nil {
+		return nil, fmt.Errorf("IdP の鍵が読めません: %v", err)
+	}
+
+	keys := make(map[string]interface{})
+	for _, k := range set.Keys {
+		// 暗号化用の鍵は署名の確認には使わないのだ
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+			e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+			if err1 != nil || err2 != nil || len(e) == 0 || len(e) > 4 {
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			var curve elliptic.Curve
+			switch k.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				continue
+			}
+			x, err1 := base64.RawURLEncoding.DecodeString(k.X)
+			y, err2 := base64.RawURLEncoding.DecodeString(k.Y)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+	return keys, nil
+}
+
+func (c *oidcClient) getJSON(rawURL string, out interface{}) error {
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: status %d", rawURL, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out)
+}
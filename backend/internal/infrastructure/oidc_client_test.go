@@ -0,0 +1,326 @@
+package infrastructure
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+)
+
+const (
+	testClientID    = "web-occurrence"
+	testRedirectURL = "http://localhost:8080/api/oidc/callback"
+	testCode        = "authorization-code"
+)
+
+// mockIdP はテスト用の OpenID Connect の IdP なのだ (discovery・JWKS・トークンエンドポイント)
+type mockIdP struct {
+	server *httptest.Server
+
+	mu        sync.Mutex
+	key       *rsa.PrivateKey
+	kid       string
+	jwksHits  int
+	challenge string
+	// idToken はトークンエンドポイントが返す ID トークンを作るのだ
+	idToken func(idp *mockIdP) string
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	idp := &mockIdP{}
+	idp.rotateKey(t, "key-1")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, http.StatusOK, map[string]interface{}{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+		idp.jwksHits++
+		writeTestJSON(w, http.StatusOK, map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": idp.kid,
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(idp.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			writeTestJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+			return
+		}
+		idp.mu.Lock()
+		challenge := idp.challenge
+		idp.mu.Unlock()
+		// 送り出したときの code_challenge に合う code_verifier でないと引き換えないのだ
+		if r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("code") != testCode ||
+			r.PostForm.Get("redirect_uri") != testRedirectURL || PKCEChallenge(r.PostForm.Get("code_verifier")) != challenge {
+			writeTestJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		writeTestJSON(w, http.StatusOK, map[string]string{"id_token": idp.idToken(idp), "token_type": "Bearer"})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *mockIdP) rotateKey(t *testing.T, kid string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.key, idp.kid = key, kid
+}
+
+// claims は正しい ID トークンの中身なのだ
+func (idp *mockIdP) claims(nonce string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            idp.server.URL,
+		"aud":            testClientID,
+		"sub":            "user-123",
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          nonce,
+		"email":          "taro@example.ac.jp",
+		"email_verified": true,
+		"name":           "山田 太郎",
+	}
+}
+
+func (idp *mockIdP) sign(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = idp.kid
+	raw, err := token.SignedString(idp.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func writeTestJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func newTestOIDCClient(idp *mockIdP) *oidcClient {
+	return NewOIDCClient(&model.OIDCConfig{
+		Issuer:      idp.server.URL,
+		ClientID:    testClientID,
+		RedirectURL: testRedirectURL,
+	}).(*oidcClient)
+}
+
+// login はブラウザが IdP でログインして戻ってきたところまでをまねて、コードを引き換えるのだ
+func login(t *testing.T, c *oidcClient, idp *mockIdP, nonce, verifier string) (*model.OIDCClaims, error) {
+	t.Helper()
+	authURL, err := c.AuthCodeURL("state-1", nonce, PKCEChallenge(verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("nonce") != nonce || q.Get("client_id") != testClientID {
+		t.Fatalf("authorization URL is missing parameters: %s", authURL)
+	}
+	idp.mu.Lock()
+	idp.challenge = q.Get("code_challenge")
+	idp.mu.Unlock()
+	return c.Exchange(testCode, verifier, nonce)
+}
+
+func TestOIDCExchangeAcceptsValidIDToken(t *testing.T) {
+	idp := newMockIdP(t)
+	idp.idToken = func(idp *mockIdP) string { return idp.sign(t, idp.claims("nonce-1")) }
+	c := newTestOIDCClient(idp)
+
+	claims, err := login(t, c, idp, "nonce-1", "verifier-1")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	want := model.OIDCClaims{
+		Issuer:        idp.server.URL,
+		Subject:       "user-123",
+		Email:         "taro@example.ac.jp",
+		EmailVerified: true,
+		Name:          "山田 太郎",
+	}
+	if *claims != want {
+		t.Fatalf("claims = %+v, want %+v", *claims, want)
+	}
+}
+
+func TestOIDCExchangeRejectsInvalidIDTokens(t *testing.T) {
+	tests := []struct {
+		name    string
+		idToken func(t *testing.T, idp *mockIdP) string
+	}{
+		{"wrong issuer", func(t *testing.T, idp *mockIdP) string {
+			claims := idp.claims("nonce-1")
+			claims["iss"] = "https://evil.example.com"
+			return idp.sign(t, claims)
+		}},
+		{"wrong audience", func(t *testing.T, idp *mockIdP) string {
+			claims := idp.claims("nonce-1")
+			claims["aud"] = "another-client"
+			return idp.sign(t, claims)
+		}},
+		{"foreign azp", func(t *testing.T, idp *mockIdP) string {
+			claims := idp.claims("nonce-1")
+			claims["aud"] = []string{testClientID, "another-client"}
+			claims["azp"] = "another-client"
+			return idp.sign(t, claims)
+		}},
+		{"wrong nonce", func(t *testing.T, idp *mockIdP) string {
+			return idp.sign(t, idp.claims("nonce-2"))
+		}},
+		{"missing nonce", func(t *testing.T, idp *mockIdP) string {
+			claims := idp.claims("nonce-1")
+			delete(claims, "nonce")
+			return idp.sign(t, claims)
+		}},
+		{"expired", func(t *testing.T, idp *mockIdP) string {
+			claims := idp.claims("nonce-1")
+			claims["iat"] = time.Now().Add(-time.Hour).Unix()
+			claims["exp"] = time.Now().Add(-10 * time.Minute).Unix()
+			return idp.sign(t, claims)
+		}},
+		{"missing exp", func(t *testing.T, idp *mockIdP) string {
+			claims := idp.claims("nonce-1")
+			delete(claims, "exp")
+			return idp.sign(t, claims)
+		}},
+		{"missing sub", func(t *testing.T, idp *mockIdP) string {
+			claims := idp.claims("nonce-1")
+			delete(claims, "sub")
+			return idp.sign(t, claims)
+		}},
+		{"alg none", func(t *testing.T, idp *mockIdP) string {
+			token := jwt.NewWithClaims(jwt.SigningMethodNone, idp.claims("nonce-1"))
+			token.Header["kid"] = idp.kid
+			raw, err := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return raw
+		}},
+		{"HS256 with the public key", func(t *testing.T, idp *mockIdP) string {
+			// 公開鍵を HMAC の鍵にする、よくある署名方式の取り違えなのだ
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, idp.claims("nonce-1"))
+			token.Header["kid"] = idp.kid
+			raw, err := token.SignedString(idp.key.N.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			return raw
+		}},
+		{"signed by another key", func(t *testing.T, idp *mockIdP) string {
+			other, err := rsa.GenerateKey(rand.Reader, 2048)
+			if err != nil {
+				t.Fatal(err)
+			}
+			token := jwt.NewWithClaims(jwt.SigningMethodRS256, idp.claims("nonce-1"))
+			token.Header["kid"] = idp.kid
+			raw, err := token.SignedString(other)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return raw
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newMockIdP(t)
+			idp.idToken = func(idp *mockIdP) string { return tt.idToken(t, idp) }
+			c := newTestOIDCClient(idp)
+
+			_, err := login(t, c, idp, "nonce-1", "verifier-1")
+			if !errors.Is(err, ErrOIDCInvalidIDToken) {
+				t.Fatalf("Exchange error = %v, want ErrOIDCInvalidIDToken", err)
+			}
+		})
+	}
+}
+
+func TestOIDCExchangeForwardsPKCEVerifier(t *testing.T) {
+	idp := newMockIdP(t)
+	idp.idToken = func(idp *mockIdP) string { return idp.sign(t, idp.claims("nonce-1")) }
+	c := newTestOIDCClient(idp)
+
+	if _, err := c.AuthCodeURL("state-1", "nonce-1", PKCEChallenge("verifier-1")); err != nil {
+		t.Fatal(err)
+	}
+	idp.challenge = PKCEChallenge("verifier-1")
+	// 別の code_verifier ではトークンと引き換えられないのだ
+	if _, err := c.Exchange(testCode, "verifier-2", "nonce-1"); !errors.Is(err, ErrOIDCTokenExchange) {
+		t.Fatalf("Exchange with wrong verifier error = %v, want ErrOIDCTokenExchange", err)
+	}
+	if _, err := c.Exchange(testCode, "verifier-1", "nonce-1"); err != nil {
+		t.Fatalf("Exchange with right verifier: %v", err)
+	}
+}
+
+func TestOIDCExchangeRefreshesKeysForUnknownKid(t *testing.T) {
+	idp := newMockIdP(t)
+	idp.idToken = func(idp *mockIdP) string { return idp.sign(t, idp.claims("nonce-1")) }
+	c := newTestOIDCClient(idp)
+
+	if _, err := login(t, c, idp, "nonce-1", "verifier-1"); err != nil {
+		t.Fatalf("first login: %v", err)
+	}
+	if idp.jwksHits != 1 {
+		t.Fatalf("jwks fetched %d times, want 1", idp.jwksHits)
+	}
+
+	// IdP が鍵を入れ替えたら、知らない kid のトークンで鍵を読み直すのだ
+	idp.rotateKey(t, "key-2")
+	c.mu.Lock()
+	c.keysFetchedAt = time.Now().Add(-2 * jwksRefreshInterval)
+	c.mu.Unlock()
+	if _, err := login(t, c, idp, "nonce-1", "verifier-1"); err != nil {
+		t.Fatalf("login after key rotation: %v", err)
+	}
+	if idp.jwksHits != 2 {
+		t.Fatalf("jwks fetched %d times, want 2", idp.jwksHits)
+	}
+
+	// 読み直したばかりのときは、知らない kid が来ても IdP を叩かないのだ
+	idp.rotateKey(t, "key-3")
+	if _, err := login(t, c, idp, "nonce-1", "verifier-1"); !errors.Is(err, ErrOIDCInvalidIDToken) {
+		t.Fatalf("login with unknown kid error = %v, want ErrOIDCInvalidIDToken", err)
+	}
+	if idp.jwksHits != 2 {
+		t.Fatalf("jwks fetched %d times, want 2", idp.jwksHits)
+	}
+}
@@ -0,0 +1,202 @@
+package infrastructure
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// 外部ライブラリなしで、文字と塗りつぶしの四角だけを描ける最小限の PDF ライターなのだ
+// ASCII は Helvetica、それ以外 (日本語など) は埋め込みなしの HeiseiKakuGo-W5 で書くのだ
+// (どちらも PDF ビューアーが持っている標準フォントなので、フォントファイルは要らないのだ)
+
+// PDFPointsPerMM は 1mm あたりのポイント数なのだ
+const PDFPointsPerMM = 72 / 25.4
+
+const (
+	pdfLatinFont = "F1"
+	pdfCJKFont   = "F2"
+)
+
+// pdfHelveticaWidths は Helvetica の ASCII 32〜126 の文字幅 (1000分率) なのだ
+var pdfHelveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// PDFDocument は全ページが同じ大きさの PDF なのだ。座標はポイントで、原点は左下なのだ
+type PDFDocument struct {
+	width  float64
+	height float64
+	pages  []*bytes.Buffer
+}
+
+func NewPDFDocument(width, height float64) *PDFDocument {
+	return &PDFDocument{width: width, height: height}
+}
+
+// AddPage は新しいページを追加して、以降の描画先にするのだ
+func (d *PDFDocument) AddPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+}
+
+func (d *PDFDocument) current() *bytes.Buffer {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+	return d.pages[len(d.pages)-1]
+}
+
+// Text は (x, y) をベースラインの左端として1行の文字を書くのだ
+func (d *PDFDocument) Text(x, y, size float64, text string) {
+	if text == "" {
+		return
+	}
+	buf := d.current()
+	fmt.Fprintf(buf, "BT %s %s Td ", pdfNumber(x), pdfNumber(y))
+	for _, run := range splitPDFRuns(text) {
+		if run.cjk {
+			fmt.Fprintf(buf, "/%s %s Tf <%s> Tj ", pdfCJKFont, pdfNumber(size), pdfUCS2Hex(run.text))
+		} else {
+			fmt.Fprintf(buf, "/%s %s Tf (%s) Tj ", pdfLatinFont, pdfNumber(size), pdfEscape(run.text))
+		}
+	}
+	buf.WriteString("ET\n")
+}
+
+// FillRect は黒で塗りつぶした四角を描くのだ
+func (d *PDFDocument) FillRect(x, y, w, h float64) {
+	fmt.Fprintf(d.current(), "%s %s %s %s re f\n", pdfNumber(x), pdfNumber(y), pdfNumber(w), pdfNumber(h))
+}
+
+// StrokeRect は四角の枠線を描くのだ
+func (d *PDFDocument) StrokeRect(x, y, w, h, lineWidth float64) {
+	fmt.Fprintf(d.current(), "%s w %s %s %s %s re S\n", pdfNumber(lineWidth), pdfNumber(x), pdfNumber(y), pdfNumber(w), pdfNumber(h))
+}
+
+// PDFTextWidth は Text で書いたときの文字列の幅 (ポイント) なのだ
+func PDFTextWidth(text string, size float64) float64 {
+	units := 0
+	for _, r := range text {
+		if r >= 32 && r <= 126 {
+			units += pdfHelveticaWidths[r-32]
+		} else {
+			units += 1000
+		}
+	}
+	return float64(units) * size / 1000
+}
+
+// Bytes は PDF ファイル全体を組み立てるのだ
+func (d *PDFDocument) Bytes() ([]byte, error) {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+
+	// オブジェクト番号: 1 カタログ, 2 ページツリー, 3〜6 フォント, 7 以降がページと内容なのだ
+	const firstPageObject = 7
+	var objects []string
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPageObject+i*2)
+	}
+
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type0 /BaseFont /HeiseiKakuGo-W5 /Encoding /UniJIS-UCS2-H /DescendantFonts [5 0 R] >>",
+		"<< /Type /Font /Subtype /CIDFontType0 /BaseFont /HeiseiKakuGo-W5 "+
+			"/CIDSystemInfo << /Registry (Adobe) /Ordering (Japan1) /Supplement 2 >> /FontDescriptor 6 0 R /DW 1000 >>",
+		"<< /Type /FontDescriptor /FontName /HeiseiKakuGo-W5 /Flags 4 /FontBBox [-92 -250 1010 922] "+
+			"/ItalicAngle 0 /Ascent 752 /Descent -221 /CapHeight 737 /StemV 114 >>",
+	)
+
+	for i, page := range d.pages {
+		var content bytes.Buffer
+		zw := zlib.NewWriter(&content)
+		if _, err := zw.Write(page.Bytes()); err != nil {
+			return nil, fmt.Errorf("PDFページの圧縮に失敗: %w", err)
+		}
+		if err := zw.Close(); err != nil {
+			return nil, fmt.Errorf("PDFページの圧縮に失敗: %w", err)
+		}
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] "+
+				"/Resources << /Font << /%s 3 0 R /%s 4 0 R >> >> /Contents %d 0 R >>",
+				pdfNumber(d.width), pdfNumber(d.height), pdfLatinFont, pdfCJKFont, firstPageObject+i*2+1),
+			fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", content.Len(), content.String()),
+		)
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return out.Bytes(), nil
+}
+
+type pdfRun struct {
+	text string
+	cjk  bool
+}
+
+// splitPDFRuns は文字列を ASCII の部分とそれ以外の部分に分けるのだ
+func splitPDFRuns(text string) []pdfRun {
+	var runs []pdfRun
+	var cur strings.Builder
+	curCJK := false
+	for _, r := range text {
+		cjk := r < 32 || r > 126
+		if cur.Len() > 0 && cjk != curCJK {
+			runs = append(runs, pdfRun{text: cur.String(), cjk: curCJK})
+			cur.Reset()
+		}
+		curCJK = cjk
+		cur.WriteRune(r)
+	}
+	if cur.Len() > 0 {
+		runs = append(runs, pdfRun{text: cur.String(), cjk: curCJK})
+	}
+	return runs
+}
+
+func pdfEscape(text string) string {
+	return strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`).Replace(text)
+}
+
+// pdfUCS2Hex は UniJIS-UCS2-H 用に UCS-2 (ビッグエンディアン) の16進にするのだ
+// UCS-2 で表せない文字と制御文字は〓にするのだ
+func pdfUCS2Hex(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		if r < 32 || r > 0xFFFF || utf16.IsSurrogate(r) {
+			r = '〓'
+		}
+		fmt.Fprintf(&b, "%04X", r)
+	}
+	return b.String()
+}
+
+// pdfNumber は小数点以下3桁までの数値にするのだ
+func pdfNumber(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1000)/1000, 'f', -1, 64)
+}
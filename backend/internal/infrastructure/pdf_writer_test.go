@@ -0,0 +1,82 @@
+package infrastructure
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPDFTextWidth(t *testing.T) {
+	tests := []struct {
+		text string
+		want float64
+	}{
+		// Helvetica の AFM の幅: H=722 e=556 l=222 l=222 o=556
+		{"Hello", 22.78},
+		{"", 0},
+		// ASCII 以外は全角 (1000) で数えるのだ
+		{"標本A", 10*2 + 6.67},
+	}
+	for _, tt := range tests {
+		if got := PDFTextWidth(tt.text, 10); fmt.Sprintf("%.2f", got) != fmt.Sprintf("%.2f", tt.want) {
+			t.Errorf("PDFTextWidth(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestPDFDocumentBytes(t *testing.T) {
+	doc := NewPDFDocument(100, 50)
+	doc.Text(10, 20, 8, "ID (1) 標本")
+	doc.FillRect(1, 2, 3, 4.5)
+	doc.AddPage()
+	doc.StrokeRect(0, 0, 100, 50, 0.25)
+
+	out, err := doc.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(out, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(out, []byte("%%EOF\n")) {
+		t.Fatal("missing PDF header or trailer")
+	}
+
+	// startxref が xref 表を指し、xref 表の各行が "N 0 obj" の位置を指していること
+	m := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(out)
+	if m == nil {
+		t.Fatal("startxref not found")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	if !bytes.HasPrefix(out[xref:], []byte("xref\n0 11\n")) {
+		t.Fatalf("startxref %d does not point at an xref table of 11 entries", xref)
+	}
+	lines := strings.Split(string(out[xref:]), "\n")
+	for i := 1; i <= 10; i++ {
+		offset, _ := strconv.Atoi(lines[2+i][:10])
+		if want := fmt.Sprintf("%d 0 obj\n", i); !bytes.HasPrefix(out[offset:], []byte(want)) {
+			t.Fatalf("xref entry %d points at %q", i, out[offset:offset+10])
+		}
+	}
+
+	// 1ページ目の内容を展開して、描画命令を確かめるのだ
+	streams := regexp.MustCompile(`(?s)/Length (\d+) /Filter /FlateDecode >>\nstream\n`).FindAllSubmatchIndex(out, -1)
+	if len(streams) != 2 {
+		t.Fatalf("content streams = %d, want 2", len(streams))
+	}
+	length, _ := strconv.Atoi(string(out[streams[0][2]:streams[0][3]]))
+	zr, err := zlib.NewReader(bytes.NewReader(out[streams[0][1] : streams[0][1]+length]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "BT 10 20 Td /F1 8 Tf (ID \\(1\\) ) Tj /F2 8 Tf <6A19672C> Tj ET\n1 2 3 4.5 re f\n"
+	if string(content) != want {
+		t.Fatalf("content = %q, want %q", content, want)
+	}
+}
@@ -0,0 +1,484 @@
+package infrastructure
+
+import "errors"
+
+// QR コード (JIS X 0510 / ISO/IEC 18004) のエンコーダーなのだ
+// 外部ライブラリなしで、バイトモードだけに対応しているのだ
+// (ラベルに載せる ID や短いコードを入れるだけなので、これで十分なのだ)
+
+var ErrQRDataTooLong = errors.New("QRコードに入りきらない長さです")
+
+// QRLevel は誤り訂正のレベルなのだ (L: 7%, M: 15%, Q: 25%, H: 30%)
+type QRLevel int
+
+const (
+	QRLevelL QRLevel = iota
+	QRLevelM
+	QRLevelQ
+	QRLevelH
+)
+
+// formatBits は形式情報に入れる2ビットなのだ (L=01, M=00, Q=11, H=10)
+func (l QRLevel) formatBits() int {
+	return [...]int{1, 0, 3, 2}[l]
+}
+
+// qrECCCodewordsPerBlock[レベル][型番] は1ブロックあたりの誤り訂正コード語数なのだ
+var qrECCCodewordsPerBlock = [4][41]int{
+	{-1, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{-1, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+// qrNumBlocks[レベル][型番] は RS ブロックの数なのだ
+var qrNumBlocks = [4][41]int{
+	{-1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{-1, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{-1, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{-1, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+// QRCode はエンコード済みの QR コードなのだ。Size × Size のモジュールを持つのだ
+type QRCode struct {
+	Size       int
+	version    int
+	level      QRLevel
+	modules    []bool
+	isFunction []bool
+}
+
+// Dark は (x, y) のモジュールが黒かどうかなのだ (左上が原点)
+func (q *QRCode) Dark(x, y int) bool {
+	return q.modules[y*q.Size+x]
+}
+
+// EncodeQR は data を入る一番小さい型番の QR コードにするのだ
+func EncodeQR(data []byte, level QRLevel) (*QRCode, error) {
+	for version := 1; version <= 40; version++ {
+		countBits := 8
+		if version >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+len(data)*8 <= qrNumDataCodewords(version, level)*8 {
+			return encodeQRVersion(data, version, level, countBits), nil
+		}
+	}
+	return nil, ErrQRDataTooLong
+}
+
+func encodeQRVersion(data []byte, version int, level QRLevel, countBits int) *QRCode {
+	// データのビット列: モード (0100 = バイト) + 文字数 + データ + 終端 + 埋め草
+	capacity := qrNumDataCodewords(version, level) * 8
+	var bits qrBitBuffer
+	bits.append(0x4, 4)
+	bits.append(len(data), countBits)
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+	bits.append(0, min(4, capacity-len(bits)))
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+
+	codewords := make([]byte, len(bits)/8)
+	for i, bit := range bits {
+		if bit {
+			codewords[i>>3] |= 1 << (7 - uint(i&7))
+		}
+	}
+
+	size := version*4 + 17
+	q := &QRCode{
+		Size:       size,
+		version:    version,
+		level:      level,
+		modules:    make([]bool, size*size),
+		isFunction: make([]bool, size*size),
+	}
+	q.drawFunctionPatterns()
+	q.drawCodewords(q.addECCAndInterleave(codewords))
+
+	// 評価点が一番低いマスクを選ぶのだ
+	bestMask, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		q.applyMask(mask)
+		q.drawFormatBits(mask)
+		if penalty := q.penaltyScore(); bestPenalty < 0 || penalty < bestPenalty {
+			bestMask, bestPenalty = mask, penalty
+		}
+		q.applyMask(mask) // XOR なのでもう一度かけると元に戻るのだ
+	}
+	q.applyMask(bestMask)
+	q.drawFormatBits(bestMask)
+	return q
+}
+
+type qrBitBuffer []bool
+
+func (b *qrBitBuffer) append(value, length int) {
+	for i := length - 1; i >= 0; i-- {
+		*b = append(*b, (value>>uint(i))&1 == 1)
+	}
+}
+
+// qrNumRawDataModules は機能パターン以外のモジュール数 (データ + 誤り訂正 + 余りビット) なのだ
+func qrNumRawDataModules(version int) int {
+	result := (16*version+128)*version + 64
+	if version >= 2 {
+		numAlign := version/7 + 2
+		result -= (25*numAlign-10)*numAlign - 55
+		if version >= 7 {
+			result -= 36
+		}
+	}
+	return result
+}
+
+func qrNumDataCodewords(version int, level QRLevel) int {
+	return qrNumRawDataModules(version)/8 - qrECCCodewordsPerBlock[level][version]*qrNumBlocks[level][version]
+}
+
+func (q *QRCode) setFunction(x, y int, dark bool) {
+	q.modules[y*q.Size+x] = dark
+	q.isFunction[y*q.Size+x] = true
+}
+
+func (q *QRCode) drawFunctionPatterns() {
+	// タイミングパターン
+	for i := 0; i < q.Size; i++ {
+		q.setFunction(6, i, i%2 == 0)
+		q.setFunction(i, 6, i%2 == 0)
+	}
+
+	// 位置検出パターン (3隅)
+	q.drawFinderPattern(3, 3)
+	q.drawFinderPattern(q.Size-4, 3)
+	q.drawFinderPattern(3, q.Size-4)
+
+	// 位置合わせパターン (位置検出パターンと重なるところは除くのだ)
+	positions := q.alignmentPatternPositions()
+	n := len(positions)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			if (i == 0 && j == 0) || (i == 0 && j == n-1) || (i == n-1 && j == 0) {
+				continue
+			}
+			q.drawAlignmentPattern(positions[i], positions[j])
+		}
+	}
+
+	// 形式情報はマスクを決めてから上書きするので、ここでは場所の確保だけなのだ
+	q.drawFormatBits(0)
+	q.drawVersion()
+}
+
+func (q *QRCode) drawFinderPattern(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || xx >= q.Size || yy < 0 || yy >= q.Size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			q.setFunction(xx, yy, dist != 2 && dist != 4)
+		}
+	}
+}
+
+func (q *QRCode) drawAlignmentPattern(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			q.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// alignmentPatternPositions は位置合わせパターンの中心の座標 (x, y 共通) なのだ
+func (q *QRCode) alignmentPatternPositions() []int {
+	if q.version == 1 {
+		return nil
+	}
+	numAlign := q.version/7 + 2
+	step := (q.version*8 + numAlign*3 + 5) / (numAlign*4 - 4) * 2
+	result := make([]int, numAlign)
+	result[0] = 6
+	for i, pos := numAlign-1, q.Size-7; i >= 1; i, pos = i-1, pos-step {
+		result[i] = pos
+	}
+	return result
+}
+
+// drawFormatBits は誤り訂正レベルとマスクの形式情報 (BCH(15,5)) を2か所に書くのだ
+func (q *QRCode) drawFormatBits(mask int) {
+	data := q.level.formatBits()<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+
+	for i := 0; i <= 5; i++ {
+		q.setFunction(8, i, qrBit(bits, i))
+	}
+	q.setFunction(8, 7, qrBit(bits, 6))
+	q.setFunction(8, 8, qrBit(bits, 7))
+	q.setFunction(7, 8, qrBit(bits, 8))
+	for i := 9; i < 15; i++ {
+		q.setFunction(14-i, 8, qrBit(bits, i))
+	}
+
+	for i := 0; i < 8; i++ {
+		q.setFunction(q.Size-1-i, 8, qrBit(bits, i))
+	}
+	for i := 8; i < 15; i++ {
+		q.setFunction(8, q.Size-15+i, qrBit(bits, i))
+	}
+	q.setFunction(8, q.Size-8, true) // 常に黒のモジュール
+}
+
+// drawVersion は型番情報 (BCH(18,6)) を書くのだ (型番7以上だけ)
+func (q *QRCode) drawVersion() {
+	if q.version < 7 {
+		return
+	}
+	rem := q.version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	bits := q.version<<12 | rem
+	for i := 0; i < 18; i++ {
+		dark := qrBit(bits, i)
+		a, b := q.Size-11+i%3, i/3
+		q.setFunction(a, b, dark)
+		q.setFunction(b, a, dark)
+	}
+}
+
+// addECCAndInterleave はブロックごとに RS 符号を付けて、コード語を交互に並べるのだ
+func (q *QRCode) addECCAndInterleave(data []byte) []byte {
+	numBlocks := qrNumBlocks[q.level][q.version]
+	blockECCLen := qrECCCodewordsPerBlock[q.level][q.version]
+	rawCodewords := qrNumRawDataModules(q.version) / 8
+	numShortBlocks := numBlocks - rawCodewords%numBlocks
+	shortBlockLen := rawCodewords / numBlocks
+
+	divisor := qrReedSolomonDivisor(blockECCLen)
+	blocks := make([][]byte, numBlocks)
+	for i, k := 0, 0; i < numBlocks; i++ {
+		n := shortBlockLen - blockECCLen
+		if i >= numShortBlocks {
+			n++
+		}
+		block := append([]byte{}, data[k:k+n]...)
+		k += n
+		ecc := qrReedSolomonRemainder(block, divisor)
+		if i < numShortBlocks {
+			block = append(block, 0) // 長いブロックと位置を揃えるための詰め物なのだ
+		}
+		blocks[i] = append(block, ecc...)
+	}
+
+	result := make([]byte, 0, rawCodewords)
+	for i := range blocks[0] {
+		for j, block := range blocks {
+			if i != shortBlockLen-blockECCLen || j >= numShortBlocks {
+				result = append(result, block[i])
+			}
+		}
+	}
+	return result
+}
+
+// drawCodewords は右下から2列ずつジグザグにデータを置くのだ
+func (q *QRCode) drawCodewords(data []byte) {
+	i := 0
+	for right := q.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // 縦のタイミングパターンは飛ばすのだ
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < q.Size; vert++ {
+			y := vert
+			if upward {
+				y = q.Size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if q.isFunction[y*q.Size+x] || i >= len(data)*8 {
+					continue
+				}
+				q.modules[y*q.Size+x] = qrBit(int(data[i>>3]), 7-(i&7))
+				i++
+			}
+		}
+	}
+}
+
+func (q *QRCode) applyMask(mask int) {
+	for y := 0; y < q.Size; y++ {
+		for x := 0; x < q.Size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !q.isFunction[y*q.Size+x] {
+				q.modules[y*q.Size+x] = !q.modules[y*q.Size+x]
+			}
+		}
+	}
+}
+
+// penaltyScore はマスク選択用の失点なのだ (規格の N1〜N4)
+func (q *QRCode) penaltyScore() int {
+	size := q.Size
+	score := 0
+
+	line := make([]bool, size)
+	for pass := 0; pass < 2; pass++ {
+		for a := 0; a < size; a++ {
+			for b := 0; b < size; b++ {
+				if pass == 0 {
+					line[b] = q.Dark(b, a)
+				} else {
+					line[b] = q.Dark(a, b)
+				}
+			}
+			score += qrLinePenalty(line)
+		}
+	}
+
+	// N2: 同じ色の 2×2
+	for y := 0; y < size-1; y++ {
+		for x := 0; x < size-1; x++ {
+			c := q.Dark(x, y)
+			if c == q.Dark(x+1, y) && c == q.Dark(x, y+1) && c == q.Dark(x+1, y+1) {
+				score += 3
+			}
+		}
+	}
+
+	// N4: 黒の割合が 50% からずれるほど失点なのだ
+	dark := 0
+	for _, m := range q.modules {
+		if m {
+			dark++
+		}
+	}
+	total := size * size
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	score += k * 10
+	return score
+}
+
+// qrLinePenalty は1行 (または1列) の N1 (同じ色の連続) と N3 (位置検出パターンに似た並び) なのだ
+func qrLinePenalty(line []bool) int {
+	score := 0
+	run := 1
+	for i := 1; i <= len(line); i++ {
+		if i < len(line) && line[i] == line[i-1] {
+			run++
+			continue
+		}
+		if run >= 5 {
+			score += 3 + run - 5
+		}
+		run = 1
+	}
+
+	// 黒白黒黒黒白黒 (1:1:3:1:1) の片側に白が4つ続くもの
+	pattern := []bool{true, false, true, true, true, false, true}
+	for i := 0; i+len(pattern) <= len(line); i++ {
+		match := true
+		for j, p := range pattern {
+			if line[i+j] != p {
+				match = false
+				break
+			}
+		}
+		if !match {
+			continue
+		}
+		if qrLightRun(line, i-4, i) || qrLightRun(line, i+len(pattern), i+len(pattern)+4) {
+			score += 40
+		}
+	}
+	return score
+}
+
+// qrLightRun は line[from:to] が白だけかどうかなのだ (範囲外は白として扱うのだ)
+func qrLightRun(line []bool, from, to int) bool {
+	for i := from; i < to; i++ {
+		if i >= 0 && i < len(line) && line[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// qrReedSolomonDivisor は GF(2^8) 上の生成多項式 (最高次の係数1は省略) なのだ
+func qrReedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = qrGFMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = qrGFMultiply(root, 0x02)
+	}
+	return result
+}
+
+func qrReedSolomonRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i := range result {
+			result[i] ^= qrGFMultiply(divisor[i], factor)
+		}
+	}
+	return result
+}
+
+// qrGFMultiply は GF(2^8) (既約多項式 0x11D) の掛け算なのだ
+func qrGFMultiply(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>uint(i))&1) * int(x)
+	}
+	return byte(z)
+}
+
+func qrBit(x, i int) bool {
+	return (x>>uint(i))&1 != 0
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
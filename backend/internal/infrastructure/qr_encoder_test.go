@@ -0,0 +1,395 @@
+package infrastructure
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// QR コードの確認は、規格 (JIS X 0510 / ISO/IEC 18004) の例と既知の値に合わせるのだ
+// 出来上がったモジュールは、テストの中の素朴な読み取り器で規格どおりに読み直して確かめるのだ
+
+func TestQRReedSolomonRemainder(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want []byte
+	}{
+		// ISO/IEC 18004 の付属書の例 ("01234567" を 1-M の数字モードで符号化したもの)
+		{
+			"01234567 1-M",
+			[]byte{0x10, 0x20, 0x0C, 0x56, 0x61, 0x80, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11},
+			[]byte{0xA5, 0x24, 0xD4, 0xC1, 0xED, 0x36, 0xC7, 0x87, 0x2C, 0x55},
+		},
+		// "HELLO WORLD" を 1-M の英数字モードで符号化したもの (よく使われる解説の例なのだ)
+		{
+			"HELLO WORLD 1-M",
+			[]byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17},
+			[]byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := qrReedSolomonRemainder(tt.data, qrReedSolomonDivisor(len(tt.want)))
+			if !bytes.Equal(got, tt.want) {
+				t.Fatalf("remainder = % X, want % X", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQRReedSolomonDivisor(t *testing.T) {
+	// 誤り訂正コード語7個の生成多項式 x^7 + 127x^6 + 122x^5 + 154x^4 + 164x^3 + 11x^2 + 68x + 117 なのだ
+	want := []byte{127, 122, 154, 164, 11, 68, 117}
+	if got := qrReedSolomonDivisor(7); !bytes.Equal(got, want) {
+		t.Fatalf("divisor = %v, want %v", got, want)
+	}
+}
+
+func TestQRFormatBits(t *testing.T) {
+	// マスク0のときの形式情報 (規格の表の値) なのだ
+	tests := []struct {
+		level QRLevel
+		want  int
+	}{
+		{QRLevelL, 0b111011111000100},
+		{QRLevelM, 0b101010000010010},
+		{QRLevelQ, 0b011010101011111},
+		{QRLevelH, 0b001011010001001},
+	}
+	for _, tt := range tests {
+		q := newTestQRCode(1, tt.level)
+		q.drawFormatBits(0)
+		first, second := readQRFormatBits(q)
+		if first != tt.want || second != tt.want {
+			t.Errorf("level %d: format bits = %015b / %015b, want %015b", tt.level, first, second, tt.want)
+		}
+	}
+}
+
+func TestQRVersionBits(t *testing.T) {
+	// 型番7の型番情報 (規格の表の値 0x07C94) なのだ
+	q := newTestQRCode(7, QRLevelM)
+	q.drawVersion()
+	got, transposed := 0, 0
+	for i := 0; i < 18; i++ {
+		a, b := q.Size-11+i%3, i/3
+		if q.Dark(a, b) {
+			got |= 1 << i
+		}
+		if q.Dark(b, a) {
+			transposed |= 1 << i
+		}
+	}
+	if got != 0x07C94 || transposed != 0x07C94 {
+		t.Fatalf("version bits = %05X / %05X, want 07C94", got, transposed)
+	}
+}
+
+func TestEncodeQRHelloWorld(t *testing.T) {
+	hello := []byte{0x40, 0xB4, 0x84, 0x54, 0xC4, 0xC4, 0xF2, 0x05, 0x74, 0xF5, 0x24, 0xC4, 0x40}
+	tests := []struct {
+		level   QRLevel
+		version int
+		// data はバイトモードの "HELLO WORLD" に終端と埋め草を付けたデータコード語なのだ
+		data []byte
+	}{
+		{QRLevelL, 1, append(append([]byte{}, hello...), 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11)},
+		{QRLevelM, 1, append(append([]byte{}, hello...), 0xEC, 0x11, 0xEC)},
+		{QRLevelQ, 1, hello},
+		{QRLevelH, 2, append(append([]byte{}, hello...), 0xEC, 0x11, 0xEC)},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("level %d", tt.level), func(t *testing.T) {
+			q, err := EncodeQR([]byte("HELLO WORLD"), tt.level)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if q.Size != tt.version*4+17 {
+				t.Fatalf("size = %d, want version %d", q.Size, tt.version)
+			}
+			data, payload := decodeTestQR(t, q, tt.level)
+			if !bytes.Equal(data, tt.data) {
+				t.Fatalf("data codewords = % X, want % X", data, tt.data)
+			}
+			if string(payload) != "HELLO WORLD" {
+				t.Fatalf("payload = %q", payload)
+			}
+		})
+	}
+}
+
+func TestEncodeQRRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		level   QRLevel
+		version int
+	}{
+		{"short code URL", "https://example.org/r/7K3M9QXA", QRLevelM, 3},
+		// 5-Q は短いブロック2つと長いブロック2つに分かれるのだ
+		{"mixed block lengths", "urn:uuid:0f8fad5b-d9cb-469f-a165-70867728950e/0123456789ab", QRLevelQ, 5},
+		{"version information", string(bytes.Repeat([]byte("0123456789"), 14)), QRLevelL, 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := EncodeQR([]byte(tt.payload), tt.level)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if q.Size != tt.version*4+17 {
+				t.Fatalf("size = %d, want version %d", q.Size, tt.version)
+			}
+			if _, payload := decodeTestQR(t, q, tt.level); string(payload) != tt.payload {
+				t.Fatalf("payload = %q, want %q", payload, tt.payload)
+			}
+		})
+	}
+}
+
+func TestEncodeQRTooLong(t *testing.T) {
+	// 40-L のバイトモードに入るのは 2953 バイトまでなのだ
+	if _, err := EncodeQR(make([]byte, 2953), QRLevelL); err != nil {
+		t.Fatalf("2953 bytes: %v", err)
+	}
+	if _, err := EncodeQR(make([]byte, 2954), QRLevelL); err != ErrQRDataTooLong {
+		t.Fatalf("2954 bytes error = %v, want ErrQRDataTooLong", err)
+	}
+}
+
+func newTestQRCode(version int, level QRLevel) *QRCode {
+	size := version*4 + 17
+	return &QRCode{
+		Size:       size,
+		version:    version,
+		level:      level,
+		modules:    make([]bool, size*size),
+		isFunction: make([]bool, size*size),
+	}
+}
+
+// readQRFormatBits は左上と右上・左下の2か所の形式情報を読むのだ
+func readQRFormatBits(q *QRCode) (int, int) {
+	var first, second int
+	set := func(bits *int, i, x, y int) {
+		if q.Dark(x, y) {
+			*bits |= 1 << i
+		}
+	}
+	for i := 0; i <= 5; i++ {
+		set(&first, i, 8, i)
+	}
+	set(&first, 6, 8, 7)
+	set(&first, 7, 8, 8)
+	set(&first, 8, 7, 8)
+	for i := 9; i < 15; i++ {
+		set(&first, i, 14-i, 8)
+	}
+	for i := 0; i < 8; i++ {
+		set(&second, i, q.Size-1-i, 8)
+	}
+	for i := 8; i < 15; i++ {
+		set(&second, i, 8, q.Size-15+i)
+	}
+	return first, second
+}
+
+// testQRAlignment は型番ごとの位置合わせパターンの中心 (規格の付属書の表) なのだ
+var testQRAlignment = map[int][]int{
+	1: nil, 2: {6, 18}, 3: {6, 22}, 4: {6, 26}, 5: {6, 30}, 6: {6, 34}, 7: {6, 22, 38},
+}
+
+// testQRFunctionModules はデータを置かないモジュールの地図を、規格の配置から作るのだ
+func testQRFunctionModules(t *testing.T, version int) []bool {
+	t.Helper()
+	positions, ok := testQRAlignment[version]
+	if !ok {
+		t.Fatalf("no alignment table for version %d", version)
+	}
+	size := version*4 + 17
+	function := make([]bool, size*size)
+	mark := func(x0, y0, x1, y1 int) {
+		for y := max(y0, 0); y <= min(y1, size-1); y++ {
+			for x := max(x0, 0); x <= min(x1, size-1); x++ {
+				function[y*size+x] = true
+			}
+		}
+	}
+	// 位置検出パターンと分離パターン、形式情報
+	mark(0, 0, 8, 8)
+	mark(size-8, 0, size-1, 8)
+	mark(0, size-8, 8, size-1)
+	// タイミングパターン
+	mark(6, 0, 6, size-1)
+	mark(0, 6, size-1, 6)
+	for i, cy := range positions {
+		for j, cx := range positions {
+			last := len(positions) - 1
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			mark(cx-2, cy-2, cx+2, cy+2)
+		}
+	}
+	if version >= 7 {
+		mark(size-11, 0, size-9, 5)
+		mark(0, size-11, 5, size-9)
+	}
+	return function
+}
+
+// decodeTestQR は規格の手順で QR コードを読み直すのだ
+// 形式情報の検査・マスクの解除・コード語の読み出し・ブロックの並べ直し・シンドロームの検査をして、
+// データコード語とバイトモードの中身を返すのだ
+func decodeTestQR(t *testing.T, q *QRCode, wantLevel QRLevel) ([]byte, []byte) {
+	t.Helper()
+	size := q.Size
+	version := (size - 17) / 4
+	if !q.Dark(8, size-8) {
+		t.Fatal("dark module is light")
+	}
+
+	// 形式情報: 2か所が同じで、BCH(15,5) の検査に通ること
+	first, second := readQRFormatBits(q)
+	if first != second {
+		t.Fatalf("format copies differ: %015b / %015b", first, second)
+	}
+	format := first ^ 0x5412
+	data := format >> 10
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	if format&0x3FF != rem {
+		t.Fatalf("format BCH check failed: %015b", first)
+	}
+	levelBits := map[int]QRLevel{1: QRLevelL, 0: QRLevelM, 3: QRLevelQ, 2: QRLevelH}
+	if level := levelBits[data>>3]; level != wantLevel {
+		t.Fatalf("format level = %d, want %d", level, wantLevel)
+	}
+	mask := data & 7
+
+	// 位置検出パターン (3隅)
+	for _, c := range [][2]int{{3, 3}, {size - 4, 3}, {3, size - 4}} {
+		for dy := -3; dy <= 3; dy++ {
+			for dx := -3; dx <= 3; dx++ {
+				d := max(abs(dx), abs(dy))
+				if q.Dark(c[0]+dx, c[1]+dy) != (d != 2) {
+					t.Fatalf("finder pattern at %v is broken", c)
+				}
+			}
+		}
+	}
+
+	// マスクを外しながら、右下から2列ずつジグザグにビットを読むのだ
+	masks := []func(x, y int) bool{
+		func(x, y int) bool { return (x+y)%2 == 0 },
+		func(x, y int) bool { return y%2 == 0 },
+		func(x, y int) bool { return x%3 == 0 },
+		func(x, y int) bool { return (x+y)%3 == 0 },
+		func(x, y int) bool { return (x/3+y/2)%2 == 0 },
+		func(x, y int) bool { return x*y%2+x*y%3 == 0 },
+		func(x, y int) bool { return (x*y%2+x*y%3)%2 == 0 },
+		func(x, y int) bool { return ((x+y)%2+x*y%3)%2 == 0 },
+	}
+	function := testQRFunctionModules(t, version)
+	var bits []bool
+	for right := size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < size; vert++ {
+			y := vert
+			if upward {
+				y = size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if function[y*size+x] {
+					continue
+				}
+				bits = append(bits, q.Dark(x, y) != masks[mask](x, y))
+			}
+		}
+	}
+	raw := make([]byte, len(bits)/8)
+	for i := range raw {
+		for j := 0; j < 8; j++ {
+			if bits[i*8+j] {
+				raw[i] |= 1 << (7 - j)
+			}
+		}
+	}
+
+	// ブロックごとに並べ直すのだ (データは短いブロックから、誤り訂正は全ブロック同じ長さなのだ)
+	numBlocks := qrNumBlocks[wantLevel][version]
+	eccLen := qrECCCodewordsPerBlock[wantLevel][version]
+	totalData := len(raw) - numBlocks*eccLen
+	shortLen := totalData / numBlocks
+	numLong := totalData % numBlocks
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := 0; i <= shortLen; i++ {
+		for b := range blocks {
+			if i < shortLen || b >= numBlocks-numLong {
+				blocks[b] = append(blocks[b], raw[k])
+				k++
+			}
+		}
+	}
+	for i := 0; i < eccLen; i++ {
+		for b := range blocks {
+			blocks[b] = append(blocks[b], raw[k])
+			k++
+		}
+	}
+
+	// シンドローム (α^0〜α^(eccLen-1) での値) がすべて0なら誤りのない符号語なのだ
+	var dataCodewords []byte
+	for b, block := range blocks {
+		alpha := byte(1)
+		for i := 0; i < eccLen; i++ {
+			var s byte
+			for _, c := range block {
+				s = qrGFMultiply(s, alpha) ^ c
+			}
+			if s != 0 {
+				t.Fatalf("block %d: syndrome %d = %d", b, i, s)
+			}
+			alpha = qrGFMultiply(alpha, 2)
+		}
+		dataCodewords = append(dataCodewords, block[:len(block)-eccLen]...)
+	}
+
+	// バイトモード (0100) + 文字数 + 中身
+	if dataCodewords[0]>>4 != 0x4 {
+		t.Fatalf("mode = %04b, want byte mode", dataCodewords[0]>>4)
+	}
+	var stream qrBitReader = qrBitReader{data: dataCodewords, pos: 4}
+	countBits := 8
+	if version >= 10 {
+		countBits = 16
+	}
+	n := stream.read(countBits)
+	payload := make([]byte, n)
+	for i := range payload {
+		payload[i] = byte(stream.read(8))
+	}
+	return dataCodewords, payload
+}
+
+type qrBitReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *qrBitReader) read(n int) int {
+	v := 0
+	for i := 0; i < n; i++ {
+		bit := (r.data[r.pos>>3] >> (7 - uint(r.pos&7))) & 1
+		v = v<<1 | int(bit)
+		r.pos++
+	}
+	return v
+}
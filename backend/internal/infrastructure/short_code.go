@@ -0,0 +1,51 @@
+package infrastructure
+
+import (
+	"crypto/rand"
+	"strings"
+)
+
+// 短いコードは Crockford Base32 (0-9 と I L O U を除く英大文字) の8文字 (40ビット) なのだ
+// 手で打ち込んだときの読み間違い (O と 0、I・L と 1) は NormalizeShortCode で吸収するのだ
+
+const (
+	ShortCodeLength   = 8
+	shortCodeAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+)
+
+// NewShortCode はランダムな短いコードを作るのだ (重複の確認は呼び出し側で DB に任せるのだ)
+func NewShortCode() string {
+	var b [ShortCodeLength]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	code := make([]byte, ShortCodeLength)
+	for i, v := range b {
+		code[i] = shortCodeAlphabet[v&31]
+	}
+	return string(code)
+}
+
+// NormalizeShortCode は区切りの - や空白を除いて大文字にし、紛らわしい文字を直すのだ
+// 短いコードとして読めなければ false を返すのだ
+func NormalizeShortCode(s string) (string, bool) {
+	var b strings.Builder
+	for _, c := range strings.ToUpper(s) {
+		switch c {
+		case '-', ' ':
+			continue
+		case 'O':
+			c = '0'
+		case 'I', 'L':
+			c = '1'
+		}
+		if !strings.ContainsRune(shortCodeAlphabet, c) {
+			return "", false
+		}
+		b.WriteRune(c)
+	}
+	if b.Len() != ShortCodeLength {
+		return "", false
+	}
+	return b.String(), true
+}
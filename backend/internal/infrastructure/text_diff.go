@@ -0,0 +1,215 @@
+package infrastructure
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 行単位の差分 (Wiki の版の比較用) なのだ
+// 最長共通部分列 (LCS) で比べるのだ。大きすぎる文章は全体の置き換えとして扱うのだ
+
+// maxDiffCells は LCS の表の大きさの上限なのだ (これを超えると全体の置き換えにするのだ)
+const maxDiffCells = 4_000_000
+
+// DiffOp は差分の1行の種類なのだ
+type DiffOp string
+
+const (
+	DiffEqual  DiffOp = "equal"
+	DiffInsert DiffOp = "insert"
+	DiffDelete DiffOp = "delete"
+)
+
+// DiffLine は差分の1行なのだ。行番号は 1 始まりで、その版に無い行は 0 なのだ
+type DiffLine struct {
+	Op      DiffOp `json:"op"`
+	OldLine int    `json:"old_line,omitempty"`
+	NewLine int    `json:"new_line,omitempty"`
+	Text    string `json:"text"`
+}
+
+// DiffLines は old から new への行単位の差分を返すのだ
+func DiffLines(oldText, newText string) []DiffLine {
+	a := splitDiffLines(oldText)
+	b := splitDiffLines(newText)
+
+	// 先頭と末尾の同じ行は表を作らずに済ませるのだ
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	lines := make([]DiffLine, 0, len(a)+len(b))
+	for i := 0; i < prefix; i++ {
+		lines = append(lines, DiffLine{Op: DiffEqual, OldLine: i + 1, NewLine: i + 1, Text: a[i]})
+	}
+	lines = append(lines, diffMiddle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix], prefix, prefix)...)
+	for i := 0; i < suffix; i++ {
+		oi, ni := len(a)-suffix+i, len(b)-suffix+i
+		lines = append(lines, DiffLine{Op: DiffEqual, OldLine: oi + 1, NewLine: ni + 1, Text: a[oi]})
+	}
+	return lines
+}
+
+func diffMiddle(a, b []string, oldOffset, newOffset int) []DiffLine {
+	var lines []DiffLine
+	if len(a)*len(b) > maxDiffCells {
+		for i, l := range a {
+			lines = append(lines, DiffLine{Op: DiffDelete, OldLine: oldOffset + i + 1, Text: l})
+		}
+		for j, l := range b {
+			lines = append(lines, DiffLine{Op: DiffInsert, NewLine: newOffset + j + 1, Text: l})
+		}
+		return lines
+	}
+
+	// lcs[i][j] は a[i:] と b[j:] の最長共通部分列の長さなのだ
+	lcs := make([][]int32, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, DiffLine{Op: DiffEqual, OldLine: oldOffset + i + 1, NewLine: newOffset + j + 1, Text: a[i]})
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] > lcs[i+1][j]):
+			lines = append(lines, DiffLine{Op: DiffInsert, NewLine: newOffset + j + 1, Text: b[j]})
+			j++
+		default:
+			lines = append(lines, DiffLine{Op: DiffDelete, OldLine: oldOffset + i + 1, Text: a[i]})
+			i++
+		}
+	}
+	return lines
+}
+
+// UnifiedDiff は差分を unified 形式 (diff -u) の文字列にするのだ
+// context は変更の前後に残す同じ行の数なのだ
+func UnifiedDiff(oldName, newName string, lines []DiffLine, context int) string {
+	var b strings.Builder
+	changed := false
+	for _, l := range lines {
+		if l.Op != DiffEqual {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return ""
+	}
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+
+	for start := 0; start < len(lines); {
+		// 次の変更を探して、前後の context 行を含めた範囲をひとかたまり (hunk) にするのだ
+		first := start
+		for first < len(lines) && lines[first].Op == DiffEqual {
+			first++
+		}
+		if first == len(lines) {
+			break
+		}
+		from := max(first-context, start)
+		to := first
+		for to < len(lines) {
+			if lines[to].Op != DiffEqual {
+				to++
+				continue
+			}
+			run := to
+			for run < len(lines) && lines[run].Op == DiffEqual {
+				run++
+			}
+			if run == len(lines) || run-to > 2*context {
+				to = min(to+context, len(lines))
+				break
+			}
+			to = run
+		}
+
+		oldStart, newStart, oldCount, newCount := 0, 0, 0, 0
+		for _, l := range lines[from:to] {
+			if l.Op != DiffInsert {
+				if oldStart == 0 {
+					oldStart = l.OldLine
+				}
+				oldCount++
+			}
+			if l.Op != DiffDelete {
+				if newStart == 0 {
+					newStart = l.NewLine
+				}
+				newCount++
+			}
+		}
+		// 片方に行が無いときは、その直前の行番号を書くのだ (diff -u と同じなのだ)
+		if oldCount == 0 {
+			oldStart = precedingLine(lines[:from+1], true)
+		}
+		if newCount == 0 {
+			newStart = precedingLine(lines[:from+1], false)
+		}
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount))
+		for _, l := range lines[from:to] {
+			switch l.Op {
+			case DiffInsert:
+				b.WriteString("+")
+			case DiffDelete:
+				b.WriteString("-")
+			default:
+				b.WriteString(" ")
+			}
+			b.WriteString(l.Text)
+			b.WriteString("\n")
+		}
+		start = to
+	}
+	return b.String()
+}
+
+// precedingLine は lines の中で最後に出てくる old (または new) の行番号なのだ
+func precedingLine(lines []DiffLine, old bool) int {
+	for i := len(lines) - 1; i >= 0; i-- {
+		if old && lines[i].OldLine > 0 {
+			return lines[i].OldLine
+		}
+		if !old && lines[i].NewLine > 0 {
+			return lines[i].NewLine
+		}
+	}
+	return 0
+}
+
+func hunkRange(start, count int) string {
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// splitDiffLines は改行で行に分けるのだ。最後の改行の後ろの空行は数えないのだ
+func splitDiffLines(s string) []string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
@@ -1,6 +1,10 @@
 package infrastructure
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"time"
@@ -8,11 +12,32 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func GenerateToken(userID string) (string, error) {
+// アクセストークン (JWT) は短い時間だけ使えて、切れたらリフレッシュトークンで取り直すのだ
+// JWT にはログインのセッション ID (sid) を入れて、ログアウトしたセッションは AuthMiddleware で弾くのだ
+
+const (
+	defaultAccessTokenTTL  = 15 * time.Minute
+	defaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// AccessTokenTTL はアクセストークンの有効期間なのだ (環境変数 ACCESS_TOKEN_TTL で変えられるのだ)
+func AccessTokenTTL() time.Duration {
+	return durationEnv("ACCESS_TOKEN_TTL", defaultAccessTokenTTL)
+}
+
+// RefreshTokenTTL はリフレッシュトークンの有効期間なのだ (環境変数 REFRESH_TOKEN_TTL で変えられるのだ)
+// 使うたびに新しいトークンに替わるので、この期間使わなければログインし直しになるのだ
+func RefreshTokenTTL() time.Duration {
+	return durationEnv("REFRESH_TOKEN_TTL", defaultRefreshTokenTTL)
+}
+
+func GenerateToken(userID string, sessionID string) (string, error) {
 	claims := jwt.MapClaims{}
 	claims["authorized"] = true
 	claims["user_id"] = userID
-	claims["exp"] = time.Now().Add(time.Hour * 24).Unix() 
+	claims["sid"] = sessionID
+	claims["iat"] = time.Now().Unix()
+	claims["exp"] = time.Now().Add(AccessTokenTTL()).Unix()
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	secret := os.Getenv("JWT_SECRET")
@@ -26,10 +51,11 @@ func GenerateToken(userID string) (string, error) {
 	return tokenString, nil
 }
 
-func ValidateToken(tokenString string) (string, error) {
+// ValidateToken はアクセストークンを検証して、ユーザー ID とセッション ID を返すのだ
+func ValidateToken(tokenString string) (string, string, error) {
 	secret := os.Getenv("JWT_SECRET")
 	if secret == "" {
-		return "", fmt.Errorf("JWT_SECRET が設定されていません")
+		return "", "", fmt.Errorf("JWT_SECRET が設定されていません")
 	}
 
 	// トークンをパース（解析）する
@@ -42,16 +68,53 @@ func ValidateToken(tokenString string) (string, error) {
 	})
 
 	if err != nil {
-		return "", err // (有効期限切れなどもここに含まれる)
+		return "", "", err // (有効期限切れなどもここに含まれる)
 	}
 
 	// トークンが有効で、中身（Claims）がMapClaims形式かチェック
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		// "user_id" を取り出す
-		if userID, ok := claims["user_id"].(string); ok {
-			return userID, nil
+		// "user_id" と "sid" を取り出す
+		// sid の無いトークンはセッションを取り消せないので受け付けないのだ
+		userID, ok1 := claims["user_id"].(string)
+		sessionID, ok2 := claims["sid"].(string)
+		if ok1 && ok2 && sessionID != "" {
+			return userID, sessionID, nil
 		}
 	}
 
-	return "", fmt.Errorf("無効なトークンです")
+	return "", "", fmt.Errorf("無効なトークンです")
+}
+
+// NewSecretToken はランダムなトークン (URL に使える Base64 の 43文字) を作るのだ
+// リフレッシュトークンや、メールで送る確認・パスワード再設定のトークンに使うのだ
+func NewSecretToken() string {
+	var b [32]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b[:])
+}
+
+// HashSecretToken は DB に保存するためのトークンのハッシュ (SHA-256) なのだ
+// トークンそのものは保存しないので、DB が漏れてもそのままでは使えないのだ
+func HashSecretToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// APITokenPrefix は個人アクセストークンの先頭の文字なのだ (JWT と見分けるのに使うのだ)
+const APITokenPrefix = "wop_"
+
+// NewAPIToken は個人アクセストークンを作るのだ
+func NewAPIToken() string {
+	return APITokenPrefix + NewSecretToken()
+}
+
+func durationEnv(key string, fallback time.Duration) time.Duration {
+	if v := os.Getenv(key); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return fallback
 }
@@ -0,0 +1,39 @@
+package infrastructure
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+)
+
+// NewUUID はランダムな UUID (version 4) を作るのだ
+// DB の gen_random_uuid() を使えないところ (CouchDB に先に書くときなど) で使うのだ
+func NewUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// IsUUID は s が 8-4-4-4-12 の16進の UUID の形かどうかなのだ (大文字小文字は問わないのだ)
+func IsUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i, c := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,136 @@
+package infrastructure
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// XLSXWriter は1シートだけの xlsx を行単位でストリーミング出力するのだ
+// 全行をメモリに持たないので、大量のエクスポートでも大丈夫なのだ
+type XLSXWriter struct {
+	zw    *zip.Writer
+	sheet *bufio.Writer
+	row   int
+}
+
+// XLSXCell は1セル分の値なのだ。Number が nil でなければ数値セルになるのだ
+type XLSXCell struct {
+	Text   string
+	Number *float64
+}
+
+func NewXLSXWriter(w io.Writer, sheetName string) (*XLSXWriter, error) {
+	zw := zip.NewWriter(w)
+
+	files := []struct {
+		name string
+		body string
+	}{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", fmt.Sprintf(xlsxWorkbook, xmlEscape(sheetName))},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	}
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return nil, fmt.Errorf("xlsxの作成に失敗: %w", err)
+		}
+		if _, err := io.WriteString(fw, f.body); err != nil {
+			return nil, fmt.Errorf("xlsxの書き込みに失敗: %w", err)
+		}
+	}
+
+	// シートは最後に作るので、以降の書き込みはすべてこのエントリに入るのだ
+	sw, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, fmt.Errorf("xlsxシートの作成に失敗: %w", err)
+	}
+	sheet := bufio.NewWriter(sw)
+	if _, err := sheet.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`); err != nil {
+		return nil, err
+	}
+
+	return &XLSXWriter{zw: zw, sheet: sheet}, nil
+}
+
+// WriteRow は1行を書き込むのだ
+func (x *XLSXWriter) WriteRow(cells []XLSXCell) error {
+	x.row++
+	if _, err := fmt.Fprintf(x.sheet, `<row r="%d">`, x.row); err != nil {
+		return err
+	}
+	for i, cell := range cells {
+		ref := xlsxColumnName(i) + strconv.Itoa(x.row)
+		var err error
+		if cell.Number != nil {
+			_, err = fmt.Fprintf(x.sheet, `<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(*cell.Number, 'f', -1, 64))
+		} else if cell.Text != "" {
+			_, err = fmt.Fprintf(x.sheet, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, xmlEscape(cell.Text))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err := x.sheet.WriteString(`</row>`)
+	return err
+}
+
+// WriteStrings は文字列だけの行（ヘッダーなど）を書き込むのだ
+func (x *XLSXWriter) WriteStrings(values []string) error {
+	cells := make([]XLSXCell, len(values))
+	for i, v := range values {
+		cells[i] = XLSXCell{Text: v}
+	}
+	return x.WriteRow(cells)
+}
+
+// Close はシートを閉じて zip を完成させるのだ
+func (x *XLSXWriter) Close() error {
+	if _, err := x.sheet.WriteString(`</sheetData></worksheet>`); err != nil {
+		return err
+	}
+	if err := x.sheet.Flush(); err != nil {
+		return err
+	}
+	return x.zw.Close()
+}
+
+// xlsxColumnName は 0 始まりの列番号を A, B, ..., Z, AA ... に変換するのだ
+func xlsxColumnName(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+const xlsxContentTypes = xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+	`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+	`</Types>`
+
+const xlsxRootRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+const xlsxWorkbook = xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+	`<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets></workbook>`
+
+const xlsxWorkbookRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+	`</Relationships>`
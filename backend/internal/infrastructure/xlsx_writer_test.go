@@ -0,0 +1,71 @@
+package infrastructure
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestXLSXColumnName(t *testing.T) {
+	tests := map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA", 16383: "XFD"}
+	for index, want := range tests {
+		if got := xlsxColumnName(index); got != want {
+			t.Errorf("xlsxColumnName(%d) = %q, want %q", index, got, want)
+		}
+	}
+}
+
+func TestXLSXWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewXLSXWriter(&buf, "標本 & 観察")
+	if err != nil {
+		t.Fatal(err)
+	}
+	length := 12.5
+	if err := w.WriteStrings([]string{"name", "body_length"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteRow([]XLSXCell{{Text: "<Apis>"}, {Number: &length}, {}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(body)
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/worksheets/sheet1.xml"} {
+		if _, ok := files[name]; !ok {
+			t.Fatalf("missing %s", name)
+		}
+	}
+	if !strings.Contains(files["xl/workbook.xml"], `name="標本 &amp; 観察"`) {
+		t.Fatalf("workbook.xml = %s", files["xl/workbook.xml"])
+	}
+
+	// 空のセルは書かず、文字列はインライン文字列、数値は <v> にするのだ
+	want := `<sheetData>` +
+		`<row r="1"><c r="A1" t="inlineStr"><is><t xml:space="preserve">name</t></is></c>` +
+		`<c r="B1" t="inlineStr"><is><t xml:space="preserve">body_length</t></is></c></row>` +
+		`<row r="2"><c r="A2" t="inlineStr"><is><t xml:space="preserve">&lt;Apis&gt;</t></is></c>` +
+		`<c r="B2"><v>12.5</v></c></row>` +
+		`</sheetData></worksheet>`
+	if sheet := files["xl/worksheets/sheet1.xml"]; !strings.HasSuffix(sheet, want) {
+		t.Fatalf("sheet1.xml = %s", sheet)
+	}
+}
@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saku-730/web-occurrence/backend/internal/infrastructure"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+)
+
+// 個人アクセストークンで使える API なのだ
+// どのワークステーションのデータかが URL から分かる API だけを通して、トークンのワークステーションと比べるのだ
+// (記録の ID だけで指定する API やアカウントの操作は、ログインして使ってもらうのだ)
+
+// apiTokenMetaRoutes はワークステーションのデータを返さない、読むだけの API なのだ
+var apiTokenMetaRoutes = map[string]bool{
+	"/api/users/me":        true,
+	"/api/my-workstations": true,
+	"/api/label-templates": true,
+	"/api/ogc":             true,
+	"/api/ogc/conformance": true,
+	"/api/ogc/collections": true,
+}
+
+// apiTokenQueryRoutes は ?workstation_id= でワークステーションを指定する検索の API なのだ
+// トークンでは workstation_id を必ず指定してもらうのだ
+var apiTokenQueryRoutes = map[string]bool{
+	"/api/search":         true,
+	"/api/search/export":  true,
+	"/api/search/mesh":    true,
+	"/api/search/rollup":  true,
+	"/api/tiles/:z/:x/:y": true,
+}
+
+// apiTokenReadPostRoutes は POST だけど何も書き換えない API なのだ (読むだけのトークンでも使えるのだ)
+var apiTokenReadPostRoutes = map[string]bool{
+	"/api/workstation/:workstation_id/specimens/labels": true,
+	"/api/workstation/:workstation_id/wiki/preview":     true,
+}
+
+// apiTokenSessionOnlyRoutes はワークステーションの設定やメンバーを変える管理者向けの API なのだ
+// トークンが漏れたときに設定まで変えられないように、ログインして使ってもらうのだ
+var apiTokenSessionOnlyRoutes = map[string]bool{
+	"POST /api/workstation/:workstation_id/sensitive-taxa":                          true,
+	"PUT /api/workstation/:workstation_id/sensitive-taxa/:sensitive_taxon_id":       true,
+	"DELETE /api/workstation/:workstation_id/sensitive-taxa/:sensitive_taxon_id":    true,
+	"POST /api/workstation/:workstation_id/taxa/import":                             true,
+	"PUT /api/workstation/:workstation_id/catalog-sequences":                        true,
+	"POST /api/workstation/:workstation_id/storage-locations":                       true,
+	"PUT /api/workstation/:workstation_id/storage-locations/:location_id":           true,
+	"DELETE /api/workstation/:workstation_id/storage-locations/:location_id":        true,
+	"POST /api/workstation/:workstation_id/behavior-terms":                          true,
+	"PUT /api/workstation/:workstation_id/behavior-terms/:term_id":                  true,
+	"DELETE /api/workstation/:workstation_id/behavior-terms/:term_id":               true,
+	"PUT /api/workstation/:workstation_id/projects/:project_id/members/:user_id":    true,
+	"DELETE /api/workstation/:workstation_id/projects/:project_id/members/:user_id": true,
+}
+
+// apiTokenReadCouchDBPosts は CouchDB の POST のうち、読むだけのものなのだ
+var apiTokenReadCouchDBPosts = map[string]bool{
+	"_all_docs": true,
+	"_bulk_get": true,
+	"_find":     true,
+	"_changes":  true,
+}
+
+// couchDBWorkstationDB は CouchDB のワークステーションの DB 名 (db_ws_<ID>) なのだ
+var couchDBWorkstationDB = regexp.MustCompile(`^[a-z0-9]+_ws_([0-9]+)$`)
+
+// apiTokenAllows はこのリクエストを個人アクセストークンで通してよいかを決めるのだ
+// だめなときは理由を返すのだ
+func apiTokenAllows(c *gin.Context, p *model.APITokenPrincipal) (string, bool) {
+	route := c.FullPath()
+	method := c.Request.Method
+	reading := method == http.MethodGet || method == http.MethodHead
+
+	if apiTokenSessionOnlyRoutes[method+" "+route] {
+		return "このAPIはログインして使ってほしいのだ", false
+	}
+
+	var wsID string
+	switch {
+	case route == "/api/couchdb/*path":
+		// 中継するときと同じ、整理したパスの DB 名で確かめるのだ
+		path, _, err := infrastructure.CouchDBProxyPath(c.Request.URL)
+		if err != nil {
+			return "CouchDB のパスが正しくないのだ", false
+		}
+		segments := infrastructure.CouchDBPathSegments(path)
+		m := couchDBWorkstationDB.FindStringSubmatch(segments[0])
+		if m == nil {
+			return "APIトークンで使える CouchDB はワークステーションのDBだけなのだ", false
+		}
+		wsID = m[1]
+		if method == http.MethodPost {
+			reading = apiTokenReadCouchDBPosts[segments[len(segments)-1]]
+		}
+	case strings.Contains(route, ":workstation_id"):
+		wsID = c.Param("workstation_id")
+		reading = reading || (method == http.MethodPost && apiTokenReadPostRoutes[route])
+	case strings.HasPrefix(route, "/api/ogc/collections/:collection_id"):
+		wsID = strings.TrimPrefix(c.Param("collection_id"), "ws_")
+	case apiTokenQueryRoutes[route]:
+		wsID = c.Query("workstation_id")
+		if wsID == "" {
+			return "APIトークンでは workstation_id を指定してほしいのだ", false
+		}
+	case apiTokenMetaRoutes[route]:
+		if !reading {
+			return "このAPIはAPIトークンでは使えないのだ", false
+		}
+		return "", true
+	default:
+		return "このAPIはAPIトークンでは使えないのだ", false
+	}
+
+	id, err := strconv.ParseInt(wsID, 10, 64)
+	if err != nil || !p.AllowsWorkstation(id) {
+		return "このAPIトークンではこのワークステーションを使えないのだ", false
+	}
+	if p.Scope != model.APITokenScopeReadWrite && !reading {
+		return "このAPIトークンは読むだけなのだ", false
+	}
+	return "", true
+}
@@ -7,9 +7,22 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/saku-730/web-occurrence/backend/internal/infrastructure"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+// SessionChecker はログインのセッションがまだ使えるか (ログアウトしていないか) を調べるのだ
+type SessionChecker interface {
+	IsSessionActive(userID string, sessionID string) (bool, error)
+}
+
+// APITokenAuthenticator は個人アクセストークン (wop_ で始まる) を調べるのだ
+// 無効なトークンには ErrInvalidAPIToken のようなエラーを返すのだ
+type APITokenAuthenticator interface {
+	AuthenticateAPIToken(token string) (*model.APITokenPrincipal, error)
+}
+
+// AuthMiddleware は Authorization: Bearer の JWT か個人アクセストークンを確かめるのだ
+func AuthMiddleware(sessions SessionChecker, apiTokens APITokenAuthenticator) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// [DEBUG] ヘッダーの確認ログ
 		authHeader := c.GetHeader("Authorization")
@@ -23,7 +36,7 @@ func AuthMiddleware() gin.HandlerFunc {
 		// Bearer トークンの形式チェック
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			fmt.Printf("[AuthMiddleware] Error: Invalid header format. Got: %s\n", authHeader)
+			fmt.Println("[AuthMiddleware] Error: Invalid header format")
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization format"})
 			c.Abort()
 			return
@@ -31,8 +44,27 @@ func AuthMiddleware() gin.HandlerFunc {
 
 		tokenString := parts[1]
 
+		// 個人アクセストークンは、トークンで許したワークステーションと操作だけ通すのだ
+		if strings.HasPrefix(tokenString, infrastructure.APITokenPrefix) {
+			principal, err := apiTokens.AuthenticateAPIToken(tokenString)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+				c.Abort()
+				return
+			}
+			if msg, ok := apiTokenAllows(c, principal); !ok {
+				c.JSON(http.StatusForbidden, gin.H{"error": msg})
+				c.Abort()
+				return
+			}
+			c.Set("user_id", principal.UserID)
+			c.Set("api_token_id", principal.TokenID)
+			c.Next()
+			return
+		}
+
 		// トークンの検証
-		userID, err := infrastructure.ValidateToken(tokenString)
+		userID, sessionID, err := infrastructure.ValidateToken(tokenString)
 		if err != nil {
 			// [DEBUG] 検証失敗の理由を出力（これが知りたかった！）
 			fmt.Printf("[AuthMiddleware] Error: Token validation failed: %v\n", err)
@@ -41,8 +73,22 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// ログアウト・取り消し済みのセッションのトークンは、期限内でも通さないのだ
+		active, err := sessions.IsSessionActive(userID, sessionID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "セッションの確認に失敗しました"})
+			c.Abort()
+			return
+		}
+		if !active {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session revoked"})
+			c.Abort()
+			return
+		}
+
 		// 成功！コンテキストにセット
 		c.Set("user_id", userID)
+		c.Set("session_id", sessionID)
 		c.Next()
 	}
 }
@@ -0,0 +1,17 @@
+package model
+
+// EmailVerifyRequest はメールアドレス確認APIのリクエストボディなのだ (token はメールのリンクに付いているのだ)
+type EmailVerifyRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// PasswordForgotRequest はパスワード再設定のメールを頼むAPIのリクエストボディなのだ
+type PasswordForgotRequest struct {
+	MailAddress string `json:"mailaddress" binding:"required,email"`
+}
+
+// PasswordResetRequest はパスワード再設定APIのリクエストボディなのだ
+type PasswordResetRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8"` // 登録と同じく8文字以上
+}
@@ -0,0 +1,56 @@
+package model
+
+import "time"
+
+// 個人アクセストークンの権限なのだ
+const (
+	APITokenScopeRead      = "read"       // 読むだけ (GET)
+	APITokenScopeReadWrite = "read_write" // 書き込みもできる
+)
+
+// APITokenCreateRequest は個人アクセストークンを作るAPIのリクエストボディなのだ
+type APITokenCreateRequest struct {
+	Name           string  `json:"name" binding:"required,max=100"`
+	Scope          string  `json:"scope" binding:"required,oneof=read read_write"`
+	WorkstationIDs []int64 `json:"workstation_ids" binding:"required,min=1,dive,min=1"`
+	// ExpiresInDays は有効期間 (日) なのだ。省略すると 90 日なのだ
+	ExpiresInDays int `json:"expires_in_days" binding:"omitempty,min=1,max=365"`
+}
+
+// APITokenView は個人アクセストークンの一覧の1件なのだ (トークンそのものは含まないのだ)
+type APITokenView struct {
+	TokenID        string     `json:"token_id"`
+	Name           string     `json:"name"`
+	TokenPrefix    string     `json:"token_prefix"`
+	Scope          string     `json:"scope"`
+	WorkstationIDs []int64    `json:"workstation_ids"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	LastUsedAt     *time.Time `json:"last_used_at"`
+	Expired        bool       `json:"expired"`
+}
+
+// APITokenCreateResponse は作った直後のトークンなのだ
+// token はこの時しか返さないので、控えておいてもらうのだ
+type APITokenCreateResponse struct {
+	APITokenView
+	Token string `json:"token"`
+}
+
+// APITokenPrincipal は個人アクセストークンで認証したときの、誰が何をできるかなのだ
+type APITokenPrincipal struct {
+	TokenID        string
+	UserID         string
+	Scope          string
+	WorkstationIDs []int64
+}
+
+// AllowsWorkstation はトークンでそのワークステーションを使えるかなのだ
+func (p *APITokenPrincipal) AllowsWorkstation(workstationID int64) bool {
+	for _, id := range p.WorkstationIDs {
+		if id == workstationID {
+			return true
+		}
+	}
+	return false
+}
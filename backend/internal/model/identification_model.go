@@ -0,0 +1,43 @@
+package model
+
+import "time"
+
+// IdentificationRequest は同定の追加APIのリクエストボディなのだ
+// taxon_id (チェックリストの分類) か class_classification のどちらかを指定するのだ
+type IdentificationRequest struct {
+	TaxonID             *string           `json:"taxon_id"`
+	ClassClassification map[string]string `json:"class_classification"`
+	SourceInfo          string            `json:"source_info"`
+	Note                string            `json:"note"`
+	IdentificatedAt     *time.Time        `json:"identificated_at"`
+}
+
+type IdentificationVoteRequest struct {
+	Agree *bool `json:"agree" binding:"required"`
+}
+
+// IdentificationView は同定1件と、その投票の集計なのだ
+type IdentificationView struct {
+	IdentificationID    string            `json:"identification_id"`
+	UserID              int64             `json:"user_id"`
+	Taxon               string            `json:"taxon"`
+	ClassClassification map[string]string `json:"class_classification"`
+	TaxonID             *string           `json:"taxon_id"`
+	SourceInfo          string            `json:"source_info"`
+	Note                string            `json:"note"`
+	IsCurrent           bool              `json:"is_current"`
+	WithdrawnAt         *time.Time        `json:"withdrawn_at"`
+	IdentificatedAt     time.Time         `json:"identificated_at"`
+	AgreeCount          int               `json:"agree_count"`
+	DisagreeCount       int               `json:"disagree_count"`
+	MyVote              *bool             `json:"my_vote"`
+}
+
+// IdentificationListResponse は occurrence の同定の一覧と合意の結果なのだ
+type IdentificationListResponse struct {
+	OccurrenceID              string               `json:"occurrence_id"`
+	QualityGrade              string               `json:"quality_grade"` // unidentified / needs_id / research
+	ConsensusIdentificationID *string              `json:"consensus_identification_id"`
+	ConsensusTaxon            string               `json:"consensus_taxon"`
+	Identifications           []IdentificationView `json:"identifications"`
+}
@@ -0,0 +1,29 @@
+package model
+
+// LabelFields はラベルに載せられる項目なのだ
+var LabelFields = []string{"catalog_number", "collection", "taxon", "locality", "coordinates", "date", "collector"}
+
+// LabelTemplate はラベルシートの割り付けなのだ (長さは mm、文字の大きさは pt)
+// ラベルは用紙の左上から横に並べて、入りきらなければ次のページに送るのだ
+type LabelTemplate struct {
+	Name        string   `json:"name"`
+	PageWidth   float64  `json:"page_width"`
+	PageHeight  float64  `json:"page_height"`
+	Margin      float64  `json:"margin"`
+	LabelWidth  float64  `json:"label_width"`
+	LabelHeight float64  `json:"label_height"`
+	Gap         float64  `json:"gap"`
+	FontSize    float64  `json:"font_size"`
+	QRSize      float64  `json:"qr_size"` // 周りの余白 (クワイエットゾーン) 込みの大きさなのだ。0 なら QR コードを載せないのだ
+	Border      *bool    `json:"border"`  // 切り取り用の枠線
+	Fields      []string `json:"fields"`
+}
+
+// LabelRequest はラベル PDF の作成APIのリクエストボディなのだ
+type LabelRequest struct {
+	SpecimenIDs []string `json:"specimen_ids" binding:"required,min=1,max=1000"`
+	Template    string   `json:"template"` // 省略すると standard なのだ
+	Copies      int      `json:"copies" binding:"min=0,max=10"`
+	// Layout で指定した値 (0 や空でないもの) はテンプレートの値より優先するのだ
+	Layout *LabelTemplate `json:"layout"`
+}
@@ -0,0 +1,69 @@
+package model
+
+import "time"
+
+// LoanRequest は貸し出しの登録APIのリクエストボディなのだ
+type LoanRequest struct {
+	SpecimenIDs         []string   `json:"specimen_ids" binding:"required,min=1"`
+	BorrowerName        string     `json:"borrower_name" binding:"required"`
+	BorrowerInstitution string     `json:"borrower_institution"`
+	BorrowerEmail       string     `json:"borrower_email" binding:"omitempty,email"`
+	Purpose             string     `json:"purpose"`
+	LoanedAt            *time.Time `json:"loaned_at"` // 省略すると今日なのだ
+	DueDate             *time.Time `json:"due_date"`
+	Note                string     `json:"note"`
+}
+
+// LoanUpdateRequest は貸し出しの内容 (期限の延長など) を更新するAPIのリクエストボディなのだ
+type LoanUpdateRequest struct {
+	BorrowerName        string     `json:"borrower_name" binding:"required"`
+	BorrowerInstitution string     `json:"borrower_institution"`
+	BorrowerEmail       string     `json:"borrower_email" binding:"omitempty,email"`
+	Purpose             string     `json:"purpose"`
+	DueDate             *time.Time `json:"due_date"`
+	Note                string     `json:"note"`
+}
+
+// LoanReturnRequest は返却APIのリクエストボディなのだ
+// specimen_ids を省略すると、まだ返却されていない標本をすべて返却するのだ
+// location_id を指定すると、返却した標本をその保管場所に入れるのだ
+type LoanReturnRequest struct {
+	SpecimenIDs []string   `json:"specimen_ids"`
+	LocationID  *string    `json:"location_id"`
+	ReturnedAt  *time.Time `json:"returned_at"`
+	Note        string     `json:"note"`
+}
+
+// LoanSearchQuery は貸し出しの一覧APIのクエリパラメータなのだ
+type LoanSearchQuery struct {
+	Status     string `form:"status" binding:"omitempty,oneof=open returned overdue"`
+	SpecimenID string `form:"specimen_id"`
+	Borrower   string `form:"borrower"` // 借り手の名前か機関の部分一致
+	Limit      int    `form:"limit"`
+	Offset     int    `form:"offset"`
+}
+
+// LoanItemView は貸し出しに含まれる標本1件なのだ
+type LoanItemView struct {
+	SpecimenID    string     `json:"specimen_id"`
+	CatalogNumber *string    `json:"catalog_number"`
+	ReturnedAt    *time.Time `json:"returned_at"`
+}
+
+// LoanView は貸し出しと、その状態 (open / returned / overdue) なのだ
+type LoanView struct {
+	LoanID              string         `json:"loan_id"`
+	WorkstationID       int64          `json:"workstation_id"`
+	BorrowerName        string         `json:"borrower_name"`
+	BorrowerInstitution string         `json:"borrower_institution"`
+	BorrowerEmail       string         `json:"borrower_email"`
+	Purpose             string         `json:"purpose"`
+	LoanedAt            time.Time      `json:"loaned_at"`
+	DueDate             *time.Time     `json:"due_date"`
+	ReturnedAt          *time.Time     `json:"returned_at"`
+	Note                string         `json:"note"`
+	CreatedBy           int64          `json:"created_by"`
+	Status              string         `json:"status"`
+	DaysOverdue         int            `json:"days_overdue"`
+	Items               []LoanItemView `json:"items"`
+}
@@ -0,0 +1,14 @@
+package model
+
+// MailConfig はメール送信 (SMTP) の設定なのだ
+// Host が空なら送らずにログに出すだけなのだ (開発用)
+type MailConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+	// AllowPlaintext はローカルのテスト用メールサーバー (MailHog など) のときだけ true にするのだ
+	// それ以外では STARTTLS の無いサーバーには送らないのだ
+	AllowPlaintext bool
+}
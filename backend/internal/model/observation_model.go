@@ -0,0 +1,39 @@
+package model
+
+import "time"
+
+// ObservationMethodRequest は観察手法の作成・更新APIのリクエストボディなのだ
+type ObservationMethodRequest struct {
+	MethodCommonName string  `json:"method_common_name" binding:"required"`
+	Description      string  `json:"description"`
+	PageID           *string `json:"pageid"` // 手法を説明する Wiki のページ
+}
+
+// BehaviorTermRequest は行動の語彙の作成・更新APIのリクエストボディなのだ
+type BehaviorTermRequest struct {
+	Term        string `json:"term" binding:"required"`
+	Category    string `json:"category"`
+	Description string `json:"description"`
+}
+
+// ObservationRequest は観察記録の追加・更新APIのリクエストボディなのだ
+// behavior_term_ids は語彙から選んだ行動で、behavior は語彙に無い行動の自由記述なのだ
+type ObservationRequest struct {
+	ObservationMethodID *string    `json:"observation_method_id"`
+	BehaviorTermIDs     []string   `json:"behavior_term_ids"`
+	Behavior            string     `json:"behavior"`
+	ObservedAt          *time.Time `json:"observed_at"`
+}
+
+// ObservationSearchQuery は観察記録の一覧APIのクエリパラメータなのだ
+type ObservationSearchQuery struct {
+	OccurrenceID        string    `form:"occurrence_id"`
+	ObservationMethodID string    `form:"observation_method_id"`
+	BehaviorTermID      string    `form:"behavior_term_id"`
+	Behavior            string    `form:"behavior"` // 自由記述か語彙の部分一致
+	UserID              int64     `form:"user_id"`
+	ObservedStart       time.Time `form:"observed_start" time_format:"2006-01-02T15:04:05Z07:00"`
+	ObservedEnd         time.Time `form:"observed_end" time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit               int       `form:"limit"`
+	Offset              int       `form:"offset"`
+}
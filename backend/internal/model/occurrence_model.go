@@ -0,0 +1,202 @@
+package model
+
+import "time"
+
+// OccurrenceSearchQuery は /search 系APIのクエリパラメータなのだ
+// openapi の Query* パラメータに合わせてあるのだ
+type OccurrenceSearchQuery struct {
+	WorkstationID int64     `form:"workstation_id"`
+	Page          int       `form:"page"`
+	PerPage       int       `form:"per_page"`
+	UserID        int64     `form:"user_id"`
+	OccurrenceID  string    `form:"occurrence_id"`
+	ProjectID     string    `form:"project_id"`
+	IndividualID  string    `form:"individual_id"`
+	Lifestage     string    `form:"lifestage"`
+	Sex           string    `form:"sex"`
+	CreatedStart  time.Time `form:"created_start" time_format:"2006-01-02T15:04:05Z07:00"`
+	CreatedEnd    time.Time `form:"created_end" time_format:"2006-01-02T15:04:05Z07:00"`
+	PlaceName     string    `form:"place_name"` // 地名辞書の名前 (上の階層の名前でもよい) の部分一致なのだ
+	Species       string    `form:"species"`
+	Genus         string    `form:"genus"`
+	Family        string    `form:"family"`
+	Order         string    `form:"order"`
+	Class         string    `form:"class"`
+	Phylum        string    `form:"phylum"`
+	Kingdom       string    `form:"kingdom"`
+	Note          string    `form:"note"`
+	// TaxonID はチェックリストの分類で絞り込むのだ。有効名とその異名のどれで記録されていても当たるのだ
+	TaxonID string `form:"taxon_id"`
+	// Synonyms が true なら、kingdom〜species の指定をチェックリストの異名まで広げて検索するのだ
+	Synonyms bool `form:"synonyms"`
+	// NameStatus はチェックリストと照らし合わせた結果 (accepted / synonym / doubtful / unknown) で絞り込むのだ
+	NameStatus string `form:"name_status"`
+	// MeshCode は地域メッシュコード (4/6/8/9/10桁) の前方一致で絞り込むのだ
+	MeshCode string `form:"mesh_code"`
+	// 観察記録の手法・行動で絞り込むのだ (behavior は自由記述か語彙の部分一致なのだ)
+	ObservationMethodID string `form:"observation_method_id"`
+	BehaviorTermID      string `form:"behavior_term_id"`
+	Behavior            string `form:"behavior"`
+
+	// 空間検索のパラメータなのだ
+	// bbox=minLon,minLat,maxLon,maxLat / lat,lon,radius(m) / polygon=GeoJSON の Polygon or MultiPolygon
+	BBoxText  string   `form:"bbox"`
+	Latitude  *float64 `form:"lat"`
+	Longitude *float64 `form:"lon"`
+	Radius    float64  `form:"radius"`
+	Polygon   string   `form:"polygon"`
+
+	// 以下はクエリ文字列からは直接バインドせず、サービスでパースして入れるのだ
+	BBox   *BBox         `form:"-"`
+	Circle *RadiusFilter `form:"-"`
+	// RestrictSensitive が true のとき、空間検索や地名での絞り込みでは FullPrecisionWorkstationIDs 以外の
+	// 一般化対象のレコードを外すのだ (細かい範囲指定で元の産地を割り出せないようにするため)
+	RestrictSensitive           bool    `form:"-"`
+	FullPrecisionWorkstationIDs []int64 `form:"-"`
+}
+
+// RadiusFilter は中心点からの距離 (m) での絞り込みなのだ
+type RadiusFilter struct {
+	Latitude  float64
+	Longitude float64
+	Meters    float64
+}
+
+// BBox は経緯度 (WGS84) の矩形範囲なのだ
+type BBox struct {
+	MinLon float64 `json:"min_lon"`
+	MinLat float64 `json:"min_lat"`
+	MaxLon float64 `json:"max_lon"`
+	MaxLat float64 `json:"max_lat"`
+}
+
+// OccurrenceSearchRow は検索結果の1行分なのだ
+// occurrence に classification_json / places / users を JOIN した形になっているのだ
+type OccurrenceSearchRow struct {
+	OccurrenceID        string    `json:"occurrence_id" gorm:"column:occurrence_id"`
+	WorkstationID       int64     `json:"workstation_id" gorm:"column:workstation_id"`
+	UserID              int64     `json:"user_id" gorm:"column:user_id"`
+	UserDisplayName     string    `json:"user_display_name" gorm:"column:user_display_name"`
+	ProjectID           string    `json:"project_id" gorm:"column:project_id"`
+	IndividualID        string    `json:"individual_id" gorm:"column:individual_id"`
+	Lifestage           string    `json:"lifestage" gorm:"column:lifestage"`
+	Sex                 string    `json:"sex" gorm:"column:sex"`
+	BodyLength          float64   `json:"body_length" gorm:"column:body_length"`
+	Note                string    `json:"note" gorm:"column:note"`
+	ClassificationID    string    `json:"classification_id" gorm:"column:classification_id"`
+	ClassClassification string    `json:"class_classification" gorm:"column:class_classification"`
+	PlaceID             string    `json:"place_id" gorm:"column:place_id"`
+	PlaceNameID         *string   `json:"place_name_id" gorm:"column:place_name_id"`
+	Coordinates         string    `json:"coordinates" gorm:"column:coordinates"`
+	Accuracy            float64   `json:"accuracy" gorm:"column:accuracy"`
+	Latitude            *float64  `json:"latitude" gorm:"column:latitude"`
+	Longitude           *float64  `json:"longitude" gorm:"column:longitude"`
+	MeshCode            *string   `json:"mesh_code" gorm:"column:mesh_code"`
+	Datum               *string   `json:"datum" gorm:"column:datum"`
+	LanguageID          string    `json:"language_id" gorm:"column:language_id"`
+	CreatedAt           time.Time `json:"created_at" gorm:"column:created_at"`
+	Timezone            string    `json:"timezone" gorm:"column:timezone"`
+	NameStatus          *string   `json:"name_status" gorm:"column:name_status"`
+	// Sensitivity は今有効な一般化の指定 (レコード・分類群の両方をカンマ区切りで) なのだ
+	Sensitivity  string     `json:"-" gorm:"column:sensitivity"`
+	EmbargoUntil *time.Time `json:"embargo_until" gorm:"column:embargo_until"`
+	// CoordinateGeneralization は座標を丸めたときの指定 (mesh:2 など) で、元の精度なら空なのだ
+	CoordinateGeneralization string `json:"coordinate_generalization,omitempty" gorm:"-"`
+}
+
+// OccurrenceSearchResponse は /search のJSONレスポンスなのだ
+type OccurrenceSearchResponse struct {
+	Total   int64                 `json:"total"`
+	Page    int                   `json:"page"`
+	PerPage int                   `json:"per_page"`
+	Results []OccurrenceSearchRow `json:"results"`
+}
+
+// OccurrenceExportRequest はエクスポートAPIのクエリパラメータなのだ
+// 検索条件はそのまま /search と同じものが使えるのだ
+type OccurrenceExportRequest struct {
+	OccurrenceSearchQuery
+	Format  string `form:"format"`  // csv / xlsx / geojson / kml
+	Columns string `form:"columns"` // カンマ区切りの列名。空なら全列 (csv / xlsx のみ)
+}
+
+// MeshAggregateRequest は地域メッシュ集計APIのクエリパラメータなのだ
+type MeshAggregateRequest struct {
+	OccurrenceSearchQuery
+	Level string `form:"level"` // 1 / 2 / 3 / half / quarter (省略時は 3)
+}
+
+// MeshTaxonCount はメッシュ×分類ごとの件数 (リポジトリの集計結果) なのだ
+type MeshTaxonCount struct {
+	MeshCode            string `gorm:"column:mesh_code"`
+	WorkstationID       int64  `gorm:"column:workstation_id"`
+	ClassClassification string `gorm:"column:class_classification"`
+	Sensitivity         string `gorm:"column:sensitivity"`
+	Count               int64  `gorm:"column:count"`
+}
+
+// OccurrenceGridCluster はタイルの格子1マスにまとめた occurrence (リポジトリの集計結果) なのだ
+// マスの番号は世界の西端・北端から数えたもので、X / Y は重心の Web メルカトル (EPSG:3857) 座標 (m) なのだ
+type OccurrenceGridCluster struct {
+	CellX int64   `gorm:"column:cell_x"`
+	CellY int64   `gorm:"column:cell_y"`
+	X     float64 `gorm:"column:x"`
+	Y     float64 `gorm:"column:y"`
+	Count int64   `gorm:"column:count"`
+	// Taxon はマスの全件が同じ分類名のときだけ入るのだ
+	Taxon *string `gorm:"column:taxon"`
+}
+
+// MeshAggregate は1メッシュ分の集計結果なのだ
+type MeshAggregate struct {
+	MeshCode        string       `json:"mesh_code"`
+	Bounds          [4]float64   `json:"bounds"` // [最小経度, 最小緯度, 最大経度, 最大緯度]
+	OccurrenceCount int64        `json:"occurrence_count"`
+	SpeciesCount    int          `json:"species_count"` // 種まで同定された名前の数なのだ (属などまでのレコードは入らないのだ)
+	Taxa            []TaxonCount `json:"taxa"`
+}
+
+type TaxonCount struct {
+	Taxon string `json:"taxon"`
+	Count int64  `json:"count"`
+}
+
+type MeshAggregateResponse struct {
+	Level  string          `json:"level"`
+	Meshes []MeshAggregate `json:"meshes"`
+}
+
+// ClassificationRanks は class_classification の階級を上から順に並べたものなのだ
+var ClassificationRanks = []string{"kingdom", "phylum", "class", "order", "family", "genus", "species"}
+
+// TaxonRollupRequest は分類の集計APIのクエリパラメータなのだ
+// rank を省略すると、絞り込みに使ったいちばん下の階級の1つ下で集計するのだ
+type TaxonRollupRequest struct {
+	OccurrenceSearchQuery
+	Rank string `form:"rank"`
+}
+
+// TaxonRollupRow は集計の1行 (リポジトリの結果) なのだ
+type TaxonRollupRow struct {
+	NameKey      *string `gorm:"column:name_key"`
+	Name         *string `gorm:"column:name"`
+	NameRank     *string `gorm:"column:name_rank"`
+	Count        int64   `gorm:"column:count"`
+	SpeciesCount int64   `gorm:"column:species_count"`
+}
+
+type TaxonRollupChild struct {
+	Name         string `json:"name"`
+	Rank         string `json:"rank"` // Name の階級なのだ (rank の名前が無いレコードは、入っているいちばん下の階級でまとめるのだ)
+	Count        int64  `json:"count"`
+	SpeciesCount int64  `json:"species_count"`
+}
+
+type TaxonRollupResponse struct {
+	ParentRank   string             `json:"parent_rank"` // 絞り込みに使った階級 (なければ空)
+	Parent       string             `json:"parent"`
+	Rank         string             `json:"rank"`
+	Total        int64              `json:"total"`
+	Unidentified int64              `json:"unidentified"` // rank とその上のどの階級にも名前が入っていない件数なのだ
+	Children     []TaxonRollupChild `json:"children"`
+}
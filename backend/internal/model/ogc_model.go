@@ -0,0 +1,74 @@
+package model
+
+// OGC API - Features (Part 1: Core) のレスポンス型なのだ
+// QGIS などのクライアントがそのまま読めるように、キー名は仕様どおりにしてあるのだ
+
+type OGCLink struct {
+	Href  string `json:"href"`
+	Rel   string `json:"rel"`
+	Type  string `json:"type,omitempty"`
+	Title string `json:"title,omitempty"`
+}
+
+type OGCLandingPage struct {
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Links       []OGCLink `json:"links"`
+}
+
+type OGCConformance struct {
+	ConformsTo []string `json:"conformsTo"`
+}
+
+type OGCExtent struct {
+	Spatial struct {
+		BBox [][]float64 `json:"bbox"`
+		CRS  string      `json:"crs"`
+	} `json:"spatial"`
+}
+
+type OGCCollection struct {
+	ID          string    `json:"id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description,omitempty"`
+	ItemType    string    `json:"itemType"`
+	CRS         []string  `json:"crs"`
+	Extent      OGCExtent `json:"extent"`
+	Links       []OGCLink `json:"links"`
+}
+
+type OGCCollections struct {
+	Collections []OGCCollection `json:"collections"`
+	Links       []OGCLink       `json:"links"`
+}
+
+type OGCFeature struct {
+	Type       string                 `json:"type"`
+	ID         string                 `json:"id"`
+	Geometry   *OGCPointGeometry      `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+	Links      []OGCLink              `json:"links,omitempty"`
+}
+
+type OGCPointGeometry struct {
+	Type        string    `json:"type"`
+	Coordinates []float64 `json:"coordinates"`
+}
+
+type OGCFeatureCollection struct {
+	Type           string       `json:"type"`
+	Features       []OGCFeature `json:"features"`
+	Links          []OGCLink    `json:"links"`
+	TimeStamp      string       `json:"timeStamp"`
+	NumberMatched  int64        `json:"numberMatched"`
+	NumberReturned int          `json:"numberReturned"`
+}
+
+// OGCItemsRequest は /collections/{id}/items のクエリパラメータなのだ
+// 属性での絞り込みは埋め込んだ検索条件 (sex, species など) をそのまま使うのだ
+type OGCItemsRequest struct {
+	OccurrenceSearchQuery
+	Limit    int    `form:"limit"`
+	Offset   int    `form:"offset"`
+	Datetime string `form:"datetime"`
+}
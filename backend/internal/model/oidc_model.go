@@ -0,0 +1,32 @@
+package model
+
+// OIDCConfig は OpenID Connect (大学の IdP などでのログイン) の設定なのだ
+// Issuer が空ならこのログインは使えないのだ
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string // 公開クライアント (PKCE だけ) なら空でいいのだ
+	RedirectURL  string // IdP から戻ってくる先 (.../api/oidc/callback) なのだ
+	Scopes       []string
+	ProviderName string // ログイン画面のボタンに出す名前なのだ
+}
+
+// OIDCClaims は ID トークンから読み取ったユーザーの情報なのだ (署名・発行者・宛先・nonce は確認済みなのだ)
+type OIDCClaims struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// OIDCConfigResponse はログイン画面向けの設定なのだ
+type OIDCConfigResponse struct {
+	Enabled      bool   `json:"enabled"`
+	ProviderName string `json:"provider_name,omitempty"`
+}
+
+// OIDCExchangeRequest はログイン後の券をトークンと引き換えるリクエストなのだ
+type OIDCExchangeRequest struct {
+	Ticket string `json:"ticket" binding:"required"`
+}
@@ -0,0 +1,53 @@
+package model
+
+import "encoding/json"
+
+// PlaceNameRanks は地名の階層を上から順に並べたものなのだ
+var PlaceNameRanks = []string{"country", "prefecture", "municipality", "locality"}
+
+// PlaceNameRequest は地名の作成・更新APIのリクエストボディなのだ
+type PlaceNameRequest struct {
+	ParentID  *string           `json:"parent_id"`
+	Rank      string            `json:"rank" binding:"required,oneof=country prefecture municipality locality"`
+	Name      string            `json:"name" binding:"required"`
+	Names     map[string]string `json:"names"` // 多言語表記 {"ja": "...", "en": "..."}
+	Latitude  *float64          `json:"latitude"`
+	Longitude *float64          `json:"longitude"`
+	// Boundary は境界の GeoJSON (Polygon / MultiPolygon) なのだ。省略すると境界なしになるのだ
+	Boundary json.RawMessage `json:"boundary"`
+}
+
+// PlaceNameSearchQuery は地名の一覧・あいまい検索のクエリパラメータなのだ
+type PlaceNameSearchQuery struct {
+	Q        string `form:"q"`
+	Rank     string `form:"rank"`
+	ParentID string `form:"parent_id"`
+	Limit    int    `form:"limit"`
+}
+
+// PlaceNameSuggestQuery は座標から地名を提案するAPIのクエリパラメータなのだ
+// 赤道や本初子午線 (0) も指定できるように、ポインタで「無い」と区別するのだ
+type PlaceNameSuggestQuery struct {
+	Latitude  *float64 `form:"lat" binding:"required"`
+	Longitude *float64 `form:"lon" binding:"required"`
+	Limit     int      `form:"limit"`
+}
+
+// PlaceNameMatch はリポジトリの検索結果 (地名 + 距離・包含) なのだ
+type PlaceNameMatch struct {
+	PlaceNameID string   `json:"place_name_id" gorm:"column:place_name_id"`
+	ParentID    *string  `json:"parent_id" gorm:"column:parent_id"`
+	Rank        string   `json:"rank" gorm:"column:rank"`
+	Name        string   `json:"name" gorm:"column:name"`
+	Latitude    *float64 `json:"latitude" gorm:"column:latitude"`
+	Longitude   *float64 `json:"longitude" gorm:"column:longitude"`
+	Contains    bool     `json:"contains" gorm:"column:contains"`
+	DistanceM   *float64 `json:"distance_m" gorm:"column:distance_m"`
+	Score       float64  `json:"score" gorm:"column:score"`
+}
+
+// PlaceNameSuggestion は提案1件分で、上位の地名を並べた path も付けるのだ
+type PlaceNameSuggestion struct {
+	PlaceNameMatch
+	Path []string `json:"path"` // 例: ["日本", "茨城県", "つくば市", "筑波山"]
+}
@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// ProjectRequest はプロジェクトの作成・更新APIのリクエストボディなのだ
+type ProjectRequest struct {
+	ProjectName string `json:"project_name" binding:"required"`
+	Description string `json:"description"`
+	// LegacyDescription は以前の綴り (disscription) のキーなのだ
+	// 古いクライアントのために、description が無いときはこちらを使うのだ
+	LegacyDescription *string    `json:"disscription"`
+	StartDay          *time.Time `json:"start_day"`
+	FinishedDay       *time.Time `json:"finished_day"`
+	Note              string     `json:"note"`
+}
+
+// ProjectMemberRequest はメンバーの追加・更新APIのリクエストボディなのだ
+// join_day を省略すると今日、finish_day を入れるとプロジェクトから抜けた扱いになるのだ
+type ProjectMemberRequest struct {
+	JoinDay   *time.Time `json:"join_day"`
+	FinishDay *time.Time `json:"finish_day"`
+}
@@ -0,0 +1,20 @@
+package model
+
+// ResolveQuery は読み取ったコードからレコードを探すAPIのクエリパラメータなのだ
+// payload には occurrence の UUID、標本の登録番号、短いコード (URL の末尾でもよい) を入れるのだ
+type ResolveQuery struct {
+	Payload  string `form:"payload" binding:"required"`
+	Redirect bool   `form:"redirect"` // true ならレコードの画面 (フロントエンド) にリダイレクトするのだ
+}
+
+// ResolvedRecord は見つかったレコードなのだ
+type ResolvedRecord struct {
+	Type          string  `json:"type"` // occurrence / specimen
+	ID            string  `json:"id"`
+	WorkstationID int64   `json:"workstation_id"`
+	OccurrenceID  string  `json:"occurrence_id"`
+	CatalogNumber *string `json:"catalog_number,omitempty"`
+	Code          string  `json:"code"`
+	URL           string  `json:"url"`      // レコードを取得する API のパス
+	PageURL       string  `json:"page_url"` // レコードを表示するフロントエンドの URL
+}
@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+// SensitiveTaxonRequest は産地を一般化する分類群の作成・更新APIのリクエストボディなのだ
+type SensitiveTaxonRequest struct {
+	Rank           string     `json:"rank" binding:"required,oneof=kingdom phylum class order family genus species"`
+	Name           string     `json:"name" binding:"required"`
+	Generalization string     `json:"generalization" binding:"required"` // mesh:1 / mesh:2 / mesh:3 / grid:<度> / hidden
+	EmbargoUntil   *time.Time `json:"embargo_until"`                     // この日時を過ぎたら元の精度で出すのだ (null なら無期限)
+	Note           string     `json:"note"`
+}
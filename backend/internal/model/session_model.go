@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// TokenRefreshRequest はトークンの取り直しAPIのリクエストボディなのだ
+type TokenRefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// SessionView はログイン中のセッション (端末) の一覧の1件なのだ
+type SessionView struct {
+	SessionID  string    `json:"session_id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"` // このリクエストのセッションなのだ
+}
@@ -0,0 +1,41 @@
+package model
+
+import "time"
+
+// SpecimenRequest は標本の登録・更新APIのリクエストボディなのだ
+// catalog_number を省略すると、採番の設定から次の番号を割り当てるのだ
+type SpecimenRequest struct {
+	OccurrenceID     string     `json:"occurrence_id" binding:"required"`
+	InstitutionID    string     `json:"institution_id"`
+	CollectionID     string     `json:"collection_id"`
+	SpecimenMethodID string     `json:"specimen_method_id"`
+	CatalogNumber    *string    `json:"catalog_number"`
+	Note             string     `json:"note"`
+	PreparedAt       *time.Time `json:"prepared_at"` // 標本を作製した日時 (make_specimen.created_at)
+}
+
+// SpecimenSearchQuery は標本の一覧APIのクエリパラメータなのだ
+type SpecimenSearchQuery struct {
+	OccurrenceID  string `form:"occurrence_id"`
+	InstitutionID string `form:"institution_id"`
+	CollectionID  string `form:"collection_id"`
+	CatalogNumber string `form:"catalog_number"` // 前方一致
+	// StorageLocationID を指定すると、その保管場所と下の階層にある標本を返すのだ
+	StorageLocationID string `form:"storage_location_id"`
+	Limit             int    `form:"limit"`
+	Offset            int    `form:"offset"`
+}
+
+// SpecimenLookupQuery は登録番号で標本を引くAPIのクエリパラメータなのだ
+type SpecimenLookupQuery struct {
+	CatalogNumber string `form:"catalog_number" binding:"required"`
+}
+
+// CatalogNumberSequenceRequest は採番の設定APIのリクエストボディなのだ
+// collection_id を空にするとワークステーション全体の既定になるのだ
+type CatalogNumberSequenceRequest struct {
+	CollectionID string `json:"collection_id"`
+	Prefix       string `json:"prefix"`
+	Padding      int    `json:"padding" binding:"min=0,max=18"`
+	NextValue    *int64 `json:"next_value" binding:"omitempty,min=1"`
+}
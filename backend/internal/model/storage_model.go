@@ -0,0 +1,33 @@
+package model
+
+import "time"
+
+// StorageLocationRequest は保管場所の作成・更新APIのリクエストボディなのだ
+// parent_id を省略すると一番上の階層になるのだ
+type StorageLocationRequest struct {
+	ParentID *string `json:"parent_id"`
+	Kind     string  `json:"kind" binding:"required,oneof=building room cabinet drawer"`
+	Name     string  `json:"name" binding:"required"`
+	Note     string  `json:"note"`
+}
+
+// StorageLocationView は保管場所と、上の階層からの名前のつながりなのだ
+type StorageLocationView struct {
+	LocationID    string    `json:"location_id"`
+	WorkstationID int64     `json:"workstation_id"`
+	ParentID      *string   `json:"parent_id"`
+	Kind          string    `json:"kind"`
+	Name          string    `json:"name"`
+	Note          string    `json:"note"`
+	Path          string    `json:"path"` // 例: "本館 / 標本室3 / キャビネット12 / 引き出し4"
+	SpecimenCount int64     `json:"specimen_count"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// SpecimenMoveRequest は標本を別の保管場所に移すAPIのリクエストボディなのだ
+// location_id を null にすると保管場所を外すのだ
+type SpecimenMoveRequest struct {
+	LocationID *string    `json:"location_id"`
+	MovedAt    *time.Time `json:"moved_at"`
+	Note       string     `json:"note"`
+}
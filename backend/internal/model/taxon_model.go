@@ -0,0 +1,46 @@
+package model
+
+// TaxonSearchQuery は学名・和名の補完APIのクエリパラメータなのだ
+type TaxonSearchQuery struct {
+	Q     string `form:"q"`
+	Rank  string `form:"rank"`
+	Limit int    `form:"limit"`
+}
+
+// TaxonValidationQuery は名前の検証APIのクエリパラメータなのだ
+type TaxonValidationQuery struct {
+	Rank string `form:"rank" binding:"required"`
+	Name string `form:"name" binding:"required"`
+}
+
+// TaxonMatch は検索結果の1件で、異名なら有効名も付けるのだ
+type TaxonMatch struct {
+	TaxonID         string  `json:"taxon_id" gorm:"column:taxon_id"`
+	Rank            string  `json:"rank" gorm:"column:rank"`
+	ScientificName  string  `json:"scientific_name" gorm:"column:scientific_name"`
+	CanonicalName   string  `json:"canonical_name" gorm:"column:canonical_name"`
+	Authorship      string  `json:"authorship" gorm:"column:authorship"`
+	TaxonomicStatus string  `json:"taxonomic_status" gorm:"column:taxonomic_status"`
+	VernacularName  string  `json:"vernacular_name" gorm:"column:vernacular_name"`
+	AcceptedID      *string `json:"accepted_id" gorm:"column:accepted_id"`
+	AcceptedName    *string `json:"accepted_name" gorm:"column:accepted_name"`
+	Score           float64 `json:"score" gorm:"column:score"`
+}
+
+// TaxonValidation は名前の検証結果なのだ
+// Status は accepted (有効名) / synonym (異名) / doubtful / unknown (チェックリストにない) のいずれかなのだ
+type TaxonValidation struct {
+	Rank        string       `json:"rank"`
+	Name        string       `json:"name"`
+	Status      string       `json:"status"`
+	Taxon       *TaxonMatch  `json:"taxon"`
+	Accepted    *TaxonMatch  `json:"accepted"`
+	Suggestions []TaxonMatch `json:"suggestions"`
+}
+
+// TaxonImportResult はチェックリスト取り込みの結果なのだ
+type TaxonImportResult struct {
+	Imported int      `json:"imported"`
+	Skipped  int      `json:"skipped"`
+	Errors   []string `json:"errors"`
+}
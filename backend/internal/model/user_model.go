@@ -23,7 +23,33 @@ type UserLoginRequest struct {
 	Password    string `json:"password" binding:"required"` // ログイン時はminチェック不要
 }
 
-// UserLoginResponse はログインAPIの成功レスポンスなのだ
+// UserLoginResponse はログインAPI・トークンの取り直しAPIの成功レスポンスなのだ
+// token (アクセストークン) は expires_in 秒で切れるので、refresh_token で取り直すのだ
 type UserLoginResponse struct {
-	Token string `json:"token"` // JWTトークンを返す
+	Token        string `json:"token"` // JWTトークンを返す
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"` // 1回使うと新しいものに替わるのだ
+}
+
+// UserProfileUpdateRequest はプロフィール変更APIのJSONリクエストボディなのだ
+// 送らなかった項目はそのままなのだ
+type UserProfileUpdateRequest struct {
+	DisplayName *string `json:"display_name" binding:"omitempty,max=100"`
+	// PreferredLanguageID は languages マスターの language_id なのだ (0 で未設定に戻すのだ)
+	PreferredLanguageID *int64 `json:"preferred_language_id" binding:"omitempty,min=0"`
+	// Timezone は IANA のタイムゾーン名なのだ (例: "Asia/Tokyo")
+	Timezone *string `json:"timezone"`
+}
+
+// PasswordChangeRequest はパスワード変更APIのJSONリクエストボディなのだ
+type PasswordChangeRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=8"` // 登録と同じく8文字以上
+}
+
+// AccountDeleteRequest はアカウント削除APIのJSONリクエストボディなのだ (本人確認のパスワード)
+// IdP でしかログインしないユーザー (パスワード無し) は空でいいのだ
+type AccountDeleteRequest struct {
+	Password string `json:"password"`
 }
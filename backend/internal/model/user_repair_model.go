@@ -0,0 +1,11 @@
+package model
+
+// UserRepairReport は PostgreSQL と CouchDB のユーザーを突き合わせて直した結果なのだ
+type UserRepairReport struct {
+	// CreatedCouchDBUsers は CouchDB に無かったので作ったユーザー (user_id) なのだ
+	CreatedCouchDBUsers []string `json:"created_couchdb_users"`
+	// DeletedCouchDBUsers は PostgreSQL に無い (または削除済みの) ので消した CouchDB ユーザーなのだ
+	DeletedCouchDBUsers []string `json:"deleted_couchdb_users"`
+	// Failed は直そうとして失敗したものなのだ (次の回にまたやるのだ)
+	Failed []string `json:"failed"`
+}
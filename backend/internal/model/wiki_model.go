@@ -0,0 +1,34 @@
+package model
+
+// WikiPageRequest は Wiki のページの作成・更新APIのリクエストボディなのだ
+// base_revision は編集を始めたときの版で、その後に別の人が保存していたら 409 を返すのだ
+type WikiPageRequest struct {
+	Title        string `json:"title" binding:"required"`
+	Content      string `json:"content"`
+	Summary      string `json:"summary"`
+	BaseRevision *int   `json:"base_revision"`
+}
+
+// WikiPreviewRequest は保存前の Markdown を HTML にして確かめるAPIのリクエストボディなのだ
+type WikiPreviewRequest struct {
+	Content string `json:"content"`
+}
+
+// WikiSearchQuery は Wiki のページ一覧APIのクエリパラメータなのだ
+type WikiSearchQuery struct {
+	Q      string `form:"q"` // タイトルか本文の部分一致
+	Limit  int    `form:"limit"`
+	Offset int    `form:"offset"`
+}
+
+// WikiDiffQuery は2つの版を比べるAPIのクエリパラメータなのだ
+// to を省略すると今の版、from を省略すると to の1つ前の版と比べるのだ
+type WikiDiffQuery struct {
+	From int `form:"from"`
+	To   int `form:"to"`
+}
+
+// WikiRestoreRequest は古い版に戻すAPIのリクエストボディなのだ
+type WikiRestoreRequest struct {
+	Summary string `json:"summary"`
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/saku-730/web-occurrence/backend/internal/entity"
+	"gorm.io/gorm"
+)
+
+type APITokenRepository interface {
+	// Create はトークンと使えるワークステーションをまとめて保存するのだ
+	Create(token *entity.PersonalAccessToken, workstationIDs []int64) error
+	// ListByUserID は取り消されていないトークンを新しい順に返すのだ
+	ListByUserID(userID int64) ([]entity.PersonalAccessToken, error)
+	CountActive(userID int64, now time.Time) (int64, error)
+	FindByID(tokenID string) (*entity.PersonalAccessToken, error)
+	FindByHash(tokenHash string) (*entity.PersonalAccessToken, error)
+	// ListWorkstationIDs はトークンごとの使えるワークステーションを返すのだ (token_id -> workstation_id)
+	ListWorkstationIDs(tokenIDs []string) (map[string][]int64, error)
+	Revoke(tokenID string, now time.Time) error
+	// TouchLastUsed は最後に使った日時を記録するのだ (毎回書かないように、前回から1分経ったときだけなのだ)
+	TouchLastUsed(tokenID string, now time.Time) error
+}
+
+type apiTokenRepository struct {
+	db *gorm.DB
+}
+
+func NewAPITokenRepository(db *gorm.DB) APITokenRepository {
+	return &apiTokenRepository{db: db}
+}
+
+func (r *apiTokenRepository) Create(token *entity.PersonalAccessToken, workstationIDs []int64) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(token).Error; err != nil {
+			return err
+		}
+		links := make([]entity.PersonalAccessTokenWorkstation, 0, len(workstationIDs))
+		for _, wsID := range workstationIDs {
+			links = append(links, entity.PersonalAccessTokenWorkstation{TokenID: token.TokenID, WorkstationID: wsID})
+		}
+		return tx.Create(&links).Error
+	})
+}
+
+func (r *apiTokenRepository) ListByUserID(userID int64) ([]entity.PersonalAccessToken, error) {
+	var list []entity.PersonalAccessToken
+	err := r.db.Where("user_id = ? AND revoked_at IS NULL", userID).
+		Order("created_at DESC").
+		Find(&list).Error
+	return list, err
+}
+
+func (r *apiTokenRepository) CountActive(userID int64, now time.Time) (int64, error) {
+	var count int64
+	err := r.db.Model(&entity.PersonalAccessToken{}).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, now).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *apiTokenRepository) FindByID(tokenID string) (*entity.PersonalAccessToken, error) {
+	var token entity.PersonalAccessToken
+	if err := r.db.Where("token_id = ?", tokenID).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *apiTokenRepository) FindByHash(tokenHash string) (*entity.PersonalAccessToken, error) {
+	var token entity.PersonalAccessToken
+	if err := r.db.Where("token_hash = ?", tokenHash).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *apiTokenRepository) ListWorkstationIDs(tokenIDs []string) (map[string][]int64, error) {
+	res := make(map[string][]int64, len(tokenIDs))
+	if len(tokenIDs) == 0 {
+		return res, nil
+	}
+	var links []entity.PersonalAccessTokenWorkstation
+	if err := r.db.Where("token_id IN ?", tokenIDs).Order("workstation_id").Find(&links).Error; err != nil {
+		return nil, err
+	}
+	for _, l := range links {
+		res[l.TokenID] = append(res[l.TokenID], l.WorkstationID)
+	}
+	return res, nil
+}
+
+func (r *apiTokenRepository) Revoke(tokenID string, now time.Time) error {
+	return r.db.Model(&entity.PersonalAccessToken{}).
+		Where("token_id = ? AND revoked_at IS NULL", tokenID).
+		Update("revoked_at", now).Error
+}
+
+func (r *apiTokenRepository) TouchLastUsed(tokenID string, now time.Time) error {
+	return r.db.Model(&entity.PersonalAccessToken{}).
+		Where("token_id = ? AND (last_used_at IS NULL OR last_used_at < ?)", tokenID, now.Add(-time.Minute)).
+		Update("last_used_at", now).Error
+}
@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/saku-730/web-occurrence/backend/internal/entity"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IdentificationRepository interface {
+	FindOccurrence(occurrenceID string) (*entity.Occurrence, error)
+	ListByOccurrenceID(occurrenceID string) ([]entity.Identification, error)
+	ListVotesByOccurrenceID(occurrenceID string) ([]entity.IdentificationVote, error)
+	FindByID(identificationID string) (*entity.Identification, error)
+	// Create は同じ人の前の同定を is_current = false にしてから保存するのだ
+	Create(ident *entity.Identification) error
+	Withdraw(identificationID string) error
+	SaveVote(vote *entity.IdentificationVote) error
+	DeleteVote(identificationID string, userID int64) error
+	// SaveConsensus は合意の結果を occurrence と分類 (classification_json) に書き込むのだ
+	SaveConsensus(occ *entity.Occurrence, classification *entity.ClassificationJSON) error
+}
+
+type identificationRepository struct {
+	db *gorm.DB
+}
+
+func NewIdentificationRepository(db *gorm.DB) IdentificationRepository {
+	return &identificationRepository{db: db}
+}
+
+func (r *identificationRepository) FindOccurrence(occurrenceID string) (*entity.Occurrence, error) {
+	var occ entity.Occurrence
+	if err := r.db.Where("occurrence_id = ?", occurrenceID).First(&occ).Error; err != nil {
+		return nil, err
+	}
+	return &occ, nil
+}
+
+func (r *identificationRepository) ListByOccurrenceID(occurrenceID string) ([]entity.Identification, error) {
+	var list []entity.Identification
+	err := r.db.Where("occurrence_id = ?", occurrenceID).
+		Order("created_at").
+		Find(&list).Error
+	return list, err
+}
+
+func (r *identificationRepository) ListVotesByOccurrenceID(occurrenceID string) ([]entity.IdentificationVote, error) {
+	var list []entity.IdentificationVote
+	err := r.db.Joins("JOIN identifications ON identifications.identification_id = identification_votes.identification_id").
+		Where("identifications.occurrence_id = ?", occurrenceID).
+		Find(&list).Error
+	return list, err
+}
+
+func (r *identificationRepository) FindByID(identificationID string) (*entity.Identification, error) {
+	var ident entity.Identification
+	if err := r.db.Where("identification_id = ?", identificationID).First(&ident).Error; err != nil {
+		return nil, err
+	}
+	return &ident, nil
+}
+
+func (r *identificationRepository) Create(ident *entity.Identification) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&entity.Identification{}).
+			Where("occurrence_id = ? AND user_id = ? AND is_current", ident.OccurrenceID, ident.UserID).
+			Update("is_current", false).Error
+		if err != nil {
+			return err
+		}
+		ident.IsCurrent = true
+		return tx.Create(ident).Error
+	})
+}
+
+func (r *identificationRepository) Withdraw(identificationID string) error {
+	return r.db.Model(&entity.Identification{}).
+		Where("identification_id = ?", identificationID).
+		Updates(map[string]interface{}{"is_current": false, "withdrawn_at": time.Now()}).Error
+}
+
+// SaveVote は投票を保存するのだ
+// 賛成の投票なら、同じ occurrence の別の同定への同じユーザーの賛成は取り消すのだ (1人が推せる分類は1つだけなのだ)
+func (r *identificationRepository) SaveVote(vote *entity.IdentificationVote) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if vote.Agree {
+			others := tx.Model(&entity.Identification{}).Select("identification_id").
+				Where("occurrence_id = (?)", tx.Model(&entity.Identification{}).Select("occurrence_id").Where("identification_id = ?", vote.IdentificationID))
+			if err := tx.Where("user_id = ? AND agree AND identification_id <> ? AND identification_id IN (?)", vote.UserID, vote.IdentificationID, others).
+				Delete(&entity.IdentificationVote{}).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "identification_id"}, {Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"agree", "voted_at"}),
+		}).Create(vote).Error
+	})
+}
+
+func (r *identificationRepository) DeleteVote(identificationID string, userID int64) error {
+	return r.db.Where("identification_id = ? AND user_id = ?", identificationID, userID).
+		Delete(&entity.IdentificationVote{}).Error
+}
+
+func (r *identificationRepository) SaveConsensus(occ *entity.Occurrence, classification *entity.ClassificationJSON) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if classification != nil {
+			if err := tx.Save(classification).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&entity.Occurrence{}).
+			Where("occurrence_id = ?", occ.OccurrenceID).
+			Updates(map[string]interface{}{
+				"classification_id":           occ.ClassificationID,
+				"quality_grade":               occ.QualityGrade,
+				"consensus_identification_id": occ.ConsensusIdentificationID,
+			}).Error
+	})
+}
@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/saku-730/web-occurrence/backend/internal/entity"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"gorm.io/gorm"
+)
+
+var ErrSpecimenOnLoan = errors.New("貸し出し中の標本が含まれています")
+
+// LoanItemRow は貸し出しに含まれる標本と、その登録番号なのだ
+type LoanItemRow struct {
+	entity.SpecimenLoanItem
+	CatalogNumber *string `gorm:"column:catalog_number"`
+}
+
+type LoanRepository interface {
+	// List は貸し出しを探すのだ。today は延滞かどうかを決める日付 (YYYY-MM-DD) なのだ
+	List(workstationID int64, q *model.LoanSearchQuery, today string) ([]entity.SpecimenLoan, error)
+	FindByID(loanID string) (*entity.SpecimenLoan, error)
+	ListItems(loanIDs []string) ([]LoanItemRow, error)
+	// Create は貸し出しと標本、移動の履歴 (loan_out) をまとめて保存するのだ
+	// 返却されていない貸し出しに含まれる標本があれば ErrSpecimenOnLoan を返すのだ
+	Create(loan *entity.SpecimenLoan, items []entity.SpecimenLoanItem, movements []entity.SpecimenMovement) error
+	Update(loan *entity.SpecimenLoan) error
+	// Return は標本を返却済みにして移動の履歴 (loan_return) を残すのだ
+	// locationID を渡すとその保管場所に入れ、すべて返却されたら貸し出しも返却済みにするのだ
+	Return(loan *entity.SpecimenLoan, specimenIDs []string, returnedAt time.Time, locationID *string, movements []entity.SpecimenMovement) error
+}
+
+type loanRepository struct {
+	db *gorm.DB
+}
+
+func NewLoanRepository(db *gorm.DB) LoanRepository {
+	return &loanRepository{db: db}
+}
+
+func (r *loanRepository) List(workstationID int64, q *model.LoanSearchQuery, today string) ([]entity.SpecimenLoan, error) {
+	tx := r.db.Where("workstation_id = ?", workstationID)
+	switch q.Status {
+	case "open":
+		tx = tx.Where("returned_at IS NULL")
+	case "returned":
+		tx = tx.Where("returned_at IS NOT NULL")
+	case "overdue":
+		tx = tx.Where("returned_at IS NULL AND due_date < ?", today)
+	}
+	if q.SpecimenID != "" {
+		tx = tx.Where("loan_id IN (SELECT loan_id FROM specimen_loan_items WHERE specimen_id = ?)", q.SpecimenID)
+	}
+	if q.Borrower != "" {
+		like := "%" + q.Borrower + "%"
+		tx = tx.Where("borrower_name ILIKE ? OR borrower_institution ILIKE ?", like, like)
+	}
+
+	// 延滞の一覧は期限の古い順、それ以外は新しい貸し出しから並べるのだ
+	if q.Status == "overdue" {
+		tx = tx.Order("due_date").Order("loaned_at")
+	} else {
+		tx = tx.Order("loaned_at DESC").Order("created_at DESC")
+	}
+
+	var list []entity.SpecimenLoan
+	err := tx.Limit(q.Limit).Offset(q.Offset).Find(&list).Error
+	return list, err
+}
+
+func (r *loanRepository) FindByID(loanID string) (*entity.SpecimenLoan, error) {
+	var loan entity.SpecimenLoan
+	if err := r.db.Where("loan_id = ?", loanID).First(&loan).Error; err != nil {
+		return nil, err
+	}
+	return &loan, nil
+}
+
+func (r *loanRepository) ListItems(loanIDs []string) ([]LoanItemRow, error) {
+	var rows []LoanItemRow
+	if len(loanIDs) == 0 {
+		return rows, nil
+	}
+	err := r.db.Table("specimen_loan_items").
+		Select("specimen_loan_items.*, specimen.catalog_number").
+		Joins("JOIN specimen ON specimen.specimen_id = specimen_loan_items.specimen_id").
+		Where("specimen_loan_items.loan_id IN ?", loanIDs).
+		Order("specimen.catalog_number").
+		Scan(&rows).Error
+	return rows, err
+}
+
+func (r *loanRepository) Create(loan *entity.SpecimenLoan, items []entity.SpecimenLoanItem, movements []entity.SpecimenMovement) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(loan).Error; err != nil {
+			return err
+		}
+		for i := range items {
+			items[i].LoanID = loan.LoanID
+		}
+		if err := tx.Create(&items).Error; err != nil {
+			return err
+		}
+		for i := range movements {
+			movements[i].LoanID = &loan.LoanID
+		}
+		return tx.Create(&movements).Error
+	})
+	if err != nil && (errors.Is(err, gorm.ErrDuplicatedKey) || strings.Contains(err.Error(), "23505")) {
+		return ErrSpecimenOnLoan
+	}
+	return err
+}
+
+func (r *loanRepository) Update(loan *entity.SpecimenLoan) error {
+	return r.db.Save(loan).Error
+}
+
+func (r *loanRepository) Return(loan *entity.SpecimenLoan, specimenIDs []string, returnedAt time.Time, locationID *string, movements []entity.SpecimenMovement) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&entity.SpecimenLoanItem{}).
+			Where("loan_id = ? AND specimen_id IN ? AND returned_at IS NULL", loan.LoanID, specimenIDs).
+			Update("returned_at", returnedAt).Error
+		if err != nil {
+			return err
+		}
+		if locationID != nil {
+			err := tx.Model(&entity.Specimen{}).
+				Where("specimen_id IN ?", specimenIDs).
+				Update("storage_location_id", *locationID).Error
+			if err != nil {
+				return err
+			}
+		}
+		if err := tx.Create(&movements).Error; err != nil {
+			return err
+		}
+
+		var open int64
+		err = tx.Model(&entity.SpecimenLoanItem{}).
+			Where("loan_id = ? AND returned_at IS NULL", loan.LoanID).
+			Count(&open).Error
+		if err != nil {
+			return err
+		}
+		if open > 0 {
+			return nil
+		}
+		loan.ReturnedAt = &returnedAt
+		return tx.Model(&entity.SpecimenLoan{}).
+			Where("loan_id = ?", loan.LoanID).
+			Update("returned_at", returnedAt).Error
+	})
+}
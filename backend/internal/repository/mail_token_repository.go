@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/saku-730/web-occurrence/backend/internal/entity"
+	"gorm.io/gorm"
+)
+
+type MailTokenRepository interface {
+	Create(token *entity.UserMailToken) error
+	FindToken(tokenHash string) (*entity.UserMailToken, error)
+	// CountSince は since 以降に作ったトークンの数なのだ (送りすぎを防ぐのに使うのだ)
+	CountSince(userID int64, purpose string, since time.Time) (int64, error)
+
+	// VerifyEmail はトークンを使い済みにして、メールアドレスを確かめた印を付けるのだ
+	// トークンが先に使われていたら false を返すのだ
+	VerifyEmail(tokenHash string, userID int64, mailAddress string, now time.Time) (bool, error)
+	// ResetPassword はトークンを使い済みにしてパスワードを替えるのだ
+	// 残りの再設定トークンも使えなくするのだ。トークンが先に使われていたら false を返すのだ
+	// afterConsume はトークンを使えた後、コミットする前に呼ぶのだ。エラーを返したらトークンは使わなかったことになるのだ
+	ResetPassword(tokenHash string, userID int64, mailAddress string, passwordHash string, now time.Time, afterConsume func() error) (bool, error)
+
+	// DeleteExpired は期限切れのトークンを消すのだ
+	DeleteExpired(before time.Time) error
+}
+
+type mailTokenRepository struct {
+	db *gorm.DB
+}
+
+func NewMailTokenRepository(db *gorm.DB) MailTokenRepository {
+	return &mailTokenRepository{db: db}
+}
+
+func (r *mailTokenRepository) Create(token *entity.UserMailToken) error {
+	return r.db.Create(token).Error
+}
+
+func (r *mailTokenRepository) FindToken(tokenHash string) (*entity.UserMailToken, error) {
+	var token entity.UserMailToken
+	if err := r.db.Where("token_hash = ?", tokenHash).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *mailTokenRepository) CountSince(userID int64, purpose string, since time.Time) (int64, error) {
+	var count int64
+	err := r.db.Model(&entity.UserMailToken{}).
+		Where("user_id = ? AND purpose = ? AND created_at >= ?", userID, purpose, since).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *mailTokenRepository) VerifyEmail(tokenHash string, userID int64, mailAddress string, now time.Time) (bool, error) {
+	ok := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		consumed, err := consumeMailToken(tx, tokenHash, now)
+		if err != nil || !consumed {
+			return err
+		}
+		ok = true
+		return tx.Model(&entity.User{}).
+			Where("user_id = ? AND mail_address = ? AND email_verified_at IS NULL", userID, mailAddress).
+			Update("email_verified_at", now).Error
+	})
+	return ok, err
+}
+
+func (r *mailTokenRepository) ResetPassword(tokenHash string, userID int64, mailAddress string, passwordHash string, now time.Time, afterConsume func() error) (bool, error) {
+	ok := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		consumed, err := consumeMailToken(tx, tokenHash, now)
+		if err != nil || !consumed {
+			return err
+		}
+		ok = true
+		if err := tx.Model(&entity.User{}).
+			Where("user_id = ?", userID).
+			Update("password", passwordHash).Error; err != nil {
+			return err
+		}
+		// 再設定のメールを受け取れたので、メールアドレスも確かめられたことになるのだ
+		if err := tx.Model(&entity.User{}).
+			Where("user_id = ? AND mail_address = ? AND email_verified_at IS NULL", userID, mailAddress).
+			Update("email_verified_at", now).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&entity.UserMailToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, entity.MailTokenResetPassword).
+			Update("used_at", now).Error; err != nil {
+			return err
+		}
+		return afterConsume()
+	})
+	if err != nil {
+		return false, err
+	}
+	return ok, nil
+}
+
+func (r *mailTokenRepository) DeleteExpired(before time.Time) error {
+	return r.db.Where("expires_at < ?", before).Delete(&entity.UserMailToken{}).Error
+}
+
+// consumeMailToken はまだ使われていない期限内のトークンに使った印を付けるのだ
+func consumeMailToken(tx *gorm.DB, tokenHash string, now time.Time) (bool, error) {
+	res := tx.Model(&entity.UserMailToken{}).
+		Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, now).
+		Update("used_at", now)
+	return res.RowsAffected == 1, res.Error
+}
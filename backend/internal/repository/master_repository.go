@@ -1,17 +1,21 @@
 package repository
 
 import (
+	"github.com/saku-730/web-occurrence/backend/internal/entity"
 	"github.com/saku-730/web-occurrence/backend/internal/model"
 	"gorm.io/gorm"
 )
 
 type MasterRepository interface {
 	GetAllLanguages() ([]model.Language, error)
+	// FindLanguageByID は言語を1件返すのだ。無ければ gorm.ErrRecordNotFound なのだ
+	FindLanguageByID(languageID int64) (*model.Language, error)
 	GetAllFileTypes() ([]model.FileType, error)
 	GetAllFileExtensions() ([]model.FileExtension, error)
 	GetAllUserRoles() ([]model.UserRole, error)
 	// ▼ 変更: 全件取得をやめて、ワークステーション指定で取得するメソッドにするのだ
 	GetUsersByWorkstationID(workstationID int64) ([]model.WorkstationUser, error)
+	GetPlaceNamesByWorkstationID(workstationID int64) ([]entity.PlaceName, error)
 }
 
 type masterRepository struct {
@@ -28,6 +32,14 @@ func (r *masterRepository) GetAllLanguages() ([]model.Language, error) {
 	return list, err
 }
 
+func (r *masterRepository) FindLanguageByID(languageID int64) (*model.Language, error) {
+	var lang model.Language
+	if err := r.db.Where("language_id = ?", languageID).First(&lang).Error; err != nil {
+		return nil, err
+	}
+	return &lang, nil
+}
+
 func (r *masterRepository) GetAllFileTypes() ([]model.FileType, error) {
 	var list []model.FileType
 	err := r.db.Find(&list).Error
@@ -60,3 +72,12 @@ func (r *masterRepository) GetUsersByWorkstationID(workstationID int64) ([]model
 		
 	return list, err
 }
+
+// 地名辞典はオフライン入力でも使うので、ワークステーション分をまるごとマスターデータで配るのだ
+func (r *masterRepository) GetPlaceNamesByWorkstationID(workstationID int64) ([]entity.PlaceName, error) {
+	var list []entity.PlaceName
+	err := r.db.Where("workstation_id = ?", workstationID).
+		Order("name").
+		Find(&list).Error
+	return list, err
+}
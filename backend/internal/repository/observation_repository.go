@@ -0,0 +1,211 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/saku-730/web-occurrence/backend/internal/entity"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"gorm.io/gorm"
+)
+
+var ErrVocabularyNameTaken = errors.New("同じ名前が既にあります")
+
+// ObservationBehaviorRow は観察に付けた行動の語彙なのだ
+type ObservationBehaviorRow struct {
+	ObservationID string `gorm:"column:observation_id"`
+	entity.BehaviorTerm
+}
+
+type ObservationRepository interface {
+	FindOccurrence(occurrenceID string) (*entity.Occurrence, error)
+
+	ListMethods(workstationID int64) ([]entity.ObservationMethod, error)
+	FindMethod(methodID string) (*entity.ObservationMethod, error)
+	// SaveMethod は観察手法を作成・更新するのだ。名前が重なれば ErrVocabularyNameTaken を返すのだ
+	SaveMethod(m *entity.ObservationMethod) error
+	DeleteMethod(methodID string) error
+	CountMethodUse(methodID string) (int64, error)
+
+	ListTerms(workstationID int64) ([]entity.BehaviorTerm, error)
+	FindTerms(termIDs []string) ([]entity.BehaviorTerm, error)
+	// SaveTerm は行動の語彙を作成・更新するのだ。名前が重なれば ErrVocabularyNameTaken を返すのだ
+	SaveTerm(t *entity.BehaviorTerm) error
+	DeleteTerm(termID string) error
+	CountTermUse(termID string) (int64, error)
+
+	List(workstationID int64, q *model.ObservationSearchQuery) ([]entity.Observation, error)
+	ListByOccurrenceID(occurrenceID string) ([]entity.Observation, error)
+	FindByID(observationID string) (*entity.Observation, error)
+	ListBehaviors(observationIDs []string) ([]ObservationBehaviorRow, error)
+	// Save は観察記録を作成・更新して、行動の語彙を termIDs に置き換えるのだ
+	Save(obs *entity.Observation, termIDs []string) error
+	Delete(observationID string) error
+}
+
+type observationRepository struct {
+	db *gorm.DB
+}
+
+func NewObservationRepository(db *gorm.DB) ObservationRepository {
+	return &observationRepository{db: db}
+}
+
+func (r *observationRepository) FindOccurrence(occurrenceID string) (*entity.Occurrence, error) {
+	var occ entity.Occurrence
+	if err := r.db.Where("occurrence_id = ?", occurrenceID).First(&occ).Error; err != nil {
+		return nil, err
+	}
+	return &occ, nil
+}
+
+func (r *observationRepository) ListMethods(workstationID int64) ([]entity.ObservationMethod, error) {
+	var list []entity.ObservationMethod
+	err := r.db.Where("workstation_id = ?", workstationID).Order("method_common_name").Find(&list).Error
+	return list, err
+}
+
+func (r *observationRepository) FindMethod(methodID string) (*entity.ObservationMethod, error) {
+	var m entity.ObservationMethod
+	if err := r.db.Where("observation_method_id = ?", methodID).First(&m).Error; err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (r *observationRepository) SaveMethod(m *entity.ObservationMethod) error {
+	return vocabularyError(r.db.Save(m).Error)
+}
+
+func (r *observationRepository) DeleteMethod(methodID string) error {
+	return r.db.Where("observation_method_id = ?", methodID).Delete(&entity.ObservationMethod{}).Error
+}
+
+func (r *observationRepository) CountMethodUse(methodID string) (int64, error) {
+	var count int64
+	err := r.db.Model(&entity.Observation{}).Where("observation_method_id = ?", methodID).Count(&count).Error
+	return count, err
+}
+
+func (r *observationRepository) ListTerms(workstationID int64) ([]entity.BehaviorTerm, error) {
+	var list []entity.BehaviorTerm
+	err := r.db.Where("workstation_id = ?", workstationID).Order("category").Order("term").Find(&list).Error
+	return list, err
+}
+
+func (r *observationRepository) FindTerms(termIDs []string) ([]entity.BehaviorTerm, error) {
+	var list []entity.BehaviorTerm
+	if len(termIDs) == 0 {
+		return list, nil
+	}
+	err := r.db.Where("term_id IN ?", termIDs).Find(&list).Error
+	return list, err
+}
+
+func (r *observationRepository) SaveTerm(t *entity.BehaviorTerm) error {
+	return vocabularyError(r.db.Save(t).Error)
+}
+
+func (r *observationRepository) DeleteTerm(termID string) error {
+	return r.db.Where("term_id = ?", termID).Delete(&entity.BehaviorTerm{}).Error
+}
+
+func (r *observationRepository) CountTermUse(termID string) (int64, error) {
+	var count int64
+	err := r.db.Model(&entity.ObservationBehavior{}).Where("term_id = ?", termID).Count(&count).Error
+	return count, err
+}
+
+func (r *observationRepository) List(workstationID int64, q *model.ObservationSearchQuery) ([]entity.Observation, error) {
+	tx := r.db.Table("observations AS obs").Select("obs.*").Where("obs.workstation_id = ?", workstationID)
+	if q.OccurrenceID != "" {
+		tx = tx.Where("obs.occurrence_id = ?", q.OccurrenceID)
+	}
+	if q.ObservationMethodID != "" {
+		tx = tx.Where("obs.observation_method_id = ?", q.ObservationMethodID)
+	}
+	if q.BehaviorTermID != "" {
+		tx = tx.Where("EXISTS (SELECT 1 FROM observation_behaviors ob WHERE ob.observation_id = obs.observation_id AND ob.term_id = ?)", q.BehaviorTermID)
+	}
+	if q.Behavior != "" {
+		tx = tx.Where(observationBehaviorMatchExpr, "%"+q.Behavior+"%", "%"+q.Behavior+"%")
+	}
+	if q.UserID != 0 {
+		tx = tx.Where("obs.user_id = ?", q.UserID)
+	}
+	if !q.ObservedStart.IsZero() {
+		tx = tx.Where("obs.observed_at >= ?", q.ObservedStart)
+	}
+	if !q.ObservedEnd.IsZero() {
+		tx = tx.Where("obs.observed_at <= ?", q.ObservedEnd)
+	}
+
+	var list []entity.Observation
+	err := tx.Order("obs.observed_at DESC").
+		Limit(q.Limit).
+		Offset(q.Offset).
+		Find(&list).Error
+	return list, err
+}
+
+func (r *observationRepository) ListByOccurrenceID(occurrenceID string) ([]entity.Observation, error) {
+	var list []entity.Observation
+	err := r.db.Where("occurrence_id = ?", occurrenceID).Order("observed_at").Find(&list).Error
+	return list, err
+}
+
+func (r *observationRepository) FindByID(observationID string) (*entity.Observation, error) {
+	var obs entity.Observation
+	if err := r.db.Where("observation_id = ?", observationID).First(&obs).Error; err != nil {
+		return nil, err
+	}
+	return &obs, nil
+}
+
+func (r *observationRepository) ListBehaviors(observationIDs []string) ([]ObservationBehaviorRow, error) {
+	var rows []ObservationBehaviorRow
+	if len(observationIDs) == 0 {
+		return rows, nil
+	}
+	err := r.db.Table("observation_behaviors").
+		Select("observation_behaviors.observation_id, behavior_terms.*").
+		Joins("JOIN behavior_terms ON behavior_terms.term_id = observation_behaviors.term_id").
+		Where("observation_behaviors.observation_id IN ?", observationIDs).
+		Order("behavior_terms.term").
+		Scan(&rows).Error
+	return rows, err
+}
+
+func (r *observationRepository) Save(obs *entity.Observation, termIDs []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(obs).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("observation_id = ?", obs.ObservationID).Delete(&entity.ObservationBehavior{}).Error; err != nil {
+			return err
+		}
+		if len(termIDs) == 0 {
+			return nil
+		}
+		links := make([]entity.ObservationBehavior, len(termIDs))
+		for i, id := range termIDs {
+			links[i] = entity.ObservationBehavior{ObservationID: obs.ObservationID, TermID: id}
+		}
+		return tx.Create(&links).Error
+	})
+}
+
+func (r *observationRepository) Delete(observationID string) error {
+	return r.db.Where("observation_id = ?", observationID).Delete(&entity.Observation{}).Error
+}
+
+// vocabularyError は名前の一意制約の違反を ErrVocabularyNameTaken にするのだ
+func vocabularyError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) || strings.Contains(err.Error(), "23505") {
+		return ErrVocabularyNameTaken
+	}
+	return err
+}
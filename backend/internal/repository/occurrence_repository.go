@@ -0,0 +1,350 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"gorm.io/gorm"
+)
+
+// OccurrenceRepository は同期済みの occurrence テーブルを検索するのだ
+type OccurrenceRepository interface {
+	Search(workstationIDs []int64, q *model.OccurrenceSearchQuery, limit, offset int) ([]model.OccurrenceSearchRow, int64, error)
+	// StreamSearch は検索結果を1行ずつ fn に渡すのだ（大量エクスポート用）
+	StreamSearch(workstationIDs []int64, q *model.OccurrenceSearchQuery, fn func(row *model.OccurrenceSearchRow) error) error
+	// CountByMesh はメッシュコードの先頭 meshLength 桁と分類ごとに件数を数えるのだ
+	// 一般化の指定ごとにも分けて返すので、サービス側でさらに粗いメッシュにまとめられるのだ
+	CountByMesh(workstationIDs []int64, q *model.OccurrenceSearchQuery, meshLength int) ([]model.MeshTaxonCount, error)
+	// ClusterByGrid は地点を Web メルカトルの cellSize (m) の格子でまとめて、マスごとの件数と重心を返すのだ
+	// 件数の多いマスから limit 件までなのだ
+	ClusterByGrid(workstationIDs []int64, q *model.OccurrenceSearchQuery, cellSize float64, limit int) ([]model.OccurrenceGridCluster, error)
+	// RollupByRank は分類の階級 rank の名前ごとに件数を数えるのだ (大文字小文字と前後の空白は同じものとして扱うのだ)
+	// rank の名前が無いレコードは、入っているいちばん下の階級の名前で数えるのだ
+	RollupByRank(workstationIDs []int64, q *model.OccurrenceSearchQuery, rank string) ([]model.TaxonRollupRow, error)
+}
+
+type occurrenceRepository struct {
+	db *gorm.DB
+}
+
+func NewOccurrenceRepository(db *gorm.DB) OccurrenceRepository {
+	return &occurrenceRepository{db: db}
+}
+
+// baseQuery は occurrence に分類・場所・ユーザーを JOIN したクエリを作るのだ
+func (r *occurrenceRepository) baseQuery(workstationIDs []int64, q *model.OccurrenceSearchQuery) *gorm.DB {
+	tx := r.db.Table("occurrence").
+		Joins("LEFT JOIN classification_json ON classification_json.classification_id = occurrence.classification_id").
+		Joins("LEFT JOIN LATERAL (SELECT "+occurrenceSensitivitySubquery+" AS sensitivity) AS occurrence_sensitivity ON true").
+		Joins("LEFT JOIN places ON places.place_id = occurrence.place_id").
+		Joins("LEFT JOIN users ON users.user_id = occurrence.user_id").
+		Where("occurrence.workstation_id IN ?", workstationIDs)
+
+	return applyOccurrenceFilter(tx, q)
+}
+
+// applyOccurrenceFilter は検索条件を WHERE 句に変換するのだ
+// 空の条件は無視するので、指定されたものだけで絞り込めるのだ
+func applyOccurrenceFilter(tx *gorm.DB, q *model.OccurrenceSearchQuery) *gorm.DB {
+	if q.UserID != 0 {
+		tx = tx.Where("occurrence.user_id = ?", q.UserID)
+	}
+	if q.OccurrenceID != "" {
+		tx = tx.Where("occurrence.occurrence_id = ?", q.OccurrenceID)
+	}
+	if q.ProjectID != "" {
+		tx = tx.Where("occurrence.project_id = ?", q.ProjectID)
+	}
+	if q.IndividualID != "" {
+		tx = tx.Where("occurrence.individual_id = ?", q.IndividualID)
+	}
+	if q.Lifestage != "" {
+		tx = tx.Where("occurrence.lifestage = ?", q.Lifestage)
+	}
+	if q.Sex != "" {
+		tx = tx.Where("occurrence.sex = ?", q.Sex)
+	}
+	if !q.CreatedStart.IsZero() {
+		tx = tx.Where("occurrence.created_at >= ?", q.CreatedStart)
+	}
+	if !q.CreatedEnd.IsZero() {
+		tx = tx.Where("occurrence.created_at <= ?", q.CreatedEnd)
+	}
+	// 空間検索は places.geom (GISTインデックス付き) を使うのだ
+	if q.BBox != nil {
+		tx = tx.Where("places.geom && ST_MakeEnvelope(?, ?, ?, ?, 4326)", q.BBox.MinLon, q.BBox.MinLat, q.BBox.MaxLon, q.BBox.MaxLat)
+	}
+	if q.Circle != nil {
+		tx = tx.Where("ST_DWithin(places.geom::geography, ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography, ?)", q.Circle.Longitude, q.Circle.Latitude, q.Circle.Meters)
+	}
+	if q.Polygon != "" {
+		tx = tx.Where("ST_Intersects(places.geom, ST_SetSRID(ST_GeomFromGeoJSON(?), 4326))", q.Polygon)
+	}
+	if q.MeshCode != "" {
+		tx = tx.Where("places.mesh_code LIKE ?", q.MeshCode+"%")
+	}
+	// 地名は上の階層 (都道府県・市区町村など) の名前でも当たるようにするのだ
+	if q.PlaceName != "" {
+		pattern := "%" + q.PlaceName + "%"
+		tx = tx.Where("EXISTS (WITH RECURSIVE lineage AS ("+
+			"SELECT pn.place_name_id, pn.parent_id, pn.name, pn.class_place_name, 1 AS depth FROM place_names_json pn "+
+			"WHERE pn.place_name_id = places.place_name_id "+
+			"UNION ALL SELECT parent.place_name_id, parent.parent_id, parent.name, parent.class_place_name, lineage.depth + 1 "+
+			"FROM place_names_json parent JOIN lineage ON parent.place_name_id = lineage.parent_id WHERE lineage.depth < ?) "+
+			"SELECT 1 FROM lineage WHERE lineage.name ILIKE ? OR lineage.class_place_name::text ILIKE ?)", maxPlaceNameDepth, pattern, pattern)
+	}
+	if q.RestrictSensitive && (q.BBox != nil || q.Circle != nil || q.Polygon != "" || q.MeshCode != "" || q.PlaceName != "") {
+		tx = tx.Where("(occurrence.workstation_id IN ? OR "+occurrenceSensitivityExpr+" = '')", q.FullPrecisionWorkstationIDs)
+	}
+	if q.NameStatus != "" {
+		tx = tx.Where("occurrence.name_status = ?", q.NameStatus)
+	}
+	if q.Note != "" {
+		tx = tx.Where("occurrence.note ILIKE ?", "%"+q.Note+"%")
+	}
+	if q.ObservationMethodID != "" {
+		tx = tx.Where("EXISTS (SELECT 1 FROM observations obs WHERE obs.occurrence_id = occurrence.occurrence_id "+
+			"AND obs.observation_method_id = ?)", q.ObservationMethodID)
+	}
+	if q.BehaviorTermID != "" {
+		tx = tx.Where("EXISTS (SELECT 1 FROM observations obs JOIN observation_behaviors ob ON ob.observation_id = obs.observation_id "+
+			"WHERE obs.occurrence_id = occurrence.occurrence_id AND ob.term_id = ?)", q.BehaviorTermID)
+	}
+	if q.Behavior != "" {
+		tx = tx.Where("EXISTS (SELECT 1 FROM observations obs WHERE obs.occurrence_id = occurrence.occurrence_id AND "+
+			observationBehaviorMatchExpr+")", "%"+q.Behavior+"%", "%"+q.Behavior+"%")
+	}
+
+	// 分類は class_classification (jsonb) のキーで絞り込むのだ
+	ranks := []struct {
+		rank  string
+		value string
+	}{
+		{"kingdom", q.Kingdom},
+		{"phylum", q.Phylum},
+		{"class", q.Class},
+		{"order", q.Order},
+		{"family", q.Family},
+		{"genus", q.Genus},
+		{"species", q.Species},
+	}
+	for _, r := range ranks {
+		if r.value == "" {
+			continue
+		}
+		// 上位の階級で絞り込んだときは、チェックリストでその下に入る分類で記録されたものも含めるのだ
+		// (species だけ入力されて family が空のレコードなども拾えるようにするため)
+		// チェックリストが無くても、species に学名で書いてあれば genus や学名でも当たるようにするのだ
+		conds := []string{
+			"classification_json.class_classification ->> ? ILIKE ?",
+			"btrim(" + classificationRankExprs[r.rank] + ") ILIKE ?",
+			"EXISTS (SELECT 1 FROM taxa AS name_match WHERE name_match.workstation_id = occurrence.workstation_id " +
+				"AND lower(name_match.classification ->> ?) = lower(?) AND " + taxonNameMatchExpr + ")",
+		}
+		args := []interface{}{r.rank, r.value, r.value, r.rank, r.value}
+		if q.Synonyms {
+			conds = append(conds, "EXISTS (SELECT 1 FROM taxa AS matched JOIN taxa AS name_match ON name_match.workstation_id = matched.workstation_id "+
+				"AND coalesce(name_match.accepted_id, name_match.taxon_id) = coalesce(matched.accepted_id, matched.taxon_id) "+
+				"WHERE matched.workstation_id = occurrence.workstation_id AND matched.rank = ? "+
+				"AND (lower(matched.canonical_name) = lower(?) OR lower(matched.scientific_name) = lower(?)) AND "+taxonNameMatchExpr+")")
+			args = append(args, r.rank, r.value, r.value)
+		}
+		tx = tx.Where("("+strings.Join(conds, " OR ")+")", args...)
+	}
+
+	// チェックリストの分類 (有効名と全ての異名、下位の分類) のどれかで記録されているものを探すのだ
+	if q.TaxonID != "" {
+		tx = tx.Where("EXISTS (SELECT 1 FROM taxa AS target, taxa AS name_match "+
+			"WHERE target.taxon_id = ? AND name_match.workstation_id = occurrence.workstation_id "+
+			"AND (coalesce(name_match.accepted_id, name_match.taxon_id) = coalesce(target.accepted_id, target.taxon_id) "+
+			"OR lower(name_match.classification ->> target.rank) = lower(target.canonical_name)) AND "+taxonNameMatchExpr+")", q.TaxonID)
+	}
+
+	return tx
+}
+
+// maxPlaceNameDepth は地名の親をたどる深さの上限なのだ (国 > 都道府県 > 市区町村 > 地点 より深くはならないのだ)
+const maxPlaceNameDepth = 10
+
+// observationBehaviorMatchExpr は観察 (別名 obs) の自由記述か語彙の名前が部分一致するかの式なのだ
+const observationBehaviorMatchExpr = "(obs.behavior ILIKE ? OR EXISTS (SELECT 1 FROM observation_behaviors ob " +
+	"JOIN behavior_terms bt ON bt.term_id = ob.term_id WHERE ob.observation_id = obs.observation_id AND bt.term ILIKE ?))"
+
+// taxonNameMatchExpr は taxa の1件 (別名 name_match) が occurrence の分類と一致するかの式なのだ
+// species は種小名だけで記録されていることがあるので、genus と組み合わせた学名とも比べるのだ
+const taxonNameMatchExpr = "(lower(classification_json.class_classification ->> name_match.rank) = lower(name_match.canonical_name) " +
+	"OR (name_match.rank = 'species' AND lower(concat_ws(' ', classification_json.class_classification ->> 'genus', " +
+	"classification_json.class_classification ->> 'species')) = lower(name_match.canonical_name)))"
+
+// occurrenceSensitivityExpr は今有効な一般化の指定をカンマ区切りで返す式なのだ
+// baseQuery の LATERAL JOIN で1行に1回だけ計算したものを、SELECT と WHERE の両方で使うのだ
+const occurrenceSensitivityExpr = "occurrence_sensitivity.sensitivity"
+
+// occurrenceSensitivitySubquery は occurrenceSensitivityExpr の中身なのだ
+// レコード自身の指定と、分類群 (sensitive_taxa) の指定のうち embargo_until を過ぎていないものを集めるのだ
+const occurrenceSensitivitySubquery = "concat_ws(',', " +
+	"CASE WHEN occurrence.embargo_until IS NULL OR occurrence.embargo_until > now() THEN NULLIF(occurrence.sensitivity, '') END, " +
+	"(SELECT string_agg(st.generalization, ',') FROM sensitive_taxa st " +
+	"WHERE st.workstation_id = occurrence.workstation_id " +
+	"AND (st.embargo_until IS NULL OR st.embargo_until > now()) " +
+	"AND (lower(classification_json.class_classification ->> st.rank) = lower(st.name) " +
+	"OR (st.rank = 'species' AND lower(concat_ws(' ', classification_json.class_classification ->> 'genus', classification_json.class_classification ->> 'species')) = lower(st.name)))))"
+
+const occurrenceSearchColumns = "occurrence.occurrence_id, occurrence.workstation_id, occurrence.user_id, " +
+	"users.display_name AS user_display_name, occurrence.project_id, occurrence.individual_id, " +
+	"occurrence.lifestage, occurrence.sex, occurrence.body_length, occurrence.note, " +
+	"occurrence.classification_id, classification_json.class_classification, " +
+	"occurrence.place_id, places.place_name_id, places.coordinates, places.accuracy, places.latitude, places.longitude, places.mesh_code, places.datum, " +
+	"occurrence.language_id, occurrence.created_at, occurrence.timezone, occurrence.name_status, " +
+	occurrenceSensitivityExpr + " AS sensitivity, occurrence.embargo_until"
+
+func (r *occurrenceRepository) Search(workstationIDs []int64, q *model.OccurrenceSearchQuery, limit, offset int) ([]model.OccurrenceSearchRow, int64, error) {
+	var total int64
+	if err := r.baseQuery(workstationIDs, q).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var list []model.OccurrenceSearchRow
+	err := r.baseQuery(workstationIDs, q).
+		Select(occurrenceSearchColumns).
+		Order("occurrence.created_at DESC").
+		Offset(offset).
+		Limit(limit).
+		Scan(&list).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return list, total, nil
+}
+
+func (r *occurrenceRepository) StreamSearch(workstationIDs []int64, q *model.OccurrenceSearchQuery, fn func(row *model.OccurrenceSearchRow) error) error {
+	rows, err := r.baseQuery(workstationIDs, q).
+		Select(occurrenceSearchColumns).
+		Order("occurrence.created_at DESC").
+		Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	return scanOccurrenceRows(r.db, rows, fn)
+}
+
+func (r *occurrenceRepository) CountByMesh(workstationIDs []int64, q *model.OccurrenceSearchQuery, meshLength int) ([]model.MeshTaxonCount, error) {
+	var list []model.MeshTaxonCount
+	err := r.baseQuery(workstationIDs, q).
+		Select("left(places.mesh_code, ?) AS mesh_code, occurrence.workstation_id, "+
+			"classification_json.class_classification::text AS class_classification, "+
+			occurrenceSensitivityExpr+" AS sensitivity, COUNT(*) AS count", meshLength).
+		Where("places.mesh_code IS NOT NULL").
+		Group("1, 2, 3, 4").
+		Order("1").
+		Scan(&list).Error
+	return list, err
+}
+
+// webMercatorHalfWorld は Web メルカトル (EPSG:3857) の原点から世界の端までの長さ (m) なのだ
+const webMercatorHalfWorld = 20037508.342789244
+
+// occurrenceTaxonLabelExpr は地図に出す分類名 (いちばん下の階級の名前) の式なのだ
+var occurrenceTaxonLabelExpr = "coalesce(CASE WHEN nullif(btrim(classification_json.class_classification ->> 'species'), '') IS NOT NULL " +
+	"THEN btrim(" + classificationRankExprs["species"] + ") END, " +
+	"nullif(btrim(classification_json.class_classification ->> 'genus'), ''), " +
+	"nullif(btrim(classification_json.class_classification ->> 'family'), ''), " +
+	"nullif(btrim(classification_json.class_classification ->> 'order'), ''), " +
+	"nullif(btrim(classification_json.class_classification ->> 'class'), ''), " +
+	"nullif(btrim(classification_json.class_classification ->> 'phylum'), ''), " +
+	"nullif(btrim(classification_json.class_classification ->> 'kingdom'), ''))"
+
+func (r *occurrenceRepository) ClusterByGrid(workstationIDs []int64, q *model.OccurrenceSearchQuery, cellSize float64, limit int) ([]model.OccurrenceGridCluster, error) {
+	var list []model.OccurrenceGridCluster
+	err := r.baseQuery(workstationIDs, q).
+		Joins("CROSS JOIN LATERAL (SELECT ST_Transform(places.geom, 3857) AS geom, "+occurrenceTaxonLabelExpr+" AS label) AS tile_point").
+		Select("floor((ST_X(tile_point.geom) + ?) / ?)::bigint AS cell_x, "+
+			"floor((? - ST_Y(tile_point.geom)) / ?)::bigint AS cell_y, "+
+			"avg(ST_X(tile_point.geom)) AS x, avg(ST_Y(tile_point.geom)) AS y, COUNT(*) AS count, "+
+			"CASE WHEN min(coalesce(tile_point.label, '')) = max(coalesce(tile_point.label, '')) THEN min(tile_point.label) END AS taxon",
+			webMercatorHalfWorld, cellSize, webMercatorHalfWorld, cellSize).
+		Where("places.geom IS NOT NULL").
+		Group("1, 2").
+		Order("count DESC").
+		Limit(limit).
+		Scan(&list).Error
+	return list, err
+}
+
+// scanOccurrenceRows は sql.Rows を1行ずつ構造体に詰めて fn に渡すのだ
+func scanOccurrenceRows(db *gorm.DB, rows *sql.Rows, fn func(row *model.OccurrenceSearchRow) error) error {
+	for rows.Next() {
+		var row model.OccurrenceSearchRow
+		if err := db.ScanRows(rows, &row); err != nil {
+			return err
+		}
+		if err := fn(&row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// classificationRankExprs は階級ごとの名前の式なのだ
+// species は種小名だけで記録されていることがあるので、その場合は genus と組み合わせて学名にするのだ
+// genus が空でも species が学名で書いてあれば、その属名を使うのだ
+var classificationRankExprs = map[string]string{
+	"kingdom": "classification_json.class_classification ->> 'kingdom'",
+	"phylum":  "classification_json.class_classification ->> 'phylum'",
+	"class":   "classification_json.class_classification ->> 'class'",
+	"order":   "classification_json.class_classification ->> 'order'",
+	"family":  "classification_json.class_classification ->> 'family'",
+	"genus": "coalesce(nullif(btrim(classification_json.class_classification ->> 'genus'), ''), " +
+		"CASE WHEN strpos(btrim(classification_json.class_classification ->> 'species'), ' ') > 0 " +
+		"THEN split_part(btrim(classification_json.class_classification ->> 'species'), ' ', 1) END)",
+	"species": "CASE WHEN strpos(classification_json.class_classification ->> 'species', ' ') > 0 " +
+		"THEN classification_json.class_classification ->> 'species' " +
+		"ELSE concat_ws(' ', classification_json.class_classification ->> 'genus', classification_json.class_classification ->> 'species') END",
+}
+
+func (r *occurrenceRepository) RollupByRank(workstationIDs []int64, q *model.OccurrenceSearchQuery, rank string) ([]model.TaxonRollupRow, error) {
+	rankIndex := -1
+	for i, name := range model.ClassificationRanks {
+		if name == rank {
+			rankIndex = i
+		}
+	}
+	if rankIndex < 0 {
+		return nil, fmt.Errorf("unknown rank: %s", rank)
+	}
+	// rank の名前が空のものは、入っているいちばん下の階級の名前でまとめるのだ
+	// どの階級も空のものは NULL にまとめて「未同定」として返すのだ
+	names := make([]string, 0, rankIndex+1)
+	rankCase := "CASE"
+	for i := rankIndex; i >= 0; i-- {
+		name := classificationRankNameExpr(model.ClassificationRanks[i])
+		names = append(names, name)
+		rankCase += " WHEN " + name + " IS NOT NULL THEN '" + model.ClassificationRanks[i] + "'"
+	}
+	rankCase += " END"
+	nameExpr := "coalesce(" + strings.Join(names, ", ") + ")"
+
+	var list []model.TaxonRollupRow
+	err := r.baseQuery(workstationIDs, q).
+		Select(rankCase + " || ':' || lower(" + nameExpr + ") AS name_key, min(" + nameExpr + ") AS name, min(" + rankCase + ") AS name_rank, COUNT(*) AS count, " +
+			"COUNT(DISTINCT lower(btrim(" + classificationRankExprs["species"] + "))) " +
+			"FILTER (WHERE nullif(btrim(classification_json.class_classification ->> 'species'), '') IS NOT NULL) AS species_count").
+		Group("1").
+		Order("count DESC").
+		Order("name").
+		Scan(&list).Error
+	return list, err
+}
+
+// classificationRankNameExpr は階級の名前の式なのだ (名前が空なら NULL なのだ)
+func classificationRankNameExpr(rank string) string {
+	if rank == "species" {
+		return "CASE WHEN nullif(btrim(classification_json.class_classification ->> 'species'), '') IS NULL THEN NULL " +
+			"ELSE btrim(" + classificationRankExprs["species"] + ") END"
+	}
+	return "nullif(btrim(" + classificationRankExprs[rank] + "), '')"
+}
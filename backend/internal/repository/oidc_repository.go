@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/saku-730/web-occurrence/backend/internal/entity"
+	"gorm.io/gorm"
+)
+
+var ErrIdentityAlreadyLinked = errors.New("この IdP のアカウントはすでに結び付けられています")
+
+type OIDCRepository interface {
+	SaveState(state *entity.OIDCLoginState) error
+	// TakeState は state を1回だけ取り出すのだ (取り出したら消すので、同じ state は2回使えないのだ)
+	TakeState(stateHash string) (*entity.OIDCLoginState, error)
+	FindIdentity(issuer, subject string) (*entity.UserIdentity, error)
+	// LinkIdentity は今あるユーザーに IdP のアカウントを結び付けるのだ
+	LinkIdentity(identity *entity.UserIdentity) error
+	// CreateUserWithIdentity はユーザーと IdP のアカウントの結び付けを1つのトランザクションで作るのだ
+	// afterCreate がエラーを返したら、どちらも作らなかったことになるのだ
+	CreateUserWithIdentity(user *entity.User, identity *entity.UserIdentity, afterCreate func(created *entity.User) error) (*entity.User, error)
+	TouchIdentity(issuer, subject string, now time.Time) error
+	SaveTicket(ticket *entity.OIDCLoginTicket) error
+	// TakeTicket は券を1回だけ取り出すのだ
+	TakeTicket(ticketHash string) (*entity.OIDCLoginTicket, error)
+	// DeleteExpired は期限の切れた state と券を消すのだ
+	DeleteExpired(now time.Time) error
+}
+
+type oidcRepository struct {
+	db *gorm.DB
+}
+
+func NewOIDCRepository(db *gorm.DB) OIDCRepository {
+	return &oidcRepository{db: db}
+}
+
+func (r *oidcRepository) SaveState(state *entity.OIDCLoginState) error {
+	return r.db.Create(state).Error
+}
+
+func (r *oidcRepository) TakeState(stateHash string) (*entity.OIDCLoginState, error) {
+	var state entity.OIDCLoginState
+	if err := r.db.Where("state_hash = ?", stateHash).First(&state).Error; err != nil {
+		return nil, err
+	}
+	// 同時に戻ってきたときは、消せた方だけが使えるのだ
+	res := r.db.Where("state_hash = ?", stateHash).Delete(&entity.OIDCLoginState{})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &state, nil
+}
+
+func (r *oidcRepository) FindIdentity(issuer, subject string) (*entity.UserIdentity, error) {
+	var identity entity.UserIdentity
+	err := r.db.Where("issuer = ? AND subject = ?", issuer, subject).First(&identity).Error
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (r *oidcRepository) LinkIdentity(identity *entity.UserIdentity) error {
+	if err := r.db.Create(identity).Error; err != nil {
+		if isUniqueViolation(err) {
+			return ErrIdentityAlreadyLinked
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *oidcRepository) CreateUserWithIdentity(user *entity.User, identity *entity.UserIdentity, afterCreate func(created *entity.User) error) (*entity.User, error) {
+	if user.Timezone == "" {
+		user.Timezone = DefaultTimezone
+	}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			if isUniqueViolation(err) {
+				return ErrEmailAlreadyExists
+			}
+			return err
+		}
+		identity.UserID = user.UserID
+		if err := tx.Create(identity).Error; err != nil {
+			if isUniqueViolation(err) {
+				return ErrIdentityAlreadyLinked
+			}
+			return err
+		}
+		return afterCreate(user)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (r *oidcRepository) TouchIdentity(issuer, subject string, now time.Time) error {
+	return r.db.Model(&entity.UserIdentity{}).
+		Where("issuer = ? AND subject = ?", issuer, subject).
+		Update("last_login_at", now).Error
+}
+
+func (r *oidcRepository) SaveTicket(ticket *entity.OIDCLoginTicket) error {
+	return r.db.Create(ticket).Error
+}
+
+func (r *oidcRepository) TakeTicket(ticketHash string) (*entity.OIDCLoginTicket, error) {
+	var ticket entity.OIDCLoginTicket
+	if err := r.db.Where("ticket_hash = ?", ticketHash).First(&ticket).Error; err != nil {
+		return nil, err
+	}
+	res := r.db.Where("ticket_hash = ?", ticketHash).Delete(&entity.OIDCLoginTicket{})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &ticket, nil
+}
+
+func (r *oidcRepository) DeleteExpired(now time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("expires_at < ?", now).Delete(&entity.OIDCLoginState{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("expires_at < ?", now).Delete(&entity.OIDCLoginTicket{}).Error
+	})
+}
+
+func isUniqueViolation(err error) bool {
+	return errors.Is(err, gorm.ErrDuplicatedKey) || strings.Contains(err.Error(), "23505")
+}
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"github.com/saku-730/web-occurrence/backend/internal/entity"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PlaceNameRepository は地名辞書 (place_names_json) のDB操作なのだ
+type PlaceNameRepository interface {
+	// boundary は GeoJSON の Polygon / MultiPolygon。nil なら境界を消すのだ
+	Create(pn *entity.PlaceName, boundary *string) (*entity.PlaceName, error)
+	Update(pn *entity.PlaceName, boundary *string) error
+	Delete(placeNameID string) error
+	FindByID(placeNameID string) (*entity.PlaceName, error)
+	Search(workstationID int64, q *model.PlaceNameSearchQuery) ([]model.PlaceNameMatch, error)
+	FindContaining(workstationID int64, lat, lon float64) ([]model.PlaceNameMatch, error)
+	FindNearest(workstationID int64, lat, lon float64, limit int) ([]model.PlaceNameMatch, error)
+	// FindAncestors は自分を含めた上位の地名を、いちばん上 (国) から順に返すのだ
+	FindAncestors(placeNameID string) ([]entity.PlaceName, error)
+	CountReferences(placeNameID string) (int64, error)
+}
+
+type placeNameRepository struct {
+	db *gorm.DB
+}
+
+func NewPlaceNameRepository(db *gorm.DB) PlaceNameRepository {
+	return &placeNameRepository{db: db}
+}
+
+const placeNameColumns = "place_name_id, parent_id, rank, name, latitude, longitude"
+
+// placeNameRankOrder は階層の深さで並べるための式なのだ (地点がいちばん深いのだ)
+const placeNameRankOrder = "CASE rank WHEN 'locality' THEN 4 WHEN 'municipality' THEN 3 WHEN 'prefecture' THEN 2 WHEN 'country' THEN 1 ELSE 0 END"
+
+func (r *placeNameRepository) Create(pn *entity.PlaceName, boundary *string) (*entity.PlaceName, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(pn).Error; err != nil {
+			return err
+		}
+		return setPlaceNameBoundary(tx, pn.PlaceNameID, boundary)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pn, nil
+}
+
+func (r *placeNameRepository) Update(pn *entity.PlaceName, boundary *string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(pn).Error; err != nil {
+			return err
+		}
+		return setPlaceNameBoundary(tx, pn.PlaceNameID, boundary)
+	})
+}
+
+func setPlaceNameBoundary(tx *gorm.DB, placeNameID string, boundary *string) error {
+	if boundary == nil {
+		return tx.Exec("UPDATE place_names_json SET boundary = NULL WHERE place_name_id = ?", placeNameID).Error
+	}
+	return tx.Exec("UPDATE place_names_json SET boundary = ST_Multi(ST_SetSRID(ST_GeomFromGeoJSON(?), 4326)) WHERE place_name_id = ?", *boundary, placeNameID).Error
+}
+
+func (r *placeNameRepository) Delete(placeNameID string) error {
+	return r.db.Delete(&entity.PlaceName{}, "place_name_id = ?", placeNameID).Error
+}
+
+func (r *placeNameRepository) FindByID(placeNameID string) (*entity.PlaceName, error) {
+	var pn entity.PlaceName
+	if err := r.db.First(&pn, "place_name_id = ?", placeNameID).Error; err != nil {
+		return nil, err
+	}
+	return &pn, nil
+}
+
+// Search は名前のあいまい検索 (pg_trgm の類似度 + 部分一致) なのだ
+// q が空なら条件に合うものを名前順に返すのだ
+func (r *placeNameRepository) Search(workstationID int64, q *model.PlaceNameSearchQuery) ([]model.PlaceNameMatch, error) {
+	tx := r.db.Table("place_names_json").Where("workstation_id = ?", workstationID)
+	if q.Rank != "" {
+		tx = tx.Where("rank = ?", q.Rank)
+	}
+	if q.ParentID != "" {
+		tx = tx.Where("parent_id = ?", q.ParentID)
+	}
+
+	if q.Q != "" {
+		tx = tx.Select(placeNameColumns+", similarity(name, ?) AS score", q.Q).
+			Where("name % ? OR name ILIKE ? OR class_place_name::text ILIKE ?", q.Q, "%"+q.Q+"%", "%"+q.Q+"%").
+			Order("score DESC").
+			Order("name")
+	} else {
+		tx = tx.Select(placeNameColumns).Order(placeNameRankOrder).Order("name")
+	}
+
+	var list []model.PlaceNameMatch
+	err := tx.Limit(q.Limit).Scan(&list).Error
+	return list, err
+}
+
+// FindContaining は境界ポリゴンに点を含む地名を、深い階層から順に返すのだ
+func (r *placeNameRepository) FindContaining(workstationID int64, lat, lon float64) ([]model.PlaceNameMatch, error) {
+	var list []model.PlaceNameMatch
+	err := r.db.Table("place_names_json").
+		Select(placeNameColumns+", true AS contains").
+		Where("workstation_id = ? AND boundary IS NOT NULL", workstationID).
+		Where("ST_Contains(boundary, ST_SetSRID(ST_MakePoint(?, ?), 4326))", lon, lat).
+		Order(placeNameRankOrder + " DESC").
+		Scan(&list).Error
+	return list, err
+}
+
+// FindNearest は代表点が近い地名を近い順に返すのだ (GIST インデックスの KNN 検索)
+func (r *placeNameRepository) FindNearest(workstationID int64, lat, lon float64, limit int) ([]model.PlaceNameMatch, error) {
+	var list []model.PlaceNameMatch
+	err := r.db.Table("place_names_json").
+		Select(placeNameColumns+", ST_Distance(geom::geography, ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography) AS distance_m", lon, lat).
+		Where("workstation_id = ? AND geom IS NOT NULL", workstationID).
+		Order(clause.OrderBy{Expression: clause.Expr{SQL: "geom <-> ST_SetSRID(ST_MakePoint(?, ?), 4326)", Vars: []interface{}{lon, lat}}}).
+		Limit(limit).
+		Scan(&list).Error
+	return list, err
+}
+
+func (r *placeNameRepository) FindAncestors(placeNameID string) ([]entity.PlaceName, error) {
+	var list []entity.PlaceName
+	err := r.db.Raw(`
+		WITH RECURSIVE ancestors AS (
+			SELECT place_name_id, class_place_name, workstation_id, parent_id, rank, name,
+			       latitude, longitude, user_id, updated_at, 0 AS depth
+			FROM place_names_json WHERE place_name_id = ?
+			UNION ALL
+			SELECT p.place_name_id, p.class_place_name, p.workstation_id, p.parent_id, p.rank, p.name,
+			       p.latitude, p.longitude, p.user_id, p.updated_at, a.depth + 1
+			FROM place_names_json p
+			JOIN ancestors a ON p.place_name_id = a.parent_id
+			WHERE a.depth < 16
+		)
+		SELECT * FROM ancestors ORDER BY depth DESC`, placeNameID).
+		Scan(&list).Error
+	return list, err
+}
+
+// CountReferences は下位の地名と places からの参照数を数えるのだ (削除してよいかの確認用)
+func (r *placeNameRepository) CountReferences(placeNameID string) (int64, error) {
+	var count int64
+	err := r.db.Raw(`
+		SELECT (SELECT COUNT(*) FROM place_names_json WHERE parent_id = ?)
+		     + (SELECT COUNT(*) FROM places WHERE place_name_id = ?)`, placeNameID, placeNameID).
+		Scan(&count).Error
+	return count, err
+}
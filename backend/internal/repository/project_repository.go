@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"github.com/saku-730/web-occurrence/backend/internal/entity"
+	"gorm.io/gorm"
+)
+
+type ProjectRepository interface {
+	List(workstationID int64) ([]entity.Project, error)
+	FindByID(projectID string) (*entity.Project, error)
+	// Create はプロジェクトと、作成した人のメンバーの行をまとめて保存するのだ
+	Create(p *entity.Project, owner *entity.ProjectMember) error
+	Update(p *entity.Project) error
+	Delete(projectID string) error
+	CountOccurrences(projectID string) (int64, error)
+
+	ListMembers(projectIDs []string) ([]entity.ProjectMember, error)
+	FindMember(projectID string, userID int64) (*entity.ProjectMember, error)
+	SaveMember(m *entity.ProjectMember) error
+	DeleteMember(projectID string, userID int64) error
+}
+
+type projectRepository struct {
+	db *gorm.DB
+}
+
+func NewProjectRepository(db *gorm.DB) ProjectRepository {
+	return &projectRepository{db: db}
+}
+
+func (r *projectRepository) List(workstationID int64) ([]entity.Project, error) {
+	var list []entity.Project
+	err := r.db.Where("workstation_id = ?", workstationID).
+		Order("start_day DESC NULLS LAST").
+		Order("project_name").
+		Find(&list).Error
+	return list, err
+}
+
+func (r *projectRepository) FindByID(projectID string) (*entity.Project, error) {
+	var p entity.Project
+	if err := r.db.Where("project_id = ?", projectID).First(&p).Error; err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *projectRepository) Create(p *entity.Project, owner *entity.ProjectMember) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(p).Error; err != nil {
+			return err
+		}
+		owner.ProjectID = p.ProjectID
+		return tx.Create(owner).Error
+	})
+}
+
+func (r *projectRepository) Update(p *entity.Project) error {
+	return r.db.Save(p).Error
+}
+
+func (r *projectRepository) Delete(projectID string) error {
+	return r.db.Where("project_id = ?", projectID).Delete(&entity.Project{}).Error
+}
+
+func (r *projectRepository) CountOccurrences(projectID string) (int64, error) {
+	var count int64
+	err := r.db.Model(&entity.Occurrence{}).Where("project_id = ?", projectID).Count(&count).Error
+	return count, err
+}
+
+func (r *projectRepository) ListMembers(projectIDs []string) ([]entity.ProjectMember, error) {
+	var list []entity.ProjectMember
+	if len(projectIDs) == 0 {
+		return list, nil
+	}
+	err := r.db.Where("project_id IN ?", projectIDs).Order("join_day").Order("user_id").Find(&list).Error
+	return list, err
+}
+
+func (r *projectRepository) FindMember(projectID string, userID int64) (*entity.ProjectMember, error) {
+	var m entity.ProjectMember
+	if err := r.db.Where("project_id = ? AND user_id = ?", projectID, userID).First(&m).Error; err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (r *projectRepository) SaveMember(m *entity.ProjectMember) error {
+	return r.db.Save(m).Error
+}
+
+func (r *projectRepository) DeleteMember(projectID string, userID int64) error {
+	return r.db.Where("project_id = ? AND user_id = ?", projectID, userID).Delete(&entity.ProjectMember{}).Error
+}
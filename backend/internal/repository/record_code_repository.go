@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/saku-730/web-occurrence/backend/internal/entity"
+	"gorm.io/gorm"
+)
+
+var ErrRecordCodeTaken = errors.New("このコードは既に使われています")
+
+type RecordCodeRepository interface {
+	FindByCode(code string) (*entity.RecordCode, error)
+	FindByTarget(targetType, targetID string) (*entity.RecordCode, error)
+	// Create はコードを保存するのだ。コードか対象が既にあれば ErrRecordCodeTaken を返すのだ
+	Create(rc *entity.RecordCode) error
+}
+
+type recordCodeRepository struct {
+	db *gorm.DB
+}
+
+func NewRecordCodeRepository(db *gorm.DB) RecordCodeRepository {
+	return &recordCodeRepository{db: db}
+}
+
+func (r *recordCodeRepository) FindByCode(code string) (*entity.RecordCode, error) {
+	var rc entity.RecordCode
+	if err := r.db.Where("code = ?", code).First(&rc).Error; err != nil {
+		return nil, err
+	}
+	return &rc, nil
+}
+
+func (r *recordCodeRepository) FindByTarget(targetType, targetID string) (*entity.RecordCode, error) {
+	var rc entity.RecordCode
+	if err := r.db.Where("target_type = ? AND target_id = ?", targetType, targetID).First(&rc).Error; err != nil {
+		return nil, err
+	}
+	return &rc, nil
+}
+
+func (r *recordCodeRepository) Create(rc *entity.RecordCode) error {
+	err := r.db.Create(rc).Error
+	if err != nil && (errors.Is(err, gorm.ErrDuplicatedKey) || strings.Contains(err.Error(), "23505")) {
+		return ErrRecordCodeTaken
+	}
+	return err
+}
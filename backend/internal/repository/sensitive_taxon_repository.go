@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"github.com/saku-730/web-occurrence/backend/internal/entity"
+	"gorm.io/gorm"
+)
+
+type SensitiveTaxonRepository interface {
+	ListByWorkstationID(workstationID int64) ([]entity.SensitiveTaxon, error)
+	FindByID(sensitiveTaxonID string) (*entity.SensitiveTaxon, error)
+	Create(st *entity.SensitiveTaxon) error
+	Update(st *entity.SensitiveTaxon) error
+	Delete(sensitiveTaxonID string) error
+}
+
+type sensitiveTaxonRepository struct {
+	db *gorm.DB
+}
+
+func NewSensitiveTaxonRepository(db *gorm.DB) SensitiveTaxonRepository {
+	return &sensitiveTaxonRepository{db: db}
+}
+
+func (r *sensitiveTaxonRepository) ListByWorkstationID(workstationID int64) ([]entity.SensitiveTaxon, error) {
+	var list []entity.SensitiveTaxon
+	err := r.db.Where("workstation_id = ?", workstationID).
+		Order("rank, name").
+		Find(&list).Error
+	return list, err
+}
+
+func (r *sensitiveTaxonRepository) FindByID(sensitiveTaxonID string) (*entity.SensitiveTaxon, error) {
+	var st entity.SensitiveTaxon
+	if err := r.db.Where("sensitive_taxon_id = ?", sensitiveTaxonID).First(&st).Error; err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+func (r *sensitiveTaxonRepository) Create(st *entity.SensitiveTaxon) error {
+	return r.db.Create(st).Error
+}
+
+func (r *sensitiveTaxonRepository) Update(st *entity.SensitiveTaxon) error {
+	return r.db.Save(st).Error
+}
+
+func (r *sensitiveTaxonRepository) Delete(sensitiveTaxonID string) error {
+	return r.db.Where("sensitive_taxon_id = ?", sensitiveTaxonID).Delete(&entity.SensitiveTaxon{}).Error
+}
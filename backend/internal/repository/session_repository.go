@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/saku-730/web-occurrence/backend/internal/entity"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SessionRepository interface {
+	// Create はセッションと最初のリフレッシュトークンをまとめて保存するのだ
+	Create(sess *entity.AuthSession, token *entity.RefreshToken) error
+	FindByID(sessionID string) (*entity.AuthSession, error)
+	// ListActive は取り消されていない、期限内のセッションを返すのだ
+	ListActive(userID int64, now time.Time) ([]entity.AuthSession, error)
+
+	FindToken(tokenHash string) (*entity.RefreshToken, error)
+	// MarkTokenUsed はまだ使われていないトークンに使った印を付けるのだ
+	// 先に他のリクエストが使っていたら false を返すのだ
+	MarkTokenUsed(tokenHash string, now time.Time) (bool, error)
+	// Rotate は新しいリフレッシュトークンを保存して、セッションの期限を延ばすのだ
+	// セッションのまだ使われていないトークン (再送の前に渡した後継) は使用済みにするので、使えるトークンはいつも1つだけなのだ
+	Rotate(sess *entity.AuthSession, token *entity.RefreshToken) error
+
+	Revoke(sessionID string, now time.Time) error
+	// RevokeAllByUserID はユーザーのセッションをすべて取り消すのだ (exceptSessionID は残すのだ)
+	RevokeAllByUserID(userID int64, exceptSessionID string, now time.Time) error
+	// DeleteExpired は期限切れや取り消し済みのセッションを消すのだ
+	DeleteExpired(before time.Time) error
+}
+
+type sessionRepository struct {
+	db *gorm.DB
+}
+
+func NewSessionRepository(db *gorm.DB) SessionRepository {
+	return &sessionRepository{db: db}
+}
+
+func (r *sessionRepository) Create(sess *entity.AuthSession, token *entity.RefreshToken) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(sess).Error; err != nil {
+			return err
+		}
+		token.SessionID = sess.SessionID
+		return tx.Create(token).Error
+	})
+}
+
+func (r *sessionRepository) FindByID(sessionID string) (*entity.AuthSession, error) {
+	var sess entity.AuthSession
+	if err := r.db.Where("session_id = ?", sessionID).First(&sess).Error; err != nil {
+		return nil, err
+	}
+	return &sess, nil
+}
+
+func (r *sessionRepository) ListActive(userID int64, now time.Time) ([]entity.AuthSession, error) {
+	var list []entity.AuthSession
+	err := r.db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, now).
+		Order("last_used_at DESC").
+		Find(&list).Error
+	return list, err
+}
+
+func (r *sessionRepository) FindToken(tokenHash string) (*entity.RefreshToken, error) {
+	var token entity.RefreshToken
+	if err := r.db.Where("token_hash = ?", tokenHash).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *sessionRepository) MarkTokenUsed(tokenHash string, now time.Time) (bool, error) {
+	res := r.db.Model(&entity.RefreshToken{}).
+		Where("token_hash = ? AND used_at IS NULL", tokenHash).
+		Update("used_at", now)
+	return res.RowsAffected == 1, res.Error
+}
+
+func (r *sessionRepository) Rotate(sess *entity.AuthSession, token *entity.RefreshToken) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// 同時に再送されても後継が2つ残らないように、セッションの行をロックして順番に入れ替えるのだ
+		var locked entity.AuthSession
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("session_id = ?", sess.SessionID).
+			First(&locked).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&entity.RefreshToken{}).
+			Where("session_id = ? AND used_at IS NULL", sess.SessionID).
+			Update("used_at", sess.LastUsedAt).Error
+		if err != nil {
+			return err
+		}
+
+		token.SessionID = sess.SessionID
+		if err := tx.Create(token).Error; err != nil {
+			return err
+		}
+		return tx.Model(&entity.AuthSession{}).
+			Where("session_id = ?", sess.SessionID).
+			Updates(map[string]interface{}{
+				"last_used_at": sess.LastUsedAt,
+				"expires_at":   sess.ExpiresAt,
+				"ip_address":   sess.IPAddress,
+				"user_agent":   sess.UserAgent,
+			}).Error
+	})
+}
+
+func (r *sessionRepository) Revoke(sessionID string, now time.Time) error {
+	return r.db.Model(&entity.AuthSession{}).
+		Where("session_id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", now).Error
+}
+
+func (r *sessionRepository) RevokeAllByUserID(userID int64, exceptSessionID string, now time.Time) error {
+	tx := r.db.Model(&entity.AuthSession{}).Where("user_id = ? AND revoked_at IS NULL", userID)
+	if exceptSessionID != "" {
+		tx = tx.Where("session_id <> ?", exceptSessionID)
+	}
+	return tx.Update("revoked_at", now).Error
+}
+
+func (r *sessionRepository) DeleteExpired(before time.Time) error {
+	return r.db.Where("expires_at < ? OR revoked_at < ?", before, before).Delete(&entity.AuthSession{}).Error
+}
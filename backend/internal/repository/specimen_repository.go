@@ -0,0 +1,236 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/saku-730/web-occurrence/backend/internal/entity"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxCatalogNumberSkips は手入力の番号と重なったときに飛ばす回数の上限なのだ
+const maxCatalogNumberSkips = 10000
+
+type SpecimenRepository interface {
+	List(workstationID int64, q *model.SpecimenSearchQuery) ([]entity.Specimen, error)
+	FindByID(specimenID string) (*entity.Specimen, error)
+	FindByCatalogNumber(workstationID int64, catalogNumber string) (*entity.Specimen, error)
+	// ListByCatalogNumber は複数のワークステーションから登録番号が一致する標本を探すのだ
+	ListByCatalogNumber(workstationIDs []int64, catalogNumber string) ([]entity.Specimen, error)
+	FindMakeSpecimens(specimenID string) ([]entity.MakeSpecimen, error)
+	FindOccurrence(occurrenceID string) (*entity.Occurrence, error)
+	// Create は標本と作製記録を保存するのだ
+	// 登録番号が空なら、採番の設定から次の番号を割り当てるのだ
+	// 登録番号が既に使われていれば gorm.ErrDuplicatedKey を返すのだ (Update も同じなのだ)
+	Create(sp *entity.Specimen, prep *entity.MakeSpecimen) error
+	Update(sp *entity.Specimen) error
+	Delete(specimenID string) error
+
+	ListSequences(workstationID int64) ([]entity.CatalogNumberSequence, error)
+	// SaveSequence は採番の設定の行をロックしてから apply で書き換えて保存するのだ (なければ作るのだ)
+	// 採番 (nextCatalogNumber) と同じロックを取るので、その間に進んだ next_value を古い値で上書きしないのだ
+	SaveSequence(workstationID int64, collectionID string, apply func(seq *entity.CatalogNumberSequence)) (*entity.CatalogNumberSequence, error)
+}
+
+type specimenRepository struct {
+	db *gorm.DB
+}
+
+func NewSpecimenRepository(db *gorm.DB) SpecimenRepository {
+	return &specimenRepository{db: db}
+}
+
+func (r *specimenRepository) List(workstationID int64, q *model.SpecimenSearchQuery) ([]entity.Specimen, error) {
+	tx := r.db.Where("workstation_id = ?", workstationID)
+	if q.OccurrenceID != "" {
+		tx = tx.Where("occurrence_id = ?", q.OccurrenceID)
+	}
+	if q.CollectionID != "" {
+		tx = tx.Where("collection_id = ?", q.CollectionID)
+	}
+	if q.InstitutionID != "" {
+		tx = tx.Where("institution_id = ?", q.InstitutionID)
+	}
+	if q.CatalogNumber != "" {
+		tx = tx.Where("catalog_number ILIKE ?", q.CatalogNumber+"%")
+	}
+	if q.StorageLocationID != "" {
+		tx = tx.Where(`storage_location_id IN (
+			WITH RECURSIVE sub AS (
+				SELECT location_id FROM storage_locations WHERE location_id = ?
+				UNION ALL
+				SELECT l.location_id FROM storage_locations l JOIN sub ON l.parent_id = sub.location_id
+			)
+			SELECT location_id FROM sub)`, q.StorageLocationID)
+	}
+
+	var list []entity.Specimen
+	err := tx.Order("catalog_number").
+		Order("created_at").
+		Limit(q.Limit).
+		Offset(q.Offset).
+		Find(&list).Error
+	return list, err
+}
+
+func (r *specimenRepository) FindByID(specimenID string) (*entity.Specimen, error) {
+	var sp entity.Specimen
+	if err := r.db.Where("specimen_id = ?", specimenID).First(&sp).Error; err != nil {
+		return nil, err
+	}
+	return &sp, nil
+}
+
+func (r *specimenRepository) FindByCatalogNumber(workstationID int64, catalogNumber string) (*entity.Specimen, error) {
+	var sp entity.Specimen
+	err := r.db.Where("workstation_id = ? AND catalog_number = ?", workstationID, catalogNumber).First(&sp).Error
+	if err != nil {
+		return nil, err
+	}
+	return &sp, nil
+}
+
+func (r *specimenRepository) ListByCatalogNumber(workstationIDs []int64, catalogNumber string) ([]entity.Specimen, error) {
+	var list []entity.Specimen
+	err := r.db.Where("workstation_id IN ? AND catalog_number = ?", workstationIDs, catalogNumber).
+		Order("workstation_id").
+		Find(&list).Error
+	return list, err
+}
+
+func (r *specimenRepository) FindMakeSpecimens(specimenID string) ([]entity.MakeSpecimen, error) {
+	var list []entity.MakeSpecimen
+	err := r.db.Where("specimen_id = ?", specimenID).Order("created_at").Find(&list).Error
+	return list, err
+}
+
+func (r *specimenRepository) FindOccurrence(occurrenceID string) (*entity.Occurrence, error) {
+	var occ entity.Occurrence
+	if err := r.db.Where("occurrence_id = ?", occurrenceID).First(&occ).Error; err != nil {
+		return nil, err
+	}
+	return &occ, nil
+}
+
+func (r *specimenRepository) Create(sp *entity.Specimen, prep *entity.MakeSpecimen) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if sp.CatalogNumber == nil {
+			number, err := r.nextCatalogNumber(tx, sp.WorkstationID, sp.CollectionID)
+			if err != nil {
+				return err
+			}
+			sp.CatalogNumber = &number
+		}
+		if err := tx.Create(sp).Error; err != nil {
+			return err
+		}
+		if prep == nil {
+			return nil
+		}
+		prep.SpecimenID = sp.SpecimenID
+		return tx.Create(prep).Error
+	})
+	return catalogNumberError(err)
+}
+
+// nextCatalogNumber は採番の設定の行をロックして次の番号を取り出すのだ
+// 同時に登録されても、ロックを待つので同じ番号は出ないのだ
+func (r *specimenRepository) nextCatalogNumber(tx *gorm.DB, workstationID int64, collectionID string) (string, error) {
+	// コレクション用の設定がなければワークステーション全体の既定を使うのだ (なければ作るのだ)
+	err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&entity.CatalogNumberSequence{WorkstationID: workstationID, CollectionID: "", Padding: 6, NextValue: 1}).Error
+	if err != nil {
+		return "", err
+	}
+
+	var seq entity.CatalogNumberSequence
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("workstation_id = ? AND collection_id IN ?", workstationID, []string{collectionID, ""}).
+		Order("collection_id DESC").
+		First(&seq).Error
+	if err != nil {
+		return "", err
+	}
+
+	// 手入力の番号と重なっていたら飛ばすのだ
+	var number string
+	for i := 0; ; i++ {
+		if i >= maxCatalogNumberSkips {
+			return "", fmt.Errorf("登録番号の空きが見つかりません (prefix %q)", seq.Prefix)
+		}
+		number = formatCatalogNumber(seq.Prefix, seq.Padding, seq.NextValue)
+		seq.NextValue++
+
+		var count int64
+		err := tx.Model(&entity.Specimen{}).
+			Where("workstation_id = ? AND catalog_number = ?", workstationID, number).
+			Count(&count).Error
+		if err != nil {
+			return "", err
+		}
+		if count == 0 {
+			break
+		}
+	}
+
+	err = tx.Model(&entity.CatalogNumberSequence{}).
+		Where("sequence_id = ?", seq.SequenceID).
+		Update("next_value", seq.NextValue).Error
+	return number, err
+}
+
+// formatCatalogNumber は接頭辞とゼロ埋めの連番をつなげるのだ (例: "NSMT-I-" + 000123)
+func formatCatalogNumber(prefix string, padding int, value int64) string {
+	return fmt.Sprintf("%s%0*d", prefix, padding, value)
+}
+
+func (r *specimenRepository) Update(sp *entity.Specimen) error {
+	return catalogNumberError(r.db.Save(sp).Error)
+}
+
+func (r *specimenRepository) Delete(specimenID string) error {
+	return r.db.Where("specimen_id = ?", specimenID).Delete(&entity.Specimen{}).Error
+}
+
+func (r *specimenRepository) ListSequences(workstationID int64) ([]entity.CatalogNumberSequence, error) {
+	var list []entity.CatalogNumberSequence
+	err := r.db.Where("workstation_id = ?", workstationID).Order("collection_id").Find(&list).Error
+	return list, err
+}
+
+func (r *specimenRepository) SaveSequence(workstationID int64, collectionID string, apply func(seq *entity.CatalogNumberSequence)) (*entity.CatalogNumberSequence, error) {
+	var seq entity.CatalogNumberSequence
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&entity.CatalogNumberSequence{WorkstationID: workstationID, CollectionID: collectionID, Padding: 6, NextValue: 1}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("workstation_id = ? AND collection_id = ?", workstationID, collectionID).
+			First(&seq).Error
+		if err != nil {
+			return err
+		}
+		apply(&seq)
+		return tx.Save(&seq).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &seq, nil
+}
+
+// catalogNumberError は一意制約違反 (23505) を gorm.ErrDuplicatedKey にそろえるのだ
+func catalogNumberError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) || strings.Contains(err.Error(), "23505") {
+		return gorm.ErrDuplicatedKey
+	}
+	return err
+}
@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/saku-730/web-occurrence/backend/internal/entity"
+	"gorm.io/gorm"
+)
+
+var ErrStorageLocationNameTaken = errors.New("同じ場所に同じ名前の保管場所があります")
+
+type StorageRepository interface {
+	ListLocations(workstationID int64) ([]entity.StorageLocation, error)
+	FindLocation(locationID string) (*entity.StorageLocation, error)
+	CreateLocation(loc *entity.StorageLocation) error
+	UpdateLocation(loc *entity.StorageLocation) error
+	DeleteLocation(locationID string) error
+	CountChildren(locationID string) (int64, error)
+	// CountSpecimens は保管場所ごとに、そこに直接入っている標本の数を数えるのだ
+	CountSpecimens(workstationID int64) (map[string]int64, error)
+
+	// MoveSpecimen は標本の保管場所を変えて、移動の履歴を残すのだ
+	MoveSpecimen(specimenID string, locationID *string, mv *entity.SpecimenMovement) error
+	ListMovements(specimenID string) ([]entity.SpecimenMovement, error)
+}
+
+type storageRepository struct {
+	db *gorm.DB
+}
+
+func NewStorageRepository(db *gorm.DB) StorageRepository {
+	return &storageRepository{db: db}
+}
+
+func (r *storageRepository) ListLocations(workstationID int64) ([]entity.StorageLocation, error) {
+	var list []entity.StorageLocation
+	err := r.db.Where("workstation_id = ?", workstationID).Order("name").Find(&list).Error
+	return list, err
+}
+
+func (r *storageRepository) FindLocation(locationID string) (*entity.StorageLocation, error) {
+	var loc entity.StorageLocation
+	if err := r.db.Where("location_id = ?", locationID).First(&loc).Error; err != nil {
+		return nil, err
+	}
+	return &loc, nil
+}
+
+func (r *storageRepository) CreateLocation(loc *entity.StorageLocation) error {
+	return storageLocationError(r.db.Create(loc).Error)
+}
+
+func (r *storageRepository) UpdateLocation(loc *entity.StorageLocation) error {
+	return storageLocationError(r.db.Save(loc).Error)
+}
+
+func (r *storageRepository) DeleteLocation(locationID string) error {
+	return r.db.Where("location_id = ?", locationID).Delete(&entity.StorageLocation{}).Error
+}
+
+func (r *storageRepository) CountChildren(locationID string) (int64, error) {
+	var count int64
+	err := r.db.Model(&entity.StorageLocation{}).Where("parent_id = ?", locationID).Count(&count).Error
+	return count, err
+}
+
+func (r *storageRepository) CountSpecimens(workstationID int64) (map[string]int64, error) {
+	var rows []struct {
+		StorageLocationID string
+		Count             int64
+	}
+	err := r.db.Model(&entity.Specimen{}).
+		Select("storage_location_id, COUNT(*) AS count").
+		Where("workstation_id = ? AND storage_location_id IS NOT NULL", workstationID).
+		Group("storage_location_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.StorageLocationID] = row.Count
+	}
+	return counts, nil
+}
+
+func (r *storageRepository) MoveSpecimen(specimenID string, locationID *string, mv *entity.SpecimenMovement) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&entity.Specimen{}).
+			Where("specimen_id = ?", specimenID).
+			Update("storage_location_id", locationID).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(mv).Error
+	})
+}
+
+func (r *storageRepository) ListMovements(specimenID string) ([]entity.SpecimenMovement, error) {
+	var list []entity.SpecimenMovement
+	err := r.db.Where("specimen_id = ?", specimenID).Order("moved_at DESC").Find(&list).Error
+	return list, err
+}
+
+// storageLocationError は名前の一意制約の違反を ErrStorageLocationNameTaken にするのだ
+func storageLocationError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) || strings.Contains(err.Error(), "23505") {
+		return ErrStorageLocationNameTaken
+	}
+	return err
+}
@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"github.com/saku-730/web-occurrence/backend/internal/entity"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type TaxonRepository interface {
+	// UpsertBatch は (workstation_id, source_id) が同じものを上書きしながら保存するのだ
+	UpsertBatch(list []entity.Taxon) error
+	// ResolveLinks は parent_source_id / accepted_source_id を taxon_id に解決するのだ
+	ResolveLinks(workstationID int64) error
+	Search(workstationID int64, q *model.TaxonSearchQuery) ([]model.TaxonMatch, error)
+	FindByName(workstationID int64, rank, name string) ([]model.TaxonMatch, error)
+	FindByID(taxonID string) (*entity.Taxon, error)
+	FindSynonyms(acceptedID string) ([]entity.Taxon, error)
+	// HasChecklist はワークステーションにチェックリストが取り込まれているかを返すのだ
+	HasChecklist(workstationID int64) (bool, error)
+}
+
+type taxonRepository struct {
+	db *gorm.DB
+}
+
+func NewTaxonRepository(db *gorm.DB) TaxonRepository {
+	return &taxonRepository{db: db}
+}
+
+const taxonMatchColumns = "taxa.taxon_id, taxa.rank, taxa.scientific_name, taxa.canonical_name, taxa.authorship, " +
+	"taxa.taxonomic_status, taxa.vernacular_name, taxa.accepted_id, accepted.canonical_name AS accepted_name"
+
+func (r *taxonRepository) matchQuery(workstationID int64) *gorm.DB {
+	return r.db.Table("taxa").
+		Joins("LEFT JOIN taxa AS accepted ON accepted.taxon_id = taxa.accepted_id").
+		Where("taxa.workstation_id = ?", workstationID)
+}
+
+func (r *taxonRepository) UpsertBatch(list []entity.Taxon) error {
+	if len(list) == 0 {
+		return nil
+	}
+	return r.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "workstation_id"}, {Name: "source_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"parent_source_id", "accepted_source_id", "rank", "scientific_name", "canonical_name",
+			"authorship", "taxonomic_status", "vernacular_name", "classification", "updated_at",
+		}),
+	}).CreateInBatches(list, 500).Error
+}
+
+func (r *taxonRepository) ResolveLinks(workstationID int64) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// 取り込み直しで親や有効名が変わることがあるので、いったん外してから付け直すのだ
+		err := tx.Exec("UPDATE taxa SET parent_id = NULL, accepted_id = NULL WHERE workstation_id = ?", workstationID).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Exec(`
+			UPDATE taxa SET parent_id = parent.taxon_id
+			FROM taxa AS parent
+			WHERE taxa.workstation_id = ? AND parent.workstation_id = taxa.workstation_id
+			  AND parent.source_id = taxa.parent_source_id`, workstationID).Error
+		if err != nil {
+			return err
+		}
+		// 有効名が自分自身を指しているものは accepted_id を入れないのだ
+		return tx.Exec(`
+			UPDATE taxa SET accepted_id = accepted.taxon_id
+			FROM taxa AS accepted
+			WHERE taxa.workstation_id = ? AND accepted.workstation_id = taxa.workstation_id
+			  AND accepted.source_id = taxa.accepted_source_id
+			  AND accepted.taxon_id <> taxa.taxon_id`, workstationID).Error
+	})
+}
+
+// Search は学名・和名の前方一致と pg_trgm の類似度で補完候補を返すのだ
+func (r *taxonRepository) Search(workstationID int64, q *model.TaxonSearchQuery) ([]model.TaxonMatch, error) {
+	tx := r.matchQuery(workstationID)
+	if q.Rank != "" {
+		tx = tx.Where("taxa.rank = ?", q.Rank)
+	}
+
+	if q.Q != "" {
+		tx = tx.Select(taxonMatchColumns+", greatest(similarity(taxa.canonical_name, ?), similarity(coalesce(taxa.vernacular_name, ''), ?), "+
+			"CASE WHEN taxa.canonical_name ILIKE ? THEN 1 ELSE 0 END) AS score", q.Q, q.Q, q.Q+"%").
+			Where("taxa.canonical_name ILIKE ? OR taxa.vernacular_name ILIKE ? OR taxa.canonical_name % ?", q.Q+"%", "%"+q.Q+"%", q.Q).
+			Order("score DESC").
+			Order("taxa.canonical_name")
+	} else {
+		tx = tx.Select(taxonMatchColumns).Order("taxa.canonical_name")
+	}
+
+	var list []model.TaxonMatch
+	err := tx.Limit(q.Limit).Scan(&list).Error
+	return list, err
+}
+
+// FindByName は学名 (著者名あり・なしのどちらでも) が大文字小文字を無視して一致するものを返すのだ
+func (r *taxonRepository) FindByName(workstationID int64, rank, name string) ([]model.TaxonMatch, error) {
+	var list []model.TaxonMatch
+	err := r.matchQuery(workstationID).
+		Select(taxonMatchColumns).
+		Where("taxa.rank = ?", rank).
+		Where("lower(taxa.canonical_name) = lower(?) OR lower(taxa.scientific_name) = lower(?)", name, name).
+		Order("taxa.taxonomic_status = 'accepted' DESC").
+		Scan(&list).Error
+	return list, err
+}
+
+func (r *taxonRepository) FindByID(taxonID string) (*entity.Taxon, error) {
+	var t entity.Taxon
+	if err := r.db.Where("taxon_id = ?", taxonID).First(&t).Error; err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *taxonRepository) FindSynonyms(acceptedID string) ([]entity.Taxon, error) {
+	var list []entity.Taxon
+	err := r.db.Where("accepted_id = ?", acceptedID).Order("canonical_name").Find(&list).Error
+	return list, err
+}
+
+func (r *taxonRepository) HasChecklist(workstationID int64) (bool, error) {
+	var count int64
+	err := r.db.Model(&entity.Taxon{}).Where("workstation_id = ?", workstationID).Limit(1).Count(&count).Error
+	return count > 0, err
+}
@@ -3,19 +3,36 @@ package repository
 import (
 	"errors"
 	"github.com/saku-730/web-occurrence/backend/internal/entity"
+	"strconv"
 	"strings"
+	"time"
 
 	"gorm.io/gorm"
 )
 
+// DefaultTimezone は登録したばかりのユーザーのタイムゾーン (IANA の名前) なのだ
+const DefaultTimezone = "Asia/Tokyo"
+
 // (今回追加) リポジトリ層で発生した特異的なエラーを定義
 var ErrEmailAlreadyExists = errors.New("このメールアドレスは既に使用されています")
 
 // UserRepository はDB操作のインターフェースなのだ
 type UserRepository interface {
 	CreateUser(user *entity.User) (*entity.User, error)
+	// CreateUserWith はトランザクションの中でユーザーを作って afterCreate を呼ぶのだ
+	// afterCreate がエラーを返したら、ユーザーは作らなかったことになる (ロールバック) のだ
+	CreateUserWith(user *entity.User, afterCreate func(created *entity.User) error) (*entity.User, error)
+	// ListActiveUserIDs は削除されていないユーザーの ID をすべて返すのだ
+	ListActiveUserIDs() ([]int64, error)
 	FindUserByEmail(email string) (*entity.User, error)
 	FindUserByID(userID int64) (*entity.User, error) // (今回追加)
+	// UpdateProfile は表示名・言語・タイムゾーンなどを書き換えるのだ (updates は列名 -> 値)
+	UpdateProfile(userID int64, updates map[string]interface{}) error
+	UpdatePassword(userID int64, passwordHash string) error
+	// DeleteUser はアカウントを削除するのだ
+	// 記録の作成者として参照されているので行は残して、個人情報を消してログインできなくするのだ
+	// ワークステーションの所属・セッション・メールのトークン・IdP との結び付けも消して、個人アクセストークンは取り消すのだ
+	DeleteUser(userID int64, now time.Time) error
 }
 
 // userRepository は UserRepository の実装なのだ
@@ -29,7 +46,9 @@ func NewUserRepository(db *gorm.DB) UserRepository {
 }
 
 func (r *userRepository) CreateUser(user *entity.User) (*entity.User, error) {
-	user.Timezone = "9"
+	if user.Timezone == "" {
+		user.Timezone = DefaultTimezone
+	}
 	result := r.db.Create(user)
 
 	if result.Error != nil {
@@ -54,6 +73,31 @@ func (r *userRepository) CreateUser(user *entity.User) (*entity.User, error) {
 	return user, nil
 }
 
+func (r *userRepository) CreateUserWith(user *entity.User, afterCreate func(created *entity.User) error) (*entity.User, error) {
+	if user.Timezone == "" {
+		user.Timezone = DefaultTimezone
+	}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) || strings.Contains(err.Error(), "23505") {
+				return ErrEmailAlreadyExists
+			}
+			return err
+		}
+		return afterCreate(user)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (r *userRepository) ListActiveUserIDs() ([]int64, error) {
+	var ids []int64
+	err := r.db.Model(&entity.User{}).Where("deleted_at IS NULL").Order("user_id").Pluck("user_id", &ids).Error
+	return ids, err
+}
+
 // FindUserByEmail はメールアドレスでユーザーを1件検索するのだ
 func (r *userRepository) FindUserByEmail(email string) (*entity.User, error) {
 	var user entity.User
@@ -80,3 +124,44 @@ func (r *userRepository) FindUserByID(userID int64) (*entity.User, error) {
 
 	return &user, nil
 }
+
+func (r *userRepository) UpdateProfile(userID int64, updates map[string]interface{}) error {
+	return r.db.Model(&entity.User{}).Where("user_id = ?", userID).Updates(updates).Error
+}
+
+func (r *userRepository) UpdatePassword(userID int64, passwordHash string) error {
+	return r.db.Model(&entity.User{}).Where("user_id = ?", userID).Update("password", passwordHash).Error
+}
+
+func (r *userRepository) DeleteUser(userID int64, now time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// mail_address は NULL にして、同じアドレスでまた登録できるようにするのだ
+		if err := tx.Model(&entity.User{}).Where("user_id = ?", userID).Updates(map[string]interface{}{
+			"user_name":             "deleted-" + strconv.FormatInt(userID, 10),
+			"display_name":          "削除されたユーザー",
+			"mail_address":          nil,
+			"password":              nil,
+			"email_verified_at":     nil,
+			"preferred_language_id": nil,
+			"deleted_at":            now,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&entity.WorkstationUser{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&entity.UserMailToken{}).Error; err != nil {
+			return err
+		}
+		// IdP のアカウントとの結び付けも外して、次に IdP でログインしたら新しいユーザーになるようにするのだ
+		if err := tx.Where("user_id = ?", userID).Delete(&entity.UserIdentity{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&entity.PersonalAccessToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&entity.AuthSession{}).Error
+	})
+}
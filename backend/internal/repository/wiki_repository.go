@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/saku-730/web-occurrence/backend/internal/entity"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"gorm.io/gorm"
+)
+
+var ErrWikiTitleTaken = errors.New("同じタイトルのページが既にあります")
+var ErrWikiRevisionConflict = errors.New("ページが他の人に更新されています")
+
+// WikiLinkRow はページを説明として参照している手法なのだ
+type WikiLinkRow struct {
+	Type             string `json:"type" gorm:"column:type"` // observation_method / specimen_method
+	ID               string `json:"id" gorm:"column:id"`
+	MethodCommonName string `json:"method_common_name" gorm:"column:method_common_name"`
+}
+
+type WikiRepository interface {
+	// List は本文を除いたページの一覧を返すのだ
+	List(workstationID int64, q *model.WikiSearchQuery) ([]entity.WikiPage, error)
+	FindByID(pageID string) (*entity.WikiPage, error)
+	// Create はページと最初の版をまとめて保存するのだ
+	Create(page *entity.WikiPage, rev *entity.WikiPageRevision) error
+	// Update はページが baseRevision の版のままのときだけ、新しい版として保存するのだ
+	// 他の人が先に保存していたら ErrWikiRevisionConflict を返すのだ
+	Update(page *entity.WikiPage, rev *entity.WikiPageRevision, baseRevision int) error
+	Delete(pageID string) error
+
+	// ListRevisions は本文を除いた版の一覧を新しい順に返すのだ
+	ListRevisions(pageID string) ([]entity.WikiPageRevision, error)
+	FindRevision(pageID string, revision int) (*entity.WikiPageRevision, error)
+	// SaveRevisionHTML は HTML をまだ持っていない古い版に、HTML を残すのだ
+	SaveRevisionHTML(pageID string, revision int, html string) error
+	ListLinks(pageID string) ([]WikiLinkRow, error)
+}
+
+type wikiRepository struct {
+	db *gorm.DB
+}
+
+func NewWikiRepository(db *gorm.DB) WikiRepository {
+	return &wikiRepository{db: db}
+}
+
+func (r *wikiRepository) List(workstationID int64, q *model.WikiSearchQuery) ([]entity.WikiPage, error) {
+	tx := r.db.Omit("content").Where("workstation_id = ?", workstationID)
+	if q.Q != "" {
+		tx = tx.Where("(title ILIKE ? OR content ILIKE ?)", "%"+q.Q+"%", "%"+q.Q+"%")
+	}
+	var list []entity.WikiPage
+	err := tx.Order("lower(title)").
+		Limit(q.Limit).
+		Offset(q.Offset).
+		Find(&list).Error
+	return list, err
+}
+
+func (r *wikiRepository) FindByID(pageID string) (*entity.WikiPage, error) {
+	var page entity.WikiPage
+	if err := r.db.Where("page_id = ?", pageID).First(&page).Error; err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+func (r *wikiRepository) Create(page *entity.WikiPage, rev *entity.WikiPageRevision) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(page).Error; err != nil {
+			return err
+		}
+		rev.PageID = page.PageID
+		return tx.Create(rev).Error
+	})
+	return wikiError(err)
+}
+
+func (r *wikiRepository) Update(page *entity.WikiPage, rev *entity.WikiPageRevision, baseRevision int) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&entity.WikiPage{}).
+			Where("page_id = ? AND revision = ?", page.PageID, baseRevision).
+			Updates(map[string]interface{}{
+				"title":        page.Title,
+				"content":      page.Content,
+				"content_path": page.ContentPath,
+				"revision":     page.Revision,
+				"updated_date": page.UpdatedDate,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrWikiRevisionConflict
+		}
+		rev.PageID = page.PageID
+		return tx.Create(rev).Error
+	})
+	return wikiError(err)
+}
+
+func (r *wikiRepository) Delete(pageID string) error {
+	return r.db.Where("page_id = ?", pageID).Delete(&entity.WikiPage{}).Error
+}
+
+func (r *wikiRepository) ListRevisions(pageID string) ([]entity.WikiPageRevision, error) {
+	var list []entity.WikiPageRevision
+	err := r.db.Omit("content", "content_html").Where("page_id = ?", pageID).Order("revision DESC").Find(&list).Error
+	return list, err
+}
+
+func (r *wikiRepository) FindRevision(pageID string, revision int) (*entity.WikiPageRevision, error) {
+	var rev entity.WikiPageRevision
+	if err := r.db.Where("page_id = ? AND revision = ?", pageID, revision).First(&rev).Error; err != nil {
+		return nil, err
+	}
+	return &rev, nil
+}
+
+func (r *wikiRepository) SaveRevisionHTML(pageID string, revision int, html string) error {
+	return r.db.Model(&entity.WikiPageRevision{}).
+		Where("page_id = ? AND revision = ?", pageID, revision).
+		Update("content_html", html).Error
+}
+
+func (r *wikiRepository) ListLinks(pageID string) ([]WikiLinkRow, error) {
+	var rows []WikiLinkRow
+	err := r.db.Raw(`
+		SELECT 'observation_method' AS type, observation_method_id AS id, method_common_name
+		FROM observation_methods WHERE pageid = ?
+		UNION ALL
+		SELECT 'specimen_method' AS type, specimen_methods_id AS id, method_common_name
+		FROM specimen_methods WHERE page_id = ?
+		ORDER BY type, method_common_name`, pageID, pageID).
+		Scan(&rows).Error
+	return rows, err
+}
+
+// wikiError はタイトルの一意制約の違反を ErrWikiTitleTaken にするのだ
+func wikiError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) || strings.Contains(err.Error(), "23505") {
+		return ErrWikiTitleTaken
+	}
+	return err
+}
@@ -12,6 +12,10 @@ type WorkstationRepository interface {
 	GetWorkstationsByUserID(userID int64) ([]entity.Workstation, error)
 	GetAllWorkstations() ([]entity.Workstation, error)
 	GetAllWorkstationUserRelations() ([]entity.WorkstationUser, error)
+	IsUserInWorkstation(userID, workstationID int64) (bool, error)
+	GetRoleIDsByUserID(userID int64) (map[int64]int, error)
+	// GetUserRelationsByWorkstationID はワークステーションのメンバーとロールを返すのだ
+	GetUserRelationsByWorkstationID(workstationID int64) ([]entity.WorkstationUser, error)
 }
 
 type workstationRepository struct {
@@ -83,3 +87,34 @@ func (r *workstationRepository) GetAllWorkstationUserRelations() ([]entity.Works
 	}
 	return relations, nil
 }
+
+// IsUserInWorkstation はユーザーがワークステーションに所属しているかを確認するのだ
+func (r *workstationRepository) IsUserInWorkstation(userID, workstationID int64) (bool, error) {
+	var count int64
+	err := r.db.Model(&entity.WorkstationUser{}).
+		Where("user_id = ? AND workstation_id = ?", userID, workstationID).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// GetRoleIDsByUserID はユーザーのワークステーションごとのロールを返すのだ (workstation_id -> role_id)
+func (r *workstationRepository) GetRoleIDsByUserID(userID int64) (map[int64]int, error) {
+	var relations []entity.WorkstationUser
+	if err := r.db.Where("user_id = ?", userID).Find(&relations).Error; err != nil {
+		return nil, err
+	}
+	roles := make(map[int64]int, len(relations))
+	for _, rel := range relations {
+		roles[rel.WorkstationID] = rel.RoleID
+	}
+	return roles, nil
+}
+
+func (r *workstationRepository) GetUserRelationsByWorkstationID(workstationID int64) ([]entity.WorkstationUser, error) {
+	var relations []entity.WorkstationUser
+	err := r.db.Where("workstation_id = ?", workstationID).Find(&relations).Error
+	return relations, err
+}
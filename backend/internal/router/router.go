@@ -14,26 +14,189 @@ func SetupRoutes(
 	workstationHandler *handler.WorkstationHandler,
 	masterHandler *handler.MasterHandler,
 	couchDBHandler *handler.CouchDBHandler,
+	occurrenceHandler *handler.OccurrenceHandler,
+	ogcHandler *handler.OGCHandler,
+	tileHandler *handler.TileHandler,
+	placeNameHandler *handler.PlaceNameHandler,
+	sensitiveTaxonHandler *handler.SensitiveTaxonHandler,
+	taxonHandler *handler.TaxonHandler,
+	identificationHandler *handler.IdentificationHandler,
+	specimenHandler *handler.SpecimenHandler,
+	labelHandler *handler.LabelHandler,
+	resolverHandler *handler.ResolverHandler,
+	storageHandler *handler.StorageHandler,
+	loanHandler *handler.LoanHandler,
+	projectHandler *handler.ProjectHandler,
+	observationHandler *handler.ObservationHandler,
+	wikiHandler *handler.WikiHandler,
+	sessionHandler *handler.SessionHandler,
+	accountHandler *handler.AccountHandler,
+	apiTokenHandler *handler.APITokenHandler,
+	oidcHandler *handler.OIDCHandler,
+	sessionChecker middleware.SessionChecker,
+	apiTokenAuthenticator middleware.APITokenAuthenticator,
 ) {
 	// --- Public API グループ (認証不要) ---
 	apiPublic := r.Group("/api")
 	{
 		apiPublic.POST("/register", userHandler.Register)
 		apiPublic.POST("/login", userHandler.Login)
+		apiPublic.POST("/token/refresh", sessionHandler.Refresh)
+		apiPublic.POST("/email/verify", accountHandler.VerifyEmail)
+		apiPublic.POST("/password/forgot", accountHandler.ForgotPassword)
+		apiPublic.POST("/password/reset", accountHandler.ResetPassword)
+
+		// 大学などの IdP (OpenID Connect) でのログイン
+		apiPublic.GET("/oidc/config", oidcHandler.Config)
+		apiPublic.GET("/oidc/login", oidcHandler.Login)
+		apiPublic.GET("/oidc/callback", oidcHandler.Callback)
+		apiPublic.POST("/oidc/exchange", oidcHandler.Exchange)
 	}
 
 	// --- Protected API グループ (認証ミドルウェアを使用)  ---
 	apiProtected := r.Group("/api")
-	apiProtected.Use(middleware.AuthMiddleware())
+	apiProtected.Use(middleware.AuthMiddleware(sessionChecker, apiTokenAuthenticator))
 	{
 		apiProtected.Any("/couchdb/*path", couchDBHandler.ProxyRequest)
 		apiProtected.GET("/master-data", masterHandler.GetMasterData)
 
 		apiProtected.GET("/users/me", userHandler.GetMe)
+		apiProtected.PATCH("/users/me", userHandler.UpdateMe)
+		apiProtected.POST("/users/me/password", accountHandler.ChangePassword)
+		apiProtected.DELETE("/users/me", accountHandler.DeleteAccount)
+
+		// ログアウトとログイン中の端末 (セッション)
+		apiProtected.POST("/logout", sessionHandler.Logout)
+		apiProtected.POST("/logout/all", sessionHandler.LogoutAll)
+		apiProtected.GET("/users/me/sessions", sessionHandler.List)
+		apiProtected.DELETE("/users/me/sessions/:session_id", sessionHandler.Revoke)
+
+		// メールアドレス確認のメールを送り直す
+		apiProtected.POST("/users/me/email/verification", accountHandler.ResendVerification)
+
+		// 個人アクセストークン (スクリプト用)
+		apiProtected.GET("/users/me/tokens", apiTokenHandler.List)
+		apiProtected.POST("/users/me/tokens", apiTokenHandler.Create)
+		apiProtected.DELETE("/users/me/tokens/:token_id", apiTokenHandler.Revoke)
 		
 		apiProtected.POST("/workstation/create", workstationHandler.Create)
 		apiProtected.GET("/my-workstations", workstationHandler.List) 
+
+		apiProtected.GET("/search", occurrenceHandler.Search)
+		apiProtected.GET("/search/export", occurrenceHandler.Export)
+		apiProtected.GET("/search/mesh", occurrenceHandler.MeshAggregate)
+		apiProtected.GET("/search/rollup", occurrenceHandler.TaxonRollup)
 		
+		// OGC API - Features (QGIS などの GIS クライアント用)
+		apiProtected.GET("/ogc", ogcHandler.LandingPage)
+		apiProtected.GET("/ogc/conformance", ogcHandler.Conformance)
+		apiProtected.GET("/ogc/collections", ogcHandler.Collections)
+		apiProtected.GET("/ogc/collections/:collection_id", ogcHandler.Collection)
+		apiProtected.GET("/ogc/collections/:collection_id/items", ogcHandler.Items)
+		apiProtected.GET("/ogc/collections/:collection_id/items/:feature_id", ogcHandler.Item)
+
+		// 地図用ベクタータイル (/api/tiles/{z}/{x}/{y}.mvt)
+		apiProtected.GET("/tiles/:z/:x/:y", tileHandler.Occurrences)
+
+		// 地名辞典 (国 > 都道府県 > 市区町村 > 地点)
+		apiProtected.GET("/workstation/:workstation_id/place-names", placeNameHandler.List)
+		apiProtected.POST("/workstation/:workstation_id/place-names", placeNameHandler.Create)
+		apiProtected.GET("/workstation/:workstation_id/place-names/suggest", placeNameHandler.Suggest)
+		apiProtected.GET("/workstation/:workstation_id/place-names/:place_name_id", placeNameHandler.Get)
+		apiProtected.PUT("/workstation/:workstation_id/place-names/:place_name_id", placeNameHandler.Update)
+		apiProtected.DELETE("/workstation/:workstation_id/place-names/:place_name_id", placeNameHandler.Delete)
+
+		// 産地を一般化する分類群 (変更は管理者のみ)
+		apiProtected.GET("/workstation/:workstation_id/sensitive-taxa", sensitiveTaxonHandler.List)
+		apiProtected.POST("/workstation/:workstation_id/sensitive-taxa", sensitiveTaxonHandler.Create)
+		apiProtected.PUT("/workstation/:workstation_id/sensitive-taxa/:sensitive_taxon_id", sensitiveTaxonHandler.Update)
+		apiProtected.DELETE("/workstation/:workstation_id/sensitive-taxa/:sensitive_taxon_id", sensitiveTaxonHandler.Delete)
+
+		// 分類チェックリスト (取り込みは管理者のみ)
+		apiProtected.GET("/workstation/:workstation_id/taxa", taxonHandler.Search)
+		apiProtected.POST("/workstation/:workstation_id/taxa/import", taxonHandler.Import)
+		apiProtected.GET("/workstation/:workstation_id/taxa/validate", taxonHandler.Validate)
+		apiProtected.GET("/workstation/:workstation_id/taxa/:taxon_id", taxonHandler.Get)
+
+		// 同定の履歴とコミュニティによる検証
+		apiProtected.GET("/occurrences/:occurrence_id/identifications", identificationHandler.List)
+		apiProtected.POST("/occurrences/:occurrence_id/identifications", identificationHandler.Create)
+		apiProtected.DELETE("/occurrences/:occurrence_id/identifications/:identification_id", identificationHandler.Withdraw)
+		apiProtected.PUT("/occurrences/:occurrence_id/identifications/:identification_id/vote", identificationHandler.Vote)
+		apiProtected.DELETE("/occurrences/:occurrence_id/identifications/:identification_id/vote", identificationHandler.DeleteVote)
+
+		// 標本の登録 (登録番号は採番の設定から自動で割り当てるのだ)
+		apiProtected.GET("/workstation/:workstation_id/specimens", specimenHandler.List)
+		apiProtected.POST("/workstation/:workstation_id/specimens", specimenHandler.Create)
+		apiProtected.GET("/workstation/:workstation_id/specimens/lookup", specimenHandler.Lookup)
+		apiProtected.GET("/workstation/:workstation_id/specimens/:specimen_id", specimenHandler.Get)
+		apiProtected.PUT("/workstation/:workstation_id/specimens/:specimen_id", specimenHandler.Update)
+		apiProtected.DELETE("/workstation/:workstation_id/specimens/:specimen_id", specimenHandler.Delete)
+		apiProtected.GET("/workstation/:workstation_id/catalog-sequences", specimenHandler.ListSequences)
+		apiProtected.PUT("/workstation/:workstation_id/catalog-sequences", specimenHandler.SaveSequence)
+
+		// 標本ラベルの PDF (QR コード付き)
+		apiProtected.GET("/label-templates", labelHandler.Templates)
+		apiProtected.POST("/workstation/:workstation_id/specimens/labels", labelHandler.Render)
+
+		// QR コード・バーコードの読み取り結果からレコードを探すのだ
+		apiProtected.GET("/resolve", resolverHandler.Resolve)
+		apiProtected.GET("/occurrences/:occurrence_id/code", resolverHandler.OccurrenceCode)
+		apiProtected.GET("/workstation/:workstation_id/specimens/:specimen_id/code", resolverHandler.SpecimenCode)
+
+		// 標本の保管場所と移動の履歴
+		apiProtected.GET("/workstation/:workstation_id/storage-locations", storageHandler.ListLocations)
+		apiProtected.POST("/workstation/:workstation_id/storage-locations", storageHandler.CreateLocation)
+		apiProtected.PUT("/workstation/:workstation_id/storage-locations/:location_id", storageHandler.UpdateLocation)
+		apiProtected.DELETE("/workstation/:workstation_id/storage-locations/:location_id", storageHandler.DeleteLocation)
+		apiProtected.POST("/workstation/:workstation_id/specimens/:specimen_id/move", storageHandler.MoveSpecimen)
+		apiProtected.GET("/workstation/:workstation_id/specimens/:specimen_id/movements", storageHandler.ListMovements)
+
+		// 標本の貸し出しと返却
+		apiProtected.GET("/workstation/:workstation_id/loans", loanHandler.List)
+		apiProtected.POST("/workstation/:workstation_id/loans", loanHandler.Create)
+		apiProtected.GET("/workstation/:workstation_id/loans/overdue", loanHandler.Overdue)
+		apiProtected.GET("/workstation/:workstation_id/loans/:loan_id", loanHandler.Get)
+		apiProtected.PUT("/workstation/:workstation_id/loans/:loan_id", loanHandler.Update)
+		apiProtected.POST("/workstation/:workstation_id/loans/:loan_id/return", loanHandler.Return)
+
+		// プロジェクトとメンバー (変更は CouchDB の project ドキュメントにも書き込むのだ)
+		apiProtected.GET("/workstation/:workstation_id/projects", projectHandler.List)
+		apiProtected.POST("/workstation/:workstation_id/projects", projectHandler.Create)
+		apiProtected.GET("/workstation/:workstation_id/projects/:project_id", projectHandler.Get)
+		apiProtected.PUT("/workstation/:workstation_id/projects/:project_id", projectHandler.Update)
+		apiProtected.DELETE("/workstation/:workstation_id/projects/:project_id", projectHandler.Delete)
+		apiProtected.PUT("/workstation/:workstation_id/projects/:project_id/members/:user_id", projectHandler.SaveMember)
+		apiProtected.DELETE("/workstation/:workstation_id/projects/:project_id/members/:user_id", projectHandler.RemoveMember)
+		apiProtected.GET("/workstation/:workstation_id/projects/:project_id/occurrences", projectHandler.Occurrences)
+
+		// 観察手法・行動の語彙と観察記録
+		apiProtected.GET("/workstation/:workstation_id/observation-methods", observationHandler.ListMethods)
+		apiProtected.POST("/workstation/:workstation_id/observation-methods", observationHandler.CreateMethod)
+		apiProtected.PUT("/workstation/:workstation_id/observation-methods/:method_id", observationHandler.UpdateMethod)
+		apiProtected.DELETE("/workstation/:workstation_id/observation-methods/:method_id", observationHandler.DeleteMethod)
+		apiProtected.GET("/workstation/:workstation_id/behavior-terms", observationHandler.ListTerms)
+		apiProtected.POST("/workstation/:workstation_id/behavior-terms", observationHandler.CreateTerm)
+		apiProtected.PUT("/workstation/:workstation_id/behavior-terms/:term_id", observationHandler.UpdateTerm)
+		apiProtected.DELETE("/workstation/:workstation_id/behavior-terms/:term_id", observationHandler.DeleteTerm)
+		apiProtected.GET("/workstation/:workstation_id/observations", observationHandler.Search)
+		apiProtected.GET("/occurrences/:occurrence_id/observations", observationHandler.List)
+		apiProtected.POST("/occurrences/:occurrence_id/observations", observationHandler.Create)
+		apiProtected.PUT("/occurrences/:occurrence_id/observations/:observation_id", observationHandler.Update)
+		apiProtected.DELETE("/occurrences/:occurrence_id/observations/:observation_id", observationHandler.Delete)
+
+		// Wiki (本文は Markdown で、保存するたびに版が増えるのだ)
+		apiProtected.GET("/workstation/:workstation_id/wiki", wikiHandler.List)
+		apiProtected.POST("/workstation/:workstation_id/wiki", wikiHandler.Create)
+		apiProtected.POST("/workstation/:workstation_id/wiki/preview", wikiHandler.Preview)
+		apiProtected.GET("/workstation/:workstation_id/wiki/:page_id", wikiHandler.Get)
+		apiProtected.PUT("/workstation/:workstation_id/wiki/:page_id", wikiHandler.Update)
+		apiProtected.DELETE("/workstation/:workstation_id/wiki/:page_id", wikiHandler.Delete)
+		apiProtected.GET("/workstation/:workstation_id/wiki/:page_id/revisions", wikiHandler.ListRevisions)
+		apiProtected.GET("/workstation/:workstation_id/wiki/:page_id/revisions/:revision", wikiHandler.GetRevision)
+		apiProtected.POST("/workstation/:workstation_id/wiki/:page_id/revisions/:revision/restore", wikiHandler.Restore)
+		apiProtected.GET("/workstation/:workstation_id/wiki/:page_id/diff", wikiHandler.Diff)
+
 		// フロントエンドからのリクエストに合わせてエンドポイントを追加・調整する場合はここで行うのだ
 		// 例: apiProtected.GET("/my-workstations", workstationHandler.List) 
 	}
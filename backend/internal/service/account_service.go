@@ -0,0 +1,392 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/saku-730/web-occurrence/backend/internal/entity"
+	"github.com/saku-730/web-occurrence/backend/internal/infrastructure"
+	"github.com/saku-730/web-occurrence/backend/internal/repository"
+	"gorm.io/gorm"
+)
+
+var ErrInvalidMailToken = errors.New("リンクが無効か、期限が切れています")
+var ErrEmailAlreadyVerified = errors.New("このメールアドレスは確認済みです")
+var ErrMailTooSoon = errors.New("メールを送ったばかりです。しばらく待ってからやり直してください")
+var ErrCouchDBPasswordUpdate = errors.New("CouchDBユーザーのパスワード変更に失敗しました")
+var ErrWrongPassword = errors.New("パスワードが正しくありません")
+var ErrReauthenticationRequired = errors.New("パスワードの無いアカウントは、ログインし直してから10分以内に削除してください")
+var ErrLastAdministrator = errors.New("他のメンバーがいるワークステーションの唯一の管理者なので削除できません。先に他のメンバーを管理者にしてください")
+
+const (
+	// verifyEmailTTL はメールアドレス確認のリンクの有効期間なのだ
+	verifyEmailTTL = 48 * time.Hour
+	// resetPasswordTTL はパスワード再設定のリンクの有効期間なのだ (短めにするのだ)
+	resetPasswordTTL = time.Hour
+	// mailCooldown は同じ用途のメールを続けて送らない間隔なのだ
+	mailCooldown = time.Minute
+	// reauthenticationWindow はパスワードの無いユーザーが、ログインし直してから削除できる間なのだ
+	reauthenticationWindow = 10 * time.Minute
+)
+
+// AccountService はメールアドレスの確認・パスワード・アカウントの削除を扱うのだ
+type AccountService interface {
+	// SendVerification はメールアドレス確認のリンクを送るのだ (送信は裏で行うのだ)
+	SendVerification(user *entity.User) error
+	// ResendVerification はログイン中のユーザーに確認のリンクを送り直すのだ
+	ResendVerification(userID string) error
+	VerifyEmail(token string) error
+
+	// RequestPasswordReset は再設定のリンクを送るのだ
+	// 登録されていないアドレスでも、それが分からないように同じ結果を返すのだ
+	RequestPasswordReset(mailAddress string) error
+	// ResetPassword はリンクのトークンでパスワードを替えて、すべての端末をログアウトさせるのだ
+	ResetPassword(token string, newPassword string) error
+
+	// ChangePassword は今のパスワードを確かめてから替えるのだ
+	// この端末 (currentSessionID) 以外はログアウトさせるのだ
+	ChangePassword(userID string, currentSessionID string, currentPassword string, newPassword string) error
+	// DeleteAccount はパスワードを確かめてアカウントを削除し、CouchDB のユーザーと所属も消すのだ
+	// IdP でしかログインしないユーザー (パスワード無し) は、この端末 (currentSessionID) でログインし直したばかりなら消せるのだ
+	DeleteAccount(userID string, currentSessionID string, password string) error
+}
+
+type accountService struct {
+	userRepo       repository.UserRepository
+	mailTokenRepo  repository.MailTokenRepository
+	wsRepo         repository.WorkstationRepository
+	couchClient    infrastructure.CouchDBClient
+	sessionService SessionService
+	mailer         infrastructure.Mailer
+	appBaseURL     string
+}
+
+// NewAccountService は AccountService を作るのだ
+// appBaseURL はメールに書くリンクの先 (フロントエンド) なのだ
+func NewAccountService(
+	userRepo repository.UserRepository,
+	mailTokenRepo repository.MailTokenRepository,
+	wsRepo repository.WorkstationRepository,
+	couchClient infrastructure.CouchDBClient,
+	sessionService SessionService,
+	mailer infrastructure.Mailer,
+	appBaseURL string,
+) AccountService {
+	if appBaseURL == "" {
+		appBaseURL = "http://localhost:3000"
+	}
+	return &accountService{
+		userRepo:       userRepo,
+		mailTokenRepo:  mailTokenRepo,
+		wsRepo:         wsRepo,
+		couchClient:    couchClient,
+		sessionService: sessionService,
+		mailer:         mailer,
+		appBaseURL:     strings.TrimRight(appBaseURL, "/"),
+	}
+}
+
+func (s *accountService) SendVerification(user *entity.User) error {
+	token, err := s.issueToken(user, entity.MailTokenVerifyEmail, verifyEmailTTL)
+	if err != nil {
+		return err
+	}
+	body := fmt.Sprintf(`%s さん
+
+ご登録ありがとうございます。
+次のリンクを開いて、メールアドレスを確認してください。
+
+%s
+
+このリンクは %d 時間で使えなくなります。
+心当たりが無い場合は、このメールを無視してください。
+`, user.DisplayName, s.link("/verify-email", token), int(verifyEmailTTL/time.Hour))
+	s.sendAsync(user.MailAddress, "メールアドレスの確認", body)
+	return nil
+}
+
+func (s *accountService) ResendVerification(userIDStr string) error {
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		return err
+	}
+	user, err := s.userRepo.FindUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerifiedAt != nil {
+		return ErrEmailAlreadyVerified
+	}
+	recent, err := s.mailTokenRepo.CountSince(user.UserID, entity.MailTokenVerifyEmail, time.Now().Add(-mailCooldown))
+	if err != nil {
+		return err
+	}
+	if recent > 0 {
+		return ErrMailTooSoon
+	}
+	return s.SendVerification(user)
+}
+
+func (s *accountService) VerifyEmail(token string) error {
+	now := time.Now()
+	mt, user, err := s.findToken(token, entity.MailTokenVerifyEmail, now)
+	if err != nil {
+		return err
+	}
+	ok, err := s.mailTokenRepo.VerifyEmail(mt.TokenHash, user.UserID, mt.MailAddress, now)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidMailToken
+	}
+	return nil
+}
+
+func (s *accountService) RequestPasswordReset(mailAddress string) error {
+	user, err := s.userRepo.FindUserByEmail(mailAddress)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	// 続けて頼まれたときは黙って送らないのだ (受信箱を埋められないようにするのだ)
+	recent, err := s.mailTokenRepo.CountSince(user.UserID, entity.MailTokenResetPassword, time.Now().Add(-mailCooldown))
+	if err != nil {
+		return err
+	}
+	if recent > 0 {
+		return nil
+	}
+
+	token, err := s.issueToken(user, entity.MailTokenResetPassword, resetPasswordTTL)
+	if err != nil {
+		return err
+	}
+	body := fmt.Sprintf(`%s さん
+
+パスワードの再設定を受け付けました。
+次のリンクを開いて、新しいパスワードを決めてください。
+
+%s
+
+このリンクは %d 分で使えなくなります。1回使うと、もう一度は使えません。
+心当たりが無い場合は、このメールを無視してください。パスワードは変わりません。
+`, user.DisplayName, s.link("/reset-password", token), int(resetPasswordTTL/time.Minute))
+	s.sendAsync(user.MailAddress, "パスワードの再設定", body)
+	return nil
+}
+
+func (s *accountService) ResetPassword(token string, newPassword string) error {
+	now := time.Now()
+	mt, user, err := s.findToken(token, entity.MailTokenResetPassword, now)
+	if err != nil {
+		return err
+	}
+	hashed, err := infrastructure.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	// 先にトークンを使い済みにしてから CouchDB のユーザーも同じパスワードにするのだ
+	// 同じリンクが同時に送られても、トークンを使えた方だけが CouchDB を替えるのだ
+	// CouchDB で失敗したらトークンは使わなかったことになるので、もう一度試せるのだ
+	couchDBUsername := strconv.FormatInt(user.UserID, 10)
+	ok, err := s.mailTokenRepo.ResetPassword(mt.TokenHash, user.UserID, mt.MailAddress, hashed, now, func() error {
+		if err := s.couchClient.SetCouchDBUserPassword(couchDBUsername, newPassword); err != nil {
+			return fmt.Errorf("%w: %v", ErrCouchDBPasswordUpdate, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidMailToken
+	}
+	// 盗まれたパスワードで作られたセッションも残さないのだ
+	return s.sessionService.RevokeAll(couchDBUsername, "")
+}
+
+func (s *accountService) ChangePassword(userIDStr string, currentSessionID string, currentPassword string, newPassword string) error {
+	user, err := s.checkPassword(userIDStr, currentPassword)
+	if err != nil {
+		return err
+	}
+	hashed, err := infrastructure.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	if err := s.couchClient.SetCouchDBUserPassword(userIDStr, newPassword); err != nil {
+		return fmt.Errorf("%w: %v", ErrCouchDBPasswordUpdate, err)
+	}
+	if err := s.userRepo.UpdatePassword(user.UserID, hashed); err != nil {
+		return err
+	}
+	return s.sessionService.RevokeAll(userIDStr, currentSessionID)
+}
+
+func (s *accountService) DeleteAccount(userIDStr string, currentSessionID string, password string) error {
+	user, err := s.checkIdentity(userIDStr, currentSessionID, password)
+	if err != nil {
+		return err
+	}
+	roles, err := s.wsRepo.GetRoleIDsByUserID(user.UserID)
+	if err != nil {
+		return err
+	}
+	// 管理者がいなくなるワークステーションを残さないのだ
+	// (自分しかいないワークステーションは、記録を残したまま誰も入れなくなるだけなのだ)
+	for wsID, role := range roles {
+		if role != roleAdministrator {
+			continue
+		}
+		members, err := s.wsRepo.GetUserRelationsByWorkstationID(wsID)
+		if err != nil {
+			return err
+		}
+		others, otherAdmins := 0, 0
+		for _, m := range members {
+			if m.UserID == user.UserID {
+				continue
+			}
+			others++
+			if m.RoleID == roleAdministrator {
+				otherAdmins++
+			}
+		}
+		if others > 0 && otherAdmins == 0 {
+			return ErrLastAdministrator
+		}
+	}
+
+	// PostgreSQL を正として先に消すのだ。セッションも消えるので、この後はもう API を使えないのだ
+	if err := s.userRepo.DeleteUser(user.UserID, time.Now()); err != nil {
+		return err
+	}
+
+	// CouchDB の後片付けは失敗してもログだけ残すのだ (プロキシは JWT が無いと通らないので、もう同期はできないのだ)
+	for wsID := range roles {
+		dbName := s.couchClient.CreateWorkstationDBName(wsID)
+		if err := s.couchClient.RemoveDatabaseUserAccess(dbName, userIDStr); err != nil {
+			log.Printf("CouchDBの所属の削除に失敗 (user_id=%s, db=%s): %v", userIDStr, dbName, err)
+		}
+	}
+	if err := s.couchClient.DeleteDocument("_users", infrastructure.CouchDBUserDocID(userIDStr)); err != nil {
+		log.Printf("CouchDBユーザーの削除に失敗 (user_id=%s): %v", userIDStr, err)
+	}
+	return nil
+}
+
+// checkPassword はログイン中のユーザーのパスワードを確かめるのだ
+func (s *accountService) checkPassword(userIDStr string, password string) (*entity.User, error) {
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.userRepo.FindUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !infrastructure.CheckPasswordHash(password, user.Password) {
+		return nil, ErrWrongPassword
+	}
+	return user, nil
+}
+
+// checkIdentity は大事な操作の前に本人かどうかを確かめるのだ
+// パスワードがあればパスワードで、無ければ (IdP でしかログインしないユーザー) ログインし直したばかりかで確かめるのだ
+func (s *accountService) checkIdentity(userIDStr string, currentSessionID string, password string) (*entity.User, error) {
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.userRepo.FindUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Password != "" {
+		return s.checkPassword(userIDStr, password)
+	}
+	if currentSessionID == "" {
+		return nil, ErrReauthenticationRequired
+	}
+	loggedInAt, err := s.sessionService.LoggedInAt(userIDStr, currentSessionID)
+	if err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			return nil, ErrReauthenticationRequired
+		}
+		return nil, err
+	}
+	if time.Since(loggedInAt) > reauthenticationWindow {
+		return nil, ErrReauthenticationRequired
+	}
+	return user, nil
+}
+
+// issueToken は新しいトークンを保存して、メールに書くトークンを返すのだ
+func (s *accountService) issueToken(user *entity.User, purpose string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	// 古いトークンは作るついでに片付けるのだ
+	if err := s.mailTokenRepo.DeleteExpired(now.Add(-sessionRetention)); err != nil {
+		return "", err
+	}
+	token := infrastructure.NewSecretToken()
+	mt := &entity.UserMailToken{
+		TokenHash:   infrastructure.HashSecretToken(token),
+		UserID:      user.UserID,
+		Purpose:     purpose,
+		MailAddress: user.MailAddress,
+		ExpiresAt:   now.Add(ttl),
+	}
+	if err := s.mailTokenRepo.Create(mt); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// findToken はメールのトークンを調べて、使えるならトークンとユーザーを返すのだ
+func (s *accountService) findToken(token string, purpose string, now time.Time) (*entity.UserMailToken, *entity.User, error) {
+	mt, err := s.mailTokenRepo.FindToken(infrastructure.HashSecretToken(token))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidMailToken
+		}
+		return nil, nil, err
+	}
+	if mt.Purpose != purpose || mt.UsedAt != nil || !now.Before(mt.ExpiresAt) {
+		return nil, nil, ErrInvalidMailToken
+	}
+	user, err := s.userRepo.FindUserByID(mt.UserID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidMailToken
+		}
+		return nil, nil, err
+	}
+	// 送った後にメールアドレスが変わっていたら、古いアドレスに届いたリンクは使えないのだ
+	if !strings.EqualFold(user.MailAddress, mt.MailAddress) {
+		return nil, nil, ErrInvalidMailToken
+	}
+	return mt, user, nil
+}
+
+func (s *accountService) link(path string, token string) string {
+	return s.appBaseURL + path + "?token=" + url.QueryEscape(token)
+}
+
+// sendAsync はメールを裏で送るのだ。SMTP が遅くてもリクエストを待たせないのだ
+// 送れなかったときはログに残すだけなのだ (ユーザーはもう一度頼めるのだ)
+func (s *accountService) sendAsync(to string, subject string, body string) {
+	go func() {
+		if err := s.mailer.Send(to, subject, body); err != nil {
+			log.Printf("メールの送信に失敗 (%s): %v", subject, err)
+		}
+	}()
+}
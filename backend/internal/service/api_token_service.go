@@ -0,0 +1,210 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/saku-730/web-occurrence/backend/internal/entity"
+	"github.com/saku-730/web-occurrence/backend/internal/infrastructure"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/repository"
+	"gorm.io/gorm"
+)
+
+var ErrInvalidAPIToken = errors.New("APIトークンが無効か、期限が切れています")
+var ErrAPITokenNotFound = errors.New("APIトークンが見つかりません")
+var ErrInvalidAPITokenRequest = errors.New("APIトークンの内容が正しくありません")
+
+const (
+	// defaultAPITokenDays は有効期間を省略したときの日数なのだ
+	defaultAPITokenDays = 90
+	// maxActiveAPITokens は1人が同時に持てるトークンの数なのだ
+	maxActiveAPITokens = 50
+	// apiTokenPrefixLength は一覧で見せるトークンの先頭の長さなのだ ("wop_" を含むのだ)
+	apiTokenPrefixLength = 12
+)
+
+// APITokenService は個人アクセストークン (R や Python のスクリプト用) を扱うのだ
+type APITokenService interface {
+	Create(userID string, req *model.APITokenCreateRequest) (*model.APITokenCreateResponse, error)
+	List(userID string) ([]model.APITokenView, error)
+	Revoke(userID string, tokenID string) error
+	// AuthenticateAPIToken はトークンを調べて、誰が何をできるかを返すのだ (AuthMiddleware が使うのだ)
+	AuthenticateAPIToken(token string) (*model.APITokenPrincipal, error)
+}
+
+type apiTokenService struct {
+	tokenRepo repository.APITokenRepository
+	userRepo  repository.UserRepository
+	wsRepo    repository.WorkstationRepository
+}
+
+func NewAPITokenService(
+	tokenRepo repository.APITokenRepository,
+	userRepo repository.UserRepository,
+	wsRepo repository.WorkstationRepository,
+) APITokenService {
+	return &apiTokenService{
+		tokenRepo: tokenRepo,
+		userRepo:  userRepo,
+		wsRepo:    wsRepo,
+	}
+}
+
+func (s *apiTokenService) Create(userIDStr string, req *model.APITokenCreateRequest) (*model.APITokenCreateResponse, error) {
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: name を入力してください", ErrInvalidAPITokenRequest)
+	}
+
+	// 自分が所属しているワークステーションだけ選べるのだ
+	roles, err := s.wsRepo.GetRoleIDsByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[int64]bool{}
+	wsIDs := make([]int64, 0, len(req.WorkstationIDs))
+	for _, wsID := range req.WorkstationIDs {
+		if _, ok := roles[wsID]; !ok {
+			return nil, ErrWorkstationAccessDenied
+		}
+		if !seen[wsID] {
+			seen[wsID] = true
+			wsIDs = append(wsIDs, wsID)
+		}
+	}
+
+	now := time.Now()
+	active, err := s.tokenRepo.CountActive(userID, now)
+	if err != nil {
+		return nil, err
+	}
+	if active >= maxActiveAPITokens {
+		return nil, fmt.Errorf("%w: トークンは %d 個までです。使っていないものを取り消してください", ErrInvalidAPITokenRequest, maxActiveAPITokens)
+	}
+
+	days := req.ExpiresInDays
+	if days == 0 {
+		days = defaultAPITokenDays
+	}
+	raw := infrastructure.NewAPIToken()
+	token := &entity.PersonalAccessToken{
+		UserID:      userID,
+		Name:        name,
+		TokenHash:   infrastructure.HashSecretToken(raw),
+		TokenPrefix: raw[:apiTokenPrefixLength],
+		Scope:       req.Scope,
+		ExpiresAt:   now.AddDate(0, 0, days),
+	}
+	if err := s.tokenRepo.Create(token, wsIDs); err != nil {
+		return nil, err
+	}
+	return &model.APITokenCreateResponse{
+		APITokenView: apiTokenView(token, wsIDs, now),
+		Token:        raw,
+	}, nil
+}
+
+func (s *apiTokenService) List(userIDStr string) ([]model.APITokenView, error) {
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := s.tokenRepo.ListByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(tokens))
+	for _, t := range tokens {
+		ids = append(ids, t.TokenID)
+	}
+	wsIDs, err := s.tokenRepo.ListWorkstationIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	views := make([]model.APITokenView, 0, len(tokens))
+	for i := range tokens {
+		views = append(views, apiTokenView(&tokens[i], wsIDs[tokens[i].TokenID], now))
+	}
+	return views, nil
+}
+
+func (s *apiTokenService) Revoke(userIDStr string, tokenID string) error {
+	token, err := s.tokenRepo.FindByID(tokenID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrAPITokenNotFound
+		}
+		return err
+	}
+	// 他の人のトークンは無いものとして扱うのだ
+	if strconv.FormatInt(token.UserID, 10) != userIDStr || token.RevokedAt != nil {
+		return ErrAPITokenNotFound
+	}
+	return s.tokenRepo.Revoke(token.TokenID, time.Now())
+}
+
+func (s *apiTokenService) AuthenticateAPIToken(raw string) (*model.APITokenPrincipal, error) {
+	token, err := s.tokenRepo.FindByHash(infrastructure.HashSecretToken(raw))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidAPIToken
+		}
+		return nil, err
+	}
+	now := time.Now()
+	if token.RevokedAt != nil || !now.Before(token.ExpiresAt) {
+		return nil, ErrInvalidAPIToken
+	}
+	// 削除したアカウントのトークンは使えないのだ
+	user, err := s.userRepo.FindUserByID(token.UserID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidAPIToken
+		}
+		return nil, err
+	}
+	if user.DeletedAt != nil {
+		return nil, ErrInvalidAPIToken
+	}
+
+	wsIDs, err := s.tokenRepo.ListWorkstationIDs([]string{token.TokenID})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.tokenRepo.TouchLastUsed(token.TokenID, now); err != nil {
+		return nil, err
+	}
+	return &model.APITokenPrincipal{
+		TokenID:        token.TokenID,
+		UserID:         strconv.FormatInt(token.UserID, 10),
+		Scope:          token.Scope,
+		WorkstationIDs: wsIDs[token.TokenID],
+	}, nil
+}
+
+func apiTokenView(t *entity.PersonalAccessToken, wsIDs []int64, now time.Time) model.APITokenView {
+	if wsIDs == nil {
+		wsIDs = []int64{}
+	}
+	return model.APITokenView{
+		TokenID:        t.TokenID,
+		Name:           t.Name,
+		TokenPrefix:    t.TokenPrefix,
+		Scope:          t.Scope,
+		WorkstationIDs: wsIDs,
+		CreatedAt:      t.CreatedAt,
+		ExpiresAt:      t.ExpiresAt,
+		LastUsedAt:     t.LastUsedAt,
+		Expired:        !now.Before(t.ExpiresAt),
+	}
+}
@@ -0,0 +1,349 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/saku-730/web-occurrence/backend/internal/entity"
+	"github.com/saku-730/web-occurrence/backend/internal/infrastructure"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+)
+
+var ErrGeneralizedDocument = errors.New("一般化された座標のドキュメントは新しく保存できません")
+
+// couchGeneralizationField は一般化して返した place_data に付ける印なのだ
+// 書き戻されたときに、元の座標に戻すかどうかをこれで見分けるのだ
+const couchGeneralizationField = "coordinate_generalization"
+
+// placeFields は一般化で書き換える place_data のキーなのだ
+var placeFields = []string{"coordinates", "accuracy", "datum", "place_name_id"}
+
+// CouchDocumentFilter はメンバーが CouchDB のプロキシで読み書きするドキュメントを直すのだ
+// 同定の合意はサーバーだけが書くので、誰が書き込んでも保存済みの値に戻すのだ
+// 管理者でないメンバーには、検索 API と同じく、配慮が必要なレコードの座標を一般化して渡すのだ
+type CouchDocumentFilter struct {
+	couchClient   infrastructure.CouchDBClient
+	dbName        string
+	fullPrecision bool
+	taxa          []entity.SensitiveTaxon
+	now           time.Time
+}
+
+func (s *couchDBService) DocumentFilter(userIDStr string, dbName string) (*CouchDocumentFilter, error) {
+	workstationID, ok := s.workstationIDFromDBName(dbName)
+	if !ok {
+		return nil, nil
+	}
+	access, err := loadCoordinateAccess(s.wsRepo, userIDStr)
+	if err != nil {
+		return nil, err
+	}
+	filter := &CouchDocumentFilter{
+		couchClient:   s.couchClient,
+		dbName:        dbName,
+		fullPrecision: access.fullPrecision[workstationID],
+		now:           time.Now(),
+	}
+	if filter.fullPrecision {
+		return filter, nil
+	}
+	if filter.taxa, err = s.stRepo.ListByWorkstationID(workstationID); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// Redacts は座標を一般化して渡す (管理者でない) ときに true なのだ
+func (f *CouchDocumentFilter) Redacts() bool {
+	return !f.fullPrecision
+}
+
+// workstationIDFromDBName は db_ws_<ID> の形の DB 名からワークステーションIDを読むのだ
+func (s *couchDBService) workstationIDFromDBName(dbName string) (int64, bool) {
+	i := strings.LastIndex(dbName, "_ws_")
+	if i < 0 {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(dbName[i+len("_ws_"):], 10, 64)
+	if err != nil || s.couchClient.CreateWorkstationDBName(id) != dbName {
+		return 0, false
+	}
+	return id, true
+}
+
+// RedactDocument は配慮が必要な occurrence の座標を一般化するのだ
+// 書き換えたときは true を返すのだ
+func (f *CouchDocumentFilter) RedactDocument(doc map[string]interface{}) bool {
+	if f.fullPrecision {
+		return false
+	}
+	if docType, _ := doc["type"].(string); docType != "occurrence" {
+		return false
+	}
+	g, ok := effectiveGeneralization(f.sensitivity(doc))
+	if !ok {
+		return false
+	}
+	place, _ := doc["place_data"].(map[string]interface{})
+	if place == nil {
+		return false
+	}
+	redactPlace(place, g)
+	return true
+}
+
+// RestoreDocument は書き込まれるドキュメントを保存済みのドキュメントに合わせて直すのだ
+//   - 同定の合意 (identification_status) は保存済みの値に戻すのだ (新しいドキュメントなら外すのだ)
+//   - 管理者でなければ、一般化の指定 (sensitivity / embargo_until) は保存済みの値に戻すのだ
+//   - 一般化して渡したドキュメントが書き戻されたら、元の座標に戻すのだ
+//     座標を変えていなければ元の値に戻し、変えていればその座標を使って地名だけ元に戻すのだ
+func (f *CouchDocumentFilter) RestoreDocument(doc map[string]interface{}) error {
+	current, err := f.storedDocument(doc)
+	if err != nil {
+		return err
+	}
+	if status, ok := current["identification_status"]; ok {
+		doc["identification_status"] = status
+	} else {
+		delete(doc, "identification_status")
+	}
+	if f.fullPrecision {
+		return nil
+	}
+	f.restoreSensitivity(doc, current)
+
+	place, _ := doc["place_data"].(map[string]interface{})
+	if place == nil {
+		return nil
+	}
+	marker, ok := place[couchGeneralizationField]
+	if !ok {
+		return nil
+	}
+	delete(place, couchGeneralizationField)
+	text, _ := marker.(string)
+	g, err := parseGeneralization(text)
+	if err != nil || current == nil {
+		return ErrGeneralizedDocument
+	}
+	currentPlace, _ := normalizeJSON(current["place_data"]).(map[string]interface{})
+	if currentPlace == nil {
+		return ErrGeneralizedDocument
+	}
+
+	// 渡したときと同じ一般化をして、送られてきた座標と比べるのだ
+	redactedPlace, _ := normalizeJSON(currentPlace).(map[string]interface{})
+	redactPlace(redactedPlace, g)
+	redactedPlace, _ = normalizeJSON(redactedPlace).(map[string]interface{})
+	incoming, _ := normalizeJSON(place).(map[string]interface{})
+
+	unchanged := true
+	for _, key := range placeFields {
+		if !reflect.DeepEqual(incoming[key], redactedPlace[key]) {
+			unchanged = false
+			break
+		}
+	}
+	if unchanged {
+		for _, key := range placeFields {
+			if value, ok := currentPlace[key]; ok {
+				place[key] = value
+			} else {
+				delete(place, key)
+			}
+		}
+		return nil
+	}
+	if name, _ := place["place_name_id"].(string); name == "" {
+		place["place_name_id"] = currentPlace["place_name_id"]
+	}
+	return nil
+}
+
+// storedDocument は書き込まれるドキュメントの保存済みの版を返すのだ (新しいドキュメントなら nil なのだ)
+func (f *CouchDocumentFilter) storedDocument(doc map[string]interface{}) (map[string]interface{}, error) {
+	id, _ := doc["_id"].(string)
+	if id == "" {
+		return nil, nil
+	}
+	current, err := f.couchClient.GetDocument(f.dbName, id)
+	if err != nil {
+		if errors.Is(err, infrastructure.ErrCouchDocumentNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return current, nil
+}
+
+// redactPlace は place_data の座標を g で一般化するのだ
+// 地名 (place_name_id) からも産地が分かるので空にするのだ
+func redactPlace(place map[string]interface{}, g generalization) {
+	row := model.OccurrenceSearchRow{Coordinates: "null"}
+	coordinates, _ := place["coordinates"].(map[string]interface{})
+	if raw, err := json.Marshal(coordinates); err == nil {
+		row.Coordinates = string(raw)
+	}
+	row.Accuracy = jsonFloat(place["accuracy"])
+	if rawLat, rawLon, ok := decodeCoordinates(row.Coordinates); ok {
+		datum, _ := place["datum"].(string)
+		lat, lon, err := infrastructure.ConvertToJGD2011(rawLat, rawLon, placeDatum(&datum, coordinates))
+		if err != nil {
+			// 丸められないときは何も出さないのだ
+			g.hidden = true
+		} else {
+			row.Latitude, row.Longitude = &lat, &lon
+		}
+	}
+	generalizeRow(&row, g)
+
+	var generalized interface{}
+	_ = json.Unmarshal([]byte(row.Coordinates), &generalized)
+	place["coordinates"] = generalized
+	place["accuracy"] = row.Accuracy
+	place["datum"] = infrastructure.DatumJGD2011
+	place["place_name_id"] = ""
+	place[couchGeneralizationField] = g.text
+}
+
+// restoreSensitivity は保存済みのドキュメントの一般化の指定を、書き込まれるドキュメントに戻すのだ
+// 分類を書き換えて分類群 (sensitive_taxa) の指定から外れるときは、外れた指定をレコードの指定として残すのだ
+// (名前を変えるだけで元の精度の座標が出るようにはさせないのだ。外すのは管理者なのだ)
+func (f *CouchDocumentFilter) restoreSensitivity(doc, current map[string]interface{}) {
+	if current == nil {
+		return
+	}
+	occ, _ := doc["occurrence_data"].(map[string]interface{})
+	if occ == nil {
+		occ = map[string]interface{}{}
+		doc["occurrence_data"] = occ
+	}
+	stored, _ := current["occurrence_data"].(map[string]interface{})
+	for _, key := range []string{"sensitivity", "embargo_until"} {
+		if value, ok := stored[key]; ok {
+			occ[key] = value
+		} else {
+			delete(occ, key)
+		}
+	}
+
+	kept := map[string]bool{}
+	for _, st := range f.matchedTaxa(doc) {
+		kept[st.SensitiveTaxonID] = true
+	}
+	var lost []string
+	var lostUntil *time.Time
+	forever := false
+	for _, st := range f.matchedTaxa(current) {
+		if kept[st.SensitiveTaxonID] {
+			continue
+		}
+		lost = append(lost, st.Generalization)
+		if st.EmbargoUntil == nil {
+			forever = true
+		} else if lostUntil == nil || st.EmbargoUntil.After(*lostUntil) {
+			lostUntil = st.EmbargoUntil
+		}
+	}
+	if len(lost) == 0 {
+		return
+	}
+	if forever {
+		lostUntil = nil
+	}
+
+	text, _ := occ["sensitivity"].(string)
+	embargo, _ := occ["embargo_until"].(string)
+	until := parseEmbargoUntil(&embargo)
+	if text == "" || (until != nil && !until.After(f.now)) {
+		// レコードの指定が効いていなければ、外れた指定だけにするのだ
+		text, until = "", lostUntil
+	} else if until != nil && (lostUntil == nil || lostUntil.After(*until)) {
+		until = lostUntil
+	}
+	if text != "" {
+		lost = append([]string{text}, lost...)
+	}
+	occ["sensitivity"] = strings.Join(lost, ",")
+	if until == nil {
+		delete(occ, "embargo_until")
+	} else {
+		occ["embargo_until"] = until.Format(time.RFC3339)
+	}
+}
+
+// sensitivity はドキュメントに今効いている一般化の指定をカンマ区切りで返すのだ
+// occurrenceSensitivityExpr (PostgreSQL) と同じ決め方なのだ
+func (f *CouchDocumentFilter) sensitivity(doc map[string]interface{}) string {
+	var parts []string
+	if occ, ok := doc["occurrence_data"].(map[string]interface{}); ok {
+		if text, _ := occ["sensitivity"].(string); text != "" {
+			embargo, _ := occ["embargo_until"].(string)
+			if until := parseEmbargoUntil(&embargo); until == nil || until.After(f.now) {
+				parts = append(parts, text)
+			}
+		}
+	}
+	for _, st := range f.matchedTaxa(doc) {
+		parts = append(parts, st.Generalization)
+	}
+	return strings.Join(parts, ",")
+}
+
+// matchedTaxa はドキュメントの分類に今効いている分類群の指定なのだ
+func (f *CouchDocumentFilter) matchedTaxa(doc map[string]interface{}) []entity.SensitiveTaxon {
+	classification := map[string]string{}
+	if cls, ok := doc["classification_data"].(map[string]interface{}); ok {
+		if ranks, ok := cls["class_classification"].(map[string]interface{}); ok {
+			for rank, value := range ranks {
+				if name, ok := value.(string); ok {
+					classification[rank] = name
+				}
+			}
+		}
+	}
+	binomial := strings.TrimSpace(classification["genus"] + " " + classification["species"])
+	var matched []entity.SensitiveTaxon
+	for _, st := range f.taxa {
+		if st.EmbargoUntil != nil && !st.EmbargoUntil.After(f.now) {
+			continue
+		}
+		name, ok := classification[st.Rank]
+		if (ok && strings.EqualFold(name, st.Name)) || (st.Rank == "species" && strings.EqualFold(binomial, st.Name)) {
+			matched = append(matched, st)
+		}
+	}
+	return matched
+}
+
+// normalizeJSON は JSON に書き出して読み直した値を返すのだ
+// 数値の型をそろえて、読み込んだドキュメントと比べられるようにするのだ
+func normalizeJSON(v interface{}) interface{} {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var out interface{}
+	if err := dec.Decode(&out); err != nil {
+		return nil
+	}
+	return out
+}
+
+func jsonFloat(v interface{}) float64 {
+	switch n := v.(type) {
+	case float64:
+		return n
+	case json.Number:
+		f, _ := n.Float64()
+		return f
+	}
+	return 0
+}
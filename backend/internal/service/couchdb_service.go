@@ -4,6 +4,7 @@ import (
 	"crypto/hmac"
 	"crypto/sha1"
 	"encoding/hex"
+	"errors"
 	"github.com/saku-730/web-occurrence/backend/internal/infrastructure"
 	"github.com/saku-730/web-occurrence/backend/internal/repository"
 )
@@ -13,10 +14,15 @@ type CouchDBService interface {
 	RequestCouchDBSession(userID string) (string, error)
 	GenerateProxyCredentials(userID string) (string, string, error)
 	GetCouchDBURL() string
+	// DocumentFilter はプロキシで読み書きするドキュメントを直す仕組みを返すのだ
+	// ワークステーションの DB でないときは nil なのだ
+	DocumentFilter(userID string, dbName string) (*CouchDocumentFilter, error)
 }
 
 type couchDBService struct {
 	userRepo     repository.UserRepository
+	wsRepo       repository.WorkstationRepository
+	stRepo       repository.SensitiveTaxonRepository
 	couchClient  infrastructure.CouchDBClient
 	configSecret string
 	configURL    string
@@ -24,12 +30,16 @@ type couchDBService struct {
 
 func NewCouchDBService(
 	userRepo repository.UserRepository,
+	wsRepo repository.WorkstationRepository,
+	stRepo repository.SensitiveTaxonRepository,
 	couchClient infrastructure.CouchDBClient,
 	secret string,
 	url string,
 ) CouchDBService {
 	return &couchDBService{
 		userRepo:     userRepo,
+		wsRepo:       wsRepo,
+		stRepo:       stRepo,
 		couchClient:  couchClient,
 		configSecret: secret,
 		configURL:    url,
@@ -61,3 +71,19 @@ func (s *couchDBService) GenerateProxyCredentials(userID string) (string, string
 func (s *couchDBService) GetCouchDBURL() string {
 	return s.configURL
 }
+
+// patchOccurrenceDocument は CouchDB の occurrence ドキュメントを fn で書き換えて保存するのだ
+// ドキュメントがまだ無いとき (PostgreSQL にしかない occurrence) は何もしないのだ
+func patchOccurrenceDocument(couchClient infrastructure.CouchDBClient, workstationID int64, occurrenceID string, fn func(doc map[string]interface{}) error) error {
+	doc, err := couchClient.GetDocument(couchClient.CreateWorkstationDBName(workstationID), occurrenceID)
+	if err != nil {
+		if errors.Is(err, infrastructure.ErrCouchDocumentNotFound) {
+			return nil
+		}
+		return err
+	}
+	if err := fn(doc); err != nil {
+		return err
+	}
+	return couchClient.UpsertDocument(occurrenceID, doc)
+}
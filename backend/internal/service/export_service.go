@@ -0,0 +1,462 @@
+package service
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/saku-730/web-occurrence/backend/internal/infrastructure"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/repository"
+)
+
+var ErrInvalidExportFormat = errors.New("対応していないエクスポート形式です")
+var ErrInvalidExportColumn = errors.New("存在しない列が指定されています")
+
+// exportRecord は1件の occurrence を平坦化したものなのだ
+type exportRecord struct {
+	row    *model.OccurrenceSearchRow
+	taxa   map[string]string
+	lat    float64
+	lon    float64
+	hasLoc bool
+}
+
+// exportColumn は出力できる列の定義なのだ
+// number が nil でなければ xlsx では数値セルとして書き出すのだ
+type exportColumn struct {
+	key    string
+	text   func(r *exportRecord) string
+	number func(r *exportRecord) (float64, bool)
+}
+
+func textColumn(key string, fn func(r *exportRecord) string) exportColumn {
+	return exportColumn{key: key, text: fn}
+}
+
+func numberColumn(key string, fn func(r *exportRecord) (float64, bool)) exportColumn {
+	return exportColumn{
+		key:    key,
+		number: fn,
+		text: func(r *exportRecord) string {
+			if v, ok := fn(r); ok {
+				return strconv.FormatFloat(v, 'f', -1, 64)
+			}
+			return ""
+		},
+	}
+}
+
+func taxonColumn(rank string) exportColumn {
+	return textColumn(rank, func(r *exportRecord) string { return r.taxa[rank] })
+}
+
+// exportColumns は列の並び順もそのまま出力順になるのだ
+var exportColumns = []exportColumn{
+	textColumn("occurrence_id", func(r *exportRecord) string { return r.row.OccurrenceID }),
+	textColumn("workstation_id", func(r *exportRecord) string { return strconv.FormatInt(r.row.WorkstationID, 10) }),
+	textColumn("user_id", func(r *exportRecord) string { return strconv.FormatInt(r.row.UserID, 10) }),
+	textColumn("user_display_name", func(r *exportRecord) string { return r.row.UserDisplayName }),
+	textColumn("project_id", func(r *exportRecord) string { return r.row.ProjectID }),
+	textColumn("individual_id", func(r *exportRecord) string { return r.row.IndividualID }),
+	textColumn("lifestage", func(r *exportRecord) string { return r.row.Lifestage }),
+	textColumn("sex", func(r *exportRecord) string { return r.row.Sex }),
+	numberColumn("body_length", func(r *exportRecord) (float64, bool) { return r.row.BodyLength, r.row.BodyLength != 0 }),
+	taxonColumn("kingdom"),
+	taxonColumn("phylum"),
+	taxonColumn("class"),
+	taxonColumn("order"),
+	taxonColumn("family"),
+	taxonColumn("genus"),
+	taxonColumn("species"),
+	numberColumn("latitude", func(r *exportRecord) (float64, bool) { return r.lat, r.hasLoc }),
+	numberColumn("longitude", func(r *exportRecord) (float64, bool) { return r.lon, r.hasLoc }),
+	// verbatim_* と datum は端末から送られてきた元の座標 (変換前) なのだ
+	numberColumn("verbatim_latitude", func(r *exportRecord) (float64, bool) {
+		lat, _, ok := decodeCoordinates(r.row.Coordinates)
+		return lat, ok
+	}),
+	numberColumn("verbatim_longitude", func(r *exportRecord) (float64, bool) {
+		_, lon, ok := decodeCoordinates(r.row.Coordinates)
+		return lon, ok
+	}),
+	textColumn("datum", func(r *exportRecord) string {
+		if r.row.Datum == nil {
+			return ""
+		}
+		return *r.row.Datum
+	}),
+	numberColumn("accuracy", func(r *exportRecord) (float64, bool) { return r.row.Accuracy, r.row.Accuracy != 0 }),
+	textColumn("mesh_code", func(r *exportRecord) string {
+		if r.row.MeshCode == nil {
+			return ""
+		}
+		return *r.row.MeshCode
+	}),
+	textColumn("coordinate_generalization", func(r *exportRecord) string { return r.row.CoordinateGeneralization }),
+	textColumn("place_id", func(r *exportRecord) string { return r.row.PlaceID }),
+	textColumn("place_name_id", func(r *exportRecord) string {
+		if r.row.PlaceNameID == nil {
+			return ""
+		}
+		return *r.row.PlaceNameID
+	}),
+	textColumn("created_at", func(r *exportRecord) string {
+		if r.row.CreatedAt.IsZero() {
+			return ""
+		}
+		return r.row.CreatedAt.Format(time.RFC3339)
+	}),
+	textColumn("timezone", func(r *exportRecord) string { return r.row.Timezone }),
+	textColumn("note", func(r *exportRecord) string { return r.row.Note }),
+}
+
+// OccurrenceExport は準備済みのエクスポートなのだ
+// ハンドラーはヘッダーを書いた後に Write を呼ぶだけでいいのだ
+type OccurrenceExport struct {
+	ContentType string
+	FileName    string
+	write       func(w io.Writer) error
+}
+
+func (e *OccurrenceExport) Write(w io.Writer) error {
+	return e.write(w)
+}
+
+type ExportService interface {
+	NewOccurrenceExport(userID string, req *model.OccurrenceExportRequest) (*OccurrenceExport, error)
+}
+
+type exportService struct {
+	occRepo repository.OccurrenceRepository
+	wsRepo  repository.WorkstationRepository
+}
+
+func NewExportService(occRepo repository.OccurrenceRepository, wsRepo repository.WorkstationRepository) ExportService {
+	return &exportService{
+		occRepo: occRepo,
+		wsRepo:  wsRepo,
+	}
+}
+
+// NewOccurrenceExport は権限と形式をチェックして、書き出し処理を組み立てるのだ
+// ここでエラーを返しておけば、レスポンスを書き始める前に 4xx を返せるのだ
+func (s *exportService) NewOccurrenceExport(userIDStr string, req *model.OccurrenceExportRequest) (*OccurrenceExport, error) {
+	columns, err := selectExportColumns(req.Columns)
+	if err != nil {
+		return nil, err
+	}
+
+	wsIDs, err := resolveWorkstationIDs(s.wsRepo, userIDStr, req.WorkstationID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := req.OccurrenceSearchQuery
+	if err := applySpatialParams(&query); err != nil {
+		return nil, err
+	}
+	// エクスポートはチームの外に出ていくので、管理者でも一般化した座標で書き出すのだ
+	access, err := loadCoordinateAccess(s.wsRepo, userIDStr)
+	if err != nil {
+		return nil, err
+	}
+	access.restrict(&query)
+	baseName := "occurrences_" + time.Now().Format("20060102_150405")
+
+	switch strings.ToLower(req.Format) {
+	case "", "csv":
+		return &OccurrenceExport{
+			ContentType: "text/csv; charset=utf-8",
+			FileName:    baseName + ".csv",
+			write: func(w io.Writer) error {
+				return s.writeCSV(w, wsIDs, &query, columns)
+			},
+		}, nil
+	case "xlsx":
+		return &OccurrenceExport{
+			ContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+			FileName:    baseName + ".xlsx",
+			write: func(w io.Writer) error {
+				return s.writeXLSX(w, wsIDs, &query, columns)
+			},
+		}, nil
+	case "geojson":
+		return &OccurrenceExport{
+			ContentType: "application/geo+json",
+			FileName:    baseName + ".geojson",
+			write: func(w io.Writer) error {
+				return s.writeGeoJSON(w, wsIDs, &query)
+			},
+		}, nil
+	case "kml":
+		return &OccurrenceExport{
+			ContentType: "application/vnd.google-earth.kml+xml",
+			FileName:    baseName + ".kml",
+			write: func(w io.Writer) error {
+				return s.writeKML(w, wsIDs, &query)
+			},
+		}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrInvalidExportFormat, req.Format)
+	}
+}
+
+func (s *exportService) writeCSV(w io.Writer, wsIDs []int64, q *model.OccurrenceSearchQuery, columns []exportColumn) error {
+	// Excel で開いたときに文字化けしないように BOM を付けるのだ
+	if _, err := io.WriteString(w, "\ufeff"); err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(exportHeader(columns)); err != nil {
+		return err
+	}
+
+	values := make([]string, len(columns))
+	err := s.occRepo.StreamSearch(wsIDs, q, func(row *model.OccurrenceSearchRow) error {
+		publicCoordinateAccess.generalize(row)
+		rec := newExportRecord(row)
+		for i, col := range columns {
+			values[i] = col.text(rec)
+		}
+		return cw.Write(values)
+	})
+	if err != nil {
+		return err
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func (s *exportService) writeXLSX(w io.Writer, wsIDs []int64, q *model.OccurrenceSearchQuery, columns []exportColumn) error {
+	xw, err := infrastructure.NewXLSXWriter(w, "occurrences")
+	if err != nil {
+		return err
+	}
+	if err := xw.WriteStrings(exportHeader(columns)); err != nil {
+		return err
+	}
+
+	cells := make([]infrastructure.XLSXCell, len(columns))
+	err = s.occRepo.StreamSearch(wsIDs, q, func(row *model.OccurrenceSearchRow) error {
+		publicCoordinateAccess.generalize(row)
+		rec := newExportRecord(row)
+		for i, col := range columns {
+			cells[i] = infrastructure.XLSXCell{}
+			if col.number != nil {
+				if v, ok := col.number(rec); ok {
+					cells[i].Number = &v
+				}
+				continue
+			}
+			cells[i].Text = col.text(rec)
+		}
+		return xw.WriteRow(cells)
+	})
+	if err != nil {
+		return err
+	}
+
+	return xw.Close()
+}
+
+// geoFeatureProperties は GeoJSON / KML に載せる属性なのだ
+// QGIS や Google Earth で見たときに必要な項目だけにしてあるのだ
+func geoFeatureProperties(rec *exportRecord) map[string]interface{} {
+	props := map[string]interface{}{
+		"occurrence_id": rec.row.OccurrenceID,
+		"taxon":         taxonLabel(rec.taxa),
+		"observer":      rec.row.UserDisplayName,
+		"observer_id":   rec.row.UserID,
+		"project_id":    rec.row.ProjectID,
+	}
+	for rank, name := range rec.taxa {
+		props[rank] = name
+	}
+	if !rec.row.CreatedAt.IsZero() {
+		props["date"] = rec.row.CreatedAt.Format(time.RFC3339)
+	}
+	if rec.row.Accuracy != 0 {
+		props["accuracy"] = rec.row.Accuracy
+	}
+	if rec.row.CoordinateGeneralization != "" {
+		props["coordinate_generalization"] = rec.row.CoordinateGeneralization
+	}
+	return props
+}
+
+// writeGeoJSON は座標を持つ occurrence を FeatureCollection として書き出すのだ
+// 座標がないものは地図に置けないので飛ばすのだ
+func (s *exportService) writeGeoJSON(w io.Writer, wsIDs []int64, q *model.OccurrenceSearchQuery) error {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(`{"type":"FeatureCollection","features":[`); err != nil {
+		return err
+	}
+
+	first := true
+	err := s.occRepo.StreamSearch(wsIDs, q, func(row *model.OccurrenceSearchRow) error {
+		publicCoordinateAccess.generalize(row)
+		rec := newExportRecord(row)
+		if !rec.hasLoc {
+			return nil
+		}
+
+		feature := map[string]interface{}{
+			"type": "Feature",
+			"id":   row.OccurrenceID,
+			"geometry": map[string]interface{}{
+				"type":        "Point",
+				"coordinates": []float64{rec.lon, rec.lat},
+			},
+			"properties": geoFeatureProperties(rec),
+		}
+		data, err := json.Marshal(feature)
+		if err != nil {
+			return err
+		}
+
+		if !first {
+			if err := bw.WriteByte(','); err != nil {
+				return err
+			}
+		}
+		first = false
+		_, err = bw.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := bw.WriteString("]}"); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+type kmlData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value"`
+}
+
+type kmlPlacemark struct {
+	XMLName      xml.Name  `xml:"Placemark"`
+	ID           string    `xml:"id,attr"`
+	Name         string    `xml:"name"`
+	When         string    `xml:"TimeStamp>when,omitempty"`
+	ExtendedData []kmlData `xml:"ExtendedData>Data"`
+	Coordinates  string    `xml:"Point>coordinates"`
+}
+
+// writeKML は Google Earth 用に Placemark を1件ずつ書き出すのだ
+func (s *exportService) writeKML(w io.Writer, wsIDs []int64, q *model.OccurrenceSearchQuery) error {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(xml.Header + `<kml xmlns="http://www.opengis.net/kml/2.2"><Document><name>occurrences</name>`); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(bw)
+	err := s.occRepo.StreamSearch(wsIDs, q, func(row *model.OccurrenceSearchRow) error {
+		publicCoordinateAccess.generalize(row)
+		rec := newExportRecord(row)
+		if !rec.hasLoc {
+			return nil
+		}
+
+		props := geoFeatureProperties(rec)
+		keys := make([]string, 0, len(props))
+		for k := range props {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		pm := kmlPlacemark{
+			ID:          row.OccurrenceID,
+			Name:        taxonLabel(rec.taxa),
+			Coordinates: strconv.FormatFloat(rec.lon, 'f', -1, 64) + "," + strconv.FormatFloat(rec.lat, 'f', -1, 64),
+		}
+		if date, ok := props["date"].(string); ok {
+			pm.When = date
+		}
+		for _, k := range keys {
+			pm.ExtendedData = append(pm.ExtendedData, kmlData{Name: k, Value: fmt.Sprint(props[k])})
+		}
+		return enc.Encode(pm)
+	})
+	if err != nil {
+		return err
+	}
+	if err := enc.Flush(); err != nil {
+		return err
+	}
+
+	if _, err := bw.WriteString("</Document></kml>"); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func newExportRecord(row *model.OccurrenceSearchRow) *exportRecord {
+	rec := &exportRecord{
+		row:  row,
+		taxa: decodeClassification(row.ClassClassification),
+	}
+	// 正規化済みの緯度経度があればそれを使い、なければ jsonb から読むのだ
+	if row.Latitude != nil && row.Longitude != nil {
+		rec.lat, rec.lon, rec.hasLoc = *row.Latitude, *row.Longitude, true
+	} else {
+		rec.lat, rec.lon, rec.hasLoc = decodeCoordinates(row.Coordinates)
+	}
+	return rec
+}
+
+// selectExportColumns はカンマ区切りの列指定を列定義に変換するのだ
+func selectExportColumns(spec string) ([]exportColumn, error) {
+	if strings.TrimSpace(spec) == "" {
+		return exportColumns, nil
+	}
+
+	var selected []exportColumn
+	for _, key := range strings.Split(spec, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		col, ok := findExportColumn(key)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidExportColumn, key)
+		}
+		selected = append(selected, col)
+	}
+	if len(selected) == 0 {
+		return exportColumns, nil
+	}
+	return selected, nil
+}
+
+func findExportColumn(key string) (exportColumn, bool) {
+	for _, col := range exportColumns {
+		if col.key == key {
+			return col, true
+		}
+	}
+	return exportColumn{}, false
+}
+
+func exportHeader(columns []exportColumn) []string {
+	header := make([]string, len(columns))
+	for i, col := range columns {
+		header[i] = col.key
+	}
+	return header
+}
@@ -0,0 +1,509 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/saku-730/web-occurrence/backend/internal/entity"
+	"github.com/saku-730/web-occurrence/backend/internal/infrastructure"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/repository"
+	"gorm.io/gorm"
+)
+
+var ErrOccurrenceNotFound = errors.New("occurrence が見つかりません")
+var ErrIdentificationNotFound = errors.New("同定が見つかりません")
+var ErrInvalidIdentification = errors.New("同定の内容が正しくありません")
+
+const (
+	QualityGradeUnidentified = "unidentified"
+	QualityGradeNeedsID      = "needs_id"
+	QualityGradeResearch     = "research"
+)
+
+// consensusThreshold は合意とみなす支持の割合なのだ (参加者の 2/3 より多く)
+const consensusThreshold = 2.0 / 3.0
+
+type IdentificationService interface {
+	List(userID string, occurrenceID string) (*model.IdentificationListResponse, error)
+	Create(userID string, occurrenceID string, req *model.IdentificationRequest) (*model.IdentificationListResponse, error)
+	Withdraw(userID string, occurrenceID string, identificationID string) (*model.IdentificationListResponse, error)
+	Vote(userID string, occurrenceID string, identificationID string, agree bool) (*model.IdentificationListResponse, error)
+	DeleteVote(userID string, occurrenceID string, identificationID string) (*model.IdentificationListResponse, error)
+}
+
+type identificationService struct {
+	identRepo   repository.IdentificationRepository
+	taxonRepo   repository.TaxonRepository
+	wsRepo      repository.WorkstationRepository
+	couchClient infrastructure.CouchDBClient
+}
+
+func NewIdentificationService(identRepo repository.IdentificationRepository, taxonRepo repository.TaxonRepository, wsRepo repository.WorkstationRepository, couchClient infrastructure.CouchDBClient) IdentificationService {
+	return &identificationService{
+		identRepo:   identRepo,
+		taxonRepo:   taxonRepo,
+		wsRepo:      wsRepo,
+		couchClient: couchClient,
+	}
+}
+
+func (s *identificationService) List(userIDStr string, occurrenceID string) (*model.IdentificationListResponse, error) {
+	occ, userID, err := s.findOccurrence(userIDStr, occurrenceID)
+	if err != nil {
+		return nil, err
+	}
+	return s.buildResponse(occ, userID)
+}
+
+// Create は新しい同定を追加して、合意を計算し直すのだ
+func (s *identificationService) Create(userIDStr string, occurrenceID string, req *model.IdentificationRequest) (*model.IdentificationListResponse, error) {
+	occ, userID, err := s.findOccurrence(userIDStr, occurrenceID)
+	if err != nil {
+		return nil, err
+	}
+	// 同定は合意の1票になるので、投票と同じく閲覧者はできないのだ
+	if err := requireWorkstationEditor(s.wsRepo, userID, occ.WorkstationID); err != nil {
+		return nil, err
+	}
+
+	classification, taxonID, err := s.identificationClassification(occ.WorkstationID, req)
+	if err != nil {
+		return nil, err
+	}
+	classJSON, err := json.Marshal(classification)
+	if err != nil {
+		return nil, err
+	}
+
+	identificatedAt := time.Now()
+	if req.IdentificatedAt != nil {
+		identificatedAt = *req.IdentificatedAt
+	}
+	ident := &entity.Identification{
+		OccurrenceID:        occ.OccurrenceID,
+		WorkstationID:       occ.WorkstationID,
+		UserID:              userID,
+		SourceInfo:          req.SourceInfo,
+		IdentificatedAt:     identificatedAt,
+		ClassClassification: string(classJSON),
+		TaxonID:             taxonID,
+		Note:                req.Note,
+	}
+	if err := s.identRepo.Create(ident); err != nil {
+		return nil, err
+	}
+	return s.recompute(occ, userID)
+}
+
+// Withdraw は自分の同定を取り下げるのだ (管理者は他の人のものも取り下げられるのだ)
+func (s *identificationService) Withdraw(userIDStr string, occurrenceID string, identificationID string) (*model.IdentificationListResponse, error) {
+	occ, userID, err := s.findOccurrence(userIDStr, occurrenceID)
+	if err != nil {
+		return nil, err
+	}
+	ident, err := s.findIdentification(occ, identificationID)
+	if err != nil {
+		return nil, err
+	}
+	if ident.UserID != userID {
+		if _, err := requireWorkstationAdmin(s.wsRepo, userIDStr, occ.WorkstationID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.identRepo.Withdraw(ident.IdentificationID); err != nil {
+		return nil, err
+	}
+	return s.recompute(occ, userID)
+}
+
+func (s *identificationService) Vote(userIDStr string, occurrenceID string, identificationID string, agree bool) (*model.IdentificationListResponse, error) {
+	occ, userID, err := s.findOccurrence(userIDStr, occurrenceID)
+	if err != nil {
+		return nil, err
+	}
+	ident, err := s.findIdentification(occ, identificationID)
+	if err != nil {
+		return nil, err
+	}
+	if ident.UserID == userID {
+		return nil, fmt.Errorf("%w: 自分の同定には投票できません", ErrInvalidIdentification)
+	}
+	if !ident.IsCurrent {
+		return nil, fmt.Errorf("%w: 取り下げられた同定には投票できません", ErrInvalidIdentification)
+	}
+	if err := requireWorkstationEditor(s.wsRepo, userID, occ.WorkstationID); err != nil {
+		return nil, err
+	}
+
+	if err := s.identRepo.SaveVote(&entity.IdentificationVote{IdentificationID: ident.IdentificationID, UserID: userID, Agree: agree}); err != nil {
+		return nil, err
+	}
+	return s.recompute(occ, userID)
+}
+
+func (s *identificationService) DeleteVote(userIDStr string, occurrenceID string, identificationID string) (*model.IdentificationListResponse, error) {
+	occ, userID, err := s.findOccurrence(userIDStr, occurrenceID)
+	if err != nil {
+		return nil, err
+	}
+	ident, err := s.findIdentification(occ, identificationID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.identRepo.DeleteVote(ident.IdentificationID, userID); err != nil {
+		return nil, err
+	}
+	return s.recompute(occ, userID)
+}
+
+// findOccurrence は occurrence を取得して、ユーザーがそのワークステーションのメンバーかを確認するのだ
+func (s *identificationService) findOccurrence(userIDStr string, occurrenceID string) (*entity.Occurrence, int64, error) {
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		return nil, 0, err
+	}
+	occ, err := s.identRepo.FindOccurrence(occurrenceID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, 0, ErrOccurrenceNotFound
+		}
+		return nil, 0, err
+	}
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, occ.WorkstationID); err != nil {
+		return nil, 0, err
+	}
+	return occ, userID, nil
+}
+
+func (s *identificationService) findIdentification(occ *entity.Occurrence, identificationID string) (*entity.Identification, error) {
+	ident, err := s.identRepo.FindByID(identificationID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrIdentificationNotFound
+		}
+		return nil, err
+	}
+	if ident.OccurrenceID != occ.OccurrenceID {
+		return nil, ErrIdentificationNotFound
+	}
+	return ident, nil
+}
+
+// identificationClassification は同定の分類を決めるのだ
+// taxon_id が指定されていればチェックリストの有効名の分類を使うのだ
+func (s *identificationService) identificationClassification(workstationID int64, req *model.IdentificationRequest) (map[string]string, *string, error) {
+	classification := map[string]string{}
+	if req.TaxonID != nil && *req.TaxonID != "" {
+		taxon, err := s.taxonRepo.FindByID(*req.TaxonID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, nil, fmt.Errorf("%w: taxon_id がチェックリストにありません", ErrInvalidIdentification)
+			}
+			return nil, nil, err
+		}
+		if taxon.WorkstationID != workstationID {
+			return nil, nil, fmt.Errorf("%w: taxon_id がチェックリストにありません", ErrInvalidIdentification)
+		}
+		if taxon.AcceptedID != nil {
+			if taxon, err = s.taxonRepo.FindByID(*taxon.AcceptedID); err != nil {
+				return nil, nil, err
+			}
+		}
+		return taxonClassification(taxon), &taxon.TaxonID, nil
+	}
+
+	for _, rank := range model.ClassificationRanks {
+		if name := strings.TrimSpace(req.ClassClassification[rank]); name != "" {
+			classification[rank] = name
+		}
+	}
+	if len(classification) == 0 {
+		return nil, nil, fmt.Errorf("%w: taxon_id か class_classification を指定してください", ErrInvalidIdentification)
+	}
+
+	// チェックリストがあれば、名前がチェックリストにあるかを確かめて、有効名の分類にそろえるのだ
+	check, err := newClassificationChecker(s.taxonRepo).Check(workstationID, classification)
+	if err != nil {
+		return nil, nil, err
+	}
+	if check == nil {
+		return classification, nil, nil
+	}
+	if len(check.Unknown) > 0 {
+		return nil, nil, fmt.Errorf("%w: チェックリストにない名前です (%s)", ErrInvalidIdentification, strings.Join(check.Unknown, ", "))
+	}
+	taxon, err := s.taxonRepo.FindByID(*check.TaxonID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return taxonClassification(taxon), &taxon.TaxonID, nil
+}
+
+// taxonClassification はチェックリストの分類を class_classification の形にするのだ
+func taxonClassification(taxon *entity.Taxon) map[string]string {
+	classification := map[string]string{}
+	for rank, name := range decodeClassification(taxon.Classification) {
+		classification[rank] = name
+	}
+	classification[taxon.Rank] = taxon.CanonicalName
+	return classification
+}
+
+// recompute は合意を計算し直して、occurrence の分類と状態を更新するのだ
+// CouchDB のドキュメントを先に書き換えるのだ (同期で PostgreSQL 側が元に戻されないようにするため)
+func (s *identificationService) recompute(occ *entity.Occurrence, userID int64) (*model.IdentificationListResponse, error) {
+	idents, err := s.identRepo.ListByOccurrenceID(occ.OccurrenceID)
+	if err != nil {
+		return nil, err
+	}
+	votes, err := s.identRepo.ListVotesByOccurrenceID(occ.OccurrenceID)
+	if err != nil {
+		return nil, err
+	}
+
+	consensus, grade := computeConsensus(idents, votes)
+	occ.QualityGrade = grade
+	occ.ConsensusIdentificationID = nil
+
+	var classification *entity.ClassificationJSON
+	if consensus != nil {
+		occ.ConsensusIdentificationID = &consensus.IdentificationID
+		if occ.ClassificationID == "" {
+			occ.ClassificationID = infrastructure.NewUUID()
+		}
+		classification = &entity.ClassificationJSON{
+			ClassificationID:    occ.ClassificationID,
+			ClassClassification: consensus.ClassClassification,
+		}
+	}
+
+	if err := s.writeCouchDocument(occ, classification); err != nil {
+		return nil, err
+	}
+	if err := s.identRepo.SaveConsensus(occ, classification); err != nil {
+		return nil, err
+	}
+	return s.buildResponseFrom(occ, userID, idents, votes), nil
+}
+
+// writeCouchDocument は CouchDB の occurrence ドキュメントに合意の結果を書き込むのだ
+func (s *identificationService) writeCouchDocument(occ *entity.Occurrence, classification *entity.ClassificationJSON) error {
+	return patchOccurrenceDocument(s.couchClient, occ.WorkstationID, occ.OccurrenceID, func(doc map[string]interface{}) error {
+		if classification != nil {
+			var classMap map[string]interface{}
+			if err := json.Unmarshal([]byte(classification.ClassClassification), &classMap); err != nil {
+				return err
+			}
+			doc["classification_data"] = map[string]interface{}{
+				"classification_id":    classification.ClassificationID,
+				"class_classification": classMap,
+			}
+		}
+		doc["identification_status"] = map[string]interface{}{
+			"quality_grade":               occ.QualityGrade,
+			"consensus_identification_id": occ.ConsensusIdentificationID,
+		}
+		return nil
+	})
+}
+
+func (s *identificationService) buildResponse(occ *entity.Occurrence, userID int64) (*model.IdentificationListResponse, error) {
+	idents, err := s.identRepo.ListByOccurrenceID(occ.OccurrenceID)
+	if err != nil {
+		return nil, err
+	}
+	votes, err := s.identRepo.ListVotesByOccurrenceID(occ.OccurrenceID)
+	if err != nil {
+		return nil, err
+	}
+	return s.buildResponseFrom(occ, userID, idents, votes), nil
+}
+
+func (s *identificationService) buildResponseFrom(occ *entity.Occurrence, userID int64, idents []entity.Identification, votes []entity.IdentificationVote) *model.IdentificationListResponse {
+	res := &model.IdentificationListResponse{
+		OccurrenceID:              occ.OccurrenceID,
+		QualityGrade:              occ.QualityGrade,
+		ConsensusIdentificationID: occ.ConsensusIdentificationID,
+		Identifications:           make([]model.IdentificationView, 0, len(idents)),
+	}
+	if res.QualityGrade == "" {
+		res.QualityGrade = QualityGradeUnidentified
+	}
+
+	for _, ident := range idents {
+		taxa := decodeClassification(ident.ClassClassification)
+		view := model.IdentificationView{
+			IdentificationID:    ident.IdentificationID,
+			UserID:              ident.UserID,
+			Taxon:               taxonLabel(taxa),
+			ClassClassification: taxa,
+			TaxonID:             ident.TaxonID,
+			SourceInfo:          ident.SourceInfo,
+			Note:                ident.Note,
+			IsCurrent:           ident.IsCurrent,
+			WithdrawnAt:         ident.WithdrawnAt,
+			IdentificatedAt:     ident.IdentificatedAt,
+		}
+		for _, v := range votes {
+			if v.IdentificationID != ident.IdentificationID {
+				continue
+			}
+			if v.Agree {
+				view.AgreeCount++
+			} else {
+				view.DisagreeCount++
+			}
+			if v.UserID == userID {
+				agree := v.Agree
+				view.MyVote = &agree
+			}
+		}
+		if occ.ConsensusIdentificationID != nil && *occ.ConsensusIdentificationID == ident.IdentificationID {
+			res.ConsensusTaxon = view.Taxon
+		}
+		res.Identifications = append(res.Identifications, view)
+	}
+	return res
+}
+
+// computeConsensus は現在の同定と投票から合意した同定と品質の段階を決めるのだ
+//
+//   - 1人の意見は1つだけで、自分の同定と賛成の投票のうち新しい方なのだ
+//   - ある分類について、その分類かその下の分類を意見にしている人を支持者として数えるのだ
+//   - その分類とも上の分類とも違う分類を意見にしている人と、その分類か上の分類に反対した人を不支持者として数えるのだ
+//     (上の分類 (属など) だけを意見にしている人は、下の分類 (種) には支持でも不支持でもないのだ)
+//   - 支持者が支持者と不支持者の 2/3 より多い分類のうち、いちばん下の階級のものを合意とするのだ
+//   - 合意が種まで決まっていて、支持者が2人以上なら research なのだ
+func computeConsensus(idents []entity.Identification, votes []entity.IdentificationVote) (*entity.Identification, string) {
+	type opinion struct {
+		lineage taxonLineage
+		at      time.Time
+	}
+	lineages := map[string]taxonLineage{}
+	candidates := map[string]*entity.Identification{}
+	var keys []string
+	opinions := map[int64]opinion{}
+
+	for i := range idents {
+		ident := &idents[i]
+		if !ident.IsCurrent {
+			continue
+		}
+		l := newTaxonLineage(decodeClassification(ident.ClassClassification))
+		if l.key == "" {
+			continue
+		}
+		lineages[ident.IdentificationID] = l
+		if _, ok := candidates[l.key]; !ok {
+			candidates[l.key] = ident
+			keys = append(keys, l.key)
+		}
+		if op, ok := opinions[ident.UserID]; !ok || !ident.CreatedAt.Before(op.at) {
+			opinions[ident.UserID] = opinion{lineage: l, at: ident.CreatedAt}
+		}
+	}
+	if len(keys) == 0 {
+		return nil, QualityGradeUnidentified
+	}
+
+	against := map[int64][]taxonLineage{}
+	for _, v := range votes {
+		l, ok := lineages[v.IdentificationID]
+		if !ok {
+			continue
+		}
+		if !v.Agree {
+			against[v.UserID] = append(against[v.UserID], l)
+			continue
+		}
+		if op, ok := opinions[v.UserID]; !ok || !v.VotedAt.Before(op.at) {
+			opinions[v.UserID] = opinion{lineage: l, at: v.VotedAt}
+		}
+	}
+
+	var best *entity.Identification
+	bestRank, bestSupport := -1, 0
+	for _, key := range keys {
+		target := newTaxonLineage(decodeClassification(candidates[key].ClassClassification))
+		support, opponents := 0, 0
+		for _, op := range opinions {
+			switch {
+			case target.contains(op.lineage):
+				support++
+			case !op.lineage.contains(target):
+				opponents++
+			}
+		}
+		for user, list := range against {
+			if op, ok := opinions[user]; ok && (target.contains(op.lineage) || !op.lineage.contains(target)) {
+				continue // 支持者か、もう不支持者として数えた人なのだ
+			}
+			for _, l := range list {
+				if l.contains(target) {
+					opponents++
+					break
+				}
+			}
+		}
+		if support == 0 || float64(support)/float64(support+opponents) <= consensusThreshold {
+			continue
+		}
+		// 同じ階級なら支持者の多い方、同点なら先に同定された分類を優先するのだ
+		if target.rank > bestRank || (target.rank == bestRank && support > bestSupport) {
+			best, bestRank, bestSupport = candidates[key], target.rank, support
+		}
+	}
+
+	if best == nil {
+		return nil, QualityGradeNeedsID
+	}
+	if model.ClassificationRanks[bestRank] == "species" && bestSupport >= 2 {
+		return best, QualityGradeResearch
+	}
+	return best, QualityGradeNeedsID
+}
+
+// taxonLineage は同定の分類を、階級ごとの名前 (小文字) にしたものなのだ
+type taxonLineage struct {
+	key   string // いちばん下の階級の名前
+	rank  int    // いちばん下の階級 (model.ClassificationRanks の添字) で、分類が無ければ -1 なのだ
+	names map[string]string
+}
+
+func newTaxonLineage(taxa map[string]string) taxonLineage {
+	l := taxonLineage{key: strings.ToLower(taxonLabel(taxa)), rank: -1, names: map[string]string{}}
+	for i, rank := range model.ClassificationRanks {
+		name := strings.TrimSpace(taxa[rank])
+		if name == "" {
+			continue
+		}
+		if rank == "species" {
+			// 種は属と組み合わせた学名で比べるのだ
+			name = taxonLabel(taxa)
+			if _, ok := l.names["genus"]; !ok {
+				if genus, _, found := strings.Cut(name, " "); found {
+					l.names["genus"] = strings.ToLower(genus)
+				}
+			}
+		}
+		l.names[rank] = strings.ToLower(name)
+		l.rank = i
+	}
+	return l
+}
+
+// contains は other が l と同じ分類か、l の下の分類かを調べるのだ
+func (l taxonLineage) contains(other taxonLineage) bool {
+	if l.rank < 0 || other.rank < l.rank {
+		return false
+	}
+	rank := model.ClassificationRanks[l.rank]
+	return other.names[rank] == l.names[rank]
+}
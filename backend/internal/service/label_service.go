@@ -0,0 +1,427 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/saku-730/web-occurrence/backend/internal/entity"
+	"github.com/saku-730/web-occurrence/backend/internal/infrastructure"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/repository"
+	"gorm.io/gorm"
+)
+
+var ErrInvalidLabelRequest = errors.New("ラベルの指定が正しくありません")
+
+const (
+	defaultLabelTemplate = "standard"
+	// labelPadding はラベルの縁と中身の間の余白 (mm) なのだ
+	labelPadding = 1.5
+	// labelLineSpacing は文字の大きさに対する行の高さの倍率なのだ
+	labelLineSpacing = 1.15
+	// qrQuietZone は QR コードの周りに空ける余白 (モジュール数) なのだ (規格では4モジュール必要なのだ)
+	qrQuietZone = 4
+)
+
+func labelBorder(v bool) *bool {
+	return &v
+}
+
+// labelTemplates は最初から使えるテンプレートなのだ (A4 に並べるのだ)
+var labelTemplates = []model.LabelTemplate{
+	{
+		Name: "standard", PageWidth: 210, PageHeight: 297, Margin: 10,
+		LabelWidth: 60, LabelHeight: 30, Gap: 2, FontSize: 6, QRSize: 16, Border: labelBorder(true),
+		Fields: []string{"catalog_number", "taxon", "locality", "coordinates", "date", "collector"},
+	},
+	{
+		// 昆虫標本の針に刺す小さなラベルなのだ
+		Name: "pin", PageWidth: 210, PageHeight: 297, Margin: 10,
+		LabelWidth: 30, LabelHeight: 12, Gap: 1, FontSize: 3.5, QRSize: 9, Border: labelBorder(false),
+		Fields: []string{"catalog_number", "locality", "date", "collector"},
+	},
+	{
+		// 液浸標本の瓶に入れるラベルなのだ
+		Name: "vial", PageWidth: 210, PageHeight: 297, Margin: 10,
+		LabelWidth: 40, LabelHeight: 16, Gap: 1, FontSize: 4.5, QRSize: 12, Border: labelBorder(true),
+		Fields: []string{"catalog_number", "taxon", "locality", "date"},
+	},
+}
+
+type LabelService interface {
+	Templates() []model.LabelTemplate
+	// Render は標本のラベルを並べた PDF を作るのだ
+	Render(userID string, workstationID int64, req *model.LabelRequest) ([]byte, error)
+}
+
+type labelService struct {
+	specimenRepo repository.SpecimenRepository
+	codeRepo     repository.RecordCodeRepository
+	occRepo      repository.OccurrenceRepository
+	pnRepo       repository.PlaceNameRepository
+	wsRepo       repository.WorkstationRepository
+}
+
+func NewLabelService(specimenRepo repository.SpecimenRepository, codeRepo repository.RecordCodeRepository, occRepo repository.OccurrenceRepository, pnRepo repository.PlaceNameRepository, wsRepo repository.WorkstationRepository) LabelService {
+	return &labelService{
+		specimenRepo: specimenRepo,
+		codeRepo:     codeRepo,
+		occRepo:      occRepo,
+		pnRepo:       pnRepo,
+		wsRepo:       wsRepo,
+	}
+}
+
+func (s *labelService) Templates() []model.LabelTemplate {
+	return labelTemplates
+}
+
+// labelContent はラベル1枚に載せる内容なのだ
+type labelContent struct {
+	lines     []string
+	qrPayload string
+}
+
+func (s *labelService) Render(userIDStr string, workstationID int64, req *model.LabelRequest) ([]byte, error) {
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	tmpl, err := resolveLabelTemplate(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// 座標の精度は検索と同じ扱いにするのだ (一般化対象は管理者以外には丸めた値を載せるのだ)
+	access, err := loadCoordinateAccess(s.wsRepo, userIDStr)
+	if err != nil {
+		return nil, err
+	}
+
+	copies := req.Copies
+	if copies <= 0 {
+		copies = 1
+	}
+	var labels []labelContent
+	for _, specimenID := range req.SpecimenIDs {
+		label, err := s.buildLabel(workstationID, specimenID, tmpl, access)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < copies; i++ {
+			labels = append(labels, *label)
+		}
+	}
+
+	return renderLabelSheet(tmpl, labels)
+}
+
+func (s *labelService) buildLabel(workstationID int64, specimenID string, tmpl *model.LabelTemplate, access *coordinateAccess) (*labelContent, error) {
+	sp, err := s.specimenRepo.FindByID(specimenID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrSpecimenNotFound, specimenID)
+		}
+		return nil, err
+	}
+	if sp.WorkstationID != workstationID {
+		return nil, fmt.Errorf("%w: %s", ErrSpecimenNotFound, specimenID)
+	}
+
+	rows, _, err := s.occRepo.Search([]int64{workstationID}, &model.OccurrenceSearchQuery{OccurrenceID: sp.OccurrenceID}, 1, 0)
+	if err != nil {
+		return nil, err
+	}
+	var rec *exportRecord
+	if len(rows) > 0 {
+		access.generalize(&rows[0])
+		rec = newExportRecord(&rows[0])
+	}
+
+	// QR には短いコードを入れるのだ。読み取ったら /resolve で標本にたどり着けるのだ
+	rc, err := ensureRecordCode(s.codeRepo, sp.WorkstationID, recordTypeSpecimen, sp.SpecimenID)
+	if err != nil {
+		return nil, err
+	}
+
+	label := &labelContent{qrPayload: rc.Code}
+	for _, field := range tmpl.Fields {
+		text, err := s.labelField(field, sp, rec)
+		if err != nil {
+			return nil, err
+		}
+		if text != "" {
+			label.lines = append(label.lines, text)
+		}
+	}
+	return label, nil
+}
+
+func (s *labelService) labelField(field string, sp *entity.Specimen, rec *exportRecord) (string, error) {
+	if field == "catalog_number" {
+		if sp.CatalogNumber == nil {
+			return "", nil
+		}
+		return *sp.CatalogNumber, nil
+	}
+	if field == "collection" {
+		return strings.TrimSpace(sp.InstitutionID + " " + sp.CollectionID), nil
+	}
+	if rec == nil {
+		return "", nil
+	}
+
+	switch field {
+	case "taxon":
+		return taxonLabel(rec.taxa), nil
+	case "locality":
+		if rec.row.PlaceNameID == nil {
+			return "", nil
+		}
+		ancestors, err := s.pnRepo.FindAncestors(*rec.row.PlaceNameID)
+		if err != nil {
+			return "", err
+		}
+		names := make([]string, 0, len(ancestors))
+		for _, pn := range ancestors {
+			names = append(names, pn.Name)
+		}
+		return strings.Join(names, ", "), nil
+	case "coordinates":
+		if !rec.hasLoc {
+			return "", nil
+		}
+		return formatLabelCoordinates(rec.lat, rec.lon), nil
+	case "date":
+		if rec.row.CreatedAt.IsZero() {
+			return "", nil
+		}
+		// サーバーのタイムゾーンではなく、記録した場所の日付にするのだ
+		return rec.row.CreatedAt.In(occurrenceLocation(rec.row.Timezone)).Format("2006-01-02"), nil
+	case "collector":
+		if rec.row.UserDisplayName == "" {
+			return "", nil
+		}
+		return "leg. " + rec.row.UserDisplayName, nil
+	}
+	return "", nil
+}
+
+// formatLabelCoordinates は "35.3606N 138.7274E" のような表記にするのだ
+func formatLabelCoordinates(lat, lon float64) string {
+	ns, ew := "N", "E"
+	if lat < 0 {
+		ns = "S"
+	}
+	if lon < 0 {
+		ew = "W"
+	}
+	return fmt.Sprintf("%.4f%s %.4f%s", math.Abs(lat), ns, math.Abs(lon), ew)
+}
+
+// resolveLabelTemplate はテンプレートに Layout の指定を重ねて、用紙に入るか確かめるのだ
+func resolveLabelTemplate(req *model.LabelRequest) (*model.LabelTemplate, error) {
+	name := req.Template
+	if name == "" {
+		name = defaultLabelTemplate
+	}
+	var tmpl model.LabelTemplate
+	found := false
+	for _, t := range labelTemplates {
+		if t.Name == name {
+			tmpl, found = t, true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: テンプレート %q はありません", ErrInvalidLabelRequest, name)
+	}
+	tmpl.Fields = append([]string{}, tmpl.Fields...)
+
+	if l := req.Layout; l != nil {
+		overrides := []struct {
+			dst *float64
+			src float64
+		}{
+			{&tmpl.PageWidth, l.PageWidth}, {&tmpl.PageHeight, l.PageHeight}, {&tmpl.Margin, l.Margin},
+			{&tmpl.LabelWidth, l.LabelWidth}, {&tmpl.LabelHeight, l.LabelHeight}, {&tmpl.Gap, l.Gap},
+			{&tmpl.FontSize, l.FontSize}, {&tmpl.QRSize, l.QRSize},
+		}
+		for _, o := range overrides {
+			if o.src < 0 {
+				return nil, fmt.Errorf("%w: 長さに負の値は使えません", ErrInvalidLabelRequest)
+			}
+			if o.src > 0 {
+				*o.dst = o.src
+			}
+		}
+		if l.Border != nil {
+			tmpl.Border = l.Border
+		}
+		if len(l.Fields) > 0 {
+			tmpl.Fields = l.Fields
+		}
+	}
+
+	for _, field := range tmpl.Fields {
+		if !containsString(model.LabelFields, field) {
+			return nil, fmt.Errorf("%w: 項目 %q はありません", ErrInvalidLabelRequest, field)
+		}
+	}
+	if tmpl.FontSize <= 0 || tmpl.LabelWidth <= 0 || tmpl.LabelHeight <= 0 {
+		return nil, fmt.Errorf("%w: ラベルの大きさと文字の大きさを指定してください", ErrInvalidLabelRequest)
+	}
+	if tmpl.LabelWidth > tmpl.PageWidth-2*tmpl.Margin || tmpl.LabelHeight > tmpl.PageHeight-2*tmpl.Margin {
+		return nil, fmt.Errorf("%w: ラベルが用紙に入りません", ErrInvalidLabelRequest)
+	}
+	if tmpl.QRSize > tmpl.LabelHeight-2*labelPadding || tmpl.QRSize > tmpl.LabelWidth-2*labelPadding {
+		return nil, fmt.Errorf("%w: QR コードがラベルに入りません", ErrInvalidLabelRequest)
+	}
+	return &tmpl, nil
+}
+
+func containsString(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// renderLabelSheet はラベルを左上から横に並べた PDF にするのだ
+func renderLabelSheet(tmpl *model.LabelTemplate, labels []labelContent) ([]byte, error) {
+	mm := infrastructure.PDFPointsPerMM
+	columns := int((tmpl.PageWidth - 2*tmpl.Margin + tmpl.Gap) / (tmpl.LabelWidth + tmpl.Gap))
+	rows := int((tmpl.PageHeight - 2*tmpl.Margin + tmpl.Gap) / (tmpl.LabelHeight + tmpl.Gap))
+	perPage := columns * rows
+
+	doc := infrastructure.NewPDFDocument(tmpl.PageWidth*mm, tmpl.PageHeight*mm)
+	for i, label := range labels {
+		if i%perPage == 0 {
+			doc.AddPage()
+		}
+		col := i % perPage % columns
+		row := i % perPage / columns
+		// PDF は左下が原点なので、ラベルの左上の角を求めてから描くのだ
+		left := (tmpl.Margin + float64(col)*(tmpl.LabelWidth+tmpl.Gap)) * mm
+		top := (tmpl.PageHeight - tmpl.Margin - float64(row)*(tmpl.LabelHeight+tmpl.Gap)) * mm
+		if err := drawLabel(doc, tmpl, label, left, top); err != nil {
+			return nil, err
+		}
+	}
+	return doc.Bytes()
+}
+
+func drawLabel(doc *infrastructure.PDFDocument, tmpl *model.LabelTemplate, label labelContent, left, top float64) error {
+	mm := infrastructure.PDFPointsPerMM
+	width, height := tmpl.LabelWidth*mm, tmpl.LabelHeight*mm
+	padding := labelPadding * mm
+	if tmpl.Border != nil && *tmpl.Border {
+		doc.StrokeRect(left, top-height, width, height, 0.3)
+	}
+
+	textWidth := width - 2*padding
+	if tmpl.QRSize > 0 && label.qrPayload != "" {
+		qrSize := tmpl.QRSize * mm
+		if err := drawQRCode(doc, label.qrPayload, left+width-padding-qrSize, top-padding-qrSize, qrSize); err != nil {
+			return err
+		}
+		textWidth -= qrSize + padding
+	}
+
+	lineHeight := tmpl.FontSize * labelLineSpacing
+	y := top - padding - tmpl.FontSize
+	bottom := top - height + padding
+	for _, text := range label.lines {
+		for _, line := range wrapLabelText(text, tmpl.FontSize, textWidth) {
+			if y < bottom {
+				return nil // 入りきらない行は切り捨てるのだ
+			}
+			doc.Text(left+padding, y, tmpl.FontSize, line)
+			y -= lineHeight
+		}
+	}
+	return nil
+}
+
+// drawQRCode は (x, y) を左下の角として size 四方に QR コードを描くのだ
+// size には周りの余白 (qrQuietZone) も含めるので、枠や文字がくっついても読み取れるのだ
+// 黒いモジュールは横に続くものをまとめて1つの四角にするのだ
+func drawQRCode(doc *infrastructure.PDFDocument, payload string, x, y, size float64) error {
+	qr, err := infrastructure.EncodeQR([]byte(payload), infrastructure.QRLevelM)
+	if err != nil {
+		return err
+	}
+	module := size / float64(qr.Size+2*qrQuietZone)
+	x += qrQuietZone * module
+	y += qrQuietZone * module
+	size -= 2 * qrQuietZone * module
+	for row := 0; row < qr.Size; row++ {
+		for col := 0; col < qr.Size; {
+			if !qr.Dark(col, row) {
+				col++
+				continue
+			}
+			start := col
+			for col < qr.Size && qr.Dark(col, row) {
+				col++
+			}
+			doc.FillRect(x+float64(start)*module, y+size-float64(row+1)*module, float64(col-start)*module, module)
+		}
+	}
+	return nil
+}
+
+// occurrenceLocation は occurrence の timezone ("+09:00" のようなずれか "Asia/Tokyo" のような名前) を読むのだ
+// 読めないときは UTC にするのだ
+func occurrenceLocation(tz string) *time.Location {
+	tz = strings.TrimSpace(tz)
+	if tz == "" || tz == "Z" {
+		return time.UTC
+	}
+	if t, err := time.Parse("-07:00", tz); err == nil {
+		_, offset := t.Zone()
+		return time.FixedZone(tz, offset)
+	}
+	if loc, err := time.LoadLocation(tz); err == nil && tz != "Local" {
+		return loc
+	}
+	return time.UTC
+}
+
+// wrapLabelText は幅 maxWidth に収まるように行を分けるのだ
+// 空白で区切れればそこで、区切れなければ (日本語など) 文字の途中で折り返すのだ
+func wrapLabelText(text string, size, maxWidth float64) []string {
+	var lines []string
+	var line []rune
+	lastSpace := -1
+	for _, r := range text {
+		line = append(line, r)
+		if r == ' ' {
+			lastSpace = len(line) - 1
+		}
+		if infrastructure.PDFTextWidth(string(line), size) <= maxWidth || len(line) == 1 {
+			continue
+		}
+		if lastSpace > 0 {
+			lines = append(lines, strings.TrimSpace(string(line[:lastSpace])))
+			line = append([]rune{}, line[lastSpace+1:]...)
+		} else {
+			lines = append(lines, string(line[:len(line)-1]))
+			line = []rune{r}
+		}
+		lastSpace = -1
+		for i, c := range line {
+			if c == ' ' {
+				lastSpace = i
+			}
+		}
+	}
+	if len(line) > 0 {
+		lines = append(lines, strings.TrimSpace(string(line)))
+	}
+	return lines
+}
@@ -0,0 +1,361 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/saku-730/web-occurrence/backend/internal/entity"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/repository"
+	"gorm.io/gorm"
+)
+
+var ErrLoanNotFound = errors.New("貸し出しが見つかりません")
+var ErrInvalidLoan = errors.New("貸し出しの内容が正しくありません")
+var ErrSpecimenAlreadyOnLoan = errors.New("貸し出し中の標本が含まれています")
+
+const (
+	LoanStatusOpen     = "open"
+	LoanStatusReturned = "returned"
+	LoanStatusOverdue  = "overdue"
+
+	defaultLoanLimit = 50
+	maxLoanLimit     = 500
+	// loanDateLayout は貸し出しの日付 (date 型) の書式なのだ
+	loanDateLayout = "2006-01-02"
+)
+
+type LoanService interface {
+	List(userID string, workstationID int64, q *model.LoanSearchQuery) ([]model.LoanView, error)
+	// Overdue は期限を過ぎても返却されていない貸し出しを、期限の古い順に返すのだ
+	Overdue(userID string, workstationID int64) ([]model.LoanView, error)
+	Get(userID string, workstationID int64, loanID string) (*model.LoanView, error)
+	Create(userID string, workstationID int64, req *model.LoanRequest) (*model.LoanView, error)
+	Update(userID string, workstationID int64, loanID string, req *model.LoanUpdateRequest) (*model.LoanView, error)
+	Return(userID string, workstationID int64, loanID string, req *model.LoanReturnRequest) (*model.LoanView, error)
+}
+
+type loanService struct {
+	loanRepo     repository.LoanRepository
+	specimenRepo repository.SpecimenRepository
+	storageRepo  repository.StorageRepository
+	wsRepo       repository.WorkstationRepository
+}
+
+func NewLoanService(loanRepo repository.LoanRepository, specimenRepo repository.SpecimenRepository, storageRepo repository.StorageRepository, wsRepo repository.WorkstationRepository) LoanService {
+	return &loanService{
+		loanRepo:     loanRepo,
+		specimenRepo: specimenRepo,
+		storageRepo:  storageRepo,
+		wsRepo:       wsRepo,
+	}
+}
+
+func (s *loanService) List(userIDStr string, workstationID int64, q *model.LoanSearchQuery) ([]model.LoanView, error) {
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	if q.Limit <= 0 {
+		q.Limit = defaultLoanLimit
+	}
+	if q.Limit > maxLoanLimit {
+		q.Limit = maxLoanLimit
+	}
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+	q.Borrower = strings.TrimSpace(q.Borrower)
+
+	today := loanDate(time.Now())
+	list, err := s.loanRepo.List(workstationID, q, today.Format(loanDateLayout))
+	if err != nil {
+		return nil, err
+	}
+	return s.views(list, today)
+}
+
+func (s *loanService) Overdue(userIDStr string, workstationID int64) ([]model.LoanView, error) {
+	return s.List(userIDStr, workstationID, &model.LoanSearchQuery{Status: LoanStatusOverdue, Limit: maxLoanLimit})
+}
+
+func (s *loanService) Get(userIDStr string, workstationID int64, loanID string) (*model.LoanView, error) {
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	loan, err := s.findLoan(workstationID, loanID)
+	if err != nil {
+		return nil, err
+	}
+	return s.view(loan)
+}
+
+// Create は標本を貸し出して、標本ごとに移動の履歴 (loan_out) を残すのだ
+func (s *loanService) Create(userIDStr string, workstationID int64, req *model.LoanRequest) (*model.LoanView, error) {
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+
+	loan := &entity.SpecimenLoan{
+		WorkstationID: workstationID,
+		LoanedAt:      loanDate(time.Now()),
+		CreatedBy:     userID,
+	}
+	if req.LoanedAt != nil {
+		loan.LoanedAt = loanDate(*req.LoanedAt)
+	}
+	if err := applyLoan(loan, req.BorrowerName, req.BorrowerInstitution, req.BorrowerEmail, req.Purpose, req.DueDate, req.Note); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	seen := make(map[string]bool, len(req.SpecimenIDs))
+	var items []entity.SpecimenLoanItem
+	var movements []entity.SpecimenMovement
+	for _, id := range req.SpecimenIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		sp, err := findWorkstationSpecimen(s.specimenRepo, workstationID, id)
+		if err != nil {
+			if errors.Is(err, ErrSpecimenNotFound) {
+				return nil, fmt.Errorf("%w: 標本が見つかりません: %s", ErrInvalidLoan, id)
+			}
+			return nil, err
+		}
+		items = append(items, entity.SpecimenLoanItem{SpecimenID: sp.SpecimenID})
+		movements = append(movements, entity.SpecimenMovement{
+			SpecimenID:     sp.SpecimenID,
+			WorkstationID:  workstationID,
+			Kind:           movementLoanOut,
+			FromLocationID: sp.StorageLocationID,
+			Note:           req.Note,
+			MovedBy:        userID,
+			MovedAt:        now,
+		})
+	}
+
+	if err := s.loanRepo.Create(loan, items, movements); err != nil {
+		if errors.Is(err, repository.ErrSpecimenOnLoan) {
+			return nil, ErrSpecimenAlreadyOnLoan
+		}
+		return nil, err
+	}
+	return s.view(loan)
+}
+
+func (s *loanService) Update(userIDStr string, workstationID int64, loanID string, req *model.LoanUpdateRequest) (*model.LoanView, error) {
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	loan, err := s.findLoan(workstationID, loanID)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyLoan(loan, req.BorrowerName, req.BorrowerInstitution, req.BorrowerEmail, req.Purpose, req.DueDate, req.Note); err != nil {
+		return nil, err
+	}
+	if err := s.loanRepo.Update(loan); err != nil {
+		return nil, err
+	}
+	return s.view(loan)
+}
+
+// Return は標本を返却して、標本ごとに移動の履歴 (loan_return) を残すのだ
+// 一部だけ返却することもできて、すべて返却されると貸し出しが returned になるのだ
+func (s *loanService) Return(userIDStr string, workstationID int64, loanID string, req *model.LoanReturnRequest) (*model.LoanView, error) {
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	loan, err := s.findLoan(workstationID, loanID)
+	if err != nil {
+		return nil, err
+	}
+	if loan.ReturnedAt != nil {
+		return nil, fmt.Errorf("%w: 既に返却されています", ErrInvalidLoan)
+	}
+
+	var locationID *string
+	if req.LocationID != nil && *req.LocationID != "" {
+		loc, err := s.storageRepo.FindLocation(*req.LocationID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		if err != nil || loc.WorkstationID != workstationID {
+			return nil, fmt.Errorf("%w: 返却先の保管場所が見つかりません", ErrInvalidLoan)
+		}
+		locationID = &loc.LocationID
+	}
+
+	rows, err := s.loanRepo.ListItems([]string{loan.LoanID})
+	if err != nil {
+		return nil, err
+	}
+	open := make(map[string]bool, len(rows))
+	var targets []string
+	for _, row := range rows {
+		if row.ReturnedAt == nil {
+			open[row.SpecimenID] = true
+			if len(req.SpecimenIDs) == 0 {
+				targets = append(targets, row.SpecimenID)
+			}
+		}
+	}
+	seen := make(map[string]bool, len(req.SpecimenIDs))
+	for _, id := range req.SpecimenIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if !open[id] {
+			return nil, fmt.Errorf("%w: 貸し出し中の標本ではありません: %s", ErrInvalidLoan, id)
+		}
+		targets = append(targets, id)
+	}
+
+	returnedAt := time.Now()
+	if req.ReturnedAt != nil {
+		returnedAt = *req.ReturnedAt
+	}
+	movements := make([]entity.SpecimenMovement, 0, len(targets))
+	for _, id := range targets {
+		sp, err := findWorkstationSpecimen(s.specimenRepo, workstationID, id)
+		if err != nil {
+			return nil, err
+		}
+		// 返却先を指定しないときは元の保管場所に戻すのだ
+		to := sp.StorageLocationID
+		if locationID != nil {
+			to = locationID
+		}
+		movements = append(movements, entity.SpecimenMovement{
+			SpecimenID:    sp.SpecimenID,
+			WorkstationID: workstationID,
+			Kind:          movementLoanReturn,
+			ToLocationID:  to,
+			LoanID:        &loan.LoanID,
+			Note:          req.Note,
+			MovedBy:       userID,
+			MovedAt:       returnedAt,
+		})
+	}
+
+	if err := s.loanRepo.Return(loan, targets, returnedAt, locationID, movements); err != nil {
+		return nil, err
+	}
+	return s.view(loan)
+}
+
+func (s *loanService) findLoan(workstationID int64, loanID string) (*entity.SpecimenLoan, error) {
+	loan, err := s.loanRepo.FindByID(loanID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrLoanNotFound
+		}
+		return nil, err
+	}
+	if loan.WorkstationID != workstationID {
+		return nil, ErrLoanNotFound
+	}
+	return loan, nil
+}
+
+// applyLoan は借り手や期限を貸し出しに入れるのだ。期限は貸し出した日より前にできないのだ
+func applyLoan(loan *entity.SpecimenLoan, borrowerName, institution, email, purpose string, dueDate *time.Time, note string) error {
+	name := strings.TrimSpace(borrowerName)
+	if name == "" {
+		return fmt.Errorf("%w: 借り手の名前が空です", ErrInvalidLoan)
+	}
+	var due *time.Time
+	if dueDate != nil {
+		d := loanDate(*dueDate)
+		if d.Before(loan.LoanedAt) {
+			return fmt.Errorf("%w: 返却期限が貸し出した日より前です", ErrInvalidLoan)
+		}
+		due = &d
+	}
+
+	loan.BorrowerName = name
+	loan.BorrowerInstitution = strings.TrimSpace(institution)
+	loan.BorrowerEmail = strings.TrimSpace(email)
+	loan.Purpose = purpose
+	loan.DueDate = due
+	loan.Note = note
+	return nil
+}
+
+func (s *loanService) view(loan *entity.SpecimenLoan) (*model.LoanView, error) {
+	views, err := s.views([]entity.SpecimenLoan{*loan}, loanDate(time.Now()))
+	if err != nil {
+		return nil, err
+	}
+	return &views[0], nil
+}
+
+// views は貸し出しに標本と状態を付けるのだ
+func (s *loanService) views(list []entity.SpecimenLoan, today time.Time) ([]model.LoanView, error) {
+	ids := make([]string, len(list))
+	for i, loan := range list {
+		ids[i] = loan.LoanID
+	}
+	rows, err := s.loanRepo.ListItems(ids)
+	if err != nil {
+		return nil, err
+	}
+	items := make(map[string][]model.LoanItemView, len(list))
+	for _, row := range rows {
+		items[row.LoanID] = append(items[row.LoanID], model.LoanItemView{
+			SpecimenID:    row.SpecimenID,
+			CatalogNumber: row.CatalogNumber,
+			ReturnedAt:    row.ReturnedAt,
+		})
+	}
+
+	views := make([]model.LoanView, 0, len(list))
+	for _, loan := range list {
+		v := model.LoanView{
+			LoanID:              loan.LoanID,
+			WorkstationID:       loan.WorkstationID,
+			BorrowerName:        loan.BorrowerName,
+			BorrowerInstitution: loan.BorrowerInstitution,
+			BorrowerEmail:       loan.BorrowerEmail,
+			Purpose:             loan.Purpose,
+			LoanedAt:            loan.LoanedAt,
+			DueDate:             loan.DueDate,
+			ReturnedAt:          loan.ReturnedAt,
+			Note:                loan.Note,
+			CreatedBy:           loan.CreatedBy,
+			Status:              LoanStatusOpen,
+			Items:               items[loan.LoanID],
+		}
+		if v.Items == nil {
+			v.Items = []model.LoanItemView{}
+		}
+		switch {
+		case loan.ReturnedAt != nil:
+			v.Status = LoanStatusReturned
+		case loan.DueDate != nil && loanDate(*loan.DueDate).Before(today):
+			v.Status = LoanStatusOverdue
+			v.DaysOverdue = int(today.Sub(loanDate(*loan.DueDate)).Hours() / 24)
+		}
+		views = append(views, v)
+	}
+	return views, nil
+}
+
+// loanDate は日時を日付だけにするのだ (date 型の列と同じく UTC の0時にそろえるのだ)
+func loanDate(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"strconv"
 
+	"github.com/saku-730/web-occurrence/backend/internal/entity"
 	"github.com/saku-730/web-occurrence/backend/internal/model"
 	"github.com/saku-730/web-occurrence/backend/internal/repository"
 )
@@ -15,6 +16,7 @@ type MasterDataResponse struct {
 	FileExtensions   []model.FileExtension   `json:"file_extensions"`
 	UserRoles        []model.UserRole        `json:"user_roles"`
 	WorkstationUsers []model.WorkstationUser `json:"workstation_users"`
+	PlaceNames       []entity.PlaceName      `json:"place_names"`
 }
 
 type MasterService interface {
@@ -60,9 +62,13 @@ func (s *masterService) GetMasterData(userIDStr string) (*MasterDataResponse, er
 	
 	// 3. ▼ 修正: ユーザー一覧は、特定した wsID に紐づくものだけを取得するのだ
 	var users []model.WorkstationUser
+	placeNames := []entity.PlaceName{}
 	if wsID != 0 {
 		users, err = s.masterRepo.GetUsersByWorkstationID(wsID)
 		if err != nil { return nil, err }
+
+		placeNames, err = s.masterRepo.GetPlaceNamesByWorkstationID(wsID)
+		if err != nil { return nil, err }
 	} else {
 		// ワークステーションに所属していない場合は空リストにするのだ
 		users = []model.WorkstationUser{}
@@ -75,5 +81,6 @@ func (s *masterService) GetMasterData(userIDStr string) (*MasterDataResponse, er
 		FileExtensions:   fileExts,
 		UserRoles:        roles,
 		WorkstationUsers: users,
+		PlaceNames:       placeNames,
 	}, nil
 }
@@ -0,0 +1,581 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/saku-730/web-occurrence/backend/internal/entity"
+	"github.com/saku-730/web-occurrence/backend/internal/infrastructure"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/repository"
+	"gorm.io/gorm"
+)
+
+var ErrObservationNotFound = errors.New("観察記録が見つかりません")
+var ErrObservationMethodNotFound = errors.New("観察手法が見つかりません")
+var ErrBehaviorTermNotFound = errors.New("行動の語彙が見つかりません")
+var ErrInvalidObservation = errors.New("観察記録の内容が正しくありません")
+var ErrObservationEditDenied = errors.New("変更できるのは作成者かワークステーションの管理者だけです")
+var ErrVocabularyConflict = errors.New("同じ名前の観察手法・行動の語彙が既にあります")
+var ErrVocabularyInUse = errors.New("観察記録で使われているため削除できません")
+
+const (
+	defaultObservationLimit = 50
+	maxObservationLimit     = 500
+)
+
+// ObservationDetail は観察記録と、付けた行動の語彙なのだ
+type ObservationDetail struct {
+	entity.Observation
+	Behaviors []entity.BehaviorTerm `json:"behaviors"`
+}
+
+type ObservationService interface {
+	// 観察手法 (メンバーなら誰でも追加でき、変更は作成者か管理者だけなのだ)
+	ListMethods(userID string, workstationID int64) ([]entity.ObservationMethod, error)
+	CreateMethod(userID string, workstationID int64, req *model.ObservationMethodRequest) (*entity.ObservationMethod, error)
+	UpdateMethod(userID string, workstationID int64, methodID string, req *model.ObservationMethodRequest) (*entity.ObservationMethod, error)
+	DeleteMethod(userID string, workstationID int64, methodID string) error
+
+	// 行動の語彙 (変更は管理者のみなのだ)
+	ListTerms(userID string, workstationID int64) ([]entity.BehaviorTerm, error)
+	CreateTerm(userID string, workstationID int64, req *model.BehaviorTermRequest) (*entity.BehaviorTerm, error)
+	UpdateTerm(userID string, workstationID int64, termID string, req *model.BehaviorTermRequest) (*entity.BehaviorTerm, error)
+	DeleteTerm(userID string, workstationID int64, termID string) error
+
+	// 観察記録
+	Search(userID string, workstationID int64, q *model.ObservationSearchQuery) ([]ObservationDetail, error)
+	List(userID string, occurrenceID string) ([]ObservationDetail, error)
+	Create(userID string, occurrenceID string, req *model.ObservationRequest) (*ObservationDetail, error)
+	Update(userID string, occurrenceID string, observationID string, req *model.ObservationRequest) (*ObservationDetail, error)
+	Delete(userID string, occurrenceID string, observationID string) error
+}
+
+type observationService struct {
+	obsRepo     repository.ObservationRepository
+	wikiRepo    repository.WikiRepository
+	wsRepo      repository.WorkstationRepository
+	couchClient infrastructure.CouchDBClient
+}
+
+func NewObservationService(obsRepo repository.ObservationRepository, wikiRepo repository.WikiRepository, wsRepo repository.WorkstationRepository, couchClient infrastructure.CouchDBClient) ObservationService {
+	return &observationService{
+		obsRepo:     obsRepo,
+		wikiRepo:    wikiRepo,
+		wsRepo:      wsRepo,
+		couchClient: couchClient,
+	}
+}
+
+func (s *observationService) ListMethods(userIDStr string, workstationID int64) ([]entity.ObservationMethod, error) {
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	return s.obsRepo.ListMethods(workstationID)
+}
+
+func (s *observationService) CreateMethod(userIDStr string, workstationID int64, req *model.ObservationMethodRequest) (*entity.ObservationMethod, error) {
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	m := &entity.ObservationMethod{WorkstationID: workstationID, UserID: userID}
+	if err := s.applyObservationMethod(m, req); err != nil {
+		return nil, err
+	}
+	return s.saveMethod(m)
+}
+
+func (s *observationService) UpdateMethod(userIDStr string, workstationID int64, methodID string, req *model.ObservationMethodRequest) (*entity.ObservationMethod, error) {
+	m, err := s.editableMethod(userIDStr, workstationID, methodID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applyObservationMethod(m, req); err != nil {
+		return nil, err
+	}
+	return s.saveMethod(m)
+}
+
+// DeleteMethod は観察記録で使われていない観察手法を削除するのだ
+func (s *observationService) DeleteMethod(userIDStr string, workstationID int64, methodID string) error {
+	m, err := s.editableMethod(userIDStr, workstationID, methodID)
+	if err != nil {
+		return err
+	}
+	count, err := s.obsRepo.CountMethodUse(m.ObservationMethodID)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrVocabularyInUse
+	}
+	if err := s.obsRepo.DeleteMethod(m.ObservationMethodID); err != nil {
+		return err
+	}
+	return s.couchClient.DeleteDocument(s.couchClient.CreateWorkstationDBName(workstationID), m.ObservationMethodID)
+}
+
+func (s *observationService) ListTerms(userIDStr string, workstationID int64) ([]entity.BehaviorTerm, error) {
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	return s.obsRepo.ListTerms(workstationID)
+}
+
+func (s *observationService) CreateTerm(userIDStr string, workstationID int64, req *model.BehaviorTermRequest) (*entity.BehaviorTerm, error) {
+	userID, err := requireWorkstationAdmin(s.wsRepo, userIDStr, workstationID)
+	if err != nil {
+		return nil, err
+	}
+	t := &entity.BehaviorTerm{WorkstationID: workstationID}
+	if err := applyBehaviorTerm(t, req); err != nil {
+		return nil, err
+	}
+	return s.saveTerm(t, userID)
+}
+
+func (s *observationService) UpdateTerm(userIDStr string, workstationID int64, termID string, req *model.BehaviorTermRequest) (*entity.BehaviorTerm, error) {
+	userID, err := requireWorkstationAdmin(s.wsRepo, userIDStr, workstationID)
+	if err != nil {
+		return nil, err
+	}
+	t, err := s.findTerm(workstationID, termID)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyBehaviorTerm(t, req); err != nil {
+		return nil, err
+	}
+	return s.saveTerm(t, userID)
+}
+
+// DeleteTerm は観察記録で使われていない行動の語彙を削除するのだ
+func (s *observationService) DeleteTerm(userIDStr string, workstationID int64, termID string) error {
+	if _, err := requireWorkstationAdmin(s.wsRepo, userIDStr, workstationID); err != nil {
+		return err
+	}
+	t, err := s.findTerm(workstationID, termID)
+	if err != nil {
+		return err
+	}
+	count, err := s.obsRepo.CountTermUse(t.TermID)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrVocabularyInUse
+	}
+	if err := s.obsRepo.DeleteTerm(t.TermID); err != nil {
+		return err
+	}
+	return s.couchClient.DeleteDocument(s.couchClient.CreateWorkstationDBName(workstationID), t.TermID)
+}
+
+func (s *observationService) Search(userIDStr string, workstationID int64, q *model.ObservationSearchQuery) ([]ObservationDetail, error) {
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	if q.Limit <= 0 {
+		q.Limit = defaultObservationLimit
+	}
+	if q.Limit > maxObservationLimit {
+		q.Limit = maxObservationLimit
+	}
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+	list, err := s.obsRepo.List(workstationID, q)
+	if err != nil {
+		return nil, err
+	}
+	return s.details(list)
+}
+
+func (s *observationService) List(userIDStr string, occurrenceID string) ([]ObservationDetail, error) {
+	occ, _, err := s.findOccurrence(userIDStr, occurrenceID)
+	if err != nil {
+		return nil, err
+	}
+	list, err := s.obsRepo.ListByOccurrenceID(occ.OccurrenceID)
+	if err != nil {
+		return nil, err
+	}
+	return s.details(list)
+}
+
+func (s *observationService) Create(userIDStr string, occurrenceID string, req *model.ObservationRequest) (*ObservationDetail, error) {
+	occ, userID, err := s.findOccurrence(userIDStr, occurrenceID)
+	if err != nil {
+		return nil, err
+	}
+	obs := &entity.Observation{
+		OccurrenceID:  occ.OccurrenceID,
+		UserID:        userID,
+		WorkstationID: occ.WorkstationID,
+	}
+	termIDs, err := s.applyObservation(obs, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.obsRepo.Save(obs, termIDs); err != nil {
+		return nil, err
+	}
+	return s.saved(obs)
+}
+
+func (s *observationService) Update(userIDStr string, occurrenceID string, observationID string, req *model.ObservationRequest) (*ObservationDetail, error) {
+	obs, err := s.editableObservation(userIDStr, occurrenceID, observationID)
+	if err != nil {
+		return nil, err
+	}
+	termIDs, err := s.applyObservation(obs, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.obsRepo.Save(obs, termIDs); err != nil {
+		return nil, err
+	}
+	return s.saved(obs)
+}
+
+func (s *observationService) Delete(userIDStr string, occurrenceID string, observationID string) error {
+	obs, err := s.editableObservation(userIDStr, occurrenceID, observationID)
+	if err != nil {
+		return err
+	}
+	if err := s.obsRepo.Delete(obs.ObservationID); err != nil {
+		return err
+	}
+	return s.removeFromCouchDocument(obs)
+}
+
+func (s *observationService) findOccurrence(userIDStr string, occurrenceID string) (*entity.Occurrence, int64, error) {
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		return nil, 0, err
+	}
+	occ, err := s.obsRepo.FindOccurrence(occurrenceID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, 0, ErrOccurrenceNotFound
+		}
+		return nil, 0, err
+	}
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, occ.WorkstationID); err != nil {
+		return nil, 0, err
+	}
+	return occ, userID, nil
+}
+
+func (s *observationService) findMethod(workstationID int64, methodID string) (*entity.ObservationMethod, error) {
+	m, err := s.obsRepo.FindMethod(methodID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrObservationMethodNotFound
+		}
+		return nil, err
+	}
+	if m.WorkstationID != workstationID {
+		return nil, ErrObservationMethodNotFound
+	}
+	return m, nil
+}
+
+func (s *observationService) findTerm(workstationID int64, termID string) (*entity.BehaviorTerm, error) {
+	terms, err := s.obsRepo.FindTerms([]string{termID})
+	if err != nil {
+		return nil, err
+	}
+	if len(terms) == 0 || terms[0].WorkstationID != workstationID {
+		return nil, ErrBehaviorTermNotFound
+	}
+	return &terms[0], nil
+}
+
+// isEditor は作成者本人かワークステーションの管理者かを調べるのだ
+func (s *observationService) isEditor(userIDStr string, workstationID int64, ownerID int64) (bool, error) {
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		return false, err
+	}
+	roles, err := s.wsRepo.GetRoleIDsByUserID(userID)
+	if err != nil {
+		return false, err
+	}
+	role, ok := roles[workstationID]
+	if !ok {
+		return false, ErrWorkstationAccessDenied
+	}
+	return ownerID == userID || role == roleAdministrator, nil
+}
+
+func (s *observationService) editableMethod(userIDStr string, workstationID int64, methodID string) (*entity.ObservationMethod, error) {
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	m, err := s.findMethod(workstationID, methodID)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := s.isEditor(userIDStr, workstationID, m.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrObservationEditDenied
+	}
+	return m, nil
+}
+
+func (s *observationService) editableObservation(userIDStr string, occurrenceID string, observationID string) (*entity.Observation, error) {
+	occ, _, err := s.findOccurrence(userIDStr, occurrenceID)
+	if err != nil {
+		return nil, err
+	}
+	obs, err := s.obsRepo.FindByID(observationID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrObservationNotFound
+		}
+		return nil, err
+	}
+	if obs.OccurrenceID != occ.OccurrenceID {
+		return nil, ErrObservationNotFound
+	}
+	ok, err := s.isEditor(userIDStr, occ.WorkstationID, obs.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrObservationEditDenied
+	}
+	return obs, nil
+}
+
+// applyObservation はリクエストの内容を観察記録に入れて、付ける行動の語彙の ID を返すのだ
+// 観察手法と語彙は occurrence と同じワークステーションのものだけ使えるのだ
+func (s *observationService) applyObservation(obs *entity.Observation, req *model.ObservationRequest) ([]string, error) {
+	var methodID *string
+	if req.ObservationMethodID != nil && strings.TrimSpace(*req.ObservationMethodID) != "" {
+		m, err := s.findMethod(obs.WorkstationID, strings.TrimSpace(*req.ObservationMethodID))
+		if err != nil {
+			if errors.Is(err, ErrObservationMethodNotFound) {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidObservation, err)
+			}
+			return nil, err
+		}
+		methodID = &m.ObservationMethodID
+	}
+
+	termIDs := make([]string, 0, len(req.BehaviorTermIDs))
+	seen := make(map[string]bool, len(req.BehaviorTermIDs))
+	for _, id := range req.BehaviorTermIDs {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		termIDs = append(termIDs, id)
+	}
+	terms, err := s.obsRepo.FindTerms(termIDs)
+	if err != nil {
+		return nil, err
+	}
+	found := 0
+	for _, t := range terms {
+		if t.WorkstationID == obs.WorkstationID {
+			found++
+		}
+	}
+	if found != len(termIDs) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidObservation, ErrBehaviorTermNotFound)
+	}
+
+	obs.ObservationMethodID = methodID
+	obs.Behavior = strings.TrimSpace(req.Behavior)
+	if req.ObservedAt != nil {
+		obs.ObservedAt = *req.ObservedAt
+	} else if obs.ObservedAt.IsZero() {
+		obs.ObservedAt = time.Now()
+	}
+	return termIDs, nil
+}
+
+// applyObservationMethod はリクエストの内容を観察手法に入れるのだ
+// 説明の Wiki のページは同じワークステーションのものだけ使えるのだ
+func (s *observationService) applyObservationMethod(m *entity.ObservationMethod, req *model.ObservationMethodRequest) error {
+	name := strings.TrimSpace(req.MethodCommonName)
+	if name == "" {
+		return fmt.Errorf("%w: 観察手法の名前が空です", ErrInvalidObservation)
+	}
+	var pageID *string
+	if req.PageID != nil && strings.TrimSpace(*req.PageID) != "" {
+		page, err := s.wikiRepo.FindByID(strings.TrimSpace(*req.PageID))
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err != nil || page.WorkstationID != m.WorkstationID {
+			return fmt.Errorf("%w: %v", ErrInvalidObservation, ErrWikiPageNotFound)
+		}
+		pageID = &page.PageID
+	}
+	m.MethodCommonName = name
+	m.Description = req.Description
+	m.PageID = pageID
+	return nil
+}
+
+func applyBehaviorTerm(t *entity.BehaviorTerm, req *model.BehaviorTermRequest) error {
+	term := strings.TrimSpace(req.Term)
+	if term == "" {
+		return fmt.Errorf("%w: 行動の語彙が空です", ErrInvalidObservation)
+	}
+	t.Term = term
+	t.Category = strings.TrimSpace(req.Category)
+	t.Description = req.Description
+	return nil
+}
+
+// saveMethod は観察手法を保存して CouchDB の observation_method ドキュメントにも書き込むのだ
+func (s *observationService) saveMethod(m *entity.ObservationMethod) (*entity.ObservationMethod, error) {
+	if err := s.obsRepo.SaveMethod(m); err != nil {
+		if errors.Is(err, repository.ErrVocabularyNameTaken) {
+			return nil, ErrVocabularyConflict
+		}
+		return nil, err
+	}
+	userID := strconv.FormatInt(m.UserID, 10)
+	doc := map[string]interface{}{
+		"_id":                m.ObservationMethodID,
+		"type":               "observation_method",
+		"workstation_id":     strconv.FormatInt(m.WorkstationID, 10),
+		"created_by_user_id": userID,
+		"user_id":            userID,
+		"method_common_name": m.MethodCommonName,
+		"description":        m.Description,
+		"pageid":             m.PageID,
+	}
+	if err := s.couchClient.UpsertDocument(m.ObservationMethodID, doc); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// saveTerm は行動の語彙を保存して CouchDB の behavior_term ドキュメントにも書き込むのだ
+// 端末はこのドキュメントから選べる語彙を知るのだ
+func (s *observationService) saveTerm(t *entity.BehaviorTerm, userID int64) (*entity.BehaviorTerm, error) {
+	if err := s.obsRepo.SaveTerm(t); err != nil {
+		if errors.Is(err, repository.ErrVocabularyNameTaken) {
+			return nil, ErrVocabularyConflict
+		}
+		return nil, err
+	}
+	doc := map[string]interface{}{
+		"_id":                t.TermID,
+		"type":               "behavior_term",
+		"workstation_id":     strconv.FormatInt(t.WorkstationID, 10),
+		"created_by_user_id": strconv.FormatInt(userID, 10),
+		"term":               t.Term,
+		"category":           t.Category,
+		"description":        t.Description,
+	}
+	if err := s.couchClient.UpsertDocument(t.TermID, doc); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// saved は保存した観察記録を CouchDB の occurrence ドキュメントにも書き込んでから返すのだ
+func (s *observationService) saved(obs *entity.Observation) (*ObservationDetail, error) {
+	details, err := s.details([]entity.Observation{*obs})
+	if err != nil {
+		return nil, err
+	}
+	d := &details[0]
+	if err := s.writeCouchDocument(d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (s *observationService) details(list []entity.Observation) ([]ObservationDetail, error) {
+	ids := make([]string, len(list))
+	for i, obs := range list {
+		ids[i] = obs.ObservationID
+	}
+	rows, err := s.obsRepo.ListBehaviors(ids)
+	if err != nil {
+		return nil, err
+	}
+	byObservation := make(map[string][]entity.BehaviorTerm, len(list))
+	for _, row := range rows {
+		byObservation[row.ObservationID] = append(byObservation[row.ObservationID], row.BehaviorTerm)
+	}
+
+	details := make([]ObservationDetail, 0, len(list))
+	for _, obs := range list {
+		d := ObservationDetail{Observation: obs, Behaviors: byObservation[obs.ObservationID]}
+		if d.Behaviors == nil {
+			d.Behaviors = []entity.BehaviorTerm{}
+		}
+		details = append(details, d)
+	}
+	return details, nil
+}
+
+// writeCouchDocument は CouchDB の occurrence ドキュメントの observations に観察記録を書き込むのだ
+func (s *observationService) writeCouchDocument(d *ObservationDetail) error {
+	termIDs := make([]interface{}, len(d.Behaviors))
+	for i, t := range d.Behaviors {
+		termIDs[i] = t.TermID
+	}
+	return patchOccurrenceDocument(s.couchClient, d.WorkstationID, d.OccurrenceID, func(doc map[string]interface{}) error {
+		items, _ := doc["observations"].([]interface{})
+		item := map[string]interface{}{}
+		index := -1
+		for i, existing := range items {
+			if m, ok := existing.(map[string]interface{}); ok && m["observation_id"] == d.ObservationID {
+				item, index = m, i
+				break
+			}
+		}
+
+		item["observation_id"] = d.ObservationID
+		item["observation_method_id"] = d.ObservationMethodID
+		item["behavior"] = d.Behavior
+		item["behavior_term_ids"] = termIDs
+		item["observed_at"] = d.ObservedAt.Format(time.RFC3339)
+		item["user_id"] = strconv.FormatInt(d.UserID, 10)
+
+		if index >= 0 {
+			items[index] = item
+		} else {
+			items = append(items, item)
+		}
+		doc["observations"] = items
+		return nil
+	})
+}
+
+// removeFromCouchDocument は CouchDB の occurrence ドキュメントの observations から観察記録を外すのだ
+func (s *observationService) removeFromCouchDocument(obs *entity.Observation) error {
+	return patchOccurrenceDocument(s.couchClient, obs.WorkstationID, obs.OccurrenceID, func(doc map[string]interface{}) error {
+		items, _ := doc["observations"].([]interface{})
+		kept := make([]interface{}, 0, len(items))
+		for _, item := range items {
+			if m, ok := item.(map[string]interface{}); ok && m["observation_id"] == obs.ObservationID {
+				continue
+			}
+			kept = append(kept, item)
+		}
+		doc["observations"] = kept
+		return nil
+	})
+}
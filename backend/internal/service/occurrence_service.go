@@ -0,0 +1,431 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/saku-730/web-occurrence/backend/internal/infrastructure"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/repository"
+)
+
+var ErrWorkstationAccessDenied = errors.New("このワークステーションへのアクセス権がありません")
+var ErrInvalidSearchQuery = errors.New("検索条件が正しくありません")
+
+const (
+	defaultSearchPerPage = 50
+	maxSearchPerPage     = 500
+)
+
+type OccurrenceService interface {
+	Search(userID string, q *model.OccurrenceSearchQuery) (*model.OccurrenceSearchResponse, error)
+	AggregateByMesh(userID string, req *model.MeshAggregateRequest) (*model.MeshAggregateResponse, error)
+	RollupByTaxon(userID string, req *model.TaxonRollupRequest) (*model.TaxonRollupResponse, error)
+}
+
+type occurrenceService struct {
+	occRepo repository.OccurrenceRepository
+	wsRepo  repository.WorkstationRepository
+}
+
+func NewOccurrenceService(occRepo repository.OccurrenceRepository, wsRepo repository.WorkstationRepository) OccurrenceService {
+	return &occurrenceService{
+		occRepo: occRepo,
+		wsRepo:  wsRepo,
+	}
+}
+
+// Search はユーザーが所属するワークステーションの中だけを検索するのだ
+func (s *occurrenceService) Search(userIDStr string, q *model.OccurrenceSearchQuery) (*model.OccurrenceSearchResponse, error) {
+	wsIDs, err := resolveWorkstationIDs(s.wsRepo, userIDStr, q.WorkstationID)
+	if err != nil {
+		return nil, err
+	}
+	if err := applySpatialParams(q); err != nil {
+		return nil, err
+	}
+	access, err := loadCoordinateAccess(s.wsRepo, userIDStr)
+	if err != nil {
+		return nil, err
+	}
+	access.restrict(q)
+
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	if q.PerPage < 1 {
+		q.PerPage = defaultSearchPerPage
+	}
+	if q.PerPage > maxSearchPerPage {
+		q.PerPage = maxSearchPerPage
+	}
+
+	results, total, err := s.occRepo.Search(wsIDs, q, q.PerPage, (q.Page-1)*q.PerPage)
+	if err != nil {
+		return nil, err
+	}
+	if results == nil {
+		results = []model.OccurrenceSearchRow{}
+	}
+	for i := range results {
+		access.generalize(&results[i])
+	}
+
+	return &model.OccurrenceSearchResponse{
+		Total:   total,
+		Page:    q.Page,
+		PerPage: q.PerPage,
+		Results: results,
+	}, nil
+}
+
+// AggregateByMesh は地域メッシュごとに種ごとの件数を数えるのだ（分布図用）
+func (s *occurrenceService) AggregateByMesh(userIDStr string, req *model.MeshAggregateRequest) (*model.MeshAggregateResponse, error) {
+	level := req.Level
+	if level == "" {
+		level = "3"
+	}
+	meshLength, ok := infrastructure.JISMeshLevels[level]
+	if !ok {
+		return nil, fmt.Errorf("%w: level は 1 / 2 / 3 / half / quarter のいずれかです", ErrInvalidSearchQuery)
+	}
+
+	wsIDs, err := resolveWorkstationIDs(s.wsRepo, userIDStr, req.WorkstationID)
+	if err != nil {
+		return nil, err
+	}
+	q := req.OccurrenceSearchQuery
+	if err := applySpatialParams(&q); err != nil {
+		return nil, err
+	}
+	access, err := loadCoordinateAccess(s.wsRepo, userIDStr)
+	if err != nil {
+		return nil, err
+	}
+	access.restrict(&q)
+
+	counts, err := s.occRepo.CountByMesh(wsIDs, &q, meshLength)
+	if err != nil {
+		return nil, err
+	}
+
+	// 同じ分類名でも jsonb の中身が少し違うと別の行になるので、ここで名前ごとにまとめ直すのだ
+	res := &model.MeshAggregateResponse{Level: level, Meshes: []model.MeshAggregate{}}
+	index := map[string]int{}
+	// species_count は種まで同定された名前だけを数えるのだ (属までのレコードは種数に入れないのだ)
+	species := map[int]map[string]bool{}
+	for _, c := range counts {
+		// 一般化対象のレコードは、許された粗さのメッシュに入れるのだ (指定より粗いコードになることがあるのだ)
+		code := c.MeshCode
+		length := access.meshLength(c.WorkstationID, c.Sensitivity, len(code))
+		if length == 0 {
+			continue
+		}
+		code = code[:length]
+
+		i, ok := index[code]
+		if !ok {
+			bounds, err := infrastructure.JISMeshBounds(code)
+			if err != nil {
+				continue
+			}
+			res.Meshes = append(res.Meshes, model.MeshAggregate{MeshCode: code, Bounds: bounds})
+			i = len(res.Meshes) - 1
+			index[code] = i
+		}
+		mesh := &res.Meshes[i]
+		mesh.OccurrenceCount += c.Count
+
+		taxa := decodeClassification(c.ClassClassification)
+		taxon := taxonLabel(taxa)
+		if strings.TrimSpace(taxa["species"]) != "" {
+			if species[i] == nil {
+				species[i] = map[string]bool{}
+			}
+			species[i][strings.ToLower(taxon)] = true
+		}
+		merged := false
+		for j := range mesh.Taxa {
+			if mesh.Taxa[j].Taxon == taxon {
+				mesh.Taxa[j].Count += c.Count
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			mesh.Taxa = append(mesh.Taxa, model.TaxonCount{Taxon: taxon, Count: c.Count})
+		}
+	}
+
+	for i := range res.Meshes {
+		mesh := &res.Meshes[i]
+		sort.Slice(mesh.Taxa, func(a, b int) bool { return mesh.Taxa[a].Count > mesh.Taxa[b].Count })
+		mesh.SpeciesCount = len(species[i])
+	}
+	return res, nil
+}
+
+// RollupByTaxon は絞り込んだ分類の1つ下の階級ごとに件数を数えるのだ
+// 例えば family=Carabidae なら属ごとの件数と種数を返すのだ
+func (s *occurrenceService) RollupByTaxon(userIDStr string, req *model.TaxonRollupRequest) (*model.TaxonRollupResponse, error) {
+	q := req.OccurrenceSearchQuery
+	filters := map[string]string{
+		"kingdom": q.Kingdom, "phylum": q.Phylum, "class": q.Class, "order": q.Order,
+		"family": q.Family, "genus": q.Genus, "species": q.Species,
+	}
+	parentIndex := -1
+	for i, rank := range model.ClassificationRanks {
+		if filters[rank] != "" {
+			parentIndex = i
+		}
+	}
+
+	res := &model.TaxonRollupResponse{Children: []model.TaxonRollupChild{}}
+	if parentIndex >= 0 {
+		res.ParentRank = model.ClassificationRanks[parentIndex]
+		res.Parent = filters[res.ParentRank]
+	}
+
+	rankIndex := parentIndex + 1
+	if req.Rank != "" {
+		rankIndex = -1
+		for i, rank := range model.ClassificationRanks {
+			if rank == strings.ToLower(req.Rank) {
+				rankIndex = i
+			}
+		}
+		if rankIndex < 0 {
+			return nil, fmt.Errorf("%w: rank は %s のいずれかです", ErrInvalidSearchQuery, strings.Join(model.ClassificationRanks, " / "))
+		}
+	}
+	if rankIndex <= parentIndex || rankIndex >= len(model.ClassificationRanks) {
+		return nil, fmt.Errorf("%w: %s より下の階級で集計してください", ErrInvalidSearchQuery, res.ParentRank)
+	}
+	res.Rank = model.ClassificationRanks[rankIndex]
+
+	wsIDs, err := resolveWorkstationIDs(s.wsRepo, userIDStr, q.WorkstationID)
+	if err != nil {
+		return nil, err
+	}
+	if err := applySpatialParams(&q); err != nil {
+		return nil, err
+	}
+	access, err := loadCoordinateAccess(s.wsRepo, userIDStr)
+	if err != nil {
+		return nil, err
+	}
+	access.restrict(&q)
+
+	rows, err := s.occRepo.RollupByRank(wsIDs, &q, res.Rank)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		res.Total += row.Count
+		if row.NameKey == nil || row.Name == nil || row.NameRank == nil {
+			res.Unidentified += row.Count
+			continue
+		}
+		res.Children = append(res.Children, model.TaxonRollupChild{Name: *row.Name, Rank: *row.NameRank, Count: row.Count, SpeciesCount: row.SpeciesCount})
+	}
+	return res, nil
+}
+
+// resolveWorkstationIDs は検索対象のワークステーションIDを決めるのだ
+// workstationID が指定されていれば所属チェックをして、なければ所属する全WSを対象にするのだ
+func resolveWorkstationIDs(wsRepo repository.WorkstationRepository, userIDStr string, workstationID int64) ([]int64, error) {
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	if workstationID != 0 {
+		ok, err := wsRepo.IsUserInWorkstation(userID, workstationID)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrWorkstationAccessDenied
+		}
+		return []int64{workstationID}, nil
+	}
+
+	workstations, err := wsRepo.GetWorkstationsByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(workstations) == 0 {
+		return nil, ErrWorkstationAccessDenied
+	}
+
+	ids := make([]int64, 0, len(workstations))
+	for _, ws := range workstations {
+		ids = append(ids, ws.WorkstationID)
+	}
+	return ids, nil
+}
+
+// applySpatialParams はクエリ文字列の空間検索パラメータを検証して、フィルター用の値に変換するのだ
+func applySpatialParams(q *model.OccurrenceSearchQuery) error {
+	if q.BBoxText != "" {
+		bbox, err := parseBBox(q.BBoxText)
+		if err != nil {
+			return err
+		}
+		q.BBox = bbox
+	}
+
+	if q.Latitude != nil || q.Longitude != nil || q.Radius != 0 {
+		if q.Latitude == nil || q.Longitude == nil || q.Radius <= 0 {
+			return fmt.Errorf("%w: 半径検索には lat, lon, radius(m) がすべて必要です", ErrInvalidSearchQuery)
+		}
+		if *q.Latitude < -90 || *q.Latitude > 90 || *q.Longitude < -180 || *q.Longitude > 180 {
+			return fmt.Errorf("%w: lat / lon が範囲外です", ErrInvalidSearchQuery)
+		}
+		q.Circle = &model.RadiusFilter{Latitude: *q.Latitude, Longitude: *q.Longitude, Meters: q.Radius}
+	}
+
+	if q.MeshCode != "" {
+		if _, err := infrastructure.JISMeshBounds(q.MeshCode); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidSearchQuery, err)
+		}
+	}
+
+	if q.Polygon != "" {
+		geometry, err := normalizePolygon(q.Polygon)
+		if err != nil {
+			return err
+		}
+		q.Polygon = geometry
+	}
+	return nil
+}
+
+// normalizePolygon は GeoJSON の Polygon / MultiPolygon (Feature に包まれていてもいい) を
+// PostGIS の ST_GeomFromGeoJSON に渡せるジオメトリだけの JSON にするのだ
+func normalizePolygon(text string) (string, error) {
+	var obj struct {
+		Type        string          `json:"type"`
+		Geometry    json.RawMessage `json:"geometry"`
+		Coordinates json.RawMessage `json:"coordinates"`
+	}
+	if err := json.Unmarshal([]byte(text), &obj); err != nil {
+		return "", fmt.Errorf("%w: polygon が GeoJSON として読めません", ErrInvalidSearchQuery)
+	}
+	if obj.Type == "Feature" {
+		return normalizePolygon(string(obj.Geometry))
+	}
+	if obj.Type != "Polygon" && obj.Type != "MultiPolygon" {
+		return "", fmt.Errorf("%w: polygon は Polygon か MultiPolygon で指定してください", ErrInvalidSearchQuery)
+	}
+
+	var coords interface{}
+	if err := json.Unmarshal(obj.Coordinates, &coords); err != nil || coords == nil {
+		return "", fmt.Errorf("%w: polygon の coordinates が正しくありません", ErrInvalidSearchQuery)
+	}
+	geometry, err := json.Marshal(map[string]interface{}{"type": obj.Type, "coordinates": coords})
+	if err != nil {
+		return "", err
+	}
+	return string(geometry), nil
+}
+
+// parseBBox は "minLon,minLat,maxLon,maxLat" 形式の文字列をパースするのだ
+// OGC API の bbox と同じく、高さ付きの6値 (minLon,minLat,minZ,maxLon,maxLat,maxZ) も受け付けるのだ
+func parseBBox(text string) (*model.BBox, error) {
+	parts := strings.Split(text, ",")
+	values := make([]float64, len(parts))
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bbox の値が数値ではありません", ErrInvalidSearchQuery)
+		}
+		values[i] = v
+	}
+
+	var bbox model.BBox
+	switch len(values) {
+	case 4:
+		bbox = model.BBox{MinLon: values[0], MinLat: values[1], MaxLon: values[2], MaxLat: values[3]}
+	case 6:
+		bbox = model.BBox{MinLon: values[0], MinLat: values[1], MaxLon: values[3], MaxLat: values[4]}
+	default:
+		return nil, fmt.Errorf("%w: bbox は4つか6つの数値で指定してください", ErrInvalidSearchQuery)
+	}
+	if bbox.MinLat > bbox.MaxLat || bbox.MinLon > bbox.MaxLon {
+		return nil, fmt.Errorf("%w: bbox の最小値が最大値より大きいです", ErrInvalidSearchQuery)
+	}
+	return &bbox, nil
+}
+
+// decodeClassification は class_classification (jsonb) を rank -> 名前 のマップにするのだ
+func decodeClassification(raw string) map[string]string {
+	result := map[string]string{}
+	if raw == "" {
+		return result
+	}
+
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &values); err != nil {
+		return result
+	}
+	for rank, v := range values {
+		if str, ok := v.(string); ok {
+			result[rank] = str
+		}
+	}
+	return result
+}
+
+// taxonLabel は分類情報からいちばん細かい階級の名前を作るのだ
+// species に種小名だけが入っている場合は genus と組み合わせて学名にするのだ
+func taxonLabel(taxa map[string]string) string {
+	species := strings.TrimSpace(taxa["species"])
+	genus := strings.TrimSpace(taxa["genus"])
+	if species != "" {
+		if genus != "" && !strings.Contains(species, " ") {
+			return genus + " " + species
+		}
+		return species
+	}
+	for _, rank := range []string{"genus", "family", "order", "class", "phylum", "kingdom"} {
+		if name := strings.TrimSpace(taxa[rank]); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// decodeCoordinates は places.coordinates (jsonb) から緯度経度を取り出すのだ
+// フロントエンドが保存する GeoJSON Point ({"type":"Point","coordinates":[lon,lat]}) と
+// {"latitude":..,"longitude":..} 形式の両方に対応するのだ
+func decodeCoordinates(raw string) (lat float64, lon float64, ok bool) {
+	if raw == "" || raw == "null" {
+		return 0, 0, false
+	}
+
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &values); err != nil {
+		return 0, 0, false
+	}
+
+	if coords, isArray := values["coordinates"].([]interface{}); isArray && len(coords) >= 2 {
+		lonVal, okLon := coords[0].(float64)
+		latVal, okLat := coords[1].(float64)
+		if okLon && okLat {
+			return latVal, lonVal, true
+		}
+	}
+
+	latVal, okLat := values["latitude"].(float64)
+	lonVal, okLon := values["longitude"].(float64)
+	if okLat && okLon {
+		return latVal, lonVal, true
+	}
+
+	return 0, 0, false
+}
@@ -0,0 +1,299 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/repository"
+)
+
+var ErrOGCNotFound = errors.New("コレクションまたは地物が見つかりません")
+
+const (
+	ogcDefaultLimit = 10
+	ogcMaxLimit     = 10000
+	ogcCRS84        = "http://www.opengis.net/def/crs/OGC/1.3/CRS84"
+	ogcGeoJSONType  = "application/geo+json"
+	ogcJSONType     = "application/json"
+)
+
+// ogcConformanceClasses は実装している適合クラスなのだ
+var ogcConformanceClasses = []string{
+	"http://www.opengis.net/spec/ogcapi-features-1/1.0/conf/core",
+	"http://www.opengis.net/spec/ogcapi-features-1/1.0/conf/geojson",
+}
+
+// OGCFeatureService は OGC API - Features として occurrence を公開するのだ
+// ワークステーションごとに1つのコレクション (ws_{id}) を見せるのだ
+type OGCFeatureService interface {
+	LandingPage(baseURL string) *model.OGCLandingPage
+	Conformance() *model.OGCConformance
+	Collections(userID string, baseURL string) (*model.OGCCollections, error)
+	Collection(userID string, collectionID string, baseURL string) (*model.OGCCollection, error)
+	Items(userID string, collectionID string, req *model.OGCItemsRequest, baseURL string, query url.Values) (*model.OGCFeatureCollection, error)
+	Item(userID string, collectionID string, featureID string, baseURL string) (*model.OGCFeature, error)
+}
+
+type ogcFeatureService struct {
+	occRepo repository.OccurrenceRepository
+	wsRepo  repository.WorkstationRepository
+}
+
+func NewOGCFeatureService(occRepo repository.OccurrenceRepository, wsRepo repository.WorkstationRepository) OGCFeatureService {
+	return &ogcFeatureService{
+		occRepo: occRepo,
+		wsRepo:  wsRepo,
+	}
+}
+
+func (s *ogcFeatureService) LandingPage(baseURL string) *model.OGCLandingPage {
+	return &model.OGCLandingPage{
+		Title:       "web-occurrence",
+		Description: "Occurrence records of each workstation as OGC API - Features",
+		Links: []model.OGCLink{
+			{Href: baseURL, Rel: "self", Type: ogcJSONType, Title: "This document"},
+			{Href: baseURL + "/conformance", Rel: "conformance", Type: ogcJSONType, Title: "Conformance classes"},
+			{Href: baseURL + "/collections", Rel: "data", Type: ogcJSONType, Title: "Collections"},
+		},
+	}
+}
+
+func (s *ogcFeatureService) Conformance() *model.OGCConformance {
+	return &model.OGCConformance{ConformsTo: ogcConformanceClasses}
+}
+
+func (s *ogcFeatureService) Collections(userIDStr string, baseURL string) (*model.OGCCollections, error) {
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	workstations, err := s.wsRepo.GetWorkstationsByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &model.OGCCollections{
+		Collections: make([]model.OGCCollection, 0, len(workstations)),
+		Links: []model.OGCLink{
+			{Href: baseURL + "/collections", Rel: "self", Type: ogcJSONType},
+		},
+	}
+	for _, ws := range workstations {
+		res.Collections = append(res.Collections, newOGCCollection(ws.WorkstationID, ws.WorkstationName, baseURL))
+	}
+	return res, nil
+}
+
+func (s *ogcFeatureService) Collection(userIDStr string, collectionID string, baseURL string) (*model.OGCCollection, error) {
+	wsID, err := s.checkCollection(userIDStr, collectionID)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, _ := strconv.ParseInt(userIDStr, 10, 64)
+	workstations, err := s.wsRepo.GetWorkstationsByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, ws := range workstations {
+		if ws.WorkstationID == wsID {
+			col := newOGCCollection(ws.WorkstationID, ws.WorkstationName, baseURL)
+			return &col, nil
+		}
+	}
+	return nil, ErrOGCNotFound
+}
+
+func (s *ogcFeatureService) Items(userIDStr string, collectionID string, req *model.OGCItemsRequest, baseURL string, query url.Values) (*model.OGCFeatureCollection, error) {
+	wsID, err := s.checkCollection(userIDStr, collectionID)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = ogcDefaultLimit
+	}
+	if limit > ogcMaxLimit {
+		limit = ogcMaxLimit
+	}
+	offset := req.Offset
+	if offset < 0 {
+		offset = 0
+	}
+
+	q := req.OccurrenceSearchQuery
+	q.WorkstationID = wsID
+	if err := applySpatialParams(&q); err != nil {
+		return nil, err
+	}
+	access, err := loadCoordinateAccess(s.wsRepo, userIDStr)
+	if err != nil {
+		return nil, err
+	}
+	access.restrict(&q)
+	if req.Datetime != "" {
+		start, end, err := parseOGCDatetime(req.Datetime)
+		if err != nil {
+			return nil, err
+		}
+		q.CreatedStart = start
+		q.CreatedEnd = end
+	}
+
+	rows, total, err := s.occRepo.Search([]int64{wsID}, &q, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	itemsURL := fmt.Sprintf("%s/collections/%s/items", baseURL, collectionID)
+	fc := &model.OGCFeatureCollection{
+		Type:          "FeatureCollection",
+		Features:      make([]model.OGCFeature, 0, len(rows)),
+		TimeStamp:     time.Now().UTC().Format(time.RFC3339),
+		NumberMatched: total,
+		Links: []model.OGCLink{
+			{Href: ogcPageURL(itemsURL, query, limit, offset), Rel: "self", Type: ogcGeoJSONType},
+			{Href: fmt.Sprintf("%s/collections/%s", baseURL, collectionID), Rel: "collection", Type: ogcJSONType},
+		},
+	}
+	for i := range rows {
+		fc.Features = append(fc.Features, newOGCFeature(&rows[i], nil))
+	}
+	fc.NumberReturned = len(fc.Features)
+
+	if int64(offset+limit) < total {
+		fc.Links = append(fc.Links, model.OGCLink{Href: ogcPageURL(itemsURL, query, limit, offset+limit), Rel: "next", Type: ogcGeoJSONType})
+	}
+	if offset > 0 {
+		prev := offset - limit
+		if prev < 0 {
+			prev = 0
+		}
+		fc.Links = append(fc.Links, model.OGCLink{Href: ogcPageURL(itemsURL, query, limit, prev), Rel: "prev", Type: ogcGeoJSONType})
+	}
+	return fc, nil
+}
+
+func (s *ogcFeatureService) Item(userIDStr string, collectionID string, featureID string, baseURL string) (*model.OGCFeature, error) {
+	wsID, err := s.checkCollection(userIDStr, collectionID)
+	if err != nil {
+		return nil, err
+	}
+
+	q := model.OccurrenceSearchQuery{WorkstationID: wsID, OccurrenceID: featureID}
+	rows, _, err := s.occRepo.Search([]int64{wsID}, &q, 1, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, ErrOGCNotFound
+	}
+
+	collectionURL := fmt.Sprintf("%s/collections/%s", baseURL, collectionID)
+	feature := newOGCFeature(&rows[0], []model.OGCLink{
+		{Href: collectionURL + "/items/" + url.PathEscape(featureID), Rel: "self", Type: ogcGeoJSONType},
+		{Href: collectionURL, Rel: "collection", Type: ogcJSONType},
+	})
+	return &feature, nil
+}
+
+// checkCollection はコレクションID (ws_{id}) をワークステーションIDにして、所属チェックもするのだ
+func (s *ogcFeatureService) checkCollection(userIDStr string, collectionID string) (int64, error) {
+	wsID, err := strconv.ParseInt(strings.TrimPrefix(collectionID, "ws_"), 10, 64)
+	if err != nil || !strings.HasPrefix(collectionID, "ws_") {
+		return 0, ErrOGCNotFound
+	}
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, wsID); err != nil {
+		return 0, err
+	}
+	return wsID, nil
+}
+
+func newOGCCollection(wsID int64, name string, baseURL string) model.OGCCollection {
+	id := fmt.Sprintf("ws_%d", wsID)
+	col := model.OGCCollection{
+		ID:       id,
+		Title:    name,
+		ItemType: "feature",
+		CRS:      []string{ogcCRS84},
+		Links: []model.OGCLink{
+			{Href: fmt.Sprintf("%s/collections/%s", baseURL, id), Rel: "self", Type: ogcJSONType},
+			{Href: fmt.Sprintf("%s/collections/%s/items", baseURL, id), Rel: "items", Type: ogcGeoJSONType},
+		},
+	}
+	col.Extent.Spatial.BBox = [][]float64{{-180, -90, 180, 90}}
+	col.Extent.Spatial.CRS = ogcCRS84
+	return col
+}
+
+// newOGCFeature は検索結果の1行を GeoJSON Feature にするのだ
+// 座標がない occurrence も geometry: null で返すのだ (仕様上許されているのだ)
+// GIS クライアントへの配信はエクスポートと同じ扱いで、座標は常に一般化するのだ
+func newOGCFeature(row *model.OccurrenceSearchRow, links []model.OGCLink) model.OGCFeature {
+	publicCoordinateAccess.generalize(row)
+	rec := newExportRecord(row)
+	feature := model.OGCFeature{
+		Type:       "Feature",
+		ID:         row.OccurrenceID,
+		Properties: geoFeatureProperties(rec),
+		Links:      links,
+	}
+	if rec.hasLoc {
+		feature.Geometry = &model.OGCPointGeometry{Type: "Point", Coordinates: []float64{rec.lon, rec.lat}}
+	}
+	return feature
+}
+
+// parseOGCDatetime は datetime パラメータ (時刻 / 区間 / 片側オープン区間) をパースするのだ
+// 日付だけが指定された場合は、その日の終わりまでを含めるのだ
+func parseOGCDatetime(text string) (time.Time, time.Time, error) {
+	parse := func(v string, endOfDay bool) (time.Time, error) {
+		if v == "" || v == ".." {
+			return time.Time{}, nil
+		}
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return t, nil
+		}
+		d, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%w: datetime の形式が正しくありません", ErrInvalidSearchQuery)
+		}
+		if endOfDay {
+			d = d.Add(24*time.Hour - time.Nanosecond)
+		}
+		return d, nil
+	}
+
+	startText, endText := text, text
+	if strings.Contains(text, "/") {
+		parts := strings.SplitN(text, "/", 2)
+		startText, endText = parts[0], parts[1]
+	}
+
+	start, err := parse(startText, false)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	end, err := parse(endText, true)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return start, end, nil
+}
+
+// ogcPageURL は元のクエリを保ったまま limit / offset だけを差し替えたURLを作るのだ
+func ogcPageURL(itemsURL string, query url.Values, limit, offset int) string {
+	params := url.Values{}
+	for k, v := range query {
+		params[k] = v
+	}
+	params.Set("limit", strconv.Itoa(limit))
+	params.Set("offset", strconv.Itoa(offset))
+	return itemsURL + "?" + params.Encode()
+}
@@ -0,0 +1,277 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/saku-730/web-occurrence/backend/internal/entity"
+	"github.com/saku-730/web-occurrence/backend/internal/infrastructure"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/repository"
+	"gorm.io/gorm"
+)
+
+var ErrOIDCDisabled = errors.New("IdP でのログインは使えません")
+var ErrInvalidOIDCState = errors.New("ログインの有効期限が切れたか、正しくありません。もう一度ログインしてください")
+var ErrInvalidOIDCTicket = errors.New("ログインの有効期限が切れたか、正しくありません。もう一度ログインしてください")
+var ErrOIDCEmailRequired = errors.New("IdP からメールアドレスを受け取れませんでした")
+var ErrOIDCEmailInUse = errors.New("このメールアドレスのアカウントがありますが、メールアドレスの確認が済んでいません。確認してからもう一度ログインしてください")
+var ErrOIDCProvider = errors.New("IdP でのログインに失敗しました")
+
+const (
+	// oidcStateTTL は IdP のログイン画面から戻ってくるまでの待ち時間なのだ
+	oidcStateTTL = 10 * time.Minute
+	// oidcTicketTTL はフロントエンドが券をトークンと引き換えるまでの待ち時間なのだ
+	oidcTicketTTL = time.Minute
+)
+
+// OIDCService は大学などの IdP (OpenID Connect) でのログインなのだ
+// 認可コードフローに PKCE を付けて、ID トークンの sub でユーザーを見分けるのだ
+//
+//  1. BeginLogin で state・nonce・code_verifier を作って、IdP のログイン画面へ送り出すのだ
+//  2. IdP から戻ってきたら CompleteLogin でコードを ID トークンと引き換えて、ユーザーを結び付けるか作るのだ
+//  3. フロントエンドは受け取った券を ExchangeTicket でトークンと引き換えるのだ
+type OIDCService interface {
+	Config() *model.OIDCConfigResponse
+	// BeginLogin は IdP のログイン画面の URL と state を返すのだ
+	// state はログインを始めたブラウザの Cookie にも入れて、戻ってきたときに比べてもらうのだ
+	BeginLogin() (authURL string, state string, err error)
+	// CompleteLogin は IdP から戻ってきたコードでログインを済ませて、トークンと引き換える券を返すのだ
+	CompleteLogin(code, state string) (string, error)
+	ExchangeTicket(ticket string, userAgent, ipAddress string) (*model.UserLoginResponse, error)
+	// FrontendCallbackURL は IdP から戻ってきた後にブラウザを送るフロントエンドの URL なのだ
+	FrontendCallbackURL(query url.Values) string
+}
+
+type oidcService struct {
+	oidcRepo       repository.OIDCRepository
+	userRepo       repository.UserRepository
+	couchClient    infrastructure.CouchDBClient
+	sessionService SessionService
+	client         infrastructure.OIDCClient
+	providerName   string
+	appBaseURL     string
+}
+
+// NewOIDCService は OIDCService を作るのだ
+// appBaseURL はログインの後に戻るフロントエンドなのだ
+func NewOIDCService(
+	oidcRepo repository.OIDCRepository,
+	userRepo repository.UserRepository,
+	couchClient infrastructure.CouchDBClient,
+	sessionService SessionService,
+	client infrastructure.OIDCClient,
+	providerName string,
+	appBaseURL string,
+) OIDCService {
+	if appBaseURL == "" {
+		appBaseURL = "http://localhost:3000"
+	}
+	if providerName == "" {
+		providerName = "シングルサインオン"
+	}
+	return &oidcService{
+		oidcRepo:       oidcRepo,
+		userRepo:       userRepo,
+		couchClient:    couchClient,
+		sessionService: sessionService,
+		client:         client,
+		providerName:   providerName,
+		appBaseURL:     strings.TrimRight(appBaseURL, "/"),
+	}
+}
+
+func (s *oidcService) Config() *model.OIDCConfigResponse {
+	if !s.client.Enabled() {
+		return &model.OIDCConfigResponse{Enabled: false}
+	}
+	return &model.OIDCConfigResponse{Enabled: true, ProviderName: s.providerName}
+}
+
+func (s *oidcService) BeginLogin() (string, string, error) {
+	if !s.client.Enabled() {
+		return "", "", ErrOIDCDisabled
+	}
+	now := time.Now()
+	// 途中でやめたログインの state はついでに片付けるのだ
+	if err := s.oidcRepo.DeleteExpired(now); err != nil {
+		return "", "", err
+	}
+
+	state := infrastructure.NewSecretToken()
+	nonce := infrastructure.NewSecretToken()
+	codeVerifier := infrastructure.NewSecretToken()
+	authURL, err := s.client.AuthCodeURL(state, nonce, infrastructure.PKCEChallenge(codeVerifier))
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %v", ErrOIDCProvider, err)
+	}
+	if err := s.oidcRepo.SaveState(&entity.OIDCLoginState{
+		StateHash:    infrastructure.HashSecretToken(state),
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		ExpiresAt:    now.Add(oidcStateTTL),
+	}); err != nil {
+		return "", "", err
+	}
+	return authURL, state, nil
+}
+
+func (s *oidcService) CompleteLogin(code, state string) (string, error) {
+	if !s.client.Enabled() {
+		return "", ErrOIDCDisabled
+	}
+	if code == "" || state == "" {
+		return "", ErrInvalidOIDCState
+	}
+	now := time.Now()
+	loginState, err := s.oidcRepo.TakeState(infrastructure.HashSecretToken(state))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", ErrInvalidOIDCState
+		}
+		return "", err
+	}
+	if !now.Before(loginState.ExpiresAt) {
+		return "", ErrInvalidOIDCState
+	}
+
+	claims, err := s.client.Exchange(code, loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrOIDCProvider, err)
+	}
+	user, err := s.resolveUser(claims, now)
+	if err != nil {
+		return "", err
+	}
+
+	ticket := infrastructure.NewSecretToken()
+	if err := s.oidcRepo.SaveTicket(&entity.OIDCLoginTicket{
+		TicketHash: infrastructure.HashSecretToken(ticket),
+		UserID:     user.UserID,
+		ExpiresAt:  now.Add(oidcTicketTTL),
+	}); err != nil {
+		return "", err
+	}
+	return ticket, nil
+}
+
+// resolveUser は IdP のアカウントに結び付いたユーザーを返すのだ
+// まだ結び付いていなければ、同じメールアドレスのユーザーに結び付けるか、新しいユーザーを作るのだ
+func (s *oidcService) resolveUser(claims *model.OIDCClaims, now time.Time) (*entity.User, error) {
+	identity, err := s.oidcRepo.FindIdentity(claims.Issuer, claims.Subject)
+	if err == nil {
+		user, err := s.userRepo.FindUserByID(identity.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if user.DeletedAt != nil {
+			return nil, ErrInvalidOIDCState
+		}
+		if err := s.oidcRepo.TouchIdentity(claims.Issuer, claims.Subject, now); err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if claims.Email == "" {
+		return nil, ErrOIDCEmailRequired
+	}
+	newIdentity := &entity.UserIdentity{
+		Issuer:      claims.Issuer,
+		Subject:     claims.Subject,
+		MailAddress: claims.Email,
+		LastLoginAt: &now,
+	}
+
+	// 同じメールアドレスのユーザーがいたら結び付けるのだ
+	// 他人が先にそのアドレスで登録していないように、両方で確認済みのときだけなのだ
+	existing, err := s.userRepo.FindUserByEmail(claims.Email)
+	if err == nil {
+		if !claims.EmailVerified || existing.EmailVerifiedAt == nil {
+			return nil, ErrOIDCEmailInUse
+		}
+		newIdentity.UserID = existing.UserID
+		if err := s.oidcRepo.LinkIdentity(newIdentity); err != nil {
+			return nil, err
+		}
+		return existing, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	return s.createUser(claims, newIdentity, now)
+}
+
+// createUser は IdP のアカウントから新しいユーザーと CouchDB ユーザーを作るのだ
+// パスワードでのログインはできないユーザーになるのだ (使いたければパスワードの再設定で決めるのだ)
+func (s *oidcService) createUser(claims *model.OIDCClaims, identity *entity.UserIdentity, now time.Time) (*entity.User, error) {
+	username := strings.Split(claims.Email, "@")[0]
+	displayName := strings.TrimSpace(claims.Name)
+	if displayName == "" || utf8.RuneCountInString(displayName) > 100 {
+		displayName = username
+	}
+	newUser := &entity.User{
+		UserName:    username,
+		DisplayName: displayName,
+		MailAddress: claims.Email,
+	}
+	if claims.EmailVerified {
+		newUser.EmailVerifiedAt = &now
+	}
+
+	// RegisterUser と同じく、コミットする前に CouchDB ユーザーを作るのだ
+	// パスワードは使わないのでランダムなものにするのだ (同期はサーバーがセッションを発行するのだ)
+	couchCreated := false
+	created, err := s.oidcRepo.CreateUserWithIdentity(newUser, identity, func(u *entity.User) error {
+		if err := s.couchClient.CreateCouchDBUser(strconv.FormatInt(u.UserID, 10), infrastructure.NewSecretToken()); err != nil {
+			return fmt.Errorf("%w: %v", ErrCouchDBUserCreation, err)
+		}
+		couchCreated = true
+		return nil
+	})
+	if err != nil {
+		if couchCreated {
+			couchDBUsername := strconv.FormatInt(newUser.UserID, 10)
+			if delErr := s.couchClient.DeleteDocument("_users", infrastructure.CouchDBUserDocID(couchDBUsername)); delErr != nil {
+				log.Printf("IdP ログインの取り消しでCouchDBユーザーの削除に失敗 (user_id=%s): %v", couchDBUsername, delErr)
+			}
+		}
+		switch {
+		case errors.Is(err, repository.ErrEmailAlreadyExists):
+			// 同時にパスワードで登録されたときなのだ
+			return nil, ErrOIDCEmailInUse
+		case errors.Is(err, repository.ErrIdentityAlreadyLinked):
+			// 同じ IdP のアカウントで同時にログインしたときなのだ。もう一度ログインすれば結び付いた方になるのだ
+			return nil, ErrInvalidOIDCState
+		}
+		return nil, err
+	}
+	return created, nil
+}
+
+func (s *oidcService) ExchangeTicket(ticket string, userAgent, ipAddress string) (*model.UserLoginResponse, error) {
+	t, err := s.oidcRepo.TakeTicket(infrastructure.HashSecretToken(ticket))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidOIDCTicket
+		}
+		return nil, err
+	}
+	if !time.Now().Before(t.ExpiresAt) {
+		return nil, ErrInvalidOIDCTicket
+	}
+	return s.sessionService.Issue(t.UserID, userAgent, ipAddress)
+}
+
+func (s *oidcService) FrontendCallbackURL(query url.Values) string {
+	return s.appBaseURL + "/login/oidc?" + query.Encode()
+}
@@ -0,0 +1,301 @@
+package service
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/saku-730/web-occurrence/backend/internal/entity"
+	"github.com/saku-730/web-occurrence/backend/internal/infrastructure"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/repository"
+	"gorm.io/gorm"
+)
+
+const testIssuer = "https://idp.example.ac.jp"
+
+// fakeOIDCClient は IdP の代わりなのだ
+// ログイン画面へ送り出したときの nonce と code_challenge を覚えて、引き換えのときに確かめるのだ
+type fakeOIDCClient struct {
+	claims    model.OIDCClaims
+	nonce     string
+	challenge string
+}
+
+func (c *fakeOIDCClient) Enabled() bool { return true }
+
+func (c *fakeOIDCClient) AuthCodeURL(state, nonce, codeChallenge string) (string, error) {
+	c.nonce, c.challenge = nonce, codeChallenge
+	return testIssuer + "/authorize?" + url.Values{"state": {state}}.Encode(), nil
+}
+
+func (c *fakeOIDCClient) Exchange(code, codeVerifier, nonce string) (*model.OIDCClaims, error) {
+	if code != "code" || infrastructure.PKCEChallenge(codeVerifier) != c.challenge || nonce != c.nonce {
+		return nil, infrastructure.ErrOIDCTokenExchange
+	}
+	claims := c.claims
+	return &claims, nil
+}
+
+type fakeOIDCRepository struct {
+	states     map[string]entity.OIDCLoginState
+	tickets    map[string]entity.OIDCLoginTicket
+	identities map[string]entity.UserIdentity
+	users      *fakeUserRepository
+}
+
+func (r *fakeOIDCRepository) SaveState(state *entity.OIDCLoginState) error {
+	r.states[state.StateHash] = *state
+	return nil
+}
+
+func (r *fakeOIDCRepository) TakeState(stateHash string) (*entity.OIDCLoginState, error) {
+	state, ok := r.states[stateHash]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	delete(r.states, stateHash)
+	return &state, nil
+}
+
+func (r *fakeOIDCRepository) FindIdentity(issuer, subject string) (*entity.UserIdentity, error) {
+	identity, ok := r.identities[issuer+" "+subject]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &identity, nil
+}
+
+func (r *fakeOIDCRepository) LinkIdentity(identity *entity.UserIdentity) error {
+	key := identity.Issuer + " " + identity.Subject
+	if _, ok := r.identities[key]; ok {
+		return repository.ErrIdentityAlreadyLinked
+	}
+	r.identities[key] = *identity
+	return nil
+}
+
+func (r *fakeOIDCRepository) CreateUserWithIdentity(user *entity.User, identity *entity.UserIdentity, afterCreate func(created *entity.User) error) (*entity.User, error) {
+	user.UserID = int64(len(r.users.users) + 1)
+	if err := afterCreate(user); err != nil {
+		return nil, err
+	}
+	r.users.users[user.UserID] = user
+	identity.UserID = user.UserID
+	return user, r.LinkIdentity(identity)
+}
+
+func (r *fakeOIDCRepository) TouchIdentity(issuer, subject string, now time.Time) error {
+	identity := r.identities[issuer+" "+subject]
+	identity.LastLoginAt = &now
+	r.identities[issuer+" "+subject] = identity
+	return nil
+}
+
+func (r *fakeOIDCRepository) SaveTicket(ticket *entity.OIDCLoginTicket) error {
+	r.tickets[ticket.TicketHash] = *ticket
+	return nil
+}
+
+func (r *fakeOIDCRepository) TakeTicket(ticketHash string) (*entity.OIDCLoginTicket, error) {
+	ticket, ok := r.tickets[ticketHash]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	delete(r.tickets, ticketHash)
+	return &ticket, nil
+}
+
+func (r *fakeOIDCRepository) DeleteExpired(now time.Time) error { return nil }
+
+// fakeUserRepository はログインで使うところだけを持つのだ (他を呼んだら panic するのだ)
+type fakeUserRepository struct {
+	repository.UserRepository
+	users map[int64]*entity.User
+}
+
+func (r *fakeUserRepository) FindUserByEmail(email string) (*entity.User, error) {
+	for _, u := range r.users {
+		if u.MailAddress == email {
+			return u, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeUserRepository) FindUserByID(userID int64) (*entity.User, error) {
+	u, ok := r.users[userID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return u, nil
+}
+
+type fakeCouchDBClient struct {
+	infrastructure.CouchDBClient
+	createdUsers []string
+}
+
+func (c *fakeCouchDBClient) CreateCouchDBUser(username string, password string) error {
+	c.createdUsers = append(c.createdUsers, username)
+	return nil
+}
+
+type fakeSessionService struct {
+	SessionService
+	issuedFor []int64
+}
+
+func (s *fakeSessionService) Issue(userID int64, userAgent, ipAddress string) (*model.UserLoginResponse, error) {
+	s.issuedFor = append(s.issuedFor, userID)
+	return &model.UserLoginResponse{Token: "access", TokenType: "Bearer", RefreshToken: "refresh"}, nil
+}
+
+type oidcTestEnv struct {
+	service  OIDCService
+	client   *fakeOIDCClient
+	repo     *fakeOIDCRepository
+	users    *fakeUserRepository
+	couch    *fakeCouchDBClient
+	sessions *fakeSessionService
+}
+
+func newOIDCTestEnv(claims model.OIDCClaims, users ...*entity.User) *oidcTestEnv {
+	env := &oidcTestEnv{
+		client:   &fakeOIDCClient{claims: claims},
+		users:    &fakeUserRepository{users: map[int64]*entity.User{}},
+		couch:    &fakeCouchDBClient{},
+		sessions: &fakeSessionService{},
+	}
+	for _, u := range users {
+		env.users.users[u.UserID] = u
+	}
+	env.repo = &fakeOIDCRepository{
+		states:     map[string]entity.OIDCLoginState{},
+		tickets:    map[string]entity.OIDCLoginTicket{},
+		identities: map[string]entity.UserIdentity{},
+		users:      env.users,
+	}
+	env.service = NewOIDCService(env.repo, env.users, env.couch, env.sessions, env.client, "", "")
+	return env
+}
+
+// login は IdP のログイン画面から戻ってきて、券をトークンと引き換えるまでを通すのだ
+func (env *oidcTestEnv) login(t *testing.T) (int64, error) {
+	t.Helper()
+	_, state, err := env.service.BeginLogin()
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	ticket, err := env.service.CompleteLogin("code", state)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := env.service.ExchangeTicket(ticket, "test", "127.0.0.1"); err != nil {
+		t.Fatalf("ExchangeTicket: %v", err)
+	}
+	return env.sessions.issuedFor[len(env.sessions.issuedFor)-1], nil
+}
+
+func verifiedClaims() model.OIDCClaims {
+	return model.OIDCClaims{
+		Issuer:        testIssuer,
+		Subject:       "sub-1",
+		Email:         "taro@example.ac.jp",
+		EmailVerified: true,
+		Name:          "山田 太郎",
+	}
+}
+
+func TestOIDCLoginCreatesUser(t *testing.T) {
+	env := newOIDCTestEnv(verifiedClaims())
+
+	userID, err := env.login(t)
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	u := env.users.users[userID]
+	if u == nil || u.MailAddress != "taro@example.ac.jp" || u.DisplayName != "山田 太郎" || u.EmailVerifiedAt == nil {
+		t.Fatalf("created user = %+v", u)
+	}
+	if len(env.couch.createdUsers) != 1 || env.couch.createdUsers[0] != "1" {
+		t.Fatalf("CouchDB users created = %v, want [1]", env.couch.createdUsers)
+	}
+	if identity, ok := env.repo.identities[testIssuer+" sub-1"]; !ok || identity.UserID != userID {
+		t.Fatalf("identity = %+v", identity)
+	}
+
+	// 2回目からは結び付いたユーザーでログインするのだ
+	again, err := env.login(t)
+	if err != nil {
+		t.Fatalf("second login: %v", err)
+	}
+	if again != userID || len(env.users.users) != 1 || len(env.couch.createdUsers) != 1 {
+		t.Fatalf("second login user = %d, users = %d, CouchDB users = %v", again, len(env.users.users), env.couch.createdUsers)
+	}
+}
+
+func TestOIDCLoginLinksVerifiedUser(t *testing.T) {
+	verifiedAt := time.Now().Add(-24 * time.Hour)
+	existing := &entity.User{UserID: 7, MailAddress: "taro@example.ac.jp", EmailVerifiedAt: &verifiedAt}
+	env := newOIDCTestEnv(verifiedClaims(), existing)
+
+	userID, err := env.login(t)
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if userID != 7 {
+		t.Fatalf("logged in as %d, want 7", userID)
+	}
+	if len(env.users.users) != 1 || len(env.couch.createdUsers) != 0 {
+		t.Fatalf("users = %d, CouchDB users = %v; want no new user", len(env.users.users), env.couch.createdUsers)
+	}
+	if identity := env.repo.identities[testIssuer+" sub-1"]; identity.UserID != 7 {
+		t.Fatalf("identity linked to %d, want 7", identity.UserID)
+	}
+}
+
+func TestOIDCLoginRefusesUnverifiedLink(t *testing.T) {
+	verifiedAt := time.Now().Add(-24 * time.Hour)
+	tests := []struct {
+		name          string
+		emailVerified bool
+		user          *entity.User
+	}{
+		{"unverified at the IdP", false, &entity.User{UserID: 7, MailAddress: "taro@example.ac.jp", EmailVerifiedAt: &verifiedAt}},
+		{"unverified here", true, &entity.User{UserID: 7, MailAddress: "taro@example.ac.jp"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := verifiedClaims()
+			claims.EmailVerified = tt.emailVerified
+			env := newOIDCTestEnv(claims, tt.user)
+
+			if _, err := env.login(t); !errors.Is(err, ErrOIDCEmailInUse) {
+				t.Fatalf("login error = %v, want ErrOIDCEmailInUse", err)
+			}
+			if len(env.repo.identities) != 0 {
+				t.Fatalf("identities = %v, want none", env.repo.identities)
+			}
+		})
+	}
+}
+
+func TestOIDCCompleteLoginRejectsReusedOrUnknownState(t *testing.T) {
+	env := newOIDCTestEnv(verifiedClaims())
+
+	if _, err := env.service.CompleteLogin("code", "unknown-state"); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Fatalf("unknown state error = %v, want ErrInvalidOIDCState", err)
+	}
+	_, state, err := env.service.BeginLogin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.service.CompleteLogin("code", state); err != nil {
+		t.Fatalf("CompleteLogin: %v", err)
+	}
+	if _, err := env.service.CompleteLogin("code", state); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Fatalf("reused state error = %v, want ErrInvalidOIDCState", err)
+	}
+}
@@ -0,0 +1,279 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/saku-730/web-occurrence/backend/internal/entity"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/repository"
+	"gorm.io/gorm"
+)
+
+var ErrPlaceNameNotFound = errors.New("地名が見つかりません")
+var ErrPlaceNameInUse = errors.New("下位の地名や場所から参照されているため削除できません")
+var ErrInvalidPlaceName = errors.New("地名の内容が正しくありません")
+
+const (
+	defaultPlaceNameLimit = 20
+	maxPlaceNameLimit     = 200
+)
+
+// PlaceNameDetail は地名と、上位の地名を並べた path なのだ
+type PlaceNameDetail struct {
+	entity.PlaceName
+	Path []string `json:"path"`
+}
+
+type PlaceNameService interface {
+	List(userID string, workstationID int64, q *model.PlaceNameSearchQuery) ([]model.PlaceNameMatch, error)
+	Get(userID string, workstationID int64, placeNameID string) (*PlaceNameDetail, error)
+	Create(userID string, workstationID int64, req *model.PlaceNameRequest) (*entity.PlaceName, error)
+	Update(userID string, workstationID int64, placeNameID string, req *model.PlaceNameRequest) (*entity.PlaceName, error)
+	Delete(userID string, workstationID int64, placeNameID string) error
+	Suggest(userID string, workstationID int64, q *model.PlaceNameSuggestQuery) ([]model.PlaceNameSuggestion, error)
+}
+
+type placeNameService struct {
+	pnRepo repository.PlaceNameRepository
+	wsRepo repository.WorkstationRepository
+}
+
+func NewPlaceNameService(pnRepo repository.PlaceNameRepository, wsRepo repository.WorkstationRepository) PlaceNameService {
+	return &placeNameService{
+		pnRepo: pnRepo,
+		wsRepo: wsRepo,
+	}
+}
+
+func (s *placeNameService) List(userIDStr string, workstationID int64, q *model.PlaceNameSearchQuery) ([]model.PlaceNameMatch, error) {
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	if q.Limit <= 0 {
+		q.Limit = defaultPlaceNameLimit
+	}
+	if q.Limit > maxPlaceNameLimit {
+		q.Limit = maxPlaceNameLimit
+	}
+
+	list, err := s.pnRepo.Search(workstationID, q)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []model.PlaceNameMatch{}
+	}
+	return list, nil
+}
+
+func (s *placeNameService) Get(userIDStr string, workstationID int64, placeNameID string) (*PlaceNameDetail, error) {
+	pn, err := s.findInWorkstation(userIDStr, workstationID, placeNameID)
+	if err != nil {
+		return nil, err
+	}
+	path, err := s.path(placeNameID)
+	if err != nil {
+		return nil, err
+	}
+	return &PlaceNameDetail{PlaceName: *pn, Path: path}, nil
+}
+
+func (s *placeNameService) Create(userIDStr string, workstationID int64, req *model.PlaceNameRequest) (*entity.PlaceName, error) {
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	userID, _ := strconv.ParseInt(userIDStr, 10, 64)
+
+	pn := &entity.PlaceName{WorkstationID: workstationID, UserID: userID}
+	boundary, err := s.apply(pn, req)
+	if err != nil {
+		return nil, err
+	}
+	return s.pnRepo.Create(pn, boundary)
+}
+
+func (s *placeNameService) Update(userIDStr string, workstationID int64, placeNameID string, req *model.PlaceNameRequest) (*entity.PlaceName, error) {
+	pn, err := s.findInWorkstation(userIDStr, workstationID, placeNameID)
+	if err != nil {
+		return nil, err
+	}
+	userID, _ := strconv.ParseInt(userIDStr, 10, 64)
+	pn.UserID = userID
+
+	boundary, err := s.apply(pn, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.pnRepo.Update(pn, boundary); err != nil {
+		return nil, err
+	}
+	return pn, nil
+}
+
+func (s *placeNameService) Delete(userIDStr string, workstationID int64, placeNameID string) error {
+	if _, err := s.findInWorkstation(userIDStr, workstationID, placeNameID); err != nil {
+		return err
+	}
+	refs, err := s.pnRepo.CountReferences(placeNameID)
+	if err != nil {
+		return err
+	}
+	if refs > 0 {
+		return ErrPlaceNameInUse
+	}
+	return s.pnRepo.Delete(placeNameID)
+}
+
+// Suggest は座標から地名を提案するのだ
+// 境界ポリゴンに含まれる地名 (深い階層から) を先に、その後に代表点が近い地名を並べるのだ
+func (s *placeNameService) Suggest(userIDStr string, workstationID int64, q *model.PlaceNameSuggestQuery) ([]model.PlaceNameSuggestion, error) {
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	if q.Latitude == nil || q.Longitude == nil {
+		return nil, fmt.Errorf("%w: lat / lon を指定してください", ErrInvalidPlaceName)
+	}
+	lat, lon := *q.Latitude, *q.Longitude
+	if lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return nil, fmt.Errorf("%w: lat / lon が範囲外です", ErrInvalidPlaceName)
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = 5
+	}
+	if limit > maxPlaceNameLimit {
+		limit = maxPlaceNameLimit
+	}
+
+	containing, err := s.pnRepo.FindContaining(workstationID, lat, lon)
+	if err != nil {
+		return nil, err
+	}
+	nearest, err := s.pnRepo.FindNearest(workstationID, lat, lon, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []model.PlaceNameSuggestion{}
+	seen := map[string]bool{}
+	for _, m := range append(containing, nearest...) {
+		if seen[m.PlaceNameID] {
+			continue
+		}
+		seen[m.PlaceNameID] = true
+
+		path, err := s.path(m.PlaceNameID)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, model.PlaceNameSuggestion{PlaceNameMatch: m, Path: path})
+	}
+	return result, nil
+}
+
+// apply はリクエストの内容を検証して entity に反映するのだ
+// 戻り値は境界の GeoJSON (なければ nil) なのだ
+func (s *placeNameService) apply(pn *entity.PlaceName, req *model.PlaceNameRequest) (*string, error) {
+	if (req.Latitude == nil) != (req.Longitude == nil) {
+		return nil, fmt.Errorf("%w: latitude と longitude は両方指定してください", ErrInvalidPlaceName)
+	}
+	if req.Latitude != nil && (*req.Latitude < -90 || *req.Latitude > 90 || *req.Longitude < -180 || *req.Longitude > 180) {
+		return nil, fmt.Errorf("%w: latitude / longitude が範囲外です", ErrInvalidPlaceName)
+	}
+
+	if req.ParentID != nil && *req.ParentID != "" {
+		parent, err := s.pnRepo.FindByID(*req.ParentID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, fmt.Errorf("%w: 親の地名が見つかりません", ErrInvalidPlaceName)
+			}
+			return nil, err
+		}
+		if parent.WorkstationID != pn.WorkstationID {
+			return nil, fmt.Errorf("%w: 親の地名が別のワークステーションのものです", ErrInvalidPlaceName)
+		}
+		if placeNameRankDepth(parent.Rank) >= placeNameRankDepth(req.Rank) {
+			return nil, fmt.Errorf("%w: %s の下に %s は置けません", ErrInvalidPlaceName, parent.Rank, req.Rank)
+		}
+		// 自分の子孫を親にすると循環してしまうのだ
+		if pn.PlaceNameID != "" {
+			ancestors, err := s.pnRepo.FindAncestors(parent.PlaceNameID)
+			if err != nil {
+				return nil, err
+			}
+			for _, a := range ancestors {
+				if a.PlaceNameID == pn.PlaceNameID {
+					return nil, fmt.Errorf("%w: 親子関係が循環します", ErrInvalidPlaceName)
+				}
+			}
+		}
+		pn.ParentID = &parent.PlaceNameID
+	} else {
+		pn.ParentID = nil
+	}
+
+	names := req.Names
+	if names == nil {
+		names = map[string]string{}
+	}
+	namesJSON, err := json.Marshal(names)
+	if err != nil {
+		return nil, err
+	}
+
+	pn.Rank = req.Rank
+	pn.Name = req.Name
+	pn.ClassPlaceName = string(namesJSON)
+	pn.Latitude = req.Latitude
+	pn.Longitude = req.Longitude
+
+	if len(req.Boundary) == 0 || string(req.Boundary) == "null" {
+		return nil, nil
+	}
+	boundary, err := normalizePolygon(string(req.Boundary))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPlaceName, err)
+	}
+	return &boundary, nil
+}
+
+func (s *placeNameService) findInWorkstation(userIDStr string, workstationID int64, placeNameID string) (*entity.PlaceName, error) {
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	pn, err := s.pnRepo.FindByID(placeNameID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPlaceNameNotFound
+		}
+		return nil, err
+	}
+	if pn.WorkstationID != workstationID {
+		return nil, ErrPlaceNameNotFound
+	}
+	return pn, nil
+}
+
+func (s *placeNameService) path(placeNameID string) ([]string, error) {
+	ancestors, err := s.pnRepo.FindAncestors(placeNameID)
+	if err != nil {
+		return nil, err
+	}
+	path := make([]string, 0, len(ancestors))
+	for _, a := range ancestors {
+		path = append(path, a.Name)
+	}
+	return path, nil
+}
+
+func placeNameRankDepth(rank string) int {
+	for i, r := range model.PlaceNameRanks {
+		if r == rank {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,375 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/saku-730/web-occurrence/backend/internal/entity"
+	"github.com/saku-730/web-occurrence/backend/internal/infrastructure"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/repository"
+	"gorm.io/gorm"
+)
+
+var ErrProjectNotFound = errors.New("プロジェクトが見つかりません")
+var ErrInvalidProject = errors.New("プロジェクトの内容が正しくありません")
+var ErrProjectEditDenied = errors.New("プロジェクトを変更できるのは作成者かワークステーションの管理者だけです")
+var ErrProjectInUse = errors.New("このプロジェクトの occurrence があるため削除できません")
+var ErrProjectMemberNotFound = errors.New("プロジェクトのメンバーが見つかりません")
+
+// projectDayLayout はプロジェクトの日付 (date 型) の書式なのだ
+const projectDayLayout = "2006-01-02"
+
+// ProjectDetail はプロジェクトとメンバーなのだ
+type ProjectDetail struct {
+	entity.Project
+	Members []entity.ProjectMember `json:"members"`
+	// LegacyDescription は以前の綴りのキーで同じ説明を返すのだ (古いクライアント用で、いずれ消すのだ)
+	LegacyDescription string `json:"disscription"`
+}
+
+type ProjectService interface {
+	List(userID string, workstationID int64) ([]ProjectDetail, error)
+	Get(userID string, workstationID int64, projectID string) (*ProjectDetail, error)
+	Create(userID string, workstationID int64, req *model.ProjectRequest) (*ProjectDetail, error)
+	Update(userID string, workstationID int64, projectID string, req *model.ProjectRequest) (*ProjectDetail, error)
+	Delete(userID string, workstationID int64, projectID string) error
+
+	// SaveMember はメンバーを追加するか、参加日・終了日を更新するのだ
+	SaveMember(userID string, workstationID int64, projectID string, memberUserID int64, req *model.ProjectMemberRequest) (*ProjectDetail, error)
+	RemoveMember(userID string, workstationID int64, projectID string, memberUserID int64) (*ProjectDetail, error)
+}
+
+type projectService struct {
+	projectRepo repository.ProjectRepository
+	wsRepo      repository.WorkstationRepository
+	couchClient infrastructure.CouchDBClient
+}
+
+func NewProjectService(projectRepo repository.ProjectRepository, wsRepo repository.WorkstationRepository, couchClient infrastructure.CouchDBClient) ProjectService {
+	return &projectService{
+		projectRepo: projectRepo,
+		wsRepo:      wsRepo,
+		couchClient: couchClient,
+	}
+}
+
+func (s *projectService) List(userIDStr string, workstationID int64) ([]ProjectDetail, error) {
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	list, err := s.projectRepo.List(workstationID)
+	if err != nil {
+		return nil, err
+	}
+	return s.details(list)
+}
+
+func (s *projectService) Get(userIDStr string, workstationID int64, projectID string) (*ProjectDetail, error) {
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	p, err := s.findProject(workstationID, projectID)
+	if err != nil {
+		return nil, err
+	}
+	return s.detail(p)
+}
+
+// Create はプロジェクトを作るのだ。作成した人が最初のメンバーになるのだ
+func (s *projectService) Create(userIDStr string, workstationID int64, req *model.ProjectRequest) (*ProjectDetail, error) {
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+
+	p := &entity.Project{WorkstationID: workstationID, UserID: userID}
+	if err := applyProject(p, req); err != nil {
+		return nil, err
+	}
+	joinDay := projectDay(time.Now())
+	if p.StartDay != nil && p.StartDay.After(joinDay) {
+		joinDay = *p.StartDay
+	}
+	owner := &entity.ProjectMember{UserID: userID, JoinDay: joinDay, WorkstationID: workstationID}
+	if err := s.projectRepo.Create(p, owner); err != nil {
+		return nil, err
+	}
+	return s.saved(p)
+}
+
+func (s *projectService) Update(userIDStr string, workstationID int64, projectID string, req *model.ProjectRequest) (*ProjectDetail, error) {
+	p, err := s.editableProject(userIDStr, workstationID, projectID)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyProject(p, req); err != nil {
+		return nil, err
+	}
+	if err := s.projectRepo.Update(p); err != nil {
+		return nil, err
+	}
+	return s.saved(p)
+}
+
+// Delete は occurrence が1件も無いプロジェクトを削除するのだ
+func (s *projectService) Delete(userIDStr string, workstationID int64, projectID string) error {
+	p, err := s.editableProject(userIDStr, workstationID, projectID)
+	if err != nil {
+		return err
+	}
+	count, err := s.projectRepo.CountOccurrences(p.ProjectID)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrProjectInUse
+	}
+	if err := s.projectRepo.Delete(p.ProjectID); err != nil {
+		return err
+	}
+	return s.couchClient.DeleteDocument(s.couchClient.CreateWorkstationDBName(workstationID), p.ProjectID)
+}
+
+func (s *projectService) SaveMember(userIDStr string, workstationID int64, projectID string, memberUserID int64, req *model.ProjectMemberRequest) (*ProjectDetail, error) {
+	p, err := s.memberEditableProject(userIDStr, workstationID, projectID, memberUserID)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := s.wsRepo.IsUserInWorkstation(memberUserID, workstationID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: ワークステーションのメンバーではないユーザーです", ErrInvalidProject)
+	}
+
+	m, err := s.projectRepo.FindMember(p.ProjectID, memberUserID)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		m = &entity.ProjectMember{
+			ProjectID:     p.ProjectID,
+			UserID:        memberUserID,
+			JoinDay:       projectDay(time.Now()),
+			WorkstationID: workstationID,
+		}
+	}
+	if req.JoinDay != nil {
+		m.JoinDay = projectDay(*req.JoinDay)
+	}
+	m.FinishDay = nil
+	if req.FinishDay != nil {
+		d := projectDay(*req.FinishDay)
+		if d.Before(m.JoinDay) {
+			return nil, fmt.Errorf("%w: 終了日が参加日より前です", ErrInvalidProject)
+		}
+		m.FinishDay = &d
+	}
+	if err := s.projectRepo.SaveMember(m); err != nil {
+		return nil, err
+	}
+	return s.touched(p)
+}
+
+func (s *projectService) RemoveMember(userIDStr string, workstationID int64, projectID string, memberUserID int64) (*ProjectDetail, error) {
+	p, err := s.memberEditableProject(userIDStr, workstationID, projectID, memberUserID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.projectRepo.FindMember(p.ProjectID, memberUserID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrProjectMemberNotFound
+		}
+		return nil, err
+	}
+	if err := s.projectRepo.DeleteMember(p.ProjectID, memberUserID); err != nil {
+		return nil, err
+	}
+	return s.touched(p)
+}
+
+func (s *projectService) findProject(workstationID int64, projectID string) (*entity.Project, error) {
+	p, err := s.projectRepo.FindByID(projectID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrProjectNotFound
+		}
+		return nil, err
+	}
+	if p.WorkstationID != workstationID {
+		return nil, ErrProjectNotFound
+	}
+	return p, nil
+}
+
+// editableProject はプロジェクトの作成者かワークステーションの管理者のときだけプロジェクトを返すのだ
+func (s *projectService) editableProject(userIDStr string, workstationID int64, projectID string) (*entity.Project, error) {
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := s.wsRepo.GetRoleIDsByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	role, ok := roles[workstationID]
+	if !ok {
+		return nil, ErrWorkstationAccessDenied
+	}
+	p, err := s.findProject(workstationID, projectID)
+	if err != nil {
+		return nil, err
+	}
+	if p.UserID != userID && role != roleAdministrator {
+		return nil, ErrProjectEditDenied
+	}
+	return p, nil
+}
+
+// memberEditableProject はメンバーを変更できるときにプロジェクトを返すのだ
+// 作成者と管理者に加えて、本人は自分の参加・終了を変更できるのだ
+func (s *projectService) memberEditableProject(userIDStr string, workstationID int64, projectID string, memberUserID int64) (*entity.Project, error) {
+	if userIDStr == strconv.FormatInt(memberUserID, 10) {
+		if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+			return nil, err
+		}
+		return s.findProject(workstationID, projectID)
+	}
+	return s.editableProject(userIDStr, workstationID, projectID)
+}
+
+// applyProject はリクエストの内容をプロジェクトに入れるのだ
+func applyProject(p *entity.Project, req *model.ProjectRequest) error {
+	name := strings.TrimSpace(req.ProjectName)
+	if name == "" {
+		return fmt.Errorf("%w: プロジェクト名が空です", ErrInvalidProject)
+	}
+	var start, finish *time.Time
+	if req.StartDay != nil {
+		d := projectDay(*req.StartDay)
+		start = &d
+	}
+	if req.FinishedDay != nil {
+		d := projectDay(*req.FinishedDay)
+		finish = &d
+	}
+	if start != nil && finish != nil && finish.Before(*start) {
+		return fmt.Errorf("%w: 終了日が開始日より前です", ErrInvalidProject)
+	}
+
+	p.ProjectName = name
+	p.Description = req.Description
+	if p.Description == "" && req.LegacyDescription != nil {
+		p.Description = *req.LegacyDescription
+	}
+	p.StartDay = start
+	p.FinishedDay = finish
+	p.Note = req.Note
+	p.UpdatedDay = projectDay(time.Now())
+	return nil
+}
+
+// touched はメンバーが変わったプロジェクトの更新日を今日にして保存し直すのだ
+func (s *projectService) touched(p *entity.Project) (*ProjectDetail, error) {
+	p.UpdatedDay = projectDay(time.Now())
+	if err := s.projectRepo.Update(p); err != nil {
+		return nil, err
+	}
+	return s.saved(p)
+}
+
+// saved は保存したプロジェクトを CouchDB にも書き込んでから返すのだ
+func (s *projectService) saved(p *entity.Project) (*ProjectDetail, error) {
+	detail, err := s.detail(p)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.writeCouchDocument(detail); err != nil {
+		return nil, err
+	}
+	return detail, nil
+}
+
+func (s *projectService) detail(p *entity.Project) (*ProjectDetail, error) {
+	details, err := s.details([]entity.Project{*p})
+	if err != nil {
+		return nil, err
+	}
+	return &details[0], nil
+}
+
+func (s *projectService) details(list []entity.Project) ([]ProjectDetail, error) {
+	ids := make([]string, len(list))
+	for i, p := range list {
+		ids[i] = p.ProjectID
+	}
+	members, err := s.projectRepo.ListMembers(ids)
+	if err != nil {
+		return nil, err
+	}
+	byProject := make(map[string][]entity.ProjectMember, len(list))
+	for _, m := range members {
+		byProject[m.ProjectID] = append(byProject[m.ProjectID], m)
+	}
+
+	details := make([]ProjectDetail, 0, len(list))
+	for _, p := range list {
+		d := ProjectDetail{Project: p, Members: byProject[p.ProjectID], LegacyDescription: p.Description}
+		if d.Members == nil {
+			d.Members = []entity.ProjectMember{}
+		}
+		details = append(details, d)
+	}
+	return details, nil
+}
+
+// writeCouchDocument はプロジェクトを CouchDB の project ドキュメント (_id = project_id) に書き込むのだ
+// 端末はこのドキュメントからプロジェクトとメンバーを知るのだ
+func (s *projectService) writeCouchDocument(d *ProjectDetail) error {
+	members := make([]interface{}, 0, len(d.Members))
+	for _, m := range d.Members {
+		members = append(members, map[string]interface{}{
+			"project_member_id": m.ProjectMemberID,
+			"user_id":           strconv.FormatInt(m.UserID, 10),
+			"join_day":          m.JoinDay.Format(projectDayLayout),
+			"finish_day":        formatOptionalDate(m.FinishDay),
+		})
+	}
+	doc := map[string]interface{}{
+		"_id":                d.ProjectID,
+		"type":               "project",
+		"workstation_id":     strconv.FormatInt(d.WorkstationID, 10),
+		"created_by_user_id": strconv.FormatInt(d.UserID, 10),
+		"project_name":       d.ProjectName,
+		"description":        d.Description,
+		"start_day":          formatOptionalDate(d.StartDay),
+		"finished_day":       formatOptionalDate(d.FinishedDay),
+		"updated_day":        d.UpdatedDay.Format(projectDayLayout),
+		"note":               d.Note,
+		"user_id":            strconv.FormatInt(d.UserID, 10),
+		"members":            members,
+	}
+	return s.couchClient.UpsertDocument(d.ProjectID, doc)
+}
+
+// projectDay は日時を日付だけにするのだ (date 型の列と同じく UTC の0時にそろえるのだ)
+func projectDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// formatOptionalDate は日付を YYYY-MM-DD にするのだ。nil なら null のままにするのだ
+func formatOptionalDate(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.Format(projectDayLayout)
+}
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/saku-730/web-occurrence/backend/internal/entity"
+	"github.com/saku-730/web-occurrence/backend/internal/infrastructure"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/repository"
+	"gorm.io/gorm"
+)
+
+var ErrRecordNotFound = errors.New("コードに対応するレコードが見つかりません")
+var ErrAmbiguousRecord = errors.New("複数のワークステーションに同じ登録番号があります")
+
+const (
+	recordTypeOccurrence = "occurrence"
+	recordTypeSpecimen   = "specimen"
+	// maxRecordCodeAttempts はコードが重なったときに作り直す回数の上限なのだ
+	maxRecordCodeAttempts = 5
+)
+
+type ResolverService interface {
+	// Resolve は読み取った文字列 (UUID / 登録番号 / 短いコード) からレコードを探すのだ
+	Resolve(userID string, payload string) (*model.ResolvedRecord, error)
+	OccurrenceCode(userID string, occurrenceID string) (*entity.RecordCode, error)
+	SpecimenCode(userID string, workstationID int64, specimenID string) (*entity.RecordCode, error)
+}
+
+type resolverService struct {
+	codeRepo     repository.RecordCodeRepository
+	specimenRepo repository.SpecimenRepository
+	wsRepo       repository.WorkstationRepository
+	appBaseURL   string
+}
+
+// appBaseURL はコードを読み取った後にブラウザを送るフロントエンドなのだ
+func NewResolverService(codeRepo repository.RecordCodeRepository, specimenRepo repository.SpecimenRepository, wsRepo repository.WorkstationRepository, appBaseURL string) ResolverService {
+	if appBaseURL == "" {
+		appBaseURL = "http://localhost:3000"
+	}
+	return &resolverService{
+		codeRepo:     codeRepo,
+		specimenRepo: specimenRepo,
+		wsRepo:       wsRepo,
+		appBaseURL:   strings.TrimRight(appBaseURL, "/"),
+	}
+}
+
+func (s *resolverService) Resolve(userIDStr string, payload string) (*model.ResolvedRecord, error) {
+	value := resolverPayloadValue(payload)
+	if value == "" {
+		return nil, ErrRecordNotFound
+	}
+
+	// 1. UUID なら occurrence か標本の ID なのだ
+	if infrastructure.IsUUID(value) {
+		id := strings.ToLower(value)
+		if occ, err := s.specimenRepo.FindOccurrence(id); err == nil {
+			return s.resolved(userIDStr, occ.WorkstationID, recordTypeOccurrence, occ.OccurrenceID, occ.OccurrenceID, nil)
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		if sp, err := s.specimenRepo.FindByID(id); err == nil {
+			return s.resolved(userIDStr, sp.WorkstationID, recordTypeSpecimen, sp.SpecimenID, sp.OccurrenceID, sp.CatalogNumber)
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		return nil, ErrRecordNotFound
+	}
+
+	// 2. 短いコードとして読めれば record_codes を探すのだ
+	if code, ok := infrastructure.NormalizeShortCode(value); ok {
+		rec, err := s.resolveShortCode(userIDStr, code)
+		if err == nil {
+			return rec, nil
+		}
+		if !errors.Is(err, ErrRecordNotFound) {
+			return nil, err
+		}
+		// 同じ形の登録番号もあり得るので、見つからない (他のワークステーションのコードだった) ときは次に進むのだ
+	}
+
+	// 3. 残りは登録番号として、自分のワークステーションの中から探すのだ
+	wsIDs, err := resolveWorkstationIDs(s.wsRepo, userIDStr, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(wsIDs) == 0 {
+		return nil, ErrRecordNotFound
+	}
+	list, err := s.specimenRepo.ListByCatalogNumber(wsIDs, value)
+	if err != nil {
+		return nil, err
+	}
+	switch len(list) {
+	case 0:
+		return nil, ErrRecordNotFound
+	case 1:
+		sp := list[0]
+		return s.resolved(userIDStr, sp.WorkstationID, recordTypeSpecimen, sp.SpecimenID, sp.OccurrenceID, sp.CatalogNumber)
+	default:
+		return nil, ErrAmbiguousRecord
+	}
+}
+
+func (s *resolverService) resolveShortCode(userIDStr string, code string) (*model.ResolvedRecord, error) {
+	rc, err := s.codeRepo.FindByCode(code)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	switch rc.TargetType {
+	case recordTypeOccurrence:
+		return s.resolved(userIDStr, rc.WorkstationID, recordTypeOccurrence, rc.TargetID, rc.TargetID, nil)
+	case recordTypeSpecimen:
+		sp, err := s.specimenRepo.FindByID(rc.TargetID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrRecordNotFound
+			}
+			return nil, err
+		}
+		return s.resolved(userIDStr, sp.WorkstationID, recordTypeSpecimen, sp.SpecimenID, sp.OccurrenceID, sp.CatalogNumber)
+	}
+	return nil, ErrRecordNotFound
+}
+
+// resolved はワークステーションのメンバーかを確かめてから結果を作るのだ
+// 見つかったことを隠すため、メンバーでなければ 404 と同じ扱いにするのだ
+func (s *resolverService) resolved(userIDStr string, workstationID int64, recordType, id, occurrenceID string, catalogNumber *string) (*model.ResolvedRecord, error) {
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		if errors.Is(err, ErrWorkstationAccessDenied) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	rc, err := ensureRecordCode(s.codeRepo, workstationID, recordType, id)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &model.ResolvedRecord{
+		Type:          recordType,
+		ID:            id,
+		WorkstationID: workstationID,
+		OccurrenceID:  occurrenceID,
+		CatalogNumber: catalogNumber,
+		Code:          rc.Code,
+	}
+	if recordType == recordTypeSpecimen {
+		res.URL = fmt.Sprintf("/api/workstation/%d/specimens/%s", workstationID, url.PathEscape(id))
+		res.PageURL = fmt.Sprintf("%s/workstation/%d/specimens/%s", s.appBaseURL, workstationID, url.PathEscape(id))
+	} else {
+		res.URL = fmt.Sprintf("/api/search?workstation_id=%d&occurrence_id=%s", workstationID, url.QueryEscape(id))
+		res.PageURL = fmt.Sprintf("%s/workstation/%d/occurrences/%s", s.appBaseURL, workstationID, url.PathEscape(id))
+	}
+	return res, nil
+}
+
+func (s *resolverService) OccurrenceCode(userIDStr string, occurrenceID string) (*entity.RecordCode, error) {
+	occ, err := s.specimenRepo.FindOccurrence(occurrenceID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOccurrenceNotFound
+		}
+		return nil, err
+	}
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, occ.WorkstationID); err != nil {
+		return nil, err
+	}
+	return ensureRecordCode(s.codeRepo, occ.WorkstationID, recordTypeOccurrence, occ.OccurrenceID)
+}
+
+func (s *resolverService) SpecimenCode(userIDStr string, workstationID int64, specimenID string) (*entity.RecordCode, error) {
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	sp, err := s.specimenRepo.FindByID(specimenID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSpecimenNotFound
+		}
+		return nil, err
+	}
+	if sp.WorkstationID != workstationID {
+		return nil, ErrSpecimenNotFound
+	}
+	return ensureRecordCode(s.codeRepo, workstationID, recordTypeSpecimen, sp.SpecimenID)
+}
+
+// ensureRecordCode はレコードの短いコードを返すのだ。まだなければ作るのだ
+// コードが他と重なったときは作り直し、同時に作られたときは先にできた方を使うのだ
+func ensureRecordCode(codeRepo repository.RecordCodeRepository, workstationID int64, targetType, targetID string) (*entity.RecordCode, error) {
+	for i := 0; i < maxRecordCodeAttempts; i++ {
+		rc, err := codeRepo.FindByTarget(targetType, targetID)
+		if err == nil {
+			return rc, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+
+		rc = &entity.RecordCode{
+			Code:          infrastructure.NewShortCode(),
+			WorkstationID: workstationID,
+			TargetType:    targetType,
+			TargetID:      targetID,
+		}
+		err = codeRepo.Create(rc)
+		if err == nil {
+			return rc, nil
+		}
+		if !errors.Is(err, repository.ErrRecordCodeTaken) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("短いコードを割り当てられませんでした")
+}
+
+// resolverPayloadValue は URL として読み取られたときは最後のパスの部分を取り出すのだ
+// (例: https://example.org/r/7K3M9QXA → 7K3M9QXA)
+func resolverPayloadValue(payload string) string {
+	value := strings.TrimSpace(payload)
+	if u, err := url.Parse(value); err == nil && u.Scheme != "" && u.Host != "" {
+		value = strings.TrimRight(u.Path, "/")
+		if i := strings.LastIndex(value, "/"); i >= 0 {
+			value = value[i+1:]
+		}
+		if unescaped, err := url.PathUnescape(value); err == nil {
+			value = unescaped
+		}
+	}
+	return strings.TrimSpace(value)
+}
@@ -0,0 +1,366 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/saku-730/web-occurrence/backend/internal/entity"
+	"github.com/saku-730/web-occurrence/backend/internal/infrastructure"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/repository"
+	"gorm.io/gorm"
+)
+
+var ErrWorkstationAdminRequired = errors.New("ワークステーションの管理者のみが操作できます")
+var ErrWorkstationEditorRequired = errors.New("閲覧者はこの操作ができません")
+var ErrSensitiveTaxonNotFound = errors.New("指定された設定が見つかりません")
+var ErrInvalidGeneralization = errors.New("generalization は mesh:1 / mesh:2 / mesh:3 / grid:<度> / hidden のいずれかです")
+
+// roleAdministrator は user_roles の administrator なのだ
+const roleAdministrator = 1
+
+// roleEditor は user_roles の editor なのだ
+const roleEditor = 2
+
+type SensitiveTaxonService interface {
+	List(userID string, workstationID int64) ([]entity.SensitiveTaxon, error)
+	Create(userID string, workstationID int64, req *model.SensitiveTaxonRequest) (*entity.SensitiveTaxon, error)
+	Update(userID string, workstationID int64, sensitiveTaxonID string, req *model.SensitiveTaxonRequest) (*entity.SensitiveTaxon, error)
+	Delete(userID string, workstationID int64, sensitiveTaxonID string) error
+}
+
+type sensitiveTaxonService struct {
+	stRepo repository.SensitiveTaxonRepository
+	wsRepo repository.WorkstationRepository
+}
+
+func NewSensitiveTaxonService(stRepo repository.SensitiveTaxonRepository, wsRepo repository.WorkstationRepository) SensitiveTaxonService {
+	return &sensitiveTaxonService{
+		stRepo: stRepo,
+		wsRepo: wsRepo,
+	}
+}
+
+func (s *sensitiveTaxonService) List(userIDStr string, workstationID int64) ([]entity.SensitiveTaxon, error) {
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	list, err := s.stRepo.ListByWorkstationID(workstationID)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []entity.SensitiveTaxon{}
+	}
+	return list, nil
+}
+
+func (s *sensitiveTaxonService) Create(userIDStr string, workstationID int64, req *model.SensitiveTaxonRequest) (*entity.SensitiveTaxon, error) {
+	userID, err := requireWorkstationAdmin(s.wsRepo, userIDStr, workstationID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := parseGeneralization(req.Generalization); err != nil {
+		return nil, err
+	}
+
+	st := &entity.SensitiveTaxon{WorkstationID: workstationID}
+	applySensitiveTaxonRequest(st, req, userID)
+	if err := s.stRepo.Create(st); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+func (s *sensitiveTaxonService) Update(userIDStr string, workstationID int64, sensitiveTaxonID string, req *model.SensitiveTaxonRequest) (*entity.SensitiveTaxon, error) {
+	userID, err := requireWorkstationAdmin(s.wsRepo, userIDStr, workstationID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := parseGeneralization(req.Generalization); err != nil {
+		return nil, err
+	}
+
+	st, err := s.find(workstationID, sensitiveTaxonID)
+	if err != nil {
+		return nil, err
+	}
+	applySensitiveTaxonRequest(st, req, userID)
+	if err := s.stRepo.Update(st); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+func (s *sensitiveTaxonService) Delete(userIDStr string, workstationID int64, sensitiveTaxonID string) error {
+	if _, err := requireWorkstationAdmin(s.wsRepo, userIDStr, workstationID); err != nil {
+		return err
+	}
+	if _, err := s.find(workstationID, sensitiveTaxonID); err != nil {
+		return err
+	}
+	return s.stRepo.Delete(sensitiveTaxonID)
+}
+
+func (s *sensitiveTaxonService) find(workstationID int64, sensitiveTaxonID string) (*entity.SensitiveTaxon, error) {
+	st, err := s.stRepo.FindByID(sensitiveTaxonID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSensitiveTaxonNotFound
+		}
+		return nil, err
+	}
+	if st.WorkstationID != workstationID {
+		return nil, ErrSensitiveTaxonNotFound
+	}
+	return st, nil
+}
+
+func applySensitiveTaxonRequest(st *entity.SensitiveTaxon, req *model.SensitiveTaxonRequest, userID int64) {
+	st.Rank = req.Rank
+	st.Name = strings.TrimSpace(req.Name)
+	st.Generalization = strings.TrimSpace(req.Generalization)
+	st.EmbargoUntil = req.EmbargoUntil
+	st.Note = req.Note
+	st.UserID = userID
+}
+
+// requireWorkstationAdmin はユーザーがワークステーションの管理者かを確認して、ユーザーIDを返すのだ
+func requireWorkstationAdmin(wsRepo repository.WorkstationRepository, userIDStr string, workstationID int64) (int64, error) {
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	roles, err := wsRepo.GetRoleIDsByUserID(userID)
+	if err != nil {
+		return 0, err
+	}
+	role, ok := roles[workstationID]
+	if !ok {
+		return 0, ErrWorkstationAccessDenied
+	}
+	if role != roleAdministrator {
+		return 0, ErrWorkstationAdminRequired
+	}
+	return userID, nil
+}
+
+// requireWorkstationEditor はユーザーがワークステーションの管理者か編集者かを確かめるのだ
+func requireWorkstationEditor(wsRepo repository.WorkstationRepository, userID int64, workstationID int64) error {
+	roles, err := wsRepo.GetRoleIDsByUserID(userID)
+	if err != nil {
+		return err
+	}
+	role, ok := roles[workstationID]
+	if !ok {
+		return ErrWorkstationAccessDenied
+	}
+	if role != roleAdministrator && role != roleEditor {
+		return ErrWorkstationEditorRequired
+	}
+	return nil
+}
+
+// generalization は産地をどこまでぼかすかの指定なのだ
+type generalization struct {
+	text       string
+	hidden     bool
+	meshLength int     // 地域メッシュで丸めるときのコードの桁数
+	grid       float64 // 格子で丸めるときの1マスの大きさ (度)
+}
+
+// generalizationMeshLevels は一般化に使える地域メッシュの次数なのだ (1km より細かいのは意味がないので使わないのだ)
+var generalizationMeshLevels = map[string]int{"1": 4, "2": 6, "3": 8}
+
+func parseGeneralization(text string) (generalization, error) {
+	text = strings.TrimSpace(text)
+	switch {
+	case text == "hidden":
+		return generalization{text: text, hidden: true}, nil
+	case strings.HasPrefix(text, "mesh:"):
+		if length, ok := generalizationMeshLevels[strings.TrimPrefix(text, "mesh:")]; ok {
+			return generalization{text: text, meshLength: length}, nil
+		}
+	case strings.HasPrefix(text, "grid:"):
+		size, err := strconv.ParseFloat(strings.TrimPrefix(text, "grid:"), 64)
+		if err == nil && size > 0 && size <= 10 {
+			return generalization{text: text, grid: size}, nil
+		}
+	}
+	return generalization{}, ErrInvalidGeneralization
+}
+
+// cellDegrees は1マスの南北方向の大きさ (度) で、どちらが粗いかを比べるのに使うのだ
+func (g generalization) cellDegrees() float64 {
+	switch {
+	case g.hidden:
+		return math.Inf(1)
+	case g.meshLength > 0:
+		bounds, _ := infrastructure.JISMeshBounds(strings.Repeat("0", g.meshLength))
+		return bounds[3] - bounds[1]
+	default:
+		return g.grid
+	}
+}
+
+// aggregateMeshLength はメッシュ集計で使ってよいメッシュコードの桁数なのだ (0 なら集計に含めないのだ)
+func (g generalization) aggregateMeshLength() int {
+	if g.hidden {
+		return 0
+	}
+	if g.meshLength > 0 {
+		return g.meshLength
+	}
+	// 格子の大きさ以上のメッシュのうち、いちばん細かいものを使うのだ
+	for _, length := range []int{8, 6, 4} {
+		if (generalization{meshLength: length}).cellDegrees() >= g.grid {
+			return length
+		}
+	}
+	return 0
+}
+
+// effectiveGeneralization は検索結果の sensitivity (カンマ区切り) からいちばん粗い指定を選ぶのだ
+// 読めない指定があれば、安全側に倒して座標を出さないことにするのだ
+func effectiveGeneralization(sensitivity string) (generalization, bool) {
+	if strings.TrimSpace(sensitivity) == "" {
+		return generalization{}, false
+	}
+	var result generalization
+	for _, text := range strings.Split(sensitivity, ",") {
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		g, err := parseGeneralization(text)
+		if err != nil {
+			return generalization{text: "hidden", hidden: true}, true
+		}
+		if result.text == "" || g.cellDegrees() > result.cellDegrees() {
+			result = g
+		}
+	}
+	return result, result.text != ""
+}
+
+// coordinateAccess はユーザーが元の精度の座標を見られるワークステーションなのだ
+// 管理者だけが元の精度で見られて、それ以外のロールには一般化した座標を返すのだ
+type coordinateAccess struct {
+	fullPrecision map[int64]bool
+}
+
+func loadCoordinateAccess(wsRepo repository.WorkstationRepository, userIDStr string) (*coordinateAccess, error) {
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := wsRepo.GetRoleIDsByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	access := &coordinateAccess{fullPrecision: map[int64]bool{}}
+	for wsID, role := range roles {
+		if role == roleAdministrator {
+			access.fullPrecision[wsID] = true
+		}
+	}
+	return access, nil
+}
+
+// restrict は検索条件に、一般化されるレコードを空間検索から外す設定を入れるのだ
+// 細かい bbox を何度も投げて元の産地を割り出せないようにするためなのだ
+func (a *coordinateAccess) restrict(q *model.OccurrenceSearchQuery) {
+	q.RestrictSensitive = true
+	q.FullPrecisionWorkstationIDs = []int64{}
+	for wsID := range a.fullPrecision {
+		q.FullPrecisionWorkstationIDs = append(q.FullPrecisionWorkstationIDs, wsID)
+	}
+}
+
+// generalize は必要なら row の座標を一般化するのだ
+func (a *coordinateAccess) generalize(row *model.OccurrenceSearchRow) {
+	if a.fullPrecision[row.WorkstationID] {
+		return
+	}
+	if g, ok := effectiveGeneralization(row.Sensitivity); ok {
+		generalizeRow(row, g)
+	}
+}
+
+// meshLength はメッシュ集計のときに、そのレコードを何桁のメッシュまで出してよいかを返すのだ
+func (a *coordinateAccess) meshLength(workstationID int64, sensitivity string, requested int) int {
+	if a.fullPrecision[workstationID] {
+		return requested
+	}
+	g, ok := effectiveGeneralization(sensitivity)
+	if !ok {
+		return requested
+	}
+	if length := g.aggregateMeshLength(); length < requested {
+		return length
+	}
+	return requested
+}
+
+// publicCoordinateAccess はエクスポートや外部向けの配信で使うのだ
+// ここではロールに関係なく一般化するのだ
+var publicCoordinateAccess = &coordinateAccess{}
+
+// generalizeRow は row の座標を g にしたがって丸めるのだ
+// 丸めた点はマスの中心にして、accuracy をマスの半対角線 (m) まで広げるのだ
+func generalizeRow(row *model.OccurrenceSearchRow, g generalization) {
+	rec := newExportRecord(row)
+	row.CoordinateGeneralization = g.text
+	// 地点名から産地が分かってしまうので地名も外すのだ
+	row.PlaceNameID = nil
+
+	if g.hidden || !rec.hasLoc {
+		row.Latitude, row.Longitude, row.MeshCode = nil, nil, nil
+		row.Coordinates = "null"
+		row.Accuracy = 0
+		return
+	}
+
+	var bounds [4]float64
+	var mesh *string
+	if g.meshLength > 0 {
+		code := ""
+		if row.MeshCode != nil {
+			code = *row.MeshCode
+		} else if c, ok := infrastructure.JISMeshCode(rec.lat, rec.lon); ok {
+			code = c
+		}
+		if len(code) >= g.meshLength {
+			code = code[:g.meshLength]
+			if b, err := infrastructure.JISMeshBounds(code); err == nil {
+				bounds = b
+				mesh = &code
+			}
+		}
+		if mesh == nil {
+			// 地域メッシュの範囲外 (日本の外) は同じくらいの大きさの格子で丸めるのだ
+			g.grid = g.cellDegrees()
+		}
+	}
+	if mesh == nil {
+		minLat := math.Floor(rec.lat/g.grid) * g.grid
+		minLon := math.Floor(rec.lon/g.grid) * g.grid
+		bounds = [4]float64{minLon, minLat, minLon + g.grid, minLat + g.grid}
+	}
+
+	lat := (bounds[1] + bounds[3]) / 2
+	lon := (bounds[0] + bounds[2]) / 2
+	const metersPerDegree = 111320.0
+	dy := (bounds[3] - bounds[1]) * metersPerDegree
+	dx := (bounds[2] - bounds[0]) * metersPerDegree * math.Cos(lat*math.Pi/180)
+	radius := math.Round(math.Hypot(dx, dy) / 2)
+
+	row.Latitude, row.Longitude, row.MeshCode = &lat, &lon, mesh
+	if radius > row.Accuracy {
+		row.Accuracy = radius
+	}
+	point, _ := json.Marshal(map[string]interface{}{"type": "Point", "coordinates": []float64{lon, lat}})
+	row.Coordinates = string(point)
+}
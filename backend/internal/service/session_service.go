@@ -0,0 +1,217 @@
+package service
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/saku-730/web-occurrence/backend/internal/entity"
+	"github.com/saku-730/web-occurrence/backend/internal/infrastructure"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/repository"
+	"gorm.io/gorm"
+)
+
+var ErrInvalidRefreshToken = errors.New("リフレッシュトークンが無効か、期限が切れています")
+var ErrSessionNotFound = errors.New("セッションが見つかりません")
+
+const (
+	// refreshReuseGrace は同じリフレッシュトークンをもう一度使っても許す時間なのだ
+	// 電波の悪い所で応答が届かずに再送したときに、ログアウトさせないためなのだ
+	// 再送で新しいトークンを渡すと、先に渡した後継は使えなくなるのだ (使えるトークンはセッションに1つだけなのだ)
+	refreshReuseGrace = 30 * time.Second
+	// sessionRetention は期限切れ・取り消し済みのセッションを残しておく期間なのだ
+	sessionRetention = 7 * 24 * time.Hour
+)
+
+type SessionService interface {
+	// Issue はログインしたユーザーの新しいセッションとトークンを作るのだ
+	Issue(userID int64, userAgent, ipAddress string) (*model.UserLoginResponse, error)
+	// Refresh はリフレッシュトークンを新しいものに替えて、アクセストークンを取り直すのだ
+	// 使用済みのトークンがまた使われたら、盗まれたとみなしてセッションごと取り消すのだ
+	Refresh(refreshToken string, userAgent, ipAddress string) (*model.UserLoginResponse, error)
+	// IsSessionActive はセッションがまだ使えるかを調べるのだ (AuthMiddleware が使うのだ)
+	IsSessionActive(userID string, sessionID string) (bool, error)
+	// LoggedInAt はセッションを作った (ログインした) 日時を返すのだ
+	LoggedInAt(userID string, sessionID string) (time.Time, error)
+
+	List(userID string, currentSessionID string) ([]model.SessionView, error)
+	Revoke(userID string, sessionID string) error
+	// RevokeAll はユーザーのセッションをすべて取り消すのだ (exceptSessionID は残すのだ)
+	RevokeAll(userID string, exceptSessionID string) error
+}
+
+type sessionService struct {
+	sessionRepo repository.SessionRepository
+}
+
+func NewSessionService(sessionRepo repository.SessionRepository) SessionService {
+	return &sessionService{sessionRepo: sessionRepo}
+}
+
+func (s *sessionService) Issue(userID int64, userAgent, ipAddress string) (*model.UserLoginResponse, error) {
+	now := time.Now()
+	// 古いセッションはログインのついでに片付けるのだ
+	if err := s.sessionRepo.DeleteExpired(now.Add(-sessionRetention)); err != nil {
+		return nil, err
+	}
+
+	refreshToken := infrastructure.NewSecretToken()
+	expiresAt := now.Add(infrastructure.RefreshTokenTTL())
+	sess := &entity.AuthSession{
+		UserID:     userID,
+		UserAgent:  userAgent,
+		IPAddress:  ipAddress,
+		LastUsedAt: now,
+		ExpiresAt:  expiresAt,
+	}
+	token := &entity.RefreshToken{
+		TokenHash: infrastructure.HashSecretToken(refreshToken),
+		ExpiresAt: expiresAt,
+	}
+	if err := s.sessionRepo.Create(sess, token); err != nil {
+		return nil, err
+	}
+	return tokenResponse(sess, refreshToken)
+}
+
+func (s *sessionService) Refresh(refreshToken string, userAgent, ipAddress string) (*model.UserLoginResponse, error) {
+	now := time.Now()
+	hash := infrastructure.HashSecretToken(refreshToken)
+	token, err := s.sessionRepo.FindToken(hash)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+	sess, err := s.sessionRepo.FindByID(token.SessionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+	if sess.RevokedAt != nil || !now.Before(sess.ExpiresAt) || !now.Before(token.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	first, err := s.sessionRepo.MarkTokenUsed(hash, now)
+	if err != nil {
+		return nil, err
+	}
+	if !first {
+		used, err := s.sessionRepo.FindToken(hash)
+		if err != nil {
+			return nil, err
+		}
+		if used.UsedAt == nil || now.Sub(*used.UsedAt) > refreshReuseGrace {
+			if err := s.sessionRepo.Revoke(sess.SessionID, now); err != nil {
+				return nil, err
+			}
+			return nil, ErrInvalidRefreshToken
+		}
+	}
+
+	newToken := infrastructure.NewSecretToken()
+	sess.LastUsedAt = now
+	sess.ExpiresAt = now.Add(infrastructure.RefreshTokenTTL())
+	sess.UserAgent = userAgent
+	sess.IPAddress = ipAddress
+	next := &entity.RefreshToken{
+		TokenHash: infrastructure.HashSecretToken(newToken),
+		ExpiresAt: sess.ExpiresAt,
+	}
+	if err := s.sessionRepo.Rotate(sess, next); err != nil {
+		return nil, err
+	}
+	return tokenResponse(sess, newToken)
+}
+
+func (s *sessionService) IsSessionActive(userIDStr string, sessionID string) (bool, error) {
+	sess, err := s.sessionRepo.FindByID(sessionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return strconv.FormatInt(sess.UserID, 10) == userIDStr &&
+		sess.RevokedAt == nil &&
+		time.Now().Before(sess.ExpiresAt), nil
+}
+
+func (s *sessionService) LoggedInAt(userIDStr string, sessionID string) (time.Time, error) {
+	sess, err := s.sessionRepo.FindByID(sessionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return time.Time{}, ErrSessionNotFound
+		}
+		return time.Time{}, err
+	}
+	if strconv.FormatInt(sess.UserID, 10) != userIDStr || sess.RevokedAt != nil {
+		return time.Time{}, ErrSessionNotFound
+	}
+	return sess.CreatedAt, nil
+}
+
+func (s *sessionService) List(userIDStr string, currentSessionID string) ([]model.SessionView, error) {
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	list, err := s.sessionRepo.ListActive(userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	views := make([]model.SessionView, 0, len(list))
+	for _, sess := range list {
+		views = append(views, model.SessionView{
+			SessionID:  sess.SessionID,
+			UserAgent:  sess.UserAgent,
+			IPAddress:  sess.IPAddress,
+			CreatedAt:  sess.CreatedAt,
+			LastUsedAt: sess.LastUsedAt,
+			ExpiresAt:  sess.ExpiresAt,
+			Current:    sess.SessionID == currentSessionID,
+		})
+	}
+	return views, nil
+}
+
+func (s *sessionService) Revoke(userIDStr string, sessionID string) error {
+	sess, err := s.sessionRepo.FindByID(sessionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSessionNotFound
+		}
+		return err
+	}
+	// 他の人のセッションは無いものとして扱うのだ
+	if strconv.FormatInt(sess.UserID, 10) != userIDStr {
+		return ErrSessionNotFound
+	}
+	return s.sessionRepo.Revoke(sess.SessionID, time.Now())
+}
+
+func (s *sessionService) RevokeAll(userIDStr string, exceptSessionID string) error {
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		return err
+	}
+	return s.sessionRepo.RevokeAllByUserID(userID, exceptSessionID, time.Now())
+}
+
+// tokenResponse はセッションのアクセストークンを作って、リフレッシュトークンと一緒に返すのだ
+func tokenResponse(sess *entity.AuthSession, refreshToken string) (*model.UserLoginResponse, error) {
+	token, err := infrastructure.GenerateToken(strconv.FormatInt(sess.UserID, 10), sess.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	return &model.UserLoginResponse{
+		Token:        token,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(infrastructure.AccessTokenTTL() / time.Second),
+		RefreshToken: refreshToken,
+	}, nil
+}
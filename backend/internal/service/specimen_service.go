@@ -0,0 +1,345 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/saku-730/web-occurrence/backend/internal/entity"
+	"github.com/saku-730/web-occurrence/backend/internal/infrastructure"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/repository"
+	"gorm.io/gorm"
+)
+
+var ErrSpecimenNotFound = errors.New("標本が見つかりません")
+var ErrInvalidSpecimen = errors.New("標本の内容が正しくありません")
+var ErrCatalogNumberConflict = errors.New("この登録番号は既に使われています")
+
+const (
+	defaultSpecimenLimit = 50
+	maxSpecimenLimit     = 500
+	// defaultCatalogPadding は採番の設定で桁数を省略したときのゼロ埋めの桁数なのだ
+	defaultCatalogPadding = 6
+)
+
+// SpecimenDetail は標本と、元の occurrence・作製記録なのだ
+type SpecimenDetail struct {
+	entity.Specimen
+	Occurrence    *entity.Occurrence    `json:"occurrence"`
+	MakeSpecimens []entity.MakeSpecimen `json:"make_specimens"`
+}
+
+type SpecimenService interface {
+	List(userID string, workstationID int64, q *model.SpecimenSearchQuery) ([]entity.Specimen, error)
+	Get(userID string, workstationID int64, specimenID string) (*SpecimenDetail, error)
+	FindByCatalogNumber(userID string, workstationID int64, catalogNumber string) (*SpecimenDetail, error)
+	Create(userID string, workstationID int64, req *model.SpecimenRequest) (*SpecimenDetail, error)
+	Update(userID string, workstationID int64, specimenID string, req *model.SpecimenRequest) (*SpecimenDetail, error)
+	Delete(userID string, workstationID int64, specimenID string) error
+
+	ListSequences(userID string, workstationID int64) ([]entity.CatalogNumberSequence, error)
+	SaveSequence(userID string, workstationID int64, req *model.CatalogNumberSequenceRequest) (*entity.CatalogNumberSequence, error)
+}
+
+type specimenService struct {
+	specimenRepo repository.SpecimenRepository
+	wsRepo       repository.WorkstationRepository
+	couchClient  infrastructure.CouchDBClient
+}
+
+func NewSpecimenService(specimenRepo repository.SpecimenRepository, wsRepo repository.WorkstationRepository, couchClient infrastructure.CouchDBClient) SpecimenService {
+	return &specimenService{
+		specimenRepo: specimenRepo,
+		wsRepo:       wsRepo,
+		couchClient:  couchClient,
+	}
+}
+
+func (s *specimenService) List(userIDStr string, workstationID int64, q *model.SpecimenSearchQuery) ([]entity.Specimen, error) {
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	if q.Limit <= 0 {
+		q.Limit = defaultSpecimenLimit
+	}
+	if q.Limit > maxSpecimenLimit {
+		q.Limit = maxSpecimenLimit
+	}
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+
+	list, err := s.specimenRepo.List(workstationID, q)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []entity.Specimen{}
+	}
+	return list, nil
+}
+
+func (s *specimenService) Get(userIDStr string, workstationID int64, specimenID string) (*SpecimenDetail, error) {
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	sp, err := s.findSpecimen(workstationID, specimenID)
+	if err != nil {
+		return nil, err
+	}
+	return s.detail(sp)
+}
+
+// FindByCatalogNumber は登録番号で標本を引くのだ (前後の空白は無視するのだ)
+func (s *specimenService) FindByCatalogNumber(userIDStr string, workstationID int64, catalogNumber string) (*SpecimenDetail, error) {
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	sp, err := s.specimenRepo.FindByCatalogNumber(workstationID, strings.TrimSpace(catalogNumber))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSpecimenNotFound
+		}
+		return nil, err
+	}
+	return s.detail(sp)
+}
+
+func (s *specimenService) Create(userIDStr string, workstationID int64, req *model.SpecimenRequest) (*SpecimenDetail, error) {
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+
+	sp := &entity.Specimen{WorkstationID: workstationID}
+	if err := s.apply(sp, req); err != nil {
+		return nil, err
+	}
+	prep := &entity.MakeSpecimen{UserID: userID, CreatedAt: time.Now()}
+	if req.PreparedAt != nil {
+		prep.CreatedAt = *req.PreparedAt
+	}
+	if err := s.specimenRepo.Create(sp, prep); err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, ErrCatalogNumberConflict
+		}
+		return nil, err
+	}
+
+	if err := s.writeCouchDocument(sp, prep); err != nil {
+		return nil, err
+	}
+	return s.detail(sp)
+}
+
+func (s *specimenService) Update(userIDStr string, workstationID int64, specimenID string, req *model.SpecimenRequest) (*SpecimenDetail, error) {
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	sp, err := s.findSpecimen(workstationID, specimenID)
+	if err != nil {
+		return nil, err
+	}
+	// 登録番号を省略したときは今の番号のままにするのだ
+	if req.CatalogNumber == nil {
+		req.CatalogNumber = sp.CatalogNumber
+	}
+	previous := *sp
+	if err := s.apply(sp, req); err != nil {
+		return nil, err
+	}
+	if err := s.specimenRepo.Update(sp); err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, ErrCatalogNumberConflict
+		}
+		return nil, err
+	}
+
+	// 別の occurrence に付け替えたときは、元のドキュメントからも外すのだ
+	if previous.OccurrenceID != sp.OccurrenceID {
+		if err := s.removeFromCouchDocument(&previous); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.writeCouchDocument(sp, nil); err != nil {
+		return nil, err
+	}
+	return s.detail(sp)
+}
+
+func (s *specimenService) Delete(userIDStr string, workstationID int64, specimenID string) error {
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return err
+	}
+	sp, err := s.findSpecimen(workstationID, specimenID)
+	if err != nil {
+		return err
+	}
+	if err := s.specimenRepo.Delete(sp.SpecimenID); err != nil {
+		return err
+	}
+	return s.removeFromCouchDocument(sp)
+}
+
+func (s *specimenService) ListSequences(userIDStr string, workstationID int64) ([]entity.CatalogNumberSequence, error) {
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	list, err := s.specimenRepo.ListSequences(workstationID)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []entity.CatalogNumberSequence{}
+	}
+	return list, nil
+}
+
+// SaveSequence は採番の設定を作成・更新するのだ (管理者のみ)
+func (s *specimenService) SaveSequence(userIDStr string, workstationID int64, req *model.CatalogNumberSequenceRequest) (*entity.CatalogNumberSequence, error) {
+	if _, err := requireWorkstationAdmin(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+
+	collectionID := strings.TrimSpace(req.CollectionID)
+	return s.specimenRepo.SaveSequence(workstationID, collectionID, func(seq *entity.CatalogNumberSequence) {
+		seq.Prefix = req.Prefix
+		seq.Padding = req.Padding
+		if seq.Padding == 0 {
+			seq.Padding = defaultCatalogPadding
+		}
+		if req.NextValue != nil {
+			seq.NextValue = *req.NextValue
+		}
+	})
+}
+
+func (s *specimenService) findSpecimen(workstationID int64, specimenID string) (*entity.Specimen, error) {
+	return findWorkstationSpecimen(s.specimenRepo, workstationID, specimenID)
+}
+
+// findWorkstationSpecimen はワークステーションの標本を探すのだ (他のワークステーションの標本は見つからない扱いなのだ)
+func findWorkstationSpecimen(specimenRepo repository.SpecimenRepository, workstationID int64, specimenID string) (*entity.Specimen, error) {
+	sp, err := specimenRepo.FindByID(specimenID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSpecimenNotFound
+		}
+		return nil, err
+	}
+	if sp.WorkstationID != workstationID {
+		return nil, ErrSpecimenNotFound
+	}
+	return sp, nil
+}
+
+// apply はリクエストの内容を標本に入れるのだ
+// occurrence は同じワークステーションのものだけを指定できるのだ
+func (s *specimenService) apply(sp *entity.Specimen, req *model.SpecimenRequest) error {
+	occ, err := s.specimenRepo.FindOccurrence(req.OccurrenceID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: occurrence が見つかりません", ErrInvalidSpecimen)
+		}
+		return err
+	}
+	if occ.WorkstationID != sp.WorkstationID {
+		return fmt.Errorf("%w: occurrence が見つかりません", ErrInvalidSpecimen)
+	}
+
+	sp.OccurrenceID = occ.OccurrenceID
+	sp.InstitutionID = req.InstitutionID
+	sp.CollectionID = strings.TrimSpace(req.CollectionID)
+	sp.SpecimenMethodID = req.SpecimenMethodID
+	sp.Note = req.Note
+	sp.CatalogNumber = nil
+	if req.CatalogNumber != nil {
+		if number := strings.TrimSpace(*req.CatalogNumber); number != "" {
+			sp.CatalogNumber = &number
+		}
+	}
+	return nil
+}
+
+func (s *specimenService) detail(sp *entity.Specimen) (*SpecimenDetail, error) {
+	occ, err := s.specimenRepo.FindOccurrence(sp.OccurrenceID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	preps, err := s.specimenRepo.FindMakeSpecimens(sp.SpecimenID)
+	if err != nil {
+		return nil, err
+	}
+	if preps == nil {
+		preps = []entity.MakeSpecimen{}
+	}
+	return &SpecimenDetail{Specimen: *sp, Occurrence: occ, MakeSpecimens: preps}, nil
+}
+
+// writeCouchDocument は CouchDB の occurrence ドキュメントの specimens に標本を書き込むのだ
+// 作製記録 prep を渡さないときは、既にある make_specimen_id をそのまま使うのだ
+func (s *specimenService) writeCouchDocument(sp *entity.Specimen, prep *entity.MakeSpecimen) error {
+	return patchOccurrenceDocument(s.couchClient, sp.WorkstationID, sp.OccurrenceID, func(doc map[string]interface{}) error {
+		items, _ := doc["specimens"].([]interface{})
+		item := map[string]interface{}{}
+		index := -1
+		for i, existing := range items {
+			if m, ok := existing.(map[string]interface{}); ok && m["specimen_id"] == sp.SpecimenID {
+				item, index = m, i
+				break
+			}
+		}
+
+		item["specimen_id"] = sp.SpecimenID
+		item["institution_id"] = sp.InstitutionID
+		item["collection_id"] = sp.CollectionID
+		item["specimen_method_id"] = sp.SpecimenMethodID
+		item["catalog_number"] = sp.CatalogNumber
+		item["note"] = sp.Note
+		if prep != nil {
+			item["make_specimen_id"] = prep.MakeSpecimenID
+			item["created_at"] = prep.CreatedAt.Format(time.RFC3339)
+		}
+		// validate_doc_update が make_specimen_id を必須にしているのだ
+		if _, ok := item["make_specimen_id"]; !ok {
+			preps, err := s.specimenRepo.FindMakeSpecimens(sp.SpecimenID)
+			if err != nil {
+				return err
+			}
+			if len(preps) == 0 {
+				return nil
+			}
+			item["make_specimen_id"] = preps[0].MakeSpecimenID
+		}
+
+		if index >= 0 {
+			items[index] = item
+		} else {
+			items = append(items, item)
+		}
+		doc["specimens"] = items
+		return nil
+	})
+}
+
+// removeFromCouchDocument は CouchDB の occurrence ドキュメントの specimens から標本を外すのだ
+func (s *specimenService) removeFromCouchDocument(sp *entity.Specimen) error {
+	return patchOccurrenceDocument(s.couchClient, sp.WorkstationID, sp.OccurrenceID, func(doc map[string]interface{}) error {
+		items, _ := doc["specimens"].([]interface{})
+		kept := make([]interface{}, 0, len(items))
+		for _, item := range items {
+			if m, ok := item.(map[string]interface{}); ok && m["specimen_id"] == sp.SpecimenID {
+				continue
+			}
+			kept = append(kept, item)
+		}
+		doc["specimens"] = kept
+		return nil
+	})
+}
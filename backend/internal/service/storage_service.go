@@ -0,0 +1,323 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/saku-730/web-occurrence/backend/internal/entity"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/repository"
+	"gorm.io/gorm"
+)
+
+var ErrStorageLocationNotFound = errors.New("保管場所が見つかりません")
+var ErrInvalidStorageLocation = errors.New("保管場所の内容が正しくありません")
+var ErrStorageLocationConflict = errors.New("同じ場所に同じ名前の保管場所があります")
+var ErrStorageLocationInUse = errors.New("中に保管場所か標本があるため削除できません")
+
+const (
+	movementMove       = "move"
+	movementLoanOut    = "loan_out"
+	movementLoanReturn = "loan_return"
+)
+
+// storageKindLevels は保管場所の階層の深さなのだ。親は必ず浅い階層でないといけないのだ
+var storageKindLevels = map[string]int{
+	"building": 0,
+	"room":     1,
+	"cabinet":  2,
+	"drawer":   3,
+}
+
+type StorageService interface {
+	ListLocations(userID string, workstationID int64) ([]model.StorageLocationView, error)
+	CreateLocation(userID string, workstationID int64, req *model.StorageLocationRequest) (*model.StorageLocationView, error)
+	UpdateLocation(userID string, workstationID int64, locationID string, req *model.StorageLocationRequest) (*model.StorageLocationView, error)
+	DeleteLocation(userID string, workstationID int64, locationID string) error
+
+	MoveSpecimen(userID string, workstationID int64, specimenID string, req *model.SpecimenMoveRequest) (*entity.SpecimenMovement, error)
+	ListMovements(userID string, workstationID int64, specimenID string) ([]entity.SpecimenMovement, error)
+}
+
+type storageService struct {
+	storageRepo  repository.StorageRepository
+	specimenRepo repository.SpecimenRepository
+	wsRepo       repository.WorkstationRepository
+}
+
+func NewStorageService(storageRepo repository.StorageRepository, specimenRepo repository.SpecimenRepository, wsRepo repository.WorkstationRepository) StorageService {
+	return &storageService{
+		storageRepo:  storageRepo,
+		specimenRepo: specimenRepo,
+		wsRepo:       wsRepo,
+	}
+}
+
+func (s *storageService) ListLocations(userIDStr string, workstationID int64) ([]model.StorageLocationView, error) {
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	return s.locationViews(workstationID)
+}
+
+// CreateLocation は保管場所を作るのだ (管理者のみ)
+func (s *storageService) CreateLocation(userIDStr string, workstationID int64, req *model.StorageLocationRequest) (*model.StorageLocationView, error) {
+	if _, err := requireWorkstationAdmin(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	loc := &entity.StorageLocation{WorkstationID: workstationID}
+	if err := s.apply(loc, req, nil); err != nil {
+		return nil, err
+	}
+	if err := s.storageRepo.CreateLocation(loc); err != nil {
+		if errors.Is(err, repository.ErrStorageLocationNameTaken) {
+			return nil, ErrStorageLocationConflict
+		}
+		return nil, err
+	}
+	return s.locationView(workstationID, loc.LocationID)
+}
+
+// UpdateLocation は保管場所の名前や親を変えるのだ (管理者のみ)
+func (s *storageService) UpdateLocation(userIDStr string, workstationID int64, locationID string, req *model.StorageLocationRequest) (*model.StorageLocationView, error) {
+	if _, err := requireWorkstationAdmin(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	loc, err := s.findLocation(workstationID, locationID)
+	if err != nil {
+		return nil, err
+	}
+	all, err := s.storageRepo.ListLocations(workstationID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.apply(loc, req, all); err != nil {
+		return nil, err
+	}
+	if err := s.storageRepo.UpdateLocation(loc); err != nil {
+		if errors.Is(err, repository.ErrStorageLocationNameTaken) {
+			return nil, ErrStorageLocationConflict
+		}
+		return nil, err
+	}
+	return s.locationView(workstationID, loc.LocationID)
+}
+
+// DeleteLocation は空の保管場所を削除するのだ (管理者のみ)
+func (s *storageService) DeleteLocation(userIDStr string, workstationID int64, locationID string) error {
+	if _, err := requireWorkstationAdmin(s.wsRepo, userIDStr, workstationID); err != nil {
+		return err
+	}
+	loc, err := s.findLocation(workstationID, locationID)
+	if err != nil {
+		return err
+	}
+	children, err := s.storageRepo.CountChildren(loc.LocationID)
+	if err != nil {
+		return err
+	}
+	counts, err := s.storageRepo.CountSpecimens(workstationID)
+	if err != nil {
+		return err
+	}
+	if children > 0 || counts[loc.LocationID] > 0 {
+		return ErrStorageLocationInUse
+	}
+	return s.storageRepo.DeleteLocation(loc.LocationID)
+}
+
+// MoveSpecimen は標本を別の保管場所に移して、移動の履歴を残すのだ
+func (s *storageService) MoveSpecimen(userIDStr string, workstationID int64, specimenID string, req *model.SpecimenMoveRequest) (*entity.SpecimenMovement, error) {
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	sp, err := findWorkstationSpecimen(s.specimenRepo, workstationID, specimenID)
+	if err != nil {
+		return nil, err
+	}
+
+	var to *string
+	if req.LocationID != nil && *req.LocationID != "" {
+		loc, err := s.findLocation(workstationID, *req.LocationID)
+		if err != nil {
+			if errors.Is(err, ErrStorageLocationNotFound) {
+				return nil, fmt.Errorf("%w: 移動先の保管場所が見つかりません", ErrInvalidStorageLocation)
+			}
+			return nil, err
+		}
+		to = &loc.LocationID
+	}
+	if sameLocation(sp.StorageLocationID, to) {
+		return nil, fmt.Errorf("%w: 標本は既にその保管場所にあります", ErrInvalidStorageLocation)
+	}
+
+	mv := &entity.SpecimenMovement{
+		SpecimenID:     sp.SpecimenID,
+		WorkstationID:  workstationID,
+		Kind:           movementMove,
+		FromLocationID: sp.StorageLocationID,
+		ToLocationID:   to,
+		Note:           req.Note,
+		MovedBy:        userID,
+		MovedAt:        time.Now(),
+	}
+	if req.MovedAt != nil {
+		mv.MovedAt = *req.MovedAt
+	}
+	if err := s.storageRepo.MoveSpecimen(sp.SpecimenID, to, mv); err != nil {
+		return nil, err
+	}
+	return mv, nil
+}
+
+func (s *storageService) ListMovements(userIDStr string, workstationID int64, specimenID string) ([]entity.SpecimenMovement, error) {
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	sp, err := findWorkstationSpecimen(s.specimenRepo, workstationID, specimenID)
+	if err != nil {
+		return nil, err
+	}
+	list, err := s.storageRepo.ListMovements(sp.SpecimenID)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []entity.SpecimenMovement{}
+	}
+	return list, nil
+}
+
+func (s *storageService) findLocation(workstationID int64, locationID string) (*entity.StorageLocation, error) {
+	loc, err := s.storageRepo.FindLocation(locationID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrStorageLocationNotFound
+		}
+		return nil, err
+	}
+	if loc.WorkstationID != workstationID {
+		return nil, ErrStorageLocationNotFound
+	}
+	return loc, nil
+}
+
+// apply はリクエストの内容を保管場所に入れるのだ
+// 親は同じワークステーションの、より浅い階層でないといけないのだ
+// 更新のときは all (ワークステーションの全保管場所) から子の階層も確かめるのだ
+func (s *storageService) apply(loc *entity.StorageLocation, req *model.StorageLocationRequest, all []entity.StorageLocation) error {
+	level := storageKindLevels[req.Kind]
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return fmt.Errorf("%w: 名前が空です", ErrInvalidStorageLocation)
+	}
+
+	var parentID *string
+	if req.ParentID != nil && *req.ParentID != "" {
+		parent, err := s.findLocation(loc.WorkstationID, *req.ParentID)
+		if err != nil {
+			if errors.Is(err, ErrStorageLocationNotFound) {
+				return fmt.Errorf("%w: 親の保管場所が見つかりません", ErrInvalidStorageLocation)
+			}
+			return err
+		}
+		if storageKindLevels[parent.Kind] >= level {
+			return fmt.Errorf("%w: %s の中に %s は置けません", ErrInvalidStorageLocation, parent.Kind, req.Kind)
+		}
+		parentID = &parent.LocationID
+	}
+	// 階層は親より必ず深くなるので、子より浅いままなら循環もしないのだ
+	for _, child := range all {
+		if child.ParentID != nil && *child.ParentID == loc.LocationID && storageKindLevels[child.Kind] <= level {
+			return fmt.Errorf("%w: 中にある %s より深い階層にはできません", ErrInvalidStorageLocation, child.Kind)
+		}
+	}
+
+	loc.ParentID = parentID
+	loc.Kind = req.Kind
+	loc.Name = name
+	loc.Note = req.Note
+	return nil
+}
+
+func (s *storageService) locationView(workstationID int64, locationID string) (*model.StorageLocationView, error) {
+	views, err := s.locationViews(workstationID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range views {
+		if views[i].LocationID == locationID {
+			return &views[i], nil
+		}
+	}
+	return nil, ErrStorageLocationNotFound
+}
+
+// locationViews はワークステーションの保管場所を、上の階層からの名前を付けて返すのだ
+func (s *storageService) locationViews(workstationID int64) ([]model.StorageLocationView, error) {
+	list, err := s.storageRepo.ListLocations(workstationID)
+	if err != nil {
+		return nil, err
+	}
+	counts, err := s.storageRepo.CountSpecimens(workstationID)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]*entity.StorageLocation, len(list))
+	for i := range list {
+		byID[list[i].LocationID] = &list[i]
+	}
+	views := make([]model.StorageLocationView, 0, len(list))
+	for _, loc := range list {
+		views = append(views, model.StorageLocationView{
+			LocationID:    loc.LocationID,
+			WorkstationID: loc.WorkstationID,
+			ParentID:      loc.ParentID,
+			Kind:          loc.Kind,
+			Name:          loc.Name,
+			Note:          loc.Note,
+			Path:          storageLocationPath(byID, &loc),
+			SpecimenCount: counts[loc.LocationID],
+			UpdatedAt:     loc.UpdatedAt,
+		})
+	}
+	sortStorageLocationViews(views)
+	return views, nil
+}
+
+// storageLocationPath は一番上の階層からの名前を " / " でつなぐのだ
+func storageLocationPath(byID map[string]*entity.StorageLocation, loc *entity.StorageLocation) string {
+	names := []string{loc.Name}
+	for depth := 0; loc.ParentID != nil && depth < len(storageKindLevels); depth++ {
+		parent, ok := byID[*loc.ParentID]
+		if !ok {
+			break
+		}
+		names = append([]string{parent.Name}, names...)
+		loc = parent
+	}
+	return strings.Join(names, " / ")
+}
+
+// sortStorageLocationViews は木の順 (親のすぐ後に子) になるよう path で並べるのだ
+func sortStorageLocationViews(views []model.StorageLocationView) {
+	sort.SliceStable(views, func(i, j int) bool {
+		return views[i].Path < views[j].Path
+	})
+}
+
+func sameLocation(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"strconv"
@@ -23,10 +24,11 @@ type syncService struct {
 	db          *gorm.DB
 	couchClient infrastructure.CouchDBClient
 	wsRepo      repository.WorkstationRepository
+	taxonRepo   repository.TaxonRepository
 	dbPrefix    string
 }
 
-func NewSyncService(db *gorm.DB, couchClient infrastructure.CouchDBClient, wsRepo repository.WorkstationRepository) SyncService {
+func NewSyncService(db *gorm.DB, couchClient infrastructure.CouchDBClient, wsRepo repository.WorkstationRepository, taxonRepo repository.TaxonRepository) SyncService {
 	prefix := os.Getenv("COUCHDB_DB_PREFIX")
 	    if prefix == "" {
 		prefix = "db"
@@ -35,6 +37,7 @@ func NewSyncService(db *gorm.DB, couchClient infrastructure.CouchDBClient, wsRep
 		db:          db,
 		couchClient: couchClient,
 		wsRepo:      wsRepo,
+		taxonRepo:   taxonRepo,
 		dbPrefix:    prefix,
 	}
 }
@@ -58,6 +61,9 @@ func (s *syncService) syncAll() {
 		return
 	}
 
+	// 同じ名前を何度もチェックリストで引かないように、1回の同期の間は結果を覚えておくのだ
+	checker := newClassificationChecker(s.taxonRepo)
+
 	// 2. 各ワークステーションのCouchDBデータベースを確認
 	for _, ws := range workstations {
 		dbName := fmt.Sprintf("%s_ws_%d", s.dbPrefix, ws.WorkstationID)
@@ -70,7 +76,7 @@ func (s *syncService) syncAll() {
 		}
 
 		for _, doc := range docs {
-			if err := s.ProcessDocument(doc); err != nil {
+			if err := s.processDocument(doc, checker); err != nil {
 				log.Printf("Failed to process doc %v in %s: %v", doc["_id"], dbName, err)
 			}
 		}
@@ -78,6 +84,10 @@ func (s *syncService) syncAll() {
 }
 
 func (s *syncService) ProcessDocument(doc map[string]interface{}) error {
+	return s.processDocument(doc, newClassificationChecker(s.taxonRepo))
+}
+
+func (s *syncService) processDocument(doc map[string]interface{}, checker *classificationChecker) error {
 	docType, _ := doc["type"].(string)
 	if docType != "occurrence" {
 		return nil
@@ -115,6 +125,13 @@ func (s *syncService) ProcessDocument(doc map[string]interface{}) error {
 				Coordinates: string(coordJSON),
 				Accuracy:    accuracy,
 			}
+			// 空間検索用に緯度経度を JGD2011 に変換して持っておくのだ
+			// 元の値は coordinates (jsonb) にそのまま残るのだ
+			// 変換できない測地系のときは、座標を消して保存せずに、このドキュメントを同期しないのだ
+			// (validate_doc_update でも断るので、ここに来るのは古いドキュメントだけなのだ)
+			if err := normalizePlaceCoordinates(&pl, placeDatum(data.PlaceData.Datum, data.PlaceData.Coordinates)); err != nil {
+				return fmt.Errorf("place %s: 座標を正規化できませんでした: %w", pl.PlaceID, err)
+			}
 			if err := tx.Save(&pl).Error; err != nil { return err }
 		}
 
@@ -132,6 +149,29 @@ func (s *syncService) ProcessDocument(doc map[string]interface{}) error {
 		langID := ""
 		if data.LanguageID != nil { langID = *data.LanguageID }
 
+		// 産地を一般化する指定 (読めない指定は検索時に座標を出さない扱いになるのだ)
+		var sensitivity *string
+		if data.OccurrenceData.Sensitivity != nil && *data.OccurrenceData.Sensitivity != "" {
+			sensitivity = data.OccurrenceData.Sensitivity
+			if _, err := parseGeneralization(*sensitivity); err != nil {
+				log.Printf("Occurrence %s: sensitivity %q を読めないので座標を出さない扱いにします", data.ID, *sensitivity)
+			}
+		}
+		embargoUntil := parseEmbargoUntil(data.OccurrenceData.EmbargoUntil)
+
+		// 同定の合意は PostgreSQL の値 (同定と投票から計算したもの) を残すのだ
+		// ドキュメントの identification_status はメンバーが書き換えられるので読まないのだ
+		var current entity.Occurrence
+		qualityGrade := QualityGradeUnidentified
+		err := tx.Select("quality_grade", "consensus_identification_id").
+			Where("occurrence_id = ?", data.ID).
+			Take(&current).Error
+		if err == nil {
+			qualityGrade = current.QualityGrade
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
 		occ := entity.Occurrence{
 			OccurrenceID:     data.ID,
 			WorkstationID:    wsID,
@@ -147,6 +187,23 @@ func (s *syncService) ProcessDocument(doc map[string]interface{}) error {
 			LanguageID:       langID,
 			CreatedAt:        createdAt,
 			Timezone:         data.Timezone,
+			Sensitivity:      sensitivity,
+			EmbargoUntil:     embargoUntil,
+			QualityGrade:     qualityGrade,
+			ConsensusIdentificationID: current.ConsensusIdentificationID,
+		}
+		// 分類名をチェックリストと照らし合わせた結果を残すのだ (チェックリストに無い名前でも記録は同期するのだ)
+		names := map[string]string{}
+		for rank, value := range data.ClassificationData.ClassClassification {
+			if name, ok := value.(string); ok {
+				names[rank] = name
+			}
+		}
+		check, err := checker.Check(wsID, names)
+		if err != nil { return err }
+		if check != nil {
+			occ.NameStatus = &check.Status
+			occ.TaxonID = check.TaxonID
 		}
 		if err := tx.Save(&occ).Error; err != nil { return err }
 
@@ -155,6 +212,63 @@ func (s *syncService) ProcessDocument(doc map[string]interface{}) error {
 	})
 }
 
+// parseEmbargoUntil は embargo_until (RFC3339 か日付だけ) を読むのだ
+func parseEmbargoUntil(text *string) *time.Time {
+	if text == nil || *text == "" {
+		return nil
+	}
+	if t, err := time.Parse(time.RFC3339, *text); err == nil {
+		return &t
+	}
+	if t, err := time.Parse("2006-01-02", *text); err == nil {
+		return &t
+	}
+	return nil
+}
+
+// placeDatum は place_data.datum、なければ GeoJSON の crs メンバーから測地系を読むのだ
+func placeDatum(datum *string, coordinates map[string]interface{}) string {
+	if datum != nil && *datum != "" {
+		return *datum
+	}
+	if crs, ok := coordinates["crs"].(map[string]interface{}); ok {
+		if props, ok := crs["properties"].(map[string]interface{}); ok {
+			if name, ok := props["name"].(string); ok {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// normalizePlaceCoordinates は coordinates を JGD2011 の緯度経度とメッシュコードにするのだ
+// 座標が無いときは緯度経度も無しにするのだ。測地系が分からないときはエラーを返すのだ
+func normalizePlaceCoordinates(pl *entity.Place, datum string) error {
+	pl.Latitude, pl.Longitude, pl.MeshCode, pl.Datum = nil, nil, nil, nil
+
+	rawLat, rawLon, ok := decodeCoordinates(pl.Coordinates)
+	if !ok {
+		return nil
+	}
+
+	code, err := infrastructure.NormalizeDatum(datum)
+	if err != nil {
+		return err
+	}
+	lat, lon, err := infrastructure.ConvertToJGD2011(rawLat, rawLon, code)
+	if err != nil {
+		return err
+	}
+
+	pl.Datum = &code
+	pl.Latitude = &lat
+	pl.Longitude = &lon
+	if mesh, ok := infrastructure.JISMeshCode(lat, lon); ok {
+		pl.MeshCode = &mesh
+	}
+	return nil
+}
+
 type IncomingOccurrenceData struct {
 	ID              string `json:"_id"`
 	WorkstationID   string `json:"workstation_id"`
@@ -170,6 +284,8 @@ type IncomingOccurrenceData struct {
 		Sex          string   `json:"sex"`
 		BodyLength   *float64 `json:"body_length"`
 		Note         string   `json:"note"`
+		Sensitivity  *string  `json:"sensitivity"`   // mesh:1 / mesh:2 / mesh:3 / grid:<度> / hidden
+		EmbargoUntil *string  `json:"embargo_until"` // この日時を過ぎたら元の精度で出すのだ
 	} `json:"occurrence_data"`
 
 	ClassificationData struct {
@@ -182,5 +298,7 @@ type IncomingOccurrenceData struct {
 		PlaceNameID *string                `json:"place_name_id"`
 		Coordinates map[string]interface{} `json:"coordinates"`
 		Accuracy    *float64               `json:"accuracy"`
+		Datum       *string                `json:"datum"`
 	} `json:"place_data"`
+
 }
@@ -0,0 +1,408 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/saku-730/web-occurrence/backend/internal/entity"
+	"github.com/saku-730/web-occurrence/backend/internal/infrastructure"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/repository"
+	"gorm.io/gorm"
+)
+
+var ErrTaxonNotFound = errors.New("分類が見つかりません")
+var ErrInvalidChecklist = errors.New("チェックリストを読めません")
+
+const (
+	defaultTaxonLimit   = 20
+	maxTaxonLimit       = 200
+	taxonImportBatch    = 1000
+	maxTaxonImportError = 20
+)
+
+// TaxonDetail は分類1件と、その有効名・異名の一覧なのだ
+type TaxonDetail struct {
+	entity.Taxon
+	Accepted *entity.Taxon  `json:"accepted"`
+	Synonyms []entity.Taxon `json:"synonyms"`
+}
+
+type TaxonService interface {
+	Import(userID string, workstationID int64, file io.ReaderAt, size int64) (*model.TaxonImportResult, error)
+	Search(userID string, workstationID int64, q *model.TaxonSearchQuery) ([]model.TaxonMatch, error)
+	Validate(userID string, workstationID int64, q *model.TaxonValidationQuery) (*model.TaxonValidation, error)
+	Get(userID string, workstationID int64, taxonID string) (*TaxonDetail, error)
+}
+
+type taxonService struct {
+	taxonRepo repository.TaxonRepository
+	wsRepo    repository.WorkstationRepository
+}
+
+func NewTaxonService(taxonRepo repository.TaxonRepository, wsRepo repository.WorkstationRepository) TaxonService {
+	return &taxonService{
+		taxonRepo: taxonRepo,
+		wsRepo:    wsRepo,
+	}
+}
+
+// Import は Darwin Core の Taxon ファイル (DwC-A またはタブ / カンマ区切り) を取り込むのだ
+// 同じ taxonID のものは上書きするので、更新されたチェックリストを何度取り込んでもいいのだ
+func (s *taxonService) Import(userIDStr string, workstationID int64, file io.ReaderAt, size int64) (*model.TaxonImportResult, error) {
+	if _, err := requireWorkstationAdmin(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+
+	reader, err := infrastructure.OpenDwCTaxa(file, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidChecklist, err)
+	}
+	defer reader.Close()
+
+	result := &model.TaxonImportResult{Errors: []string{}}
+	skip := func(line int, reason string) {
+		result.Skipped++
+		if len(result.Errors) < maxTaxonImportError {
+			result.Errors = append(result.Errors, fmt.Sprintf("%d行目: %s", line, reason))
+		}
+	}
+
+	// 同じバッチに同じ taxonID が2回あると ON CONFLICT が失敗するので、後のものを残すのだ
+	batch := map[string]entity.Taxon{}
+	flush := func() error {
+		list := make([]entity.Taxon, 0, len(batch))
+		for _, t := range batch {
+			list = append(list, t)
+		}
+		batch = map[string]entity.Taxon{}
+		return s.taxonRepo.UpsertBatch(list)
+	}
+
+	for {
+		row, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidChecklist, err)
+		}
+
+		taxon, reason := taxonFromDwC(workstationID, row)
+		if reason != "" {
+			skip(reader.Line(), reason)
+			continue
+		}
+		if _, dup := batch[taxon.SourceID]; !dup {
+			result.Imported++
+		}
+		batch[taxon.SourceID] = taxon
+		if len(batch) >= taxonImportBatch {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	if err := s.taxonRepo.ResolveLinks(workstationID); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *taxonService) Search(userIDStr string, workstationID int64, q *model.TaxonSearchQuery) ([]model.TaxonMatch, error) {
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	if q.Limit <= 0 {
+		q.Limit = defaultTaxonLimit
+	}
+	if q.Limit > maxTaxonLimit {
+		q.Limit = maxTaxonLimit
+	}
+	q.Rank = strings.ToLower(q.Rank)
+
+	list, err := s.taxonRepo.Search(workstationID, q)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []model.TaxonMatch{}
+	}
+	return list, nil
+}
+
+// Validate は入力された名前がチェックリストにあるかを調べて、異名なら有効名を返すのだ
+// 見つからなければ似た名前を候補として返すのだ
+func (s *taxonService) Validate(userIDStr string, workstationID int64, q *model.TaxonValidationQuery) (*model.TaxonValidation, error) {
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	rank := strings.ToLower(q.Rank)
+	name := strings.Join(strings.Fields(q.Name), " ")
+
+	res := &model.TaxonValidation{Rank: rank, Name: name, Status: "unknown", Suggestions: []model.TaxonMatch{}}
+	matches, err := s.taxonRepo.FindByName(workstationID, rank, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(matches) == 0 {
+		suggestions, err := s.taxonRepo.Search(workstationID, &model.TaxonSearchQuery{Q: name, Rank: rank, Limit: 5})
+		if err != nil {
+			return nil, err
+		}
+		if suggestions != nil {
+			res.Suggestions = suggestions
+		}
+		return res, nil
+	}
+
+	match := matches[0]
+	res.Taxon = &match
+	res.Status = match.TaxonomicStatus
+	if match.AcceptedID != nil {
+		accepted, err := s.taxonRepo.FindByID(*match.AcceptedID)
+		if err != nil {
+			return nil, err
+		}
+		res.Accepted = taxonMatchFromEntity(accepted)
+	} else {
+		res.Accepted = &match
+	}
+	return res, nil
+}
+
+func (s *taxonService) Get(userIDStr string, workstationID int64, taxonID string) (*TaxonDetail, error) {
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	taxon, err := s.taxonRepo.FindByID(taxonID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTaxonNotFound
+		}
+		return nil, err
+	}
+	if taxon.WorkstationID != workstationID {
+		return nil, ErrTaxonNotFound
+	}
+
+	detail := &TaxonDetail{Taxon: *taxon, Synonyms: []entity.Taxon{}}
+	acceptedID := taxon.TaxonID
+	if taxon.AcceptedID != nil {
+		accepted, err := s.taxonRepo.FindByID(*taxon.AcceptedID)
+		if err != nil {
+			return nil, err
+		}
+		detail.Accepted = accepted
+		acceptedID = accepted.TaxonID
+	}
+	synonyms, err := s.taxonRepo.FindSynonyms(acceptedID)
+	if err != nil {
+		return nil, err
+	}
+	for _, syn := range synonyms {
+		if syn.TaxonID != taxon.TaxonID {
+			detail.Synonyms = append(detail.Synonyms, syn)
+		}
+	}
+	return detail, nil
+}
+
+// taxonFromDwC は DwC の1行を Taxon にするのだ。取り込めない行は理由を返すのだ
+func taxonFromDwC(workstationID int64, row map[string]string) (entity.Taxon, string) {
+	sourceID := row["taxonID"]
+	if sourceID == "" {
+		sourceID = row["id"]
+	}
+	name := strings.Join(strings.Fields(row["scientificName"]), " ")
+	if sourceID == "" {
+		return entity.Taxon{}, "taxonID がありません"
+	}
+	if name == "" {
+		return entity.Taxon{}, "scientificName がありません"
+	}
+
+	authorship := strings.TrimSpace(row["scientificNameAuthorship"])
+	canonical := strings.TrimSpace(row["canonicalName"])
+	if canonical == "" {
+		canonical = name
+		if authorship != "" && strings.HasSuffix(name, authorship) {
+			canonical = strings.TrimSpace(strings.TrimSuffix(name, authorship))
+		}
+	}
+
+	rank := strings.ToLower(row["taxonRank"])
+	if rank == "" {
+		rank = "unranked"
+	}
+
+	taxon := entity.Taxon{
+		WorkstationID:   workstationID,
+		SourceID:        sourceID,
+		Rank:            rank,
+		ScientificName:  name,
+		CanonicalName:   canonical,
+		Authorship:      authorship,
+		TaxonomicStatus: dwcTaxonomicStatus(row["taxonomicStatus"], row["acceptedNameUsageID"], sourceID),
+		VernacularName:  row["vernacularName"],
+	}
+	if parent := row["parentNameUsageID"]; parent != "" && parent != sourceID {
+		taxon.ParentSourceID = &parent
+	}
+	if accepted := row["acceptedNameUsageID"]; accepted != "" && accepted != sourceID {
+		taxon.AcceptedSourceID = &accepted
+	}
+
+	classification := map[string]string{}
+	for _, r := range []string{"kingdom", "phylum", "class", "order", "family", "genus"} {
+		if v := row[r]; v != "" {
+			classification[r] = v
+		}
+	}
+	classJSON, _ := json.Marshal(classification)
+	taxon.Classification = string(classJSON)
+	return taxon, ""
+}
+
+// dwcTaxonomicStatus は taxonomicStatus の色々な書き方を accepted / synonym / doubtful にまとめるのだ
+func dwcTaxonomicStatus(status, acceptedID, sourceID string) string {
+	status = strings.ToLower(strings.TrimSpace(status))
+	switch {
+	case status == "":
+		if acceptedID != "" && acceptedID != sourceID {
+			return "synonym"
+		}
+		return "accepted"
+	case status == "accepted" || status == "valid":
+		return "accepted"
+	case strings.Contains(status, "synonym") || status == "invalid":
+		return "synonym"
+	default:
+		return "doubtful"
+	}
+}
+
+func taxonMatchFromEntity(t *entity.Taxon) *model.TaxonMatch {
+	return &model.TaxonMatch{
+		TaxonID:         t.TaxonID,
+		Rank:            t.Rank,
+		ScientificName:  t.ScientificName,
+		CanonicalName:   t.CanonicalName,
+		Authorship:      t.Authorship,
+		TaxonomicStatus: t.TaxonomicStatus,
+		VernacularName:  t.VernacularName,
+		AcceptedID:      t.AcceptedID,
+	}
+}
+
+// classificationCheck は記録の分類名をチェックリストと照らし合わせた結果なのだ
+type classificationCheck struct {
+	// Status は accepted / synonym / doubtful / unknown で、いちばん悪いものになるのだ
+	Status string
+	// TaxonID はいちばん下の階級で見つかった分類 (異名なら有効名) なのだ
+	TaxonID *string
+	// Accepted は異名だった階級の有効名なのだ (rank -> 有効名)
+	Accepted map[string]string
+	// Unknown はチェックリストに無かった名前なのだ ("rank: 名前")
+	Unknown []string
+}
+
+// nameStatusOrder は Status を決めるときの悪さの順なのだ
+var nameStatusOrder = map[string]int{"accepted": 0, "synonym": 1, "doubtful": 2, "unknown": 3}
+
+// classificationChecker は記録の分類名をチェックリストと照らし合わせるのだ
+// 同期ではたくさんの記録が同じ名前を使うので、引いた結果を覚えておくのだ
+type classificationChecker struct {
+	taxonRepo    repository.TaxonRepository
+	hasChecklist map[int64]bool
+	names        map[string]*model.TaxonMatch
+}
+
+func newClassificationChecker(taxonRepo repository.TaxonRepository) *classificationChecker {
+	return &classificationChecker{
+		taxonRepo:    taxonRepo,
+		hasChecklist: map[int64]bool{},
+		names:        map[string]*model.TaxonMatch{},
+	}
+}
+
+// Check は classification (rank -> 名前) をチェックリストと照らし合わせるのだ
+// ワークステーションにチェックリストが無いときは nil を返すのだ
+func (c *classificationChecker) Check(workstationID int64, classification map[string]string) (*classificationCheck, error) {
+	has, ok := c.hasChecklist[workstationID]
+	if !ok {
+		var err error
+		if has, err = c.taxonRepo.HasChecklist(workstationID); err != nil {
+			return nil, err
+		}
+		c.hasChecklist[workstationID] = has
+	}
+	if !has {
+		return nil, nil
+	}
+
+	res := &classificationCheck{Status: "accepted", Accepted: map[string]string{}}
+	for _, rank := range model.ClassificationRanks {
+		name := strings.Join(strings.Fields(classification[rank]), " ")
+		if name == "" {
+			continue
+		}
+		match, err := c.find(workstationID, rank, name)
+		if err != nil {
+			return nil, err
+		}
+		// species は種小名だけで記録されていることがあるので、genus と組み合わせた学名でも探すのだ
+		if match == nil && rank == "species" && classification["genus"] != "" {
+			if match, err = c.find(workstationID, rank, strings.TrimSpace(classification["genus"])+" "+name); err != nil {
+				return nil, err
+			}
+		}
+
+		status := "unknown"
+		if match != nil {
+			status = match.TaxonomicStatus
+			if _, known := nameStatusOrder[status]; !known {
+				status = "doubtful"
+			}
+			taxonID := match.TaxonID
+			if match.AcceptedID != nil {
+				taxonID = *match.AcceptedID
+				if match.AcceptedName != nil {
+					res.Accepted[rank] = *match.AcceptedName
+				}
+			}
+			res.TaxonID = &taxonID
+		} else {
+			res.Unknown = append(res.Unknown, rank+": "+name)
+		}
+		if nameStatusOrder[status] > nameStatusOrder[res.Status] {
+			res.Status = status
+		}
+	}
+	return res, nil
+}
+
+func (c *classificationChecker) find(workstationID int64, rank, name string) (*model.TaxonMatch, error) {
+	key := fmt.Sprintf("%d\x00%s\x00%s", workstationID, rank, strings.ToLower(name))
+	if match, ok := c.names[key]; ok {
+		return match, nil
+	}
+	matches, err := c.taxonRepo.FindByName(workstationID, rank, name)
+	if err != nil {
+		return nil, err
+	}
+	var match *model.TaxonMatch
+	if len(matches) > 0 {
+		match = &matches[0]
+	}
+	c.names[key] = match
+	return match, nil
+}
@@ -0,0 +1,206 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/saku-730/web-occurrence/backend/internal/infrastructure"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/repository"
+)
+
+const (
+	// tileMaxZoom より深いズームは受け付けないのだ
+	tileMaxZoom = 22
+	// tileClusterMaxZoom 以下のズームでは点をまとめて返すのだ
+	tileClusterMaxZoom = 12
+	// tileClusterCell はクラスタリングの格子の大きさ (タイル座標単位) なのだ
+	tileClusterCell = 256
+	// tileMaxFeatures は1枚のタイルに入れる点・クラスタの上限なのだ (密な所でも応答の大きさを抑えるのだ)
+	tileMaxFeatures = 10000
+	// tileBuffer はタイル境界の外側にはみ出して含める幅なのだ (シンボルの欠け対策)
+	tileBuffer = 64
+	// tileMaxLatitude は Web メルカトルで表せる緯度の限界なのだ
+	tileMaxLatitude = 85.0511287798
+	// webMercatorWorld は Web メルカトル (EPSG:3857) の世界1周の長さ (m) なのだ
+	webMercatorWorld = 2 * 20037508.342789244
+)
+
+// errTileFull はタイルに入れる点が上限に達したときに、検索を打ち切るためのエラーなのだ
+var errTileFull = errors.New("tile is full")
+
+type TileService interface {
+	OccurrenceTile(userID string, z, x, y int, q *model.OccurrenceSearchQuery) ([]byte, error)
+}
+
+type tileService struct {
+	occRepo repository.OccurrenceRepository
+	wsRepo  repository.WorkstationRepository
+}
+
+func NewTileService(occRepo repository.OccurrenceRepository, wsRepo repository.WorkstationRepository) TileService {
+	return &tileService{
+		occRepo: occRepo,
+		wsRepo:  wsRepo,
+	}
+}
+
+// tilePoint はタイル内に入った1件分なのだ
+type tilePoint struct {
+	x, y int32
+	rec  *exportRecord
+}
+
+// OccurrenceTile は z/x/y のタイルに入る occurrence を MVT にするのだ
+// 低ズームでは格子でクラスタリング (DB で集計) して point_count を付けるのだ
+func (s *tileService) OccurrenceTile(userIDStr string, z, x, y int, q *model.OccurrenceSearchQuery) ([]byte, error) {
+	if z < 0 || z > tileMaxZoom {
+		return nil, fmt.Errorf("%w: ズームレベルは0〜%dです", ErrInvalidSearchQuery, tileMaxZoom)
+	}
+	n := 1 << uint(z)
+	if x < 0 || x >= n || y < 0 || y >= n {
+		return nil, fmt.Errorf("%w: タイル番号が範囲外です", ErrInvalidSearchQuery)
+	}
+
+	wsIDs, err := resolveWorkstationIDs(s.wsRepo, userIDStr, q.WorkstationID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := applySpatialParams(q); err != nil {
+		return nil, err
+	}
+	// タイルも範囲検索なので、一般化対象のレコードは管理者にしか出さないのだ
+	access, err := loadCoordinateAccess(s.wsRepo, userIDStr)
+	if err != nil {
+		return nil, err
+	}
+	access.restrict(q)
+
+	extent := float64(infrastructure.MVTDefaultExtent)
+	buffer := float64(tileBuffer) / extent
+	minLon, maxLat := tileToLonLat(float64(x)-buffer, float64(y)-buffer, n)
+	maxLon, minLat := tileToLonLat(float64(x+1)+buffer, float64(y+1)+buffer, n)
+	// 利用者の bbox があれば、タイルの範囲と重なるところだけを探すのだ
+	query := *q
+	query.BBox = &model.BBox{MinLon: minLon, MinLat: minLat, MaxLon: maxLon, MaxLat: maxLat}
+	layer := infrastructure.NewMVTLayer("occurrences")
+	if q.BBox != nil {
+		query.BBox = &model.BBox{
+			MinLon: max(minLon, q.BBox.MinLon),
+			MinLat: max(minLat, q.BBox.MinLat),
+			MaxLon: min(maxLon, q.BBox.MaxLon),
+			MaxLat: min(maxLat, q.BBox.MaxLat),
+		}
+		if query.BBox.MinLon > query.BBox.MaxLon || query.BBox.MinLat > query.BBox.MaxLat {
+			return infrastructure.MarshalMVT(layer), nil
+		}
+	}
+	if z <= tileClusterMaxZoom {
+		// 一般化されるレコードは restrict で外れているので、DB で座標のまままとめてよいのだ
+		cellSize := webMercatorWorld / float64(n) * tileClusterCell / extent
+		clusters, err := s.occRepo.ClusterByGrid(wsIDs, &query, cellSize, tileMaxFeatures)
+		if err != nil {
+			return nil, err
+		}
+		if err := addClusters(layer, clusters, n, x, y); err != nil {
+			return nil, err
+		}
+		return infrastructure.MarshalMVT(layer), nil
+	}
+
+	var points []tilePoint
+	err = s.occRepo.StreamSearch(wsIDs, &query, func(row *model.OccurrenceSearchRow) error {
+		access.generalize(row)
+		rec := newExportRecord(row)
+		if !rec.hasLoc {
+			return nil
+		}
+		px, py := lonLatToTile(rec.lon, rec.lat, n)
+		tx := int32(math.Round((px - float64(x)) * extent))
+		ty := int32(math.Round((py - float64(y)) * extent))
+		if tx < -tileBuffer || tx > int32(extent)+tileBuffer || ty < -tileBuffer || ty > int32(extent)+tileBuffer {
+			return nil
+		}
+		points = append(points, tilePoint{x: tx, y: ty, rec: rec})
+		if len(points) >= tileMaxFeatures {
+			return errTileFull
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errTileFull) {
+		return nil, err
+	}
+	if err := addSinglePoints(layer, points); err != nil {
+		return nil, err
+	}
+	return infrastructure.MarshalMVT(layer), nil
+}
+
+func addSinglePoints(layer *infrastructure.MVTLayer, points []tilePoint) error {
+	for i, p := range points {
+		props := map[string]interface{}{
+			"occurrence_id": p.rec.row.OccurrenceID,
+			"taxon":         taxonLabel(p.rec.taxa),
+			"observer":      p.rec.row.UserDisplayName,
+			"point_count":   1,
+		}
+		for _, rank := range []string{"family", "genus", "species"} {
+			if name := p.rec.taxa[rank]; name != "" {
+				props[rank] = name
+			}
+		}
+		if !p.rec.row.CreatedAt.IsZero() {
+			props["date"] = p.rec.row.CreatedAt.Format("2006-01-02")
+		}
+		if err := layer.AddPoint(uint64(i+1), p.x, p.y, props); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addClusters は格子のマスごとにまとめた点を z/x/y のタイルに入れるのだ
+// フィーチャの ID はマスの番号から作るので、どのリクエストでも、隣のタイルでも同じマスなら同じ ID なのだ
+func addClusters(layer *infrastructure.MVTLayer, clusters []model.OccurrenceGridCluster, n, x, y int) error {
+	extent := float64(infrastructure.MVTDefaultExtent)
+	cellsPerAxis := int64(n) * int64(infrastructure.MVTDefaultExtent) / tileClusterCell
+	for _, cl := range clusters {
+		props := map[string]interface{}{
+			"cluster":     cl.Count > 1,
+			"point_count": cl.Count,
+		}
+		// 1種類だけのマスなら分類名も載せておくのだ
+		if cl.Taxon != nil && *cl.Taxon != "" {
+			props["taxon"] = *cl.Taxon
+		}
+		px := (cl.X + webMercatorWorld/2) / webMercatorWorld * float64(n)
+		py := (webMercatorWorld/2 - cl.Y) / webMercatorWorld * float64(n)
+		tx := int32(math.Round((px - float64(x)) * extent))
+		ty := int32(math.Round((py - float64(y)) * extent))
+		// 東端・南端ちょうどの点はいちばん端のマスに入れるのだ
+		cx := min(max(cl.CellX, 0), cellsPerAxis-1)
+		cy := min(max(cl.CellY, 0), cellsPerAxis-1)
+		if err := layer.AddPoint(uint64(cy*cellsPerAxis+cx+1), tx, ty, props); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tileToLonLat はタイル座標 (小数可) を経緯度にするのだ
+func tileToLonLat(tx, ty float64, n int) (lon, lat float64) {
+	lon = tx/float64(n)*360 - 180
+	lat = math.Atan(math.Sinh(math.Pi*(1-2*ty/float64(n)))) * 180 / math.Pi
+	return lon, lat
+}
+
+// lonLatToTile は経緯度をタイル座標 (小数) にするのだ
+func lonLatToTile(lon, lat float64, n int) (tx, ty float64) {
+	lat = math.Max(-tileMaxLatitude, math.Min(tileMaxLatitude, lat))
+	latRad := lat * math.Pi / 180
+	tx = (lon + 180) / 360 * float64(n)
+	ty = (1 - math.Log(math.Tan(latRad)+1/math.Cos(latRad))/math.Pi) / 2 * float64(n)
+	return tx, ty
+}
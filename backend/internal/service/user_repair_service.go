@@ -0,0 +1,150 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/saku-730/web-occurrence/backend/internal/infrastructure"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/repository"
+)
+
+const (
+	// userRepairInterval はユーザーの突き合わせを繰り返す間隔なのだ
+	userRepairInterval = 6 * time.Hour
+	// orphanRecheckDelay は CouchDB にしかいないユーザーを消す前に待つ時間なのだ
+	// 登録の途中 (CouchDB は作ったけど PostgreSQL はまだコミットしていない) のユーザーを消さないためなのだ
+	orphanRecheckDelay = 30 * time.Second
+)
+
+// UserRepairService は PostgreSQL と CouchDB の片方にしかいないユーザーを見つけて直すのだ
+// (登録の途中で落ちたときや、取り消しの削除に失敗したときの後片付けなのだ)
+type UserRepairService interface {
+	RepairUsers() (*model.UserRepairReport, error)
+	// StartPeriodicRepair は起動時と、その後は一定の間隔で RepairUsers を裏で動かすのだ
+	StartPeriodicRepair()
+}
+
+type userRepairService struct {
+	userRepo    repository.UserRepository
+	couchClient infrastructure.CouchDBClient
+}
+
+func NewUserRepairService(userRepo repository.UserRepository, couchClient infrastructure.CouchDBClient) UserRepairService {
+	return &userRepairService{
+		userRepo:    userRepo,
+		couchClient: couchClient,
+	}
+}
+
+func (s *userRepairService) StartPeriodicRepair() {
+	go func() {
+		log.Printf("Starting User Repair (Interval: %s)...", userRepairInterval)
+		for {
+			report, err := s.RepairUsers()
+			if err != nil {
+				log.Printf("User Repair Error: %v", err)
+			} else if len(report.CreatedCouchDBUsers)+len(report.DeletedCouchDBUsers)+len(report.Failed) > 0 {
+				log.Printf("User Repair: created=%v deleted=%v failed=%v",
+					report.CreatedCouchDBUsers, report.DeletedCouchDBUsers, report.Failed)
+			}
+			time.Sleep(userRepairInterval)
+		}
+	}()
+}
+
+func (s *userRepairService) RepairUsers() (*model.UserRepairReport, error) {
+	report := &model.UserRepairReport{
+		CreatedCouchDBUsers: []string{},
+		DeletedCouchDBUsers: []string{},
+		Failed:              []string{},
+	}
+
+	// 先に CouchDB を読むのだ (後から PostgreSQL を読めば、その間に登録を終えたユーザーも見えるのだ)
+	couchUsers, err := s.listCouchDBUsers()
+	if err != nil {
+		return nil, err
+	}
+	activeIDs, err := s.userRepo.ListActiveUserIDs()
+	if err != nil {
+		return nil, err
+	}
+	active := make(map[string]bool, len(activeIDs))
+	for _, id := range activeIDs {
+		active[strconv.FormatInt(id, 10)] = true
+	}
+
+	// 1. PostgreSQL にしかいないユーザーは CouchDB に作るのだ
+	// 平文のパスワードは分からないのでランダムなものにするのだ
+	// 同期はプロキシ認証なので困らないし、次にパスワードを変えたときに揃うのだ
+	for _, id := range activeIDs {
+		name := strconv.FormatInt(id, 10)
+		if couchUsers[name] {
+			continue
+		}
+		if err := s.couchClient.CreateCouchDBUser(name, infrastructure.NewSecretToken()); err != nil {
+			report.Failed = append(report.Failed, fmt.Sprintf("create %s: %v", name, err))
+			continue
+		}
+		report.CreatedCouchDBUsers = append(report.CreatedCouchDBUsers, name)
+	}
+
+	// 2. CouchDB にしかいないユーザー (登録を取り消したもの・削除したアカウント) を消すのだ
+	// PostgreSQL が空に見えるときは接続先の間違いかもしれないので、何も消さないのだ
+	var orphans []string
+	for name := range couchUsers {
+		if !active[name] {
+			orphans = append(orphans, name)
+		}
+	}
+	if len(orphans) == 0 || len(activeIDs) == 0 {
+		return report, nil
+	}
+	time.Sleep(orphanRecheckDelay)
+	activeIDs, err = s.userRepo.ListActiveUserIDs()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range activeIDs {
+		active[strconv.FormatInt(id, 10)] = true
+	}
+	for _, name := range orphans {
+		if active[name] {
+			continue
+		}
+		if err := s.couchClient.DeleteDocument("_users", infrastructure.CouchDBUserDocID(name)); err != nil {
+			report.Failed = append(report.Failed, fmt.Sprintf("delete %s: %v", name, err))
+			continue
+		}
+		report.DeletedCouchDBUsers = append(report.DeletedCouchDBUsers, name)
+	}
+	return report, nil
+}
+
+// listCouchDBUsers は CouchDB にいる、このアプリが作ったユーザー (名前が user_id の数字) を返すのだ
+// 管理者など、それ以外のユーザーには触らないのだ
+func (s *userRepairService) listCouchDBUsers() (map[string]bool, error) {
+	docs, err := s.couchClient.FetchAllDocs("_users")
+	if err != nil {
+		return nil, fmt.Errorf("CouchDBユーザーの一覧の取得に失敗: %w", err)
+	}
+	users := make(map[string]bool, len(docs))
+	for _, doc := range docs {
+		id, _ := doc["_id"].(string)
+		name, ok := strings.CutPrefix(id, infrastructure.CouchDBUserDocID(""))
+		if !ok {
+			continue
+		}
+		if _, err := strconv.ParseInt(name, 10, 64); err != nil {
+			continue
+		}
+		if roles, _ := doc["roles"].([]interface{}); len(roles) > 0 {
+			continue
+		}
+		users[name] = true
+	}
+	return users, nil
+}
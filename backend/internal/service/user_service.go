@@ -3,6 +3,9 @@ package service
 import (
 	"errors"
 	"fmt"
+	"log"
+	"time"
+	"unicode/utf8"
 	"strconv" // 追加: int64をstringにするため
 	"strings"
 
@@ -15,25 +18,38 @@ import (
 
 var ErrEmailConflict = errors.New("このメールアドレスは既に使用されています")
 var ErrCouchDBUserCreation = errors.New("CouchDBユーザーの作成に失敗しました")
+var ErrInvalidProfile = errors.New("プロフィールの内容が正しくありません")
 
 type UserService interface {
 	RegisterUser(req *model.UserRegisterRequest) (*entity.User, error)
-	LoginUser(req *model.UserLoginRequest) (string, error)
+	// LoginUser はパスワードを確かめて、新しいセッションのトークンを返すのだ
+	LoginUser(req *model.UserLoginRequest, userAgent, ipAddress string) (*model.UserLoginResponse, error)
 	GetUser(userIDStr string) (*entity.User, error)
+	// UpdateProfile は表示名・言語・タイムゾーンを変えて、変えた後のユーザーを返すのだ
+	UpdateProfile(userIDStr string, req *model.UserProfileUpdateRequest) (*entity.User, error)
 }
 
 type userService struct {
-	userRepo    repository.UserRepository
-	couchClient infrastructure.CouchDBClient
+	userRepo       repository.UserRepository
+	masterRepo     repository.MasterRepository
+	couchClient    infrastructure.CouchDBClient
+	sessionService SessionService
+	accountService AccountService
 }
 
 func NewUserService(
 	userRepo repository.UserRepository,
+	masterRepo repository.MasterRepository,
 	couchClient infrastructure.CouchDBClient,
+	sessionService SessionService,
+	accountService AccountService,
 ) UserService {
 	return &userService{
-		userRepo:    userRepo,
-		couchClient: couchClient,
+		userRepo:       userRepo,
+		masterRepo:     masterRepo,
+		couchClient:    couchClient,
+		sessionService: sessionService,
+		accountService: accountService,
 	}
 }
 
@@ -56,56 +72,107 @@ func (s *userService) RegisterUser(req *model.UserRegisterRequest) (*entity.User
 		Password:    hashedPassword,
 	}
 
-	// 3. PostgreSQLに保存 (ここで UserID が発番される！)
-	createdUser, err := s.userRepo.CreateUser(newUser)
+	// 3. PostgreSQLに保存して、コミットする前に CouchDBユーザーを作る
+	// CouchDB で失敗したら PostgreSQL はロールバックされるので、メールアドレスが使えなくなることは無いのだ
+	// ★PostgreSQLの user_id を文字列にして、CouchDBのユーザー名として使うのだ
+	couchCreated := false
+	createdUser, err := s.userRepo.CreateUserWith(newUser, func(created *entity.User) error {
+		// パスワードは平文で渡す（CouchDB側でハッシュ化される）
+		if err := s.couchClient.CreateCouchDBUser(strconv.FormatInt(created.UserID, 10), req.Password); err != nil {
+			return fmt.Errorf("%w: %v", ErrCouchDBUserCreation, err)
+		}
+		couchCreated = true
+		return nil
+	})
 	if err != nil {
 		if errors.Is(err, repository.ErrEmailAlreadyExists) {
 			return nil, ErrEmailConflict
 		}
+		// 4. CouchDBユーザーは作れたのにコミットに失敗したときは、CouchDBユーザーを消して元に戻すのだ
+		// 消すのにも失敗したら、RepairUsers が後で片付けるのだ
+		if couchCreated {
+			couchDBUsername := strconv.FormatInt(newUser.UserID, 10)
+			if delErr := s.couchClient.DeleteDocument("_users", infrastructure.CouchDBUserDocID(couchDBUsername)); delErr != nil {
+				log.Printf("登録の取り消しでCouchDBユーザーの削除に失敗 (user_id=%s): %v", couchDBUsername, delErr)
+			}
+		}
 		return nil, err
 	}
 
-	// 4. CouchDBユーザー作成
-	// ★修正ポイント: PostgreSQLの user_id を文字列にして、CouchDBのユーザー名として使うのだ
-	couchDBUsername := strconv.FormatInt(createdUser.UserID, 10)
-	
-	// パスワードは平文で渡す（CouchDB側でハッシュ化される）
-	err = s.couchClient.CreateCouchDBUser(couchDBUsername, req.Password)
-	if err != nil {
-		// 失敗したら本当はロールバックしたいけど、今はエラーを返す
-		return nil, fmt.Errorf("%w: %v", ErrCouchDBUserCreation, err)
+	// 5. メールアドレス確認のリンクを送る
+	// 送れなくても登録は済んでいるので、後から送り直せるようにログだけ残すのだ
+	if err := s.accountService.SendVerification(createdUser); err != nil {
+		log.Printf("確認メールの準備に失敗 (user_id=%d): %v", createdUser.UserID, err)
 	}
 
 	return createdUser, nil
 }
 
-func (s *userService) LoginUser(req *model.UserLoginRequest) (string, error) {
+func (s *userService) LoginUser(req *model.UserLoginRequest, userAgent, ipAddress string) (*model.UserLoginResponse, error) {
 	user, err := s.userRepo.FindUserByEmail(req.MailAddress)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return "", errors.New("メールアドレスまたはパスワードが正しくありません")
+			return nil, errors.New("メールアドレスまたはパスワードが正しくありません")
 		}
-		return "", err
+		return nil, err
 	}
 
 	isValidPassword := infrastructure.CheckPasswordHash(req.Password, user.Password)
 	if !isValidPassword {
-		return "", errors.New("メールアドレスまたはパスワードが正しくありません")
+		return nil, errors.New("メールアドレスまたはパスワードが正しくありません")
 	}
 
-	userIDString := strconv.FormatInt(user.UserID, 10)
-	token, err := infrastructure.GenerateToken(userIDString)
+	return s.sessionService.Issue(user.UserID, userAgent, ipAddress)
+}
+
+func (s *userService) GetUser(userIDStr string) (*entity.User, error) {
+	id, err := strconv.ParseInt(userIDStr, 10, 64)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-
-	return token, nil
+	return s.userRepo.FindUserByID(id)
 }
 
-func (s *userService) GetUser(userIDStr string) (*entity.User, error) {
+func (s *userService) UpdateProfile(userIDStr string, req *model.UserProfileUpdateRequest) (*entity.User, error) {
 	id, err := strconv.ParseInt(userIDStr, 10, 64)
 	if err != nil {
 		return nil, err
 	}
+
+	updates := map[string]interface{}{}
+	if req.DisplayName != nil {
+		name := strings.TrimSpace(*req.DisplayName)
+		if name == "" || utf8.RuneCountInString(name) > 100 {
+			return nil, fmt.Errorf("%w: display_name は1〜100文字にしてください", ErrInvalidProfile)
+		}
+		updates["display_name"] = name
+	}
+	if req.PreferredLanguageID != nil {
+		if *req.PreferredLanguageID == 0 {
+			updates["preferred_language_id"] = nil
+		} else {
+			if _, err := s.masterRepo.FindLanguageByID(*req.PreferredLanguageID); err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return nil, fmt.Errorf("%w: preferred_language_id %d は languages にありません", ErrInvalidProfile, *req.PreferredLanguageID)
+				}
+				return nil, err
+			}
+			updates["preferred_language_id"] = *req.PreferredLanguageID
+		}
+	}
+	if req.Timezone != nil {
+		tz := strings.TrimSpace(*req.Timezone)
+		// "Local" はサーバーのタイムゾーンになってしまうので受け付けないのだ
+		if _, err := time.LoadLocation(tz); err != nil || tz == "" || tz == "Local" {
+			return nil, fmt.Errorf("%w: timezone %q は IANA のタイムゾーン名ではありません", ErrInvalidProfile, tz)
+		}
+		updates["timezone"] = tz
+	}
+
+	if len(updates) > 0 {
+		if err := s.userRepo.UpdateProfile(id, updates); err != nil {
+			return nil, err
+		}
+	}
 	return s.userRepo.FindUserByID(id)
 }
@@ -0,0 +1,434 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/saku-730/web-occurrence/backend/internal/entity"
+	"github.com/saku-730/web-occurrence/backend/internal/infrastructure"
+	"github.com/saku-730/web-occurrence/backend/internal/model"
+	"github.com/saku-730/web-occurrence/backend/internal/repository"
+	"gorm.io/gorm"
+)
+
+var ErrWikiPageNotFound = errors.New("Wiki のページが見つかりません")
+var ErrWikiRevisionNotFound = errors.New("Wiki のページの版が見つかりません")
+var ErrInvalidWikiPage = errors.New("Wiki のページの内容が正しくありません")
+var ErrWikiEditDenied = errors.New("ページを削除できるのは作成者かワークステーションの管理者だけです")
+var ErrWikiConflict = errors.New("同じタイトルのページがあるか、ページが他の人に更新されています")
+var ErrWikiPageInUse = errors.New("手法の説明として使われているため削除できません")
+
+const (
+	defaultWikiLimit = 50
+	maxWikiLimit     = 500
+	// maxWikiContentBytes は1ページの本文の大きさの上限なのだ
+	maxWikiContentBytes = 1 << 20
+	// wikiDiffContext は unified 形式の差分で変更の前後に残す行数なのだ
+	wikiDiffContext = 3
+)
+
+// WikiPageDetail はページと、本文を HTML にしたもの、ページを参照している手法なのだ
+type WikiPageDetail struct {
+	entity.WikiPage
+	HTML  string                   `json:"html"`
+	Links []repository.WikiLinkRow `json:"links"`
+}
+
+// WikiRevisionDetail は1つの版と、その本文を HTML にしたものなのだ
+type WikiRevisionDetail struct {
+	entity.WikiPageRevision
+	HTML string `json:"html"`
+}
+
+// WikiDiff は2つの版の差分なのだ
+type WikiDiff struct {
+	PageID  string                    `json:"page_id"`
+	From    int                       `json:"from"`
+	To      int                       `json:"to"`
+	Title   [2]string                 `json:"title"` // [from, to] の版のタイトル
+	Lines   []infrastructure.DiffLine `json:"lines"`
+	Unified string                    `json:"unified"`
+}
+
+type WikiService interface {
+	List(userID string, workstationID int64, q *model.WikiSearchQuery) ([]entity.WikiPage, error)
+	Get(userID string, workstationID int64, pageID string) (*WikiPageDetail, error)
+	Create(userID string, workstationID int64, req *model.WikiPageRequest) (*WikiPageDetail, error)
+	// Update は新しい版として保存するのだ (前の版はすべて残るのだ)
+	Update(userID string, workstationID int64, pageID string, req *model.WikiPageRequest) (*WikiPageDetail, error)
+	Delete(userID string, workstationID int64, pageID string) error
+	// Preview は保存せずに Markdown を HTML にするのだ
+	Preview(userID string, workstationID int64, req *model.WikiPreviewRequest) (string, error)
+
+	ListRevisions(userID string, workstationID int64, pageID string) ([]entity.WikiPageRevision, error)
+	GetRevision(userID string, workstationID int64, pageID string, revision int) (*WikiRevisionDetail, error)
+	Diff(userID string, workstationID int64, pageID string, q *model.WikiDiffQuery) (*WikiDiff, error)
+	// Restore は古い版の内容を新しい版として保存し直すのだ
+	Restore(userID string, workstationID int64, pageID string, revision int, req *model.WikiRestoreRequest) (*WikiPageDetail, error)
+}
+
+type wikiService struct {
+	wikiRepo    repository.WikiRepository
+	wsRepo      repository.WorkstationRepository
+	couchClient infrastructure.CouchDBClient
+}
+
+func NewWikiService(wikiRepo repository.WikiRepository, wsRepo repository.WorkstationRepository, couchClient infrastructure.CouchDBClient) WikiService {
+	return &wikiService{
+		wikiRepo:    wikiRepo,
+		wsRepo:      wsRepo,
+		couchClient: couchClient,
+	}
+}
+
+func (s *wikiService) List(userIDStr string, workstationID int64, q *model.WikiSearchQuery) ([]entity.WikiPage, error) {
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	if q.Limit <= 0 {
+		q.Limit = defaultWikiLimit
+	}
+	if q.Limit > maxWikiLimit {
+		q.Limit = maxWikiLimit
+	}
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+	q.Q = strings.TrimSpace(q.Q)
+	return s.wikiRepo.List(workstationID, q)
+}
+
+func (s *wikiService) Get(userIDStr string, workstationID int64, pageID string) (*WikiPageDetail, error) {
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	page, err := s.findPage(workstationID, pageID)
+	if err != nil {
+		return nil, err
+	}
+	rev, err := s.findRevision(page.PageID, page.Revision)
+	if err != nil {
+		return nil, err
+	}
+	return s.detail(page, s.revisionHTML(rev))
+}
+
+func (s *wikiService) Create(userIDStr string, workstationID int64, req *model.WikiPageRequest) (*WikiPageDetail, error) {
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	title, content, err := wikiPageContent(req.Title, req.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	pageID := infrastructure.NewUUID()
+	page := &entity.WikiPage{
+		PageID:        pageID,
+		Title:         title,
+		UserID:        userID,
+		UpdatedDate:   now,
+		ContentPath:   wikiContentPath(workstationID, pageID),
+		WorkstationID: workstationID,
+		Content:       content,
+		Revision:      1,
+	}
+	rev := &entity.WikiPageRevision{
+		Revision:    1,
+		Title:       title,
+		Content:     content,
+		ContentHTML: infrastructure.RenderMarkdown(content),
+		Summary:     strings.TrimSpace(req.Summary),
+		UserID:      userID,
+	}
+	if err := s.wikiRepo.Create(page, rev); err != nil {
+		if errors.Is(err, repository.ErrWikiTitleTaken) {
+			return nil, ErrWikiConflict
+		}
+		return nil, err
+	}
+	return s.saved(page, rev.ContentHTML)
+}
+
+func (s *wikiService) Update(userIDStr string, workstationID int64, pageID string, req *model.WikiPageRequest) (*WikiPageDetail, error) {
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	page, err := s.findPage(workstationID, pageID)
+	if err != nil {
+		return nil, err
+	}
+	title, content, err := wikiPageContent(req.Title, req.Content)
+	if err != nil {
+		return nil, err
+	}
+	base := page.Revision
+	if req.BaseRevision != nil {
+		base = *req.BaseRevision
+	}
+	return s.saveRevision(page, userID, title, content, req.Summary, base)
+}
+
+// Delete は手法から参照されていないページを、すべての版と一緒に削除するのだ
+func (s *wikiService) Delete(userIDStr string, workstationID int64, pageID string) error {
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		return err
+	}
+	roles, err := s.wsRepo.GetRoleIDsByUserID(userID)
+	if err != nil {
+		return err
+	}
+	role, ok := roles[workstationID]
+	if !ok {
+		return ErrWorkstationAccessDenied
+	}
+	page, err := s.findPage(workstationID, pageID)
+	if err != nil {
+		return err
+	}
+	if page.UserID != userID && role != roleAdministrator {
+		return ErrWikiEditDenied
+	}
+	links, err := s.wikiRepo.ListLinks(page.PageID)
+	if err != nil {
+		return err
+	}
+	if len(links) > 0 {
+		return ErrWikiPageInUse
+	}
+	if err := s.wikiRepo.Delete(page.PageID); err != nil {
+		return err
+	}
+	return s.couchClient.DeleteDocument(s.couchClient.CreateWorkstationDBName(workstationID), page.PageID)
+}
+
+func (s *wikiService) Preview(userIDStr string, workstationID int64, req *model.WikiPreviewRequest) (string, error) {
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return "", err
+	}
+	if len(req.Content) > maxWikiContentBytes {
+		return "", fmt.Errorf("%w: 本文が長すぎます", ErrInvalidWikiPage)
+	}
+	return infrastructure.RenderMarkdown(req.Content), nil
+}
+
+func (s *wikiService) ListRevisions(userIDStr string, workstationID int64, pageID string) ([]entity.WikiPageRevision, error) {
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	page, err := s.findPage(workstationID, pageID)
+	if err != nil {
+		return nil, err
+	}
+	return s.wikiRepo.ListRevisions(page.PageID)
+}
+
+func (s *wikiService) GetRevision(userIDStr string, workstationID int64, pageID string, revision int) (*WikiRevisionDetail, error) {
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	page, err := s.findPage(workstationID, pageID)
+	if err != nil {
+		return nil, err
+	}
+	rev, err := s.findRevision(page.PageID, revision)
+	if err != nil {
+		return nil, err
+	}
+	return &WikiRevisionDetail{WikiPageRevision: *rev, HTML: s.revisionHTML(rev)}, nil
+}
+
+func (s *wikiService) Diff(userIDStr string, workstationID int64, pageID string, q *model.WikiDiffQuery) (*WikiDiff, error) {
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	page, err := s.findPage(workstationID, pageID)
+	if err != nil {
+		return nil, err
+	}
+	to := q.To
+	if to <= 0 {
+		to = page.Revision
+	}
+	from := q.From
+	if from <= 0 {
+		from = to - 1
+	}
+
+	toRev, err := s.findRevision(page.PageID, to)
+	if err != nil {
+		return nil, err
+	}
+	// 最初の版は空のページからの差分にするのだ
+	fromRev := &entity.WikiPageRevision{}
+	if from > 0 {
+		if fromRev, err = s.findRevision(page.PageID, from); err != nil {
+			return nil, err
+		}
+	}
+
+	lines := infrastructure.DiffLines(fromRev.Content, toRev.Content)
+	return &WikiDiff{
+		PageID:  page.PageID,
+		From:    from,
+		To:      to,
+		Title:   [2]string{fromRev.Title, toRev.Title},
+		Lines:   lines,
+		Unified: infrastructure.UnifiedDiff(fmt.Sprintf("r%d", from), fmt.Sprintf("r%d", to), lines, wikiDiffContext),
+	}, nil
+}
+
+func (s *wikiService) Restore(userIDStr string, workstationID int64, pageID string, revision int, req *model.WikiRestoreRequest) (*WikiPageDetail, error) {
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := resolveWorkstationIDs(s.wsRepo, userIDStr, workstationID); err != nil {
+		return nil, err
+	}
+	page, err := s.findPage(workstationID, pageID)
+	if err != nil {
+		return nil, err
+	}
+	rev, err := s.findRevision(page.PageID, revision)
+	if err != nil {
+		return nil, err
+	}
+	summary := strings.TrimSpace(req.Summary)
+	if summary == "" {
+		summary = fmt.Sprintf("r%d に戻した", rev.Revision)
+	}
+	return s.saveRevision(page, userID, rev.Title, rev.Content, summary, page.Revision)
+}
+
+func (s *wikiService) findPage(workstationID int64, pageID string) (*entity.WikiPage, error) {
+	page, err := s.wikiRepo.FindByID(pageID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWikiPageNotFound
+		}
+		return nil, err
+	}
+	if page.WorkstationID != workstationID {
+		return nil, ErrWikiPageNotFound
+	}
+	return page, nil
+}
+
+func (s *wikiService) findRevision(pageID string, revision int) (*entity.WikiPageRevision, error) {
+	rev, err := s.wikiRepo.FindRevision(pageID, revision)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWikiRevisionNotFound
+		}
+		return nil, err
+	}
+	return rev, nil
+}
+
+// saveRevision はページを base の版の次の版として保存するのだ
+func (s *wikiService) saveRevision(page *entity.WikiPage, userID int64, title, content, summary string, base int) (*WikiPageDetail, error) {
+	page.Title = title
+	page.Content = content
+	page.Revision = base + 1
+	page.UpdatedDate = time.Now()
+	if page.ContentPath == "" {
+		page.ContentPath = wikiContentPath(page.WorkstationID, page.PageID)
+	}
+	rev := &entity.WikiPageRevision{
+		Revision:    page.Revision,
+		Title:       title,
+		Content:     content,
+		ContentHTML: infrastructure.RenderMarkdown(content),
+		Summary:     strings.TrimSpace(summary),
+		UserID:      userID,
+	}
+	if err := s.wikiRepo.Update(page, rev, base); err != nil {
+		if errors.Is(err, repository.ErrWikiTitleTaken) || errors.Is(err, repository.ErrWikiRevisionConflict) {
+			return nil, ErrWikiConflict
+		}
+		return nil, err
+	}
+	return s.saved(page, rev.ContentHTML)
+}
+
+// saved は保存したページを CouchDB の wiki ドキュメントにも書き込んでから返すのだ
+// 端末は手法の pageid からこのドキュメントを引いて、オフラインでも説明を読めるのだ
+func (s *wikiService) saved(page *entity.WikiPage, html string) (*WikiPageDetail, error) {
+	userID := strconv.FormatInt(page.UserID, 10)
+	doc := map[string]interface{}{
+		"_id":                page.PageID,
+		"type":               "wiki",
+		"workstation_id":     strconv.FormatInt(page.WorkstationID, 10),
+		"created_by_user_id": userID,
+		"user_id":            userID,
+		"title":              page.Title,
+		"content_path":       page.ContentPath,
+		"content":            page.Content,
+		"revision":           page.Revision,
+		"updated_date":       page.UpdatedDate.Format(time.RFC3339),
+	}
+	if err := s.couchClient.UpsertDocument(page.PageID, doc); err != nil {
+		return nil, err
+	}
+	return s.detail(page, html)
+}
+
+// revisionHTML は版の本文を HTML にしたものを返すのだ
+// 保存したときに作ったものを使い、まだ持っていない古い版ならここで作って残すのだ
+func (s *wikiService) revisionHTML(rev *entity.WikiPageRevision) string {
+	if rev.ContentHTML != "" || rev.Content == "" {
+		return rev.ContentHTML
+	}
+	html := infrastructure.RenderMarkdown(rev.Content)
+	if err := s.wikiRepo.SaveRevisionHTML(rev.PageID, rev.Revision, html); err != nil {
+		log.Printf("Wiki の版の HTML を保存できませんでした (page_id=%s, revision=%d): %v", rev.PageID, rev.Revision, err)
+	}
+	return html
+}
+
+func (s *wikiService) detail(page *entity.WikiPage, html string) (*WikiPageDetail, error) {
+	links, err := s.wikiRepo.ListLinks(page.PageID)
+	if err != nil {
+		return nil, err
+	}
+	if links == nil {
+		links = []repository.WikiLinkRow{}
+	}
+	return &WikiPageDetail{
+		WikiPage: *page,
+		HTML:     html,
+		Links:    links,
+	}, nil
+}
+
+// wikiPageContent はタイトルと本文を確かめるのだ
+func wikiPageContent(title, content string) (string, string, error) {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return "", "", fmt.Errorf("%w: タイトルが空です", ErrInvalidWikiPage)
+	}
+	if len(content) > maxWikiContentBytes {
+		return "", "", fmt.Errorf("%w: 本文が長すぎます", ErrInvalidWikiPage)
+	}
+	return title, strings.ReplaceAll(content, "\r\n", "\n"), nil
+}
+
+// wikiContentPath はページの本文を取得できる API のパスなのだ (content_path に入れるのだ)
+func wikiContentPath(workstationID int64, pageID string) string {
+	return fmt.Sprintf("/api/workstation/%d/wiki/%s", workstationID, pageID)
+}
@@ -3,7 +3,10 @@ package main
 import (
 	"log"
 	"os"
+	"strings"
 	"time"
+	// タイムゾーンのデータを埋め込むのだ (tzdata の無いコンテナでも IANA の名前を確かめられるのだ)
+	_ "time/tzdata"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -41,26 +44,104 @@ func main() {
 	}
 	couchClient := infrastructure.NewCouchDBClient(couchConfig)
 
+	// メール送信 (SMTP_HOST が無ければログに出すだけなのだ)
+	mailer := infrastructure.NewMailer(&model.MailConfig{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     os.Getenv("SMTP_PORT"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("MAIL_FROM"),
+		// ローカルのテスト用メールサーバーだけ、暗号化しないで送るのを許すのだ
+		AllowPlaintext: os.Getenv("SMTP_ALLOW_PLAINTEXT") == "true",
+	})
+
+	// 大学などの IdP でのログイン (OIDC_ISSUER が無ければ使わないのだ)
+	oidcClient := infrastructure.NewOIDCClient(&model.OIDCConfig{
+		Issuer:       os.Getenv("OIDC_ISSUER"),
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:       strings.Fields(os.Getenv("OIDC_SCOPES")),
+	})
+
 	// 3. Initialize Repositories
 	userRepo := repository.NewUserRepository(db)
 	wsRepo := repository.NewWorkstationRepository(db)
 	masterRepo := repository.NewMasterRepository(db)
+	occRepo := repository.NewOccurrenceRepository(db)
+	placeNameRepo := repository.NewPlaceNameRepository(db)
+	sensitiveTaxonRepo := repository.NewSensitiveTaxonRepository(db)
+	taxonRepo := repository.NewTaxonRepository(db)
+	identRepo := repository.NewIdentificationRepository(db)
+	specimenRepo := repository.NewSpecimenRepository(db)
+	codeRepo := repository.NewRecordCodeRepository(db)
+	storageRepo := repository.NewStorageRepository(db)
+	loanRepo := repository.NewLoanRepository(db)
+	projectRepo := repository.NewProjectRepository(db)
+	obsRepo := repository.NewObservationRepository(db)
+	wikiRepo := repository.NewWikiRepository(db)
+	sessionRepo := repository.NewSessionRepository(db)
+	mailTokenRepo := repository.NewMailTokenRepository(db)
+	apiTokenRepo := repository.NewAPITokenRepository(db)
+	oidcRepo := repository.NewOIDCRepository(db)
 
 	// 4. Initialize Services
-	authService := service.NewUserService(userRepo, couchClient)
+	sessionService := service.NewSessionService(sessionRepo)
+	accountService := service.NewAccountService(userRepo, mailTokenRepo, wsRepo, couchClient, sessionService, mailer, os.Getenv("APP_BASE_URL"))
+	authService := service.NewUserService(userRepo, masterRepo, couchClient, sessionService, accountService)
 	wsService := service.NewWorkstationService(wsRepo, masterRepo, couchClient)
 	masterService := service.NewMasterService(masterRepo, wsRepo)
-	couchService := service.NewCouchDBService(userRepo, couchClient, couchConfig.Secret, couchConfig.URL)
-	syncService := service.NewSyncService(db, couchClient, wsRepo)
+	couchService := service.NewCouchDBService(userRepo, wsRepo, sensitiveTaxonRepo, couchClient, couchConfig.Secret, couchConfig.URL)
+	syncService := service.NewSyncService(db, couchClient, wsRepo, taxonRepo)
+	occService := service.NewOccurrenceService(occRepo, wsRepo)
+	exportService := service.NewExportService(occRepo, wsRepo)
+	ogcService := service.NewOGCFeatureService(occRepo, wsRepo)
+	tileService := service.NewTileService(occRepo, wsRepo)
+	placeNameService := service.NewPlaceNameService(placeNameRepo, wsRepo)
+	sensitiveTaxonService := service.NewSensitiveTaxonService(sensitiveTaxonRepo, wsRepo)
+	taxonService := service.NewTaxonService(taxonRepo, wsRepo)
+	identService := service.NewIdentificationService(identRepo, taxonRepo, wsRepo, couchClient)
+	specimenService := service.NewSpecimenService(specimenRepo, wsRepo, couchClient)
+	labelService := service.NewLabelService(specimenRepo, codeRepo, occRepo, placeNameRepo, wsRepo)
+	resolverService := service.NewResolverService(codeRepo, specimenRepo, wsRepo, os.Getenv("APP_BASE_URL"))
+	storageService := service.NewStorageService(storageRepo, specimenRepo, wsRepo)
+	loanService := service.NewLoanService(loanRepo, specimenRepo, storageRepo, wsRepo)
+	projectService := service.NewProjectService(projectRepo, wsRepo, couchClient)
+	obsService := service.NewObservationService(obsRepo, wikiRepo, wsRepo, couchClient)
+	wikiService := service.NewWikiService(wikiRepo, wsRepo, couchClient)
+	userRepairService := service.NewUserRepairService(userRepo, couchClient)
+	apiTokenService := service.NewAPITokenService(apiTokenRepo, userRepo, wsRepo)
+	oidcService := service.NewOIDCService(oidcRepo, userRepo, couchClient, sessionService, oidcClient, os.Getenv("OIDC_PROVIDER_NAME"), os.Getenv("APP_BASE_URL"))
 
 	// 5. Start Sync Polling (Background)
 	syncService.StartPolling()
+	// PostgreSQL と CouchDB の片方にしかいないユーザーを直すのだ
+	userRepairService.StartPeriodicRepair()
 
 	// 6. Initialize Handlers
 	userHandler := handler.NewUserHandler(authService)
 	wsHandler := handler.NewWorkstationHandler(wsService)
 	masterHandler := handler.NewMasterHandler(masterService)
 	couchHandler := handler.NewCouchDBHandler(couchService)
+	occHandler := handler.NewOccurrenceHandler(occService, exportService)
+	ogcHandler := handler.NewOGCHandler(ogcService, os.Getenv("API_BASE_URL"))
+	tileHandler := handler.NewTileHandler(tileService)
+	placeNameHandler := handler.NewPlaceNameHandler(placeNameService)
+	sensitiveTaxonHandler := handler.NewSensitiveTaxonHandler(sensitiveTaxonService)
+	taxonHandler := handler.NewTaxonHandler(taxonService)
+	identHandler := handler.NewIdentificationHandler(identService)
+	specimenHandler := handler.NewSpecimenHandler(specimenService)
+	labelHandler := handler.NewLabelHandler(labelService)
+	resolverHandler := handler.NewResolverHandler(resolverService)
+	storageHandler := handler.NewStorageHandler(storageService)
+	loanHandler := handler.NewLoanHandler(loanService)
+	projectHandler := handler.NewProjectHandler(projectService, occService)
+	obsHandler := handler.NewObservationHandler(obsService)
+	wikiHandler := handler.NewWikiHandler(wikiService)
+	sessionHandler := handler.NewSessionHandler(sessionService)
+	accountHandler := handler.NewAccountHandler(accountService)
+	apiTokenHandler := handler.NewAPITokenHandler(apiTokenService)
+	oidcHandler := handler.NewOIDCHandler(oidcService)
 
 	// 7. Setup Router
 	r := gin.Default()
@@ -74,7 +155,7 @@ func main() {
 		MaxAge:           12 * time.Hour,
 	}))
 
-	router.SetupRoutes(r, userHandler, wsHandler, masterHandler, couchHandler)
+	router.SetupRoutes(r, userHandler, wsHandler, masterHandler, couchHandler, occHandler, ogcHandler, tileHandler, placeNameHandler, sensitiveTaxonHandler, taxonHandler, identHandler, specimenHandler, labelHandler, resolverHandler, storageHandler, loanHandler, projectHandler, obsHandler, wikiHandler, sessionHandler, accountHandler, apiTokenHandler, oidcHandler, sessionService, apiTokenService)
 
 	port := os.Getenv("PORT")
 	if port == "" {
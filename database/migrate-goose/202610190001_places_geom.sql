@@ -0,0 +1,49 @@
+-- +goose Up
+-- places.coordinates (jsonb) から緯度経度を取り出して、空間インデックスを張れるようにするのだ
+-- jsonb はクライアントが送ってきた元の値としてそのまま残しておくのだ
+ALTER TABLE places ADD COLUMN latitude double precision;
+ALTER TABLE places ADD COLUMN longitude double precision;
+ALTER TABLE places ADD COLUMN geom geometry(Point, 4326);
+
+-- geom は latitude / longitude から自動で作るのだ（アプリ側は緯度経度だけ書けばいいのだ）
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION places_set_geom() RETURNS trigger AS $$
+BEGIN
+    IF NEW.latitude IS NOT NULL AND NEW.longitude IS NOT NULL THEN
+        NEW.geom := ST_SetSRID(ST_MakePoint(NEW.longitude, NEW.latitude), 4326);
+    ELSE
+        NEW.geom := NULL;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER places_set_geom_trigger
+    BEFORE INSERT OR UPDATE ON places
+    FOR EACH ROW EXECUTE FUNCTION places_set_geom();
+
+-- 既存データを埋めるのだ (GeoJSON Point と {"latitude":..,"longitude":..} の両方に対応)
+UPDATE places SET
+    latitude = CASE
+        WHEN jsonb_typeof(coordinates -> 'coordinates' -> 1) = 'number' THEN (coordinates -> 'coordinates' ->> 1)::float8
+        WHEN jsonb_typeof(coordinates -> 'latitude') = 'number' THEN (coordinates ->> 'latitude')::float8
+    END,
+    longitude = CASE
+        WHEN jsonb_typeof(coordinates -> 'coordinates' -> 0) = 'number' THEN (coordinates -> 'coordinates' ->> 0)::float8
+        WHEN jsonb_typeof(coordinates -> 'longitude') = 'number' THEN (coordinates ->> 'longitude')::float8
+    END
+WHERE coordinates IS NOT NULL;
+
+-- bbox / ポリゴン検索用と、距離 (m) 検索用の2つのインデックスなのだ
+CREATE INDEX places_geom_idx ON places USING GIST (geom);
+CREATE INDEX places_geog_idx ON places USING GIST ((geom::geography));
+
+-- +goose Down
+DROP INDEX IF EXISTS places_geog_idx;
+DROP INDEX IF EXISTS places_geom_idx;
+DROP TRIGGER IF EXISTS places_set_geom_trigger ON places;
+DROP FUNCTION IF EXISTS places_set_geom();
+ALTER TABLE places DROP COLUMN geom;
+ALTER TABLE places DROP COLUMN longitude;
+ALTER TABLE places DROP COLUMN latitude;
@@ -0,0 +1,30 @@
+-- +goose Up
+-- JIS X 0410 の4分の1地域メッシュコード (10桁) を保存するのだ
+-- 1次〜2分の1メッシュのコードは先頭の4/6/8/9桁なので、前方一致で絞り込めるのだ
+ALTER TABLE places ADD COLUMN mesh_code text;
+
+-- 既存データを埋めるのだ (計算方法は infrastructure/jis_mesh.go と同じなのだ)
+-- 緯度は1度=480マス、経度は1度=320マスの4分の1メッシュ単位にしてから各桁を取り出すのだ
+UPDATE places SET mesh_code = m.code
+FROM (
+    SELECT place_id,
+        lpad((lat_idx / 320)::text, 2, '0') || lpad((lon_idx / 320)::text, 2, '0') ||
+        (lat_idx % 320 / 40)::text || (lon_idx % 320 / 40)::text ||
+        (lat_idx % 40 / 4)::text || (lon_idx % 40 / 4)::text ||
+        (lat_idx % 4 / 2 * 2 + lon_idx % 4 / 2 + 1)::text ||
+        (lat_idx % 2 * 2 + lon_idx % 2 + 1)::text AS code
+    FROM (
+        SELECT place_id,
+            floor(latitude * 480 + 1e-9)::int AS lat_idx,
+            floor((longitude - 100) * 320 + 1e-9)::int AS lon_idx
+        FROM places
+        WHERE latitude >= 0 AND latitude < 100 / 1.5 AND longitude >= 100 AND longitude < 200
+    ) idx
+) m
+WHERE places.place_id = m.place_id;
+
+CREATE INDEX places_mesh_code_idx ON places (mesh_code text_pattern_ops);
+
+-- +goose Down
+DROP INDEX IF EXISTS places_mesh_code_idx;
+ALTER TABLE places DROP COLUMN mesh_code;
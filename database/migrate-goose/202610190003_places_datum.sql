@@ -0,0 +1,10 @@
+-- +goose Up
+-- 元の座標の測地系 (EPSG コード) を記録するのだ
+-- coordinates (jsonb) は端末から送られてきた元の値のまま残し、latitude / longitude は JGD2011 に変換した値になるのだ
+ALTER TABLE places ADD COLUMN datum text;
+
+-- これまでのデータはブラウザの GPS (WGS84) から入力されたものなのだ
+UPDATE places SET datum = 'EPSG:4326' WHERE latitude IS NOT NULL;
+
+-- +goose Down
+ALTER TABLE places DROP COLUMN datum;
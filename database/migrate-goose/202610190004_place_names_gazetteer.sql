@@ -0,0 +1,48 @@
+-- +goose Up
+-- place_names_json を階層つきの地名辞書 (国 > 都道府県 > 市区町村 > 地点) にするのだ
+-- class_place_name (jsonb) は多言語の表記 {"ja": "...", "en": "..."} としてそのまま使うのだ
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE place_names_json ALTER COLUMN place_name_id SET DEFAULT gen_random_uuid()::text;
+ALTER TABLE place_names_json ADD COLUMN workstation_id bigint REFERENCES workstation(workstation_id) ON DELETE CASCADE;
+ALTER TABLE place_names_json ADD COLUMN parent_id text REFERENCES place_names_json(place_name_id);
+ALTER TABLE place_names_json ADD COLUMN rank text;
+ALTER TABLE place_names_json ADD COLUMN name text;
+ALTER TABLE place_names_json ADD COLUMN latitude double precision;
+ALTER TABLE place_names_json ADD COLUMN longitude double precision;
+ALTER TABLE place_names_json ADD COLUMN geom geometry(Point, 4326);
+ALTER TABLE place_names_json ADD COLUMN boundary geometry(MultiPolygon, 4326);
+ALTER TABLE place_names_json ADD COLUMN user_id bigint REFERENCES users(user_id);
+ALTER TABLE place_names_json ADD COLUMN updated_at timestamp with time zone DEFAULT now();
+
+ALTER TABLE place_names_json ADD CONSTRAINT place_names_json_rank_check
+    CHECK (rank IS NULL OR rank IN ('country', 'prefecture', 'municipality', 'locality'));
+
+-- 代表点 (geom) は places と同じトリガー関数で latitude / longitude から作るのだ
+CREATE TRIGGER place_names_set_geom_trigger
+    BEFORE INSERT OR UPDATE ON place_names_json
+    FOR EACH ROW EXECUTE FUNCTION places_set_geom();
+
+CREATE INDEX place_names_json_workstation_idx ON place_names_json (workstation_id, parent_id);
+CREATE INDEX place_names_json_name_trgm_idx ON place_names_json USING GIN (name gin_trgm_ops);
+CREATE INDEX place_names_json_geom_idx ON place_names_json USING GIST (geom);
+CREATE INDEX place_names_json_boundary_idx ON place_names_json USING GIST (boundary);
+
+-- +goose Down
+DROP INDEX IF EXISTS place_names_json_boundary_idx;
+DROP INDEX IF EXISTS place_names_json_geom_idx;
+DROP INDEX IF EXISTS place_names_json_name_trgm_idx;
+DROP INDEX IF EXISTS place_names_json_workstation_idx;
+DROP TRIGGER IF EXISTS place_names_set_geom_trigger ON place_names_json;
+ALTER TABLE place_names_json DROP CONSTRAINT IF EXISTS place_names_json_rank_check;
+ALTER TABLE place_names_json DROP COLUMN updated_at;
+ALTER TABLE place_names_json DROP COLUMN user_id;
+ALTER TABLE place_names_json DROP COLUMN boundary;
+ALTER TABLE place_names_json DROP COLUMN geom;
+ALTER TABLE place_names_json DROP COLUMN longitude;
+ALTER TABLE place_names_json DROP COLUMN latitude;
+ALTER TABLE place_names_json DROP COLUMN name;
+ALTER TABLE place_names_json DROP COLUMN rank;
+ALTER TABLE place_names_json DROP COLUMN parent_id;
+ALTER TABLE place_names_json DROP COLUMN workstation_id;
+ALTER TABLE place_names_json ALTER COLUMN place_name_id DROP DEFAULT;
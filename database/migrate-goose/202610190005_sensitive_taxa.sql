@@ -0,0 +1,25 @@
+-- +goose Up
+-- 密猟・盗掘のおそれがある分類群の産地を隠すための設定なのだ
+-- generalization は "mesh:1" / "mesh:2" / "mesh:3" (地域メッシュ) / "grid:0.1" (度単位の格子) / "hidden" (座標を出さない)
+-- embargo_until を過ぎると元の精度で公開されるのだ (NULL なら無期限)
+CREATE TABLE sensitive_taxa (
+    sensitive_taxon_id text PRIMARY KEY DEFAULT gen_random_uuid()::text,
+    workstation_id bigint NOT NULL REFERENCES workstation(workstation_id) ON DELETE CASCADE,
+    rank text NOT NULL CHECK (rank IN ('kingdom', 'phylum', 'class', 'order', 'family', 'genus', 'species')),
+    name text NOT NULL,
+    generalization text NOT NULL,
+    embargo_until timestamp with time zone,
+    note text,
+    user_id bigint REFERENCES users(user_id),
+    updated_at timestamp with time zone DEFAULT now(),
+    UNIQUE (workstation_id, rank, name)
+);
+
+-- レコード単位の指定 (CouchDB の occurrence_data.sensitivity / embargo_until から同期するのだ)
+ALTER TABLE occurrence ADD COLUMN sensitivity text;
+ALTER TABLE occurrence ADD COLUMN embargo_until timestamp with time zone;
+
+-- +goose Down
+ALTER TABLE occurrence DROP COLUMN embargo_until;
+ALTER TABLE occurrence DROP COLUMN sensitivity;
+DROP TABLE IF EXISTS sensitive_taxa;
@@ -0,0 +1,30 @@
+-- +goose Up
+-- ワークステーションごとの分類チェックリスト (Darwin Core の Taxon を取り込むのだ)
+-- source_id / parent_source_id / accepted_source_id は取り込み元の taxonID で、
+-- 取り込み後に parent_id / accepted_id (このテーブルの taxon_id) に解決するのだ
+CREATE TABLE taxa (
+    taxon_id text PRIMARY KEY DEFAULT gen_random_uuid()::text,
+    workstation_id bigint NOT NULL REFERENCES workstation(workstation_id) ON DELETE CASCADE,
+    source_id text NOT NULL,
+    parent_source_id text,
+    accepted_source_id text,
+    parent_id text REFERENCES taxa(taxon_id) ON DELETE SET NULL,
+    accepted_id text REFERENCES taxa(taxon_id) ON DELETE SET NULL,
+    rank text NOT NULL,
+    scientific_name text NOT NULL,
+    canonical_name text NOT NULL,
+    authorship text,
+    taxonomic_status text NOT NULL DEFAULT 'accepted',
+    vernacular_name text,
+    classification jsonb,
+    updated_at timestamp with time zone DEFAULT now(),
+    UNIQUE (workstation_id, source_id)
+);
+
+CREATE INDEX taxa_canonical_name_idx ON taxa (workstation_id, rank, lower(canonical_name));
+CREATE INDEX taxa_canonical_name_trgm_idx ON taxa USING GIN (canonical_name gin_trgm_ops);
+CREATE INDEX taxa_vernacular_name_trgm_idx ON taxa USING GIN (vernacular_name gin_trgm_ops);
+CREATE INDEX taxa_accepted_id_idx ON taxa (accepted_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS taxa;
@@ -0,0 +1,33 @@
+-- +goose Up
+-- 階級ごとの絞り込み (class_classification ->> 'family' ILIKE ...) を速くするための索引なのだ
+-- ILIKE でも使えるように pg_trgm の GIN 索引にするのだ
+CREATE INDEX classification_json_kingdom_trgm_idx ON classification_json USING GIN ((class_classification ->> 'kingdom') gin_trgm_ops);
+CREATE INDEX classification_json_phylum_trgm_idx ON classification_json USING GIN ((class_classification ->> 'phylum') gin_trgm_ops);
+CREATE INDEX classification_json_class_trgm_idx ON classification_json USING GIN ((class_classification ->> 'class') gin_trgm_ops);
+CREATE INDEX classification_json_order_trgm_idx ON classification_json USING GIN ((class_classification ->> 'order') gin_trgm_ops);
+CREATE INDEX classification_json_family_trgm_idx ON classification_json USING GIN ((class_classification ->> 'family') gin_trgm_ops);
+CREATE INDEX classification_json_genus_trgm_idx ON classification_json USING GIN ((class_classification ->> 'genus') gin_trgm_ops);
+CREATE INDEX classification_json_species_trgm_idx ON classification_json USING GIN ((class_classification ->> 'species') gin_trgm_ops);
+
+-- 上位の階級での絞り込みで、チェックリストの下位の分類を探すための索引なのだ
+CREATE INDEX taxa_classification_kingdom_idx ON taxa (workstation_id, lower(classification ->> 'kingdom'));
+CREATE INDEX taxa_classification_phylum_idx ON taxa (workstation_id, lower(classification ->> 'phylum'));
+CREATE INDEX taxa_classification_class_idx ON taxa (workstation_id, lower(classification ->> 'class'));
+CREATE INDEX taxa_classification_order_idx ON taxa (workstation_id, lower(classification ->> 'order'));
+CREATE INDEX taxa_classification_family_idx ON taxa (workstation_id, lower(classification ->> 'family'));
+CREATE INDEX taxa_classification_genus_idx ON taxa (workstation_id, lower(classification ->> 'genus'));
+
+-- +goose Down
+DROP INDEX IF EXISTS taxa_classification_genus_idx;
+DROP INDEX IF EXISTS taxa_classification_family_idx;
+DROP INDEX IF EXISTS taxa_classification_order_idx;
+DROP INDEX IF EXISTS taxa_classification_class_idx;
+DROP INDEX IF EXISTS taxa_classification_phylum_idx;
+DROP INDEX IF EXISTS taxa_classification_kingdom_idx;
+DROP INDEX IF EXISTS classification_json_species_trgm_idx;
+DROP INDEX IF EXISTS classification_json_genus_trgm_idx;
+DROP INDEX IF EXISTS classification_json_family_trgm_idx;
+DROP INDEX IF EXISTS classification_json_order_trgm_idx;
+DROP INDEX IF EXISTS classification_json_class_trgm_idx;
+DROP INDEX IF EXISTS classification_json_phylum_trgm_idx;
+DROP INDEX IF EXISTS classification_json_kingdom_trgm_idx;
@@ -0,0 +1,39 @@
+-- +goose Up
+-- 同定の履歴と、メンバーによる賛成・反対の投票なのだ
+-- 同じ人が新しく同定すると、前の同定は is_current = false になるのだ
+ALTER TABLE identifications ALTER COLUMN identification_id SET DEFAULT gen_random_uuid()::text;
+ALTER TABLE identifications ADD COLUMN workstation_id bigint REFERENCES workstation(workstation_id) ON DELETE CASCADE;
+ALTER TABLE identifications ADD COLUMN class_classification jsonb;
+ALTER TABLE identifications ADD COLUMN taxon_id text REFERENCES taxa(taxon_id) ON DELETE SET NULL;
+ALTER TABLE identifications ADD COLUMN note text;
+ALTER TABLE identifications ADD COLUMN is_current boolean NOT NULL DEFAULT true;
+ALTER TABLE identifications ADD COLUMN withdrawn_at timestamp with time zone;
+ALTER TABLE identifications ADD COLUMN created_at timestamp with time zone DEFAULT now();
+
+CREATE INDEX identifications_occurrence_idx ON identifications (occurrence_id, is_current);
+
+CREATE TABLE identification_votes (
+    identification_id text NOT NULL REFERENCES identifications(identification_id) ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    agree boolean NOT NULL,
+    voted_at timestamp with time zone DEFAULT now(),
+    PRIMARY KEY (identification_id, user_id)
+);
+
+-- 合意の結果 (unidentified / needs_id / research) と、合意した同定なのだ
+ALTER TABLE occurrence ADD COLUMN quality_grade text NOT NULL DEFAULT 'unidentified';
+ALTER TABLE occurrence ADD COLUMN consensus_identification_id text REFERENCES identifications(identification_id) ON DELETE SET NULL;
+
+-- +goose Down
+ALTER TABLE occurrence DROP COLUMN consensus_identification_id;
+ALTER TABLE occurrence DROP COLUMN quality_grade;
+DROP TABLE IF EXISTS identification_votes;
+DROP INDEX IF EXISTS identifications_occurrence_idx;
+ALTER TABLE identifications DROP COLUMN created_at;
+ALTER TABLE identifications DROP COLUMN withdrawn_at;
+ALTER TABLE identifications DROP COLUMN is_current;
+ALTER TABLE identifications DROP COLUMN note;
+ALTER TABLE identifications DROP COLUMN taxon_id;
+ALTER TABLE identifications DROP COLUMN class_classification;
+ALTER TABLE identifications DROP COLUMN workstation_id;
+ALTER TABLE identifications ALTER COLUMN identification_id DROP DEFAULT;
@@ -0,0 +1,42 @@
+-- +goose Up
+-- 標本の登録番号 (catalog number) と、その採番の設定なのだ
+ALTER TABLE specimen ALTER COLUMN specimen_id SET DEFAULT gen_random_uuid()::text;
+ALTER TABLE specimen ADD COLUMN workstation_id bigint REFERENCES workstation(workstation_id) ON DELETE CASCADE;
+ALTER TABLE specimen ADD COLUMN catalog_number text;
+ALTER TABLE specimen ADD COLUMN note text;
+ALTER TABLE specimen ADD COLUMN created_at timestamp with time zone DEFAULT now();
+ALTER TABLE specimen ADD COLUMN updated_at timestamp with time zone DEFAULT now();
+
+UPDATE specimen SET workstation_id = occurrence.workstation_id
+FROM occurrence WHERE occurrence.occurrence_id = specimen.occurrence_id;
+
+-- 登録番号はワークステーションの中で重複しないのだ
+CREATE UNIQUE INDEX specimen_catalog_number_key ON specimen (workstation_id, catalog_number);
+CREATE INDEX specimen_occurrence_idx ON specimen (occurrence_id);
+
+ALTER TABLE make_specimen ALTER COLUMN make_specimen_id SET DEFAULT gen_random_uuid()::text;
+
+-- 採番の設定 (接頭辞 + ゼロ埋めの連番) なのだ
+-- collection_id が空文字の行はワークステーション全体の既定なのだ
+CREATE TABLE catalog_number_sequences (
+    sequence_id text PRIMARY KEY DEFAULT gen_random_uuid()::text,
+    workstation_id bigint NOT NULL REFERENCES workstation(workstation_id) ON DELETE CASCADE,
+    collection_id text NOT NULL DEFAULT '',
+    prefix text NOT NULL DEFAULT '',
+    padding integer NOT NULL DEFAULT 6,
+    next_value bigint NOT NULL DEFAULT 1,
+    updated_at timestamp with time zone DEFAULT now(),
+    UNIQUE (workstation_id, collection_id)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS catalog_number_sequences;
+ALTER TABLE make_specimen ALTER COLUMN make_specimen_id DROP DEFAULT;
+DROP INDEX IF EXISTS specimen_occurrence_idx;
+DROP INDEX IF EXISTS specimen_catalog_number_key;
+ALTER TABLE specimen DROP COLUMN updated_at;
+ALTER TABLE specimen DROP COLUMN created_at;
+ALTER TABLE specimen DROP COLUMN note;
+ALTER TABLE specimen DROP COLUMN catalog_number;
+ALTER TABLE specimen DROP COLUMN workstation_id;
+ALTER TABLE specimen ALTER COLUMN specimen_id DROP DEFAULT;
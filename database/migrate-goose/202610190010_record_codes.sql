@@ -0,0 +1,14 @@
+-- +goose Up
+-- ラベルの QR コードに載せる短いコードなのだ (1件のレコードに1つ)
+-- code は Crockford Base32 の8文字 (紛らわしい I L O U を使わない) なのだ
+CREATE TABLE record_codes (
+    code text PRIMARY KEY,
+    workstation_id bigint NOT NULL REFERENCES workstation(workstation_id) ON DELETE CASCADE,
+    target_type text NOT NULL CHECK (target_type IN ('occurrence', 'specimen')),
+    target_id text NOT NULL,
+    created_at timestamp with time zone DEFAULT now(),
+    UNIQUE (target_type, target_id)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS record_codes;
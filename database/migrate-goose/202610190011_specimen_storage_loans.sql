@@ -0,0 +1,70 @@
+-- +goose Up
+-- 標本の保管場所 (建物 > 部屋 > キャビネット > 引き出し) と移動の履歴、貸し出しなのだ
+CREATE TABLE storage_locations (
+    location_id text PRIMARY KEY DEFAULT gen_random_uuid()::text,
+    workstation_id bigint NOT NULL REFERENCES workstation(workstation_id) ON DELETE CASCADE,
+    parent_id text REFERENCES storage_locations(location_id) ON DELETE RESTRICT,
+    kind text NOT NULL CHECK (kind IN ('building', 'room', 'cabinet', 'drawer')),
+    name text NOT NULL,
+    note text,
+    created_at timestamp with time zone DEFAULT now(),
+    updated_at timestamp with time zone DEFAULT now()
+);
+
+-- 同じ親の下で名前は重複しないのだ
+CREATE UNIQUE INDEX storage_locations_name_key ON storage_locations (workstation_id, COALESCE(parent_id, ''), name);
+
+ALTER TABLE specimen ADD COLUMN storage_location_id text REFERENCES storage_locations(location_id) ON DELETE SET NULL;
+
+-- 貸し出し (1件の貸し出しに複数の標本を含められるのだ)
+CREATE TABLE specimen_loans (
+    loan_id text PRIMARY KEY DEFAULT gen_random_uuid()::text,
+    workstation_id bigint NOT NULL REFERENCES workstation(workstation_id) ON DELETE CASCADE,
+    borrower_name text NOT NULL,
+    borrower_institution text,
+    borrower_email text,
+    purpose text,
+    loaned_at date NOT NULL,
+    due_date date,
+    returned_at timestamp with time zone,
+    note text,
+    created_by bigint REFERENCES users(user_id) ON DELETE SET NULL,
+    created_at timestamp with time zone DEFAULT now(),
+    updated_at timestamp with time zone DEFAULT now(),
+    CHECK (due_date IS NULL OR due_date >= loaned_at)
+);
+
+CREATE INDEX specimen_loans_open_idx ON specimen_loans (workstation_id, due_date) WHERE returned_at IS NULL;
+
+CREATE TABLE specimen_loan_items (
+    loan_id text NOT NULL REFERENCES specimen_loans(loan_id) ON DELETE CASCADE,
+    specimen_id text NOT NULL REFERENCES specimen(specimen_id) ON DELETE CASCADE,
+    returned_at timestamp with time zone,
+    PRIMARY KEY (loan_id, specimen_id)
+);
+
+-- 返却されていない貸し出しは標本ごとに1件だけなのだ
+CREATE UNIQUE INDEX specimen_loan_items_open_key ON specimen_loan_items (specimen_id) WHERE returned_at IS NULL;
+
+-- 移動の履歴 (move: 保管場所の変更, loan_out: 貸し出し, loan_return: 返却)
+CREATE TABLE specimen_movements (
+    movement_id text PRIMARY KEY DEFAULT gen_random_uuid()::text,
+    specimen_id text NOT NULL REFERENCES specimen(specimen_id) ON DELETE CASCADE,
+    workstation_id bigint NOT NULL REFERENCES workstation(workstation_id) ON DELETE CASCADE,
+    kind text NOT NULL CHECK (kind IN ('move', 'loan_out', 'loan_return')),
+    from_location_id text REFERENCES storage_locations(location_id) ON DELETE SET NULL,
+    to_location_id text REFERENCES storage_locations(location_id) ON DELETE SET NULL,
+    loan_id text REFERENCES specimen_loans(loan_id) ON DELETE SET NULL,
+    note text,
+    moved_by bigint REFERENCES users(user_id) ON DELETE SET NULL,
+    moved_at timestamp with time zone DEFAULT now()
+);
+
+CREATE INDEX specimen_movements_specimen_idx ON specimen_movements (specimen_id, moved_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS specimen_movements;
+DROP TABLE IF EXISTS specimen_loan_items;
+DROP TABLE IF EXISTS specimen_loans;
+ALTER TABLE specimen DROP COLUMN storage_location_id;
+DROP TABLE IF EXISTS storage_locations;
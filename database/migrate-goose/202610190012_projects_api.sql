@@ -0,0 +1,35 @@
+-- +goose Up
+-- プロジェクトとメンバーを API から管理できるようにするのだ
+ALTER TABLE projects ALTER COLUMN workstation_id TYPE bigint;
+ALTER TABLE projects ALTER COLUMN user_id TYPE bigint;
+ALTER TABLE projects DROP CONSTRAINT IF EXISTS projects_workstation_id_fkey;
+ALTER TABLE projects ADD CONSTRAINT projects_workstation_id_fkey FOREIGN KEY (workstation_id) REFERENCES workstation(workstation_id) ON DELETE CASCADE;
+CREATE INDEX projects_workstation_idx ON projects (workstation_id);
+
+-- プロジェクトを削除したらメンバーも消すのだ
+ALTER TABLE project_members DROP CONSTRAINT IF EXISTS project_members_project_id_fkey;
+ALTER TABLE project_members ADD CONSTRAINT project_members_project_id_fkey FOREIGN KEY (project_id) REFERENCES projects(project_id) ON DELETE CASCADE;
+
+-- 1人のユーザーはプロジェクトに1行だけ (抜けた人は finish_day が入るのだ)
+-- 今ある重複は、参加中の行 (finish_day が無い) を優先して、参加日の早い1行だけ残すのだ
+DELETE FROM project_members m
+USING (
+    SELECT project_member_id,
+           row_number() OVER (
+               PARTITION BY project_id, user_id
+               ORDER BY (finish_day IS NULL) DESC, join_day NULLS LAST, project_member_id
+           ) AS rn
+    FROM project_members
+) d
+WHERE m.project_member_id = d.project_member_id AND d.rn > 1;
+CREATE UNIQUE INDEX project_members_user_key ON project_members (project_id, user_id);
+
+CREATE INDEX occurrence_project_idx ON occurrence (project_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS occurrence_project_idx;
+DROP INDEX IF EXISTS project_members_user_key;
+ALTER TABLE project_members DROP CONSTRAINT IF EXISTS project_members_project_id_fkey;
+ALTER TABLE project_members ADD CONSTRAINT project_members_project_id_fkey FOREIGN KEY (project_id) REFERENCES projects(project_id);
+DROP INDEX IF EXISTS projects_workstation_idx;
+ALTER TABLE projects DROP CONSTRAINT IF EXISTS projects_workstation_id_fkey;
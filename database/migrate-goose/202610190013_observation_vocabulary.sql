@@ -0,0 +1,76 @@
+-- +goose Up
+-- 観察手法と観察記録、行動の語彙 (統制語) なのだ
+ALTER TABLE observation_methods ADD COLUMN description text;
+ALTER TABLE observation_methods ADD COLUMN created_at timestamp with time zone DEFAULT now();
+ALTER TABLE observation_methods ADD COLUMN updated_at timestamp with time zone DEFAULT now();
+ALTER TABLE observation_methods DROP CONSTRAINT IF EXISTS observation_methods_workstation_id_fkey;
+ALTER TABLE observation_methods ADD CONSTRAINT observation_methods_workstation_id_fkey FOREIGN KEY (workstation_id) REFERENCES workstation(workstation_id) ON DELETE CASCADE;
+
+-- 同じワークステーションに同じ名前の手法が今あるときは、1つにまとめてから一意にするのだ
+-- 観察は残す方 (ID の一番小さい手法) に付け替えるのだ
+CREATE TEMPORARY TABLE observation_method_merge ON COMMIT DROP AS
+SELECT observation_method_id AS old_id,
+       first_value(observation_method_id) OVER (
+           PARTITION BY workstation_id, method_common_name ORDER BY observation_method_id
+       ) AS keep_id
+FROM observation_methods
+WHERE method_common_name IS NOT NULL;
+DELETE FROM observation_method_merge WHERE old_id = keep_id;
+
+UPDATE observations SET observation_method_id = mm.keep_id
+FROM observation_method_merge mm WHERE observations.observation_method_id = mm.old_id;
+DELETE FROM observation_methods WHERE observation_method_id IN (SELECT old_id FROM observation_method_merge);
+
+CREATE UNIQUE INDEX observation_methods_name_key ON observation_methods (workstation_id, method_common_name);
+
+-- 行動の語彙はワークステーションごとに管理者が決めるのだ (例: 採餌 / 求愛 / 訪花)
+CREATE TABLE behavior_terms (
+    term_id text PRIMARY KEY DEFAULT gen_random_uuid()::text,
+    workstation_id bigint NOT NULL REFERENCES workstation(workstation_id) ON DELETE CASCADE,
+    term text NOT NULL,
+    category text,
+    description text,
+    created_at timestamp with time zone DEFAULT now(),
+    updated_at timestamp with time zone DEFAULT now(),
+    UNIQUE (workstation_id, term)
+);
+
+ALTER TABLE observations ALTER COLUMN observation_id SET DEFAULT gen_random_uuid()::text;
+ALTER TABLE observations ADD COLUMN workstation_id bigint REFERENCES workstation(workstation_id) ON DELETE CASCADE;
+ALTER TABLE observations ADD COLUMN created_at timestamp with time zone DEFAULT now();
+
+UPDATE observations SET workstation_id = occurrence.workstation_id
+FROM occurrence WHERE occurrence.occurrence_id = observations.occurrence_id;
+
+-- 手法が見つからない観察は手法なしにしてから外部キーを付けるのだ
+UPDATE observations SET observation_method_id = NULL
+WHERE observation_method_id IS NOT NULL
+  AND NOT EXISTS (SELECT 1 FROM observation_methods m WHERE m.observation_method_id = observations.observation_method_id);
+ALTER TABLE observations ADD CONSTRAINT observations_observation_method_id_fkey FOREIGN KEY (observation_method_id) REFERENCES observation_methods(observation_method_id);
+
+CREATE INDEX observations_occurrence_idx ON observations (occurrence_id);
+CREATE INDEX observations_method_idx ON observations (observation_method_id);
+
+-- 観察と行動の語彙の対応 (1つの観察に複数の行動を付けられるのだ)
+CREATE TABLE observation_behaviors (
+    observation_id text NOT NULL REFERENCES observations(observation_id) ON DELETE CASCADE,
+    term_id text NOT NULL REFERENCES behavior_terms(term_id),
+    PRIMARY KEY (observation_id, term_id)
+);
+
+CREATE INDEX observation_behaviors_term_idx ON observation_behaviors (term_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS observation_behaviors;
+DROP INDEX IF EXISTS observations_method_idx;
+DROP INDEX IF EXISTS observations_occurrence_idx;
+ALTER TABLE observations DROP CONSTRAINT IF EXISTS observations_observation_method_id_fkey;
+ALTER TABLE observations DROP COLUMN created_at;
+ALTER TABLE observations DROP COLUMN workstation_id;
+ALTER TABLE observations ALTER COLUMN observation_id DROP DEFAULT;
+DROP TABLE IF EXISTS behavior_terms;
+DROP INDEX IF EXISTS observation_methods_name_key;
+ALTER TABLE observation_methods DROP CONSTRAINT IF EXISTS observation_methods_workstation_id_fkey;
+ALTER TABLE observation_methods DROP COLUMN updated_at;
+ALTER TABLE observation_methods DROP COLUMN created_at;
+ALTER TABLE observation_methods DROP COLUMN description;
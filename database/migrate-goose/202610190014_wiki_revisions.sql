@@ -0,0 +1,43 @@
+-- +goose Up
+-- Wiki のページ本文 (Markdown) をサーバーに保存して、すべての版を残すのだ
+ALTER TABLE wiki_pages ADD COLUMN content text NOT NULL DEFAULT '';
+ALTER TABLE wiki_pages ADD COLUMN revision integer NOT NULL DEFAULT 0;
+ALTER TABLE wiki_pages ALTER COLUMN created_date TYPE timestamp with time zone;
+ALTER TABLE wiki_pages ALTER COLUMN updated_date TYPE timestamp with time zone;
+ALTER TABLE wiki_pages DROP CONSTRAINT IF EXISTS wiki_pages_workstation_id_fkey;
+ALTER TABLE wiki_pages ADD CONSTRAINT wiki_pages_workstation_id_fkey FOREIGN KEY (workstation_id) REFERENCES workstation(workstation_id) ON DELETE CASCADE;
+
+-- ページ名はワークステーションの中で重複しないのだ
+CREATE UNIQUE INDEX wiki_pages_title_key ON wiki_pages (workstation_id, lower(title));
+
+CREATE TABLE wiki_page_revisions (
+    revision_id text PRIMARY KEY DEFAULT gen_random_uuid()::text,
+    page_id text NOT NULL REFERENCES wiki_pages(page_id) ON DELETE CASCADE,
+    revision integer NOT NULL,
+    title text NOT NULL,
+    content text NOT NULL,
+    summary text,
+    user_id bigint NOT NULL REFERENCES users(user_id),
+    created_at timestamp with time zone DEFAULT now(),
+    UNIQUE (page_id, revision)
+);
+
+-- 手法の説明ページが消えたら、手法からのリンクだけ外すのだ
+ALTER TABLE observation_methods DROP CONSTRAINT IF EXISTS observation_methods_pageid_fkey;
+ALTER TABLE observation_methods ADD CONSTRAINT observation_methods_pageid_fkey FOREIGN KEY (pageid) REFERENCES wiki_pages(page_id) ON DELETE SET NULL;
+ALTER TABLE specimen_methods DROP CONSTRAINT IF EXISTS specimen_methods_page_id_fkey;
+ALTER TABLE specimen_methods ADD CONSTRAINT specimen_methods_page_id_fkey FOREIGN KEY (page_id) REFERENCES wiki_pages(page_id) ON DELETE SET NULL;
+
+-- +goose Down
+ALTER TABLE specimen_methods DROP CONSTRAINT IF EXISTS specimen_methods_page_id_fkey;
+ALTER TABLE specimen_methods ADD CONSTRAINT specimen_methods_page_id_fkey FOREIGN KEY (page_id) REFERENCES wiki_pages(page_id);
+ALTER TABLE observation_methods DROP CONSTRAINT IF EXISTS observation_methods_pageid_fkey;
+ALTER TABLE observation_methods ADD CONSTRAINT observation_methods_pageid_fkey FOREIGN KEY (pageid) REFERENCES wiki_pages(page_id);
+DROP TABLE IF EXISTS wiki_page_revisions;
+DROP INDEX IF EXISTS wiki_pages_title_key;
+ALTER TABLE wiki_pages DROP CONSTRAINT IF EXISTS wiki_pages_workstation_id_fkey;
+ALTER TABLE wiki_pages ADD CONSTRAINT wiki_pages_workstation_id_fkey FOREIGN KEY (workstation_id) REFERENCES workstation(workstation_id);
+ALTER TABLE wiki_pages ALTER COLUMN updated_date TYPE timestamp without time zone;
+ALTER TABLE wiki_pages ALTER COLUMN created_date TYPE timestamp without time zone;
+ALTER TABLE wiki_pages DROP COLUMN revision;
+ALTER TABLE wiki_pages DROP COLUMN content;
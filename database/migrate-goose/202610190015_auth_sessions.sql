@@ -0,0 +1,30 @@
+-- +goose Up
+-- ログインのセッションと、使うたびに替わるリフレッシュトークンなのだ
+CREATE TABLE auth_sessions (
+    session_id text PRIMARY KEY DEFAULT gen_random_uuid()::text,
+    user_id bigint NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    user_agent text,
+    ip_address text,
+    created_at timestamp with time zone DEFAULT now(),
+    last_used_at timestamp with time zone DEFAULT now(),
+    expires_at timestamp with time zone NOT NULL,
+    revoked_at timestamp with time zone
+);
+
+CREATE INDEX auth_sessions_user_idx ON auth_sessions (user_id) WHERE revoked_at IS NULL;
+
+-- トークンそのものではなく SHA-256 のハッシュを保存するのだ
+-- used_at が入ったトークンをもう一度使われたら、盗まれたとみなしてセッションを取り消すのだ
+CREATE TABLE refresh_tokens (
+    token_hash text PRIMARY KEY,
+    session_id text NOT NULL REFERENCES auth_sessions(session_id) ON DELETE CASCADE,
+    created_at timestamp with time zone DEFAULT now(),
+    expires_at timestamp with time zone NOT NULL,
+    used_at timestamp with time zone
+);
+
+CREATE INDEX refresh_tokens_session_idx ON refresh_tokens (session_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS auth_sessions;
@@ -0,0 +1,22 @@
+-- +goose Up
+-- メールアドレスを確かめた日時なのだ (NULL ならまだ確かめていないのだ)
+ALTER TABLE users ADD COLUMN email_verified_at timestamp with time zone;
+
+-- メールで送る1回きりのトークンなのだ (メールアドレスの確認・パスワードの再設定)
+-- トークンそのものではなく SHA-256 のハッシュを保存するのだ
+CREATE TABLE user_mail_tokens (
+    token_hash text PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    purpose text NOT NULL CHECK (purpose IN ('verify_email', 'reset_password')),
+    -- 送った先のメールアドレスなのだ。アドレスが変わったら古いトークンは使えないのだ
+    mail_address text NOT NULL,
+    created_at timestamp with time zone DEFAULT now(),
+    expires_at timestamp with time zone NOT NULL,
+    used_at timestamp with time zone
+);
+
+CREATE INDEX user_mail_tokens_user_idx ON user_mail_tokens (user_id, purpose, created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS user_mail_tokens;
+ALTER TABLE users DROP COLUMN IF EXISTS email_verified_at;
@@ -0,0 +1,25 @@
+-- +goose Up
+-- 利用者が選ぶ言語 (languages マスター) なのだ
+ALTER TABLE users ADD COLUMN preferred_language_id integer REFERENCES languages(language_id) ON DELETE SET NULL;
+
+-- アカウントを削除した日時なのだ
+-- 記録 (occurrence や同定など) は残すので、行は消さずに個人情報だけ消すのだ
+ALTER TABLE users ADD COLUMN deleted_at timestamp with time zone;
+
+-- 登録時に "9" (時差) を入れていたのを IANA のタイムゾーン名に直すのだ
+-- Etc/GMT の符号は逆向きなのだ (Etc/GMT-9 が UTC+9)
+UPDATE users SET timezone = 'Asia/Tokyo' WHERE timezone IS NULL OR timezone = '' OR timezone = '9';
+UPDATE users SET timezone = CASE
+        WHEN timezone::int = 0 THEN 'UTC'
+        WHEN timezone::int > 0 THEN 'Etc/GMT-' || timezone::int
+        ELSE 'Etc/GMT+' || (-timezone::int)
+    END
+-- (AND は評価の順番が決まっていないので、数字かどうかを CASE で先に確かめるのだ)
+WHERE CASE WHEN timezone ~ '^[+-]?[0-9]{1,2}$' THEN abs(timezone::int) <= 14 ELSE false END;
+ALTER TABLE users ALTER COLUMN timezone SET DEFAULT 'Asia/Tokyo';
+ALTER TABLE users ALTER COLUMN timezone SET NOT NULL;
+
+-- +goose Down
+ALTER TABLE users ALTER COLUMN timezone DROP NOT NULL;
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE users DROP COLUMN IF EXISTS preferred_language_id;
@@ -0,0 +1,29 @@
+-- +goose Up
+-- スクリプトやデータの取り込み用の個人アクセストークンなのだ
+-- トークンそのものではなく SHA-256 のハッシュを保存するのだ
+CREATE TABLE personal_access_tokens (
+    token_id text PRIMARY KEY DEFAULT gen_random_uuid()::text,
+    user_id bigint NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    name text NOT NULL,
+    token_hash text NOT NULL UNIQUE,
+    -- 一覧でどのトークンか見分けるための先頭の数文字なのだ
+    token_prefix text NOT NULL,
+    scope text NOT NULL CHECK (scope IN ('read', 'read_write')),
+    created_at timestamp with time zone DEFAULT now(),
+    expires_at timestamp with time zone NOT NULL,
+    last_used_at timestamp with time zone,
+    revoked_at timestamp with time zone
+);
+
+CREATE INDEX personal_access_tokens_user_idx ON personal_access_tokens (user_id);
+
+-- トークンで使えるワークステーションなのだ
+CREATE TABLE personal_access_token_workstations (
+    token_id text NOT NULL REFERENCES personal_access_tokens(token_id) ON DELETE CASCADE,
+    workstation_id bigint NOT NULL REFERENCES workstation(workstation_id) ON DELETE CASCADE,
+    PRIMARY KEY (token_id, workstation_id)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS personal_access_token_workstations;
+DROP TABLE IF EXISTS personal_access_tokens;
@@ -0,0 +1,39 @@
+-- +goose Up
+-- 大学などの IdP (OpenID Connect) でログインしたユーザーとの結び付けなのだ
+-- 同じ IdP の同じ sub はいつも同じユーザーになるのだ
+CREATE TABLE user_identities (
+    issuer text NOT NULL,
+    subject text NOT NULL,
+    user_id bigint NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    -- 結び付けたときに IdP が教えてくれたメールアドレスなのだ (記録用)
+    mail_address text,
+    created_at timestamp with time zone DEFAULT now(),
+    last_login_at timestamp with time zone,
+    PRIMARY KEY (issuer, subject)
+);
+
+CREATE INDEX user_identities_user_idx ON user_identities (user_id);
+
+-- IdP に送ってから戻ってくるまでの state / nonce / PKCE の code_verifier なのだ
+-- state はハッシュで保存して、戻ってきたら1回で消すのだ
+CREATE TABLE oidc_login_states (
+    state_hash text PRIMARY KEY,
+    nonce text NOT NULL,
+    code_verifier text NOT NULL,
+    created_at timestamp with time zone DEFAULT now(),
+    expires_at timestamp with time zone NOT NULL
+);
+
+-- ログインが済んだ後、フロントエンドがトークンと引き換えるための使い捨ての券なのだ
+-- トークンそのものを URL に載せないためなのだ
+CREATE TABLE oidc_login_tickets (
+    ticket_hash text PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    created_at timestamp with time zone DEFAULT now(),
+    expires_at timestamp with time zone NOT NULL
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS oidc_login_tickets;
+DROP TABLE IF EXISTS oidc_login_states;
+DROP TABLE IF EXISTS user_identities;
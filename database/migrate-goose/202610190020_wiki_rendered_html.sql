@@ -0,0 +1,7 @@
+-- +goose Up
+-- 版ごとに本文を HTML にしたものを持っておくのだ
+-- 見るたびに Markdown を変換しないで済むように、保存するときに1回だけ作るのだ (古い版は最初に見たときに作るのだ)
+ALTER TABLE wiki_page_revisions ADD COLUMN content_html text;
+
+-- +goose Down
+ALTER TABLE wiki_page_revisions DROP COLUMN IF EXISTS content_html;
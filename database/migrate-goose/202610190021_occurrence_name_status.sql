@@ -0,0 +1,12 @@
+-- +goose Up
+-- 同期したときに記録の分類名をチェックリストと照らし合わせた結果なのだ
+-- name_status は accepted / synonym / doubtful / unknown (チェックリストにない名前がある) で、チェックリストが無ければ NULL なのだ
+-- taxon_id はいちばん下の階級で見つかった分類 (異名なら有効名) なのだ
+ALTER TABLE occurrence ADD COLUMN taxon_id text REFERENCES taxa(taxon_id) ON DELETE SET NULL;
+ALTER TABLE occurrence ADD COLUMN name_status text;
+CREATE INDEX occurrence_name_status_idx ON occurrence (workstation_id, name_status);
+
+-- +goose Down
+DROP INDEX IF EXISTS occurrence_name_status_idx;
+ALTER TABLE occurrence DROP COLUMN IF EXISTS name_status;
+ALTER TABLE occurrence DROP COLUMN IF EXISTS taxon_id;
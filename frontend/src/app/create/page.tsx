@@ -2,6 +2,7 @@
 
 import { useState, useEffect } from 'react';
 import { useRouter } from 'next/navigation';
+import { getAccessToken } from '@/utils/authToken';
 
 const DB_NAME = process.env.NEXT_PUBLIC_DB_NAME || 'test_db';
 
@@ -30,24 +31,28 @@ export default function CreateOccurrencePage() {
   });
 
   useEffect(() => {
-    const t = localStorage.getItem('auth_token');
-    const ws = localStorage.getItem('current_workstation');
-    if (!t || !ws) {
-      router.push('/');
-      return;
-    }
-    setToken(t);
-    setCurrentWS(JSON.parse(ws));
-
-    // ユーザーIDを取得
-    fetch('/api/users/me', { headers: { Authorization: `Bearer ${t}` } })
-      .then(res => res.json())
-      .then(data => {
-        if (data && data.user_id) {
-            setUserId(String(data.user_id));
-        }
-      })
-      .catch(console.error);
+    const load = async () => {
+      // 保存したアクセストークンは切れていることがあるので、必要なら取り直してから使うのだ
+      const t = await getAccessToken();
+      const ws = localStorage.getItem('current_workstation');
+      if (!t || !ws) {
+        router.push('/');
+        return;
+      }
+      setToken(t);
+      setCurrentWS(JSON.parse(ws));
+
+      // ユーザーIDを取得
+      fetch('/api/users/me', { headers: { Authorization: `Bearer ${t}` } })
+        .then(res => res.json())
+        .then(data => {
+          if (data && data.user_id) {
+              setUserId(String(data.user_id));
+          }
+        })
+        .catch(console.error);
+    };
+    load();
   }, [router]);
 
   const handleChange = (e: React.ChangeEvent<HTMLInputElement | HTMLSelectElement | HTMLTextAreaElement>) => {
@@ -106,6 +111,7 @@ export default function CreateOccurrencePage() {
           coordinates: (formData.latitude && formData.longitude) 
             ? { type: 'Point', coordinates: [Number(formData.longitude), Number(formData.latitude)] } 
             : null,
+          datum: 'EPSG:4326', // ブラウザの位置情報は WGS84 なのだ
           accuracy: null,
           class_place_name: null
         },
@@ -0,0 +1,76 @@
+'use client';
+
+import { useState } from 'react';
+import Link from 'next/link';
+
+export default function ForgotPasswordPage() {
+  const [email, setEmail] = useState('');
+  const [status, setStatus] = useState('');
+  const [isLoading, setIsLoading] = useState(false);
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setIsLoading(true);
+    setStatus('通信中...');
+
+    try {
+      const res = await fetch('/api/password/forgot', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ mailaddress: email }),
+      });
+
+      if (!res.ok) {
+        const err = await res.json();
+        throw new Error(err.error || '送信に失敗しました');
+      }
+
+      // 登録されていないアドレスでも同じ表示にするのだ
+      setStatus('登録されているアドレスなら、再設定のメールを送ったのだ。メールのリンクを開いてほしいのだ。');
+    } catch (err: any) {
+      setStatus(`エラー: ${err.message}`);
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
+  return (
+    <div className="min-h-screen bg-gray-50 flex flex-col items-center justify-center p-4">
+      <div className="bg-white p-8 rounded-xl shadow-sm border border-gray-100 w-full max-w-md">
+        <h2 className="text-2xl font-bold mb-6 text-center text-gray-800">パスワードの再設定</h2>
+
+        <form onSubmit={handleSubmit} className="space-y-5">
+          <div>
+            <label className="block text-sm font-semibold text-gray-600 mb-2">登録したメールアドレス</label>
+            <input
+              type="email"
+              required
+              className="w-full px-4 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-green-500 outline-none text-black transition"
+              placeholder="user@example.com"
+              value={email}
+              onChange={(e) => setEmail(e.target.value)}
+            />
+          </div>
+          {status && (
+            <p className={`text-sm text-center ${status.includes('エラー') ? 'text-red-500' : 'text-blue-500'}`}>
+              {status}
+            </p>
+          )}
+          <button
+            type="submit"
+            disabled={isLoading}
+            className="w-full bg-green-600 text-white font-bold py-3 rounded-lg hover:bg-green-700 transition duration-200 disabled:opacity-50 shadow-md"
+          >
+            {isLoading ? '処理中...' : '再設定のメールを送る'}
+          </button>
+        </form>
+
+        <div className="mt-6 text-center">
+          <Link href="/login" className="text-sm text-blue-600 hover:underline font-medium">
+            ログイン画面に戻る
+          </Link>
+        </div>
+      </div>
+    </div>
+  );
+}
@@ -0,0 +1,79 @@
+'use client';
+
+import { useState, useEffect, useRef } from 'react';
+import { useRouter } from 'next/navigation';
+import Link from 'next/link';
+import { saveTokens } from '@/utils/authToken';
+
+// サーバーから ?error= で渡されるエラーの種類ごとのメッセージなのだ
+const ERROR_MESSAGES: Record<string, string> = {
+  disabled: 'シングルサインオンは使えないのだ',
+  denied: 'ログインがキャンセルされたのだ',
+  expired: 'ログインの有効期限が切れたのだ。もう一度ログインしてほしいのだ',
+  email_required: 'IdP からメールアドレスを受け取れなかったのだ',
+  email_in_use: 'このメールアドレスのアカウントがあるけど、メールアドレスの確認が済んでいないのだ。確認してからもう一度ログインしてほしいのだ',
+  provider: 'IdP とのやり取りに失敗したのだ',
+};
+
+export default function OIDCCallbackPage() {
+  const router = useRouter();
+  const [status, setStatus] = useState('ログイン中...');
+  // 開発モードで2回呼ばれても、券は1回しか使えないので1回だけ引き換えるのだ
+  const exchanged = useRef(false);
+
+  // IdP から戻ってきた ?ticket=... をトークンと引き換えるのだ
+  useEffect(() => {
+    if (exchanged.current) return;
+    exchanged.current = true;
+
+    const params = new URLSearchParams(window.location.search);
+    const error = params.get('error');
+    if (error) {
+      setStatus(`エラー: ${ERROR_MESSAGES[error] || 'ログインに失敗したのだ'}`);
+      return;
+    }
+    const ticket = params.get('ticket');
+    if (!ticket) {
+      setStatus('エラー: リンクが正しくないのだ');
+      return;
+    }
+
+    const exchange = async () => {
+      try {
+        const res = await fetch('/api/oidc/exchange', {
+          method: 'POST',
+          headers: { 'Content-Type': 'application/json' },
+          body: JSON.stringify({ ticket }),
+        });
+        if (!res.ok) {
+          const err = await res.json();
+          throw new Error(err.error || 'ログイン失敗');
+        }
+        saveTokens(await res.json());
+        window.dispatchEvent(new Event('auth-change'));
+        router.replace('/workstation');
+      } catch (err: any) {
+        setStatus(`エラー: ${err.message}`);
+      }
+    };
+    exchange();
+  }, [router]);
+
+  return (
+    <div className="min-h-screen bg-gray-50 flex flex-col items-center justify-center p-4">
+      <div className="bg-white p-8 rounded-xl shadow-sm border border-gray-100 w-full max-w-md">
+        <h2 className="text-2xl font-bold mb-6 text-center text-gray-800">シングルサインオン</h2>
+        <p className={`text-sm text-center ${status.includes('エラー') ? 'text-red-500' : 'text-blue-500'}`}>
+          {status}
+        </p>
+        {status.includes('エラー') && (
+          <div className="mt-6 text-center">
+            <Link href="/login" className="text-sm text-blue-600 hover:underline font-medium">
+              ログイン画面へ
+            </Link>
+          </div>
+        )}
+      </div>
+    </div>
+  );
+}
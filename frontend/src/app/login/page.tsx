@@ -1,8 +1,9 @@
 'use client';
 
-import { useState } from 'react';
+import { useState, useEffect } from 'react';
 import { useRouter } from 'next/navigation';
 import Link from 'next/link';
+import { saveTokens } from '@/utils/authToken';
 
 export default function LoginPage() {
   const router = useRouter();
@@ -10,6 +11,15 @@ export default function LoginPage() {
   const [password, setPassword] = useState('');
   const [status, setStatus] = useState('');
   const [isLoading, setIsLoading] = useState(false);
+  // 大学などの IdP でログインできるときだけボタンを出すのだ
+  const [oidc, setOidc] = useState<{ enabled: boolean; provider_name?: string } | null>(null);
+
+  useEffect(() => {
+    fetch('/api/oidc/config')
+      .then((res) => (res.ok ? res.json() : null))
+      .then(setOidc)
+      .catch(() => setOidc(null));
+  }, []);
 
   const handleLogin = async (e: React.FormEvent) => {
     e.preventDefault();
@@ -31,11 +41,9 @@ export default function LoginPage() {
       const data = await res.json();
 
       // --- 保存処理 ---
-      localStorage.setItem('auth_token', data.token);
+      saveTokens(data);
       localStorage.setItem('user_email', email);
 
-      document.cookie = `auth_token=${data.token}; path=/; max-age=86400; SameSite=Lax`;
-
       window.dispatchEvent(new Event('auth-change'));
       setStatus('ログイン成功！');
       
@@ -91,6 +99,24 @@ export default function LoginPage() {
           </button>
         </form>
 
+        {oidc?.enabled && (
+          <div className="mt-4">
+            {/* サーバーが IdP のログイン画面へリダイレクトするので、普通のリンクで移動するのだ */}
+            <a
+              href="/api/oidc/login"
+              className="block w-full text-center border border-gray-300 text-gray-700 font-bold py-3 rounded-lg hover:bg-gray-50 transition duration-200"
+            >
+              {oidc.provider_name} でログイン
+            </a>
+          </div>
+        )}
+
+        <div className="mt-4 text-center">
+          <Link href="/forgot-password" className="text-sm text-blue-600 hover:underline">
+            パスワードを忘れた場合
+          </Link>
+        </div>
+
         <div className="mt-6 text-center">
           <p className="text-sm text-gray-500">アカウントをお持ちでないですか？</p>
           <Link href="/register" className="text-sm text-blue-600 hover:underline font-medium">
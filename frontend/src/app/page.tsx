@@ -5,6 +5,7 @@ import Link from 'next/link';
 import { useRouter } from 'next/navigation';
 import { usePouchDBSync } from '@/hooks/usePouchDBSync'; // 作成したフックをインポート
 import { useOccurrenceData } from '@/hooks/useOccurrenceData'; // ★追加: 発生データ取得フック
+import { getAccessToken } from '@/utils/authToken';
 
 const DB_NAME = process.env.NEXT_PUBLIC_DB_NAME || 'test_db';
 
@@ -43,55 +44,59 @@ export default function Home() {
   const { occurrences, loading: dataLoading, error: dataError } = useOccurrenceData(currentWS?.workstation_id || null);
 
   useEffect(() => {
-    const t = localStorage.getItem('auth_token');
-    if (!t) {
-      router.push('/login');
-      return;
-    }
-    setToken(t);
-
-    // ユーザー情報の取得
-    fetch('/api/users/me', { headers: { Authorization: `Bearer ${t}` } })
-      .then(res => res.json())
-      .then(data => setUser(data))
-      .catch(() => router.push('/login'));
-
-    // ワークステーション一覧取得
-    fetch('/api/my-workstations', { headers: { Authorization: `Bearer ${t}` } })
-      .then(res => res.json())
-      .then((data: Workstation[]) => { 
-        setWorkstations(data || []);
+    const load = async () => {
+      // 保存したアクセストークンは切れていることがあるので、必要なら取り直してから使うのだ
+      const t = await getAccessToken();
+      if (!t) {
+        router.push('/login');
+        return;
+      }
+      setToken(t);
+
+      // ユーザー情報の取得
+      fetch('/api/users/me', { headers: { Authorization: `Bearer ${t}` } })
+        .then(res => res.json())
+        .then(data => setUser(data))
+        .catch(() => router.push('/login'));
+
+      // ワークステーション一覧取得
+      fetch('/api/my-workstations', { headers: { Authorization: `Bearer ${t}` } })
+        .then(res => res.json())
+        .then((data: Workstation[]) => { 
+          setWorkstations(data || []);
         
-        if (data && data.length > 0) {
-          const savedWSJson = localStorage.getItem('current_workstation');
-          let targetWS: Workstation = data[0]; // デフォルトは最新のWS (APIが最新順だと仮定)
-
-          // 修正されたワークステーション選択ロジック (前回の修正を保持)
-          if (savedWSJson) {
-            try {
-              const savedWS = JSON.parse(savedWSJson);
+          if (data && data.length > 0) {
+            const savedWSJson = localStorage.getItem('current_workstation');
+            let targetWS: Workstation = data[0]; // デフォルトは最新のWS (APIが最新順だと仮定)
+
+            // 修正されたワークステーション選択ロジック (前回の修正を保持)
+            if (savedWSJson) {
+              try {
+                const savedWS = JSON.parse(savedWSJson);
               
-              // 1. savedWSが現在の一覧に存在するか確認
-              const foundWS = data.find(w => w.workstation_id === savedWS.workstation_id);
-
-              if (foundWS) {
-                  // 存在すればそれを優先する 
-                  targetWS = foundWS; 
-              } 
-            } catch (e) {
-                console.error("Failed to parse saved workstation:", e);
-                // パース失敗時は data[0] (targetWSの初期値) を使う
+                // 1. savedWSが現在の一覧に存在するか確認
+                const foundWS = data.find(w => w.workstation_id === savedWS.workstation_id);
+
+                if (foundWS) {
+                    // 存在すればそれを優先する 
+                    targetWS = foundWS; 
+                } 
+              } catch (e) {
+                  console.error("Failed to parse saved workstation:", e);
+                  // パース失敗時は data[0] (targetWSの初期値) を使う
+              }
             }
-          }
           
-          // 状態とローカルストレージを常に targetWS で更新するのだ
-          setCurrentWS(targetWS);
-          localStorage.setItem('current_workstation', JSON.stringify(targetWS));
-        } else {
-            setCurrentWS(null);
-            localStorage.removeItem('current_workstation');
-        }
-      });
+            // 状態とローカルストレージを常に targetWS で更新するのだ
+            setCurrentWS(targetWS);
+            localStorage.setItem('current_workstation', JSON.stringify(targetWS));
+          } else {
+              setCurrentWS(null);
+              localStorage.removeItem('current_workstation');
+          }
+        });
+    };
+    load();
   }, [router]);
 
   const handleWorkstationChange = (ws: Workstation) => {
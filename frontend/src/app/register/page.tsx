@@ -33,7 +33,7 @@ export default function Register() {
       }
 
       // 成功したらアラートを出してログイン画面へ
-      alert('登録が完了したのだ！ログインしてほしいのだ。');
+      alert('登録が完了したのだ！確認のメールを送ったので、リンクを開いておいてほしいのだ。ログインしてほしいのだ。');
       router.push('/');
 
     } catch (err: any) {
@@ -0,0 +1,104 @@
+'use client';
+
+import { useState, useEffect } from 'react';
+import { useRouter } from 'next/navigation';
+import Link from 'next/link';
+
+export default function ResetPasswordPage() {
+  const router = useRouter();
+  const [token, setToken] = useState('');
+  const [password, setPassword] = useState('');
+  const [confirmPassword, setConfirmPassword] = useState('');
+  const [status, setStatus] = useState('');
+  const [isLoading, setIsLoading] = useState(false);
+
+  // メールのリンクの ?token=... を読むのだ
+  useEffect(() => {
+    setToken(new URLSearchParams(window.location.search).get('token') || '');
+  }, []);
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    if (password !== confirmPassword) {
+      setStatus('エラー: パスワードが一致しないのだ');
+      return;
+    }
+    setIsLoading(true);
+    setStatus('通信中...');
+
+    try {
+      const res = await fetch('/api/password/reset', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ token, password }),
+      });
+
+      if (!res.ok) {
+        const err = await res.json();
+        throw new Error(err.error || '再設定に失敗しました');
+      }
+
+      alert('パスワードを変更したのだ！新しいパスワードでログインしてほしいのだ。');
+      router.push('/login');
+    } catch (err: any) {
+      setStatus(`エラー: ${err.message}`);
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
+  return (
+    <div className="min-h-screen bg-gray-50 flex flex-col items-center justify-center p-4">
+      <div className="bg-white p-8 rounded-xl shadow-sm border border-gray-100 w-full max-w-md">
+        <h2 className="text-2xl font-bold mb-6 text-center text-gray-800">新しいパスワード</h2>
+
+        {!token ? (
+          <p className="text-sm text-center text-red-500">リンクが正しくないのだ。メールのリンクをもう一度開いてほしいのだ。</p>
+        ) : (
+          <form onSubmit={handleSubmit} className="space-y-5">
+            <div>
+              <label className="block text-sm font-semibold text-gray-600 mb-2">新しいパスワード (8文字以上)</label>
+              <input
+                type="password"
+                required
+                minLength={8}
+                className="w-full px-4 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-green-500 outline-none text-black transition"
+                value={password}
+                onChange={(e) => setPassword(e.target.value)}
+              />
+            </div>
+            <div>
+              <label className="block text-sm font-semibold text-gray-600 mb-2">もう一度入力</label>
+              <input
+                type="password"
+                required
+                minLength={8}
+                className="w-full px-4 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-green-500 outline-none text-black transition"
+                value={confirmPassword}
+                onChange={(e) => setConfirmPassword(e.target.value)}
+              />
+            </div>
+            {status && (
+              <p className={`text-sm text-center ${status.includes('エラー') ? 'text-red-500' : 'text-blue-500'}`}>
+                {status}
+              </p>
+            )}
+            <button
+              type="submit"
+              disabled={isLoading}
+              className="w-full bg-green-600 text-white font-bold py-3 rounded-lg hover:bg-green-700 transition duration-200 disabled:opacity-50 shadow-md"
+            >
+              {isLoading ? '処理中...' : 'パスワードを変更'}
+            </button>
+          </form>
+        )}
+
+        <div className="mt-6 text-center">
+          <Link href="/forgot-password" className="text-sm text-blue-600 hover:underline font-medium">
+            再設定のメールを送り直す
+          </Link>
+        </div>
+      </div>
+    </div>
+  );
+}
@@ -0,0 +1,51 @@
+'use client';
+
+import { useState, useEffect } from 'react';
+import Link from 'next/link';
+
+export default function VerifyEmailPage() {
+  const [status, setStatus] = useState('確認中...');
+
+  // メールのリンクの ?token=... で確認するのだ (ログインしていなくても使えるのだ)
+  useEffect(() => {
+    const token = new URLSearchParams(window.location.search).get('token');
+    if (!token) {
+      setStatus('エラー: リンクが正しくないのだ');
+      return;
+    }
+
+    const verify = async () => {
+      try {
+        const res = await fetch('/api/email/verify', {
+          method: 'POST',
+          headers: { 'Content-Type': 'application/json' },
+          body: JSON.stringify({ token }),
+        });
+        if (!res.ok) {
+          const err = await res.json();
+          throw new Error(err.error || '確認に失敗しました');
+        }
+        setStatus('メールアドレスを確認したのだ！');
+      } catch (err: any) {
+        setStatus(`エラー: ${err.message}`);
+      }
+    };
+    verify();
+  }, []);
+
+  return (
+    <div className="min-h-screen bg-gray-50 flex flex-col items-center justify-center p-4">
+      <div className="bg-white p-8 rounded-xl shadow-sm border border-gray-100 w-full max-w-md">
+        <h2 className="text-2xl font-bold mb-6 text-center text-gray-800">メールアドレスの確認</h2>
+        <p className={`text-sm text-center ${status.includes('エラー') ? 'text-red-500' : 'text-blue-500'}`}>
+          {status}
+        </p>
+        <div className="mt-6 text-center">
+          <Link href="/workstation" className="text-sm text-blue-600 hover:underline font-medium">
+            トップへ
+          </Link>
+        </div>
+      </div>
+    </div>
+  );
+}
@@ -4,6 +4,7 @@
 
 import { useState } from 'react';
 import { useRouter } from 'next/navigation';
+import { getAccessToken } from '@/utils/authToken';
 
 // ★ Workstationの型定義
 interface Workstation {
@@ -23,7 +24,7 @@ export default function CreateWorkstationPage() {
     setError('');
 
     try {
-      const token = localStorage.getItem('auth_token');
+      const token = await getAccessToken();
       if (!token) throw new Error('ログイン情報の取得に失敗しました');
 
       const res = await fetch('/api/workstation/create', {
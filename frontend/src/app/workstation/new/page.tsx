@@ -3,6 +3,7 @@
 import { useState, useEffect } from 'react';
 import { useRouter } from 'next/navigation';
 import Link from 'next/link';
+import { getAccessToken } from '@/utils/authToken';
 
 interface Workstation {
   workstation_id: number;
@@ -18,7 +19,7 @@ export default function WorkstationListPage() {
   useEffect(() => {
     const fetchWorkstations = async () => {
       try {
-        const token = localStorage.getItem('auth_token');
+        const token = await getAccessToken();
         if (!token) {
           router.push('/login');
           return;
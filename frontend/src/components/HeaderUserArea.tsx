@@ -1,6 +1,7 @@
 'use client';
 
 import { useState, useEffect } from 'react';
+import { logout } from '@/utils/authToken';
 
 export default function HeaderUserArea() {
   // --- 状態管理 ---
@@ -49,20 +50,17 @@ export default function HeaderUserArea() {
   }, []);
 
   // --- ログアウト処理 ---
-  const handleLogout = () => {
+  const handleLogout = async () => {
     if (!confirm('ログアウトしますか？')) return;
     
-    // 1. LocalStorage削除
-    localStorage.removeItem('auth_token');
+    // 1. サーバーのセッションを取り消して、トークンと Cookie を削除するのだ
+    await logout();
     localStorage.removeItem('user_email');
 
-    // 2. Cookie削除 (有効期限を過去にして上書き) ★追加
-    document.cookie = "auth_token=; path=/; max-age=0";
-    
-    // 3. イベント通知
+    // 2. イベント通知
     window.dispatchEvent(new Event('auth-change'));
     
-    // 4. リロード (Middlewareが検知して /login に飛ばしてくれるはずなのだ)
+    // 3. リロード (Middlewareが検知して /login に飛ばしてくれるはずなのだ)
     window.location.href = '/login';
   };
 
@@ -1,6 +1,7 @@
 // frontend/src/hooks/usePouchDBSync.ts
 
 import { useEffect, useState } from 'react';
+import { getAccessToken } from '@/utils/authToken';
 
 // ★修正点1: getPouchDB ヘルパー関数を再定義するのだ！
 // PouchDBの動的インポート用ヘルパー
@@ -51,7 +52,7 @@ export function usePouchDBSync(
          // ★重要: fetchをオーバーライドして、強制的にヘッダーを注入するのだ！
          const remoteOpts = {
            skip_setup: true,
-           fetch: function (url: string, opts: any) {
+           fetch: async function (url: string, opts: any) {
              // opts.headers が Headers オブジェクトか単純なオブジェクトか確認してセット
              if (!opts.headers) {
                  opts.headers = new Headers();
@@ -59,8 +60,8 @@ export function usePouchDBSync(
                  opts.headers = new Headers(opts.headers);
              }
              
-             // ここでトークンをセット！
-             opts.headers.set('Authorization', `Bearer ${token}`);
+             // ここでトークンをセット！ (切れそうなら取り直したものを使うのだ)
+             opts.headers.set('Authorization', `Bearer ${(await getAccessToken()) || token}`);
              
              // デバッグ用ログ（本番では消してもいいのだ）
              // console.log('[Sync Fetch]', url, opts.headers.get('Authorization'));
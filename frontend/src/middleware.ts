@@ -9,7 +9,13 @@ export function middleware(request: NextRequest) {
   const path = request.nextUrl.pathname;
 
   // 3. 認証不要なパス（ログイン、登録、静的ファイル系）を定義
-  const isPublicPath = path === '/login' || path === '/register';
+  const isPublicPath = path === '/login' || path === '/register' ||
+    path === '/forgot-password' || path === '/reset-password';
+  // メールのリンクから開くページは、ログインしていてもいなくても通すのだ
+  // IdP から戻ってきたページも同じなのだ
+  if (path === '/verify-email' || path === '/login/oidc') {
+    return NextResponse.next();
+  }
 
   // --- リダイレクトロジック ---
 
@@ -0,0 +1,121 @@
+// frontend/src/utils/authToken.ts
+
+// アクセストークンは短い時間で切れるので、切れる前にリフレッシュトークンで取り直すのだ
+// リフレッシュトークンは1回使うと新しいものに替わるので、同時に2回取り直さないようにするのだ
+// 別のタブとも localStorage のトークンを共有しているので、タブをまたいだロック (navigator.locks) で1つずつ取り直すのだ
+
+const ACCESS_KEY = 'auth_token';
+const REFRESH_KEY = 'refresh_token';
+// 期限の少し前に取り直すのだ (秒)
+const REFRESH_MARGIN = 60;
+const REFRESH_LOCK = 'auth-token-refresh';
+
+let refreshing: Promise<string | null> | null = null;
+
+// saveTokens はログイン・取り直しのレスポンスを保存するのだ
+export function saveTokens(data: { token: string; refresh_token?: string }) {
+  localStorage.setItem(ACCESS_KEY, data.token);
+  if (data.refresh_token) {
+    localStorage.setItem(REFRESH_KEY, data.refresh_token);
+  }
+  // middleware.ts はログイン済みかどうかだけを見るので、Cookie はリフレッシュトークンの期限に合わせるのだ
+  document.cookie = `auth_token=${data.token}; path=/; max-age=${30 * 86400}; SameSite=Lax`;
+}
+
+export function clearTokens() {
+  localStorage.removeItem(ACCESS_KEY);
+  localStorage.removeItem(REFRESH_KEY);
+  document.cookie = 'auth_token=; path=/; max-age=0';
+}
+
+// tokenExpiresAt は JWT の exp (秒) を読むのだ。読めなければ 0
+function tokenExpiresAt(token: string): number {
+  try {
+    const payload = JSON.parse(atob(token.split('.')[1].replace(/-/g, '+').replace(/_/g, '/')));
+    return typeof payload.exp === 'number' ? payload.exp : 0;
+  } catch {
+    return 0;
+  }
+}
+
+function isFresh(token: string): boolean {
+  return tokenExpiresAt(token) - REFRESH_MARGIN > Date.now() / 1000;
+}
+
+// refreshWithLock はタブをまたいだロックを取ってから取り直すのだ
+// ロックを待つ間に別のタブが取り直していたら、そのタブが localStorage に保存したトークンをそのまま使うのだ
+// (古いリフレッシュトークンをもう一度使うと、サーバーは盗まれたとみなしてセッションを取り消してしまうのだ)
+async function refreshWithLock(): Promise<string | null> {
+  const run = async () => {
+    const token = localStorage.getItem(ACCESS_KEY);
+    if (token && isFresh(token)) return token;
+    return refreshAccessToken();
+  };
+  if (typeof navigator !== 'undefined' && navigator.locks) {
+    return navigator.locks.request(REFRESH_LOCK, run);
+  }
+  return run();
+}
+
+async function refreshAccessToken(): Promise<string | null> {
+  const refreshToken = localStorage.getItem(REFRESH_KEY);
+  if (!refreshToken) return null;
+
+  const res = await fetch('/api/token/refresh', {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ refresh_token: refreshToken }),
+  });
+  if (res.status === 401) {
+    // ログアウト済みか期限切れなのだ
+    clearTokens();
+    window.dispatchEvent(new Event('auth-change'));
+    return null;
+  }
+  if (!res.ok) {
+    // オフラインなどの一時的な失敗では今のトークンを返して、次の機会に取り直すのだ
+    return localStorage.getItem(ACCESS_KEY);
+  }
+  const data = await res.json();
+  saveTokens(data);
+  return data.token;
+}
+
+// getAccessToken は使えるアクセストークンを返すのだ (必要なら取り直すのだ)
+export async function getAccessToken(): Promise<string | null> {
+  const token = localStorage.getItem(ACCESS_KEY);
+  if (!token) return null;
+  if (isFresh(token)) {
+    return token;
+  }
+  if (!refreshing) {
+    refreshing = refreshWithLock()
+      .catch(() => localStorage.getItem(ACCESS_KEY))
+      .finally(() => {
+        refreshing = null;
+      });
+  }
+  return refreshing;
+}
+
+// logout はサーバーのセッションを取り消してから、保存したトークンを消すのだ
+export async function logout() {
+  const token = await getAccessToken();
+  if (token) {
+    try {
+      await fetch('/api/logout', { method: 'POST', headers: { Authorization: `Bearer ${token}` } });
+    } catch {
+      // オフラインでも端末からは消すのだ
+    }
+  }
+  clearTokens();
+}
+
+// 別のタブで取り直したりログアウトしたりしたら、このタブの画面にも知らせるのだ
+if (typeof window !== 'undefined') {
+  window.addEventListener('storage', (e) => {
+    if (e.key === ACCESS_KEY || e.key === REFRESH_KEY || e.key === null) {
+      window.dispatchEvent(new Event('auth-change'));
+    }
+  });
+}